@@ -20,12 +20,14 @@ import (
 )
 
 const (
-	HeaderBfeIP         = "X-Bfe-Ip"
-	HeaderBfeLogId      = "X-Bfe-Log-Id"
-	HeaderForwardedFor  = "X-Forwarded-For"
-	HeaderForwardedPort = "X-Forwarded-Port"
-	HeaderRealIP        = "X-Real-Ip"
-	HeaderRealPort      = "X-Real-Port"
+	HeaderBfeIP          = "X-Bfe-Ip"
+	HeaderBfeLogId       = "X-Bfe-Log-Id"
+	HeaderForwarded      = "Forwarded"
+	HeaderForwardedFor   = "X-Forwarded-For"
+	HeaderForwardedPort  = "X-Forwarded-Port"
+	HeaderForwardedProto = "X-Forwarded-Proto"
+	HeaderRealIP         = "X-Real-Ip"
+	HeaderRealPort       = "X-Real-Port"
 )
 
 type OperationStage int
@@ -26,36 +26,77 @@ import (
 	"github.com/baidu/bfe/bfe_basic/condition/parser"
 )
 
+// varResolver returns named condition referenced by condition variable
+type varResolver func(name string) (Condition, error)
+
+// Build builds condition from condition expression. Condition variables
+// are resolved by global named conditions.
 func Build(condStr string) (Condition, error) {
+	return BuildWithProduct(condStr, "")
+}
+
+// BuildWithProduct builds condition from condition expression of product.
+// Condition variables are resolved by named conditions of product first,
+// and then by global named conditions.
+func BuildWithProduct(condStr string, product string) (Condition, error) {
 	node, identList, err := parser.Parse(condStr)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(identList) != 0 {
-		return nil, fmt.Errorf("found unresolved variable %s %d", identList[0].Name, identList[0].Pos())
+	if len(identList) == 0 {
+		return build(node, nil)
+	}
+
+	// named conditions referenced are recorded, and dictionary is not
+	// replaced with one missing them (see UpdateCondDict)
+	condRefs.lock.Lock()
+	defer condRefs.lock.Unlock()
+
+	dict := condDict.Load().(*CondDict)
+	names := make([]string, 0, len(identList))
+	for _, ident := range identList {
+		if _, ok := dict.lookup(product, ident.Name); !ok {
+			return nil, fmt.Errorf("found unresolved variable %s %d", ident.Name, ident.Pos())
+		}
+		names = append(names, ident.Name)
+	}
+
+	resolve := func(name string) (Condition, error) {
+		if cond, ok := dict.lookup(product, name); ok {
+			return cond, nil
+		}
+		return nil, fmt.Errorf("found unresolved variable %s", name)
 	}
 
-	return build(node)
+	cond, err := build(node, resolve)
+	if err != nil {
+		return nil, err
+	}
+
+	addCondRefs(product, names)
+	return cond, nil
 }
 
-func build(node parser.Node) (Condition, error) {
+func build(node parser.Node, resolve varResolver) (Condition, error) {
 	switch n := node.(type) {
 	case *parser.CallExpr:
 		return buildPrimitive(n)
 	case *parser.UnaryExpr:
-		return buildUnary(n)
+		return buildUnary(n, resolve)
 	case *parser.BinaryExpr:
-		return buildBinary(n)
+		return buildBinary(n, resolve)
 	case *parser.ParenExpr:
-		return build(n.X)
+		return build(n.X, resolve)
+	case *parser.Ident:
+		return resolve(n.Name)
 	default:
 		return nil, fmt.Errorf("unsupported node %s", node)
 	}
 }
 
-func buildUnary(node *parser.UnaryExpr) (Condition, error) {
-	c, err := build(node.X)
+func buildUnary(node *parser.UnaryExpr, resolve varResolver) (Condition, error) {
+	c, err := build(node.X, resolve)
 	if err != nil {
 		return nil, err
 	}
@@ -64,13 +105,13 @@ func buildUnary(node *parser.UnaryExpr) (Condition, error) {
 
 }
 
-func buildBinary(node *parser.BinaryExpr) (Condition, error) {
-	l, err := build(node.X)
+func buildBinary(node *parser.BinaryExpr, resolve varResolver) (Condition, error) {
+	l, err := build(node.X, resolve)
 	if err != nil {
 		return nil, err
 	}
 
-	r, err := build(node.Y)
+	r, err := build(node.Y, resolve)
 	if err != nil {
 		return nil, err
 	}
@@ -122,6 +163,53 @@ func buildPrimitive(node *parser.CallExpr) (Condition, error) {
 			fetcher: &CIPFetcher{},
 			matcher: matcher,
 		}, nil
+	case "req_cip_hash_in":
+		matcher, err := NewHashMatcher(node.Args[0].Value, false)
+		if err != nil {
+			return nil, err
+		}
+
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &CIPFetcher{},
+			matcher: matcher,
+		}, nil
+	case "req_cip_country_in":
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &CIPGeoFetcher{field: GeoCountry},
+			matcher: NewInMatcher(node.Args[0].Value, node.Args[1].ToBool()),
+		}, nil
+	case "req_cip_region_in":
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &CIPGeoFetcher{field: GeoRegion},
+			matcher: NewInMatcher(node.Args[0].Value, node.Args[1].ToBool()),
+		}, nil
+	case "req_cip_city_in":
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &CIPGeoFetcher{field: GeoCity},
+			matcher: NewInMatcher(node.Args[0].Value, node.Args[1].ToBool()),
+		}, nil
+	case "req_cip_isp_in":
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &CIPGeoFetcher{field: GeoISP},
+			matcher: NewInMatcher(node.Args[0].Value, node.Args[1].ToBool()),
+		}, nil
+	case "req_jwt_claim_in":
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &JwtClaimFetcher{claim: node.Args[0].Value},
+			matcher: &AnyMatcher{matcher: NewInMatcher(node.Args[1].Value, node.Args[2].ToBool())},
+		}, nil
 	case "req_proto_match":
 		return &PrimitiveCond{
 			name:    node.Fun.Name,
@@ -225,6 +313,20 @@ func buildPrimitive(node *parser.CallExpr) (Condition, error) {
 			},
 			matcher: NewInMatcher(node.Args[1].Value, node.Args[2].ToBool()),
 		}, nil
+	case "req_query_value_hash_in":
+		matcher, err := NewHashMatcher(node.Args[1].Value, node.Args[2].ToBool())
+		if err != nil {
+			return nil, err
+		}
+
+		return &PrimitiveCond{
+			name: node.Fun.Name,
+			node: node,
+			fetcher: &QueryValueFetcher{
+				key: node.Args[0].Value,
+			},
+			matcher: matcher,
+		}, nil
 	case "req_query_value_prefix_in":
 		return &PrimitiveCond{
 			name:    node.Fun.Name,
@@ -267,6 +369,18 @@ func buildPrimitive(node *parser.CallExpr) (Condition, error) {
 			fetcher: &CookieValueFetcher{node.Args[0].Value},
 			matcher: NewInMatcher(node.Args[1].Value, node.Args[2].ToBool()),
 		}, nil
+	case "req_cookie_value_hash_in":
+		matcher, err := NewHashMatcher(node.Args[1].Value, node.Args[2].ToBool())
+		if err != nil {
+			return nil, err
+		}
+
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &CookieValueFetcher{node.Args[0].Value},
+			matcher: matcher,
+		}, nil
 	case "req_cookie_value_prefix_in":
 		return &PrimitiveCond{
 			name:    node.Fun.Name,
@@ -323,6 +437,18 @@ func buildPrimitive(node *parser.CallExpr) (Condition, error) {
 			fetcher: &HeaderValueFetcher{node.Args[0].Value},
 			matcher: NewInMatcher(node.Args[1].Value, node.Args[2].ToBool()),
 		}, nil
+	case "req_header_value_hash_in":
+		matcher, err := NewHashMatcher(node.Args[1].Value, node.Args[2].ToBool())
+		if err != nil {
+			return nil, err
+		}
+
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &HeaderValueFetcher{node.Args[0].Value},
+			matcher: matcher,
+		}, nil
 	case "req_header_value_prefix_in":
 		return &PrimitiveCond{
 			name:    node.Fun.Name,
@@ -356,6 +482,36 @@ func buildPrimitive(node *parser.CallExpr) (Condition, error) {
 			fetcher: &MethodFetcher{},
 			matcher: NewInMatcher(node.Args[0].Value, true),
 		}, nil
+	case "req_body_form_value_in":
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &ReqBodyFormValueFetcher{node.Args[0].Value},
+			matcher: NewInMatcher(node.Args[1].Value, node.Args[2].ToBool()),
+		}, nil
+	case "req_body_json_path_in":
+		fetcher, err := NewReqBodyJsonPathFetcher(node.Args[0].Value)
+		if err != nil {
+			return nil, err
+		}
+
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: fetcher,
+			matcher: NewInMatcher(node.Args[1].Value, node.Args[2].ToBool()),
+		}, nil
+	case "req_body_regmatch":
+		reg, err := regexp.Compile(node.Args[0].Value)
+		if err != nil {
+			return nil, fmt.Errorf("compile regexp err %s", err)
+		}
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &ReqBodyFetcher{},
+			matcher: NewRegMatcher(reg),
+		}, nil
 	case "res_code_in":
 		return &PrimitiveCond{
 			name:    node.Fun.Name,
@@ -404,6 +560,109 @@ func buildPrimitive(node *parser.CallExpr) (Condition, error) {
 			fetcher: &SIPFetcher{},
 			matcher: matcher,
 		}, nil
+	case "ses_tls_sni_in":
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &TlsSniFetcher{},
+			matcher: NewInMatcher(node.Args[0].Value, true),
+		}, nil
+	case "ses_tls_version_in":
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &TlsVersionFetcher{},
+			matcher: NewInMatcher(node.Args[0].Value, true),
+		}, nil
+	case "ses_tls_cipher_in":
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &TlsCipherFetcher{},
+			matcher: NewInMatcher(node.Args[0].Value, true),
+		}, nil
+	case "ses_tls_client_cert_present":
+		return &TlsClientCertMatcher{}, nil
+	case "ses_tls_client_cert_subject_cn_in":
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &TlsClientCertFetcher{CertSubjectCN},
+			matcher: NewInMatcher(node.Args[0].Value, node.Args[1].ToBool()),
+		}, nil
+	case "ses_tls_client_cert_subject_regmatch":
+		reg, err := regexp.Compile(node.Args[0].Value)
+		if err != nil {
+			return nil, fmt.Errorf("compile regexp err %s", err)
+		}
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &TlsClientCertFetcher{CertSubject},
+			matcher: NewRegMatcher(reg),
+		}, nil
+	case "ses_tls_client_cert_issuer_cn_in":
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &TlsClientCertFetcher{CertIssuerCN},
+			matcher: NewInMatcher(node.Args[0].Value, node.Args[1].ToBool()),
+		}, nil
+	case "ses_tls_client_cert_issuer_regmatch":
+		reg, err := regexp.Compile(node.Args[0].Value)
+		if err != nil {
+			return nil, fmt.Errorf("compile regexp err %s", err)
+		}
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &TlsClientCertFetcher{CertIssuer},
+			matcher: NewRegMatcher(reg),
+		}, nil
+	case "ses_tls_client_cert_san_in":
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &TlsClientCertSANFetcher{},
+			matcher: &AnyMatcher{matcher: NewInMatcher(node.Args[0].Value, node.Args[1].ToBool())},
+		}, nil
+
+	case "bfe_time_range":
+		matcher, err := NewTimeMatcher(node.Args[0].Value, node.Args[1].Value)
+		if err != nil {
+			return nil, err
+		}
+
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &BfeTimeFetcher{},
+			matcher: matcher,
+		}, nil
+	case "bfe_periodic_time_range":
+		matcher, err := NewPeriodicTimeMatcher(node.Args[0].Value, node.Args[1].Value)
+		if err != nil {
+			return nil, err
+		}
+
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &BfeTimeFetcher{},
+			matcher: matcher,
+		}, nil
+	case "bfe_weekday_in":
+		matcher, err := NewWeekdayMatcher(node.Args[0].Value, node.Args[1].Value)
+		if err != nil {
+			return nil, err
+		}
+
+		return &PrimitiveCond{
+			name:    node.Fun.Name,
+			node:    node,
+			fetcher: &BfeTimeFetcher{},
+			matcher: matcher,
+		}, nil
 
 	default:
 		return nil, fmt.Errorf("unsupported primitive %s", node.Fun.Name)
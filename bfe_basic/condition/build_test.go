@@ -15,15 +15,22 @@
 package condition
 
 import (
+	"bufio"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
 	"net"
+	"net/url"
 	"reflect"
 	"regexp"
+	"strings"
 	"testing"
 )
 
 import (
 	"github.com/baidu/bfe/bfe_basic"
 	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_tls"
 	"github.com/baidu/bfe/bfe_util/net_util"
 )
 
@@ -288,3 +295,386 @@ func TestBuildReqVipRange(t *testing.T) {
 		t.Errorf("2001:ffff::ffff not match req_vip_range(\"2001:0DB8:02de:0::e13\", \"2002:0DB8:02de:0::e13\")")
 	}
 }
+
+func TestBuildReqCipGeoIn(t *testing.T) {
+	geoReq := bfe_basic.Request{
+		Session:     &bfe_basic.Session{},
+		HttpRequest: &bfe_http.Request{},
+		Context:     make(map[interface{}]interface{}),
+	}
+
+	countryC, err := Build("req_cip_country_in(\"cn|us\", true)")
+	if err != nil {
+		t.Fatalf("build failed, req_cip_country_in: %s", err)
+	}
+	ispC, err := Build("req_cip_isp_in(\"China Telecom\", false)")
+	if err != nil {
+		t.Fatalf("build failed, req_cip_isp_in: %s", err)
+	}
+
+	// no geo info
+	if countryC.Match(&geoReq) {
+		t.Errorf("request without geo info should not match req_cip_country_in")
+	}
+
+	geoReq.SetGeoInfo(&bfe_basic.GeoInfo{Country: "CN", Region: "Beijing", City: "Beijing", ISP: "China Telecom"})
+	if !countryC.Match(&geoReq) || !ispC.Match(&geoReq) {
+		t.Errorf("CN/China Telecom should match req_cip_country_in and req_cip_isp_in")
+	}
+
+	geoReq.SetGeoInfo(&bfe_basic.GeoInfo{Country: "JP", ISP: "china telecom"})
+	if countryC.Match(&geoReq) || ispC.Match(&geoReq) {
+		t.Errorf("JP/china telecom should not match req_cip_country_in and req_cip_isp_in")
+	}
+
+	if _, err := Build("req_cip_city_in(\"Beijing\")"); err == nil {
+		t.Errorf("build req_cip_city_in with wrong args should fail")
+	}
+}
+
+func TestBuildReqJwtClaimIn(t *testing.T) {
+	jwtReq := bfe_basic.Request{
+		Session:     &bfe_basic.Session{},
+		HttpRequest: &bfe_http.Request{},
+		Context:     make(map[interface{}]interface{}),
+	}
+
+	tenantC, err := Build("req_jwt_claim_in(\"tenant\", \"acme|example\", true)")
+	if err != nil {
+		t.Fatalf("build failed, req_jwt_claim_in: %s", err)
+	}
+	roleC, err := Build("req_jwt_claim_in(\"roles\", \"admin\", false)")
+	if err != nil {
+		t.Fatalf("build failed, req_jwt_claim_in: %s", err)
+	}
+
+	// no jwt claims
+	if tenantC.Match(&jwtReq) {
+		t.Errorf("request without jwt claims should not match req_jwt_claim_in")
+	}
+
+	jwtReq.SetJwtClaims(map[string]interface{}{
+		"tenant": "ACME",
+		"roles":  []interface{}{"user", "admin"},
+	})
+	if !tenantC.Match(&jwtReq) || !roleC.Match(&jwtReq) {
+		t.Errorf("claims should match req_jwt_claim_in")
+	}
+
+	jwtReq.SetJwtClaims(map[string]interface{}{
+		"tenant": "other",
+		"roles":  []interface{}{"user"},
+	})
+	if tenantC.Match(&jwtReq) || roleC.Match(&jwtReq) {
+		t.Errorf("claims should not match req_jwt_claim_in")
+	}
+}
+
+func TestBuildReqHashIn(t *testing.T) {
+	hashReq := bfe_basic.Request{
+		Session:     &bfe_basic.Session{},
+		HttpRequest: &bfe_http.Request{Header: make(bfe_http.Header)},
+	}
+	hashReq.HttpRequest.URL, _ = url.Parse("/path?uid=uid_1001")
+	hashReq.HttpRequest.Header.Set("X-Uid", "uid_1001")
+	hashReq.HttpRequest.Header.Set("Cookie", "uid=uid_1001")
+	hashReq.ClientAddr = &net.TCPAddr{IP: net.ParseIP("1.2.3.4")}
+
+	// bucket of "1.2.3.4" is 8310, "uid_1001" is 6107 and "UID_1001" is 1816
+	cases := []struct {
+		cond  string
+		match bool
+	}{
+		{"req_cip_hash_in(\"8310\")", true},
+		{"req_cip_hash_in(\"0-100|8000-8999\")", true},
+		{"req_cip_hash_in(\"0-8309|8311-9999\")", false},
+		{"req_header_value_hash_in(\"X-Uid\", \"6107\", false)", true},
+		{"req_header_value_hash_in(\"X-Uid\", \"1816\", true)", true},
+		{"req_header_value_hash_in(\"X-Uid\", \"6107\", true)", false},
+		{"req_header_value_hash_in(\"X-Other\", \"0-9999\", false)", false},
+		{"req_cookie_value_hash_in(\"uid\", \"6000-6199\", false)", true},
+		{"req_cookie_value_hash_in(\"other\", \"0-9999\", false)", false},
+		{"req_query_value_hash_in(\"uid\", \"6107|9999\", false)", true},
+		{"req_query_value_hash_in(\"uid\", \"0-6106\", false)", false},
+	}
+
+	for _, c := range cases {
+		cond, err := Build(c.cond)
+		if err != nil {
+			t.Fatalf("build failed, %s: %s", c.cond, err)
+		}
+		if cond.Match(&hashReq) != c.match {
+			t.Errorf("%s should return %v", c.cond, c.match)
+		}
+	}
+
+	// invalid patterns
+	for _, cond := range []string{
+		"req_cip_hash_in(\"\")",
+		"req_cip_hash_in(\"10000\")",
+		"req_cip_hash_in(\"200-100\")",
+		"req_cip_hash_in(\"a-b\")",
+		"req_cip_hash_in(\"1|-1\")",
+	} {
+		if _, err := Build(cond); err == nil {
+			t.Errorf("build %s should fail", cond)
+		}
+	}
+}
+
+// peekBody is a peekable request body for test
+type peekBody struct {
+	*bufio.Reader
+}
+
+func (b peekBody) Close() error {
+	return nil
+}
+
+func newBodyRequest(product string, contentType string, body string) *bfe_basic.Request {
+	bodyReq := &bfe_basic.Request{
+		Session:     &bfe_basic.Session{},
+		HttpRequest: &bfe_http.Request{Header: make(bfe_http.Header)},
+	}
+	bodyReq.Route.Product = product
+	bodyReq.HttpRequest.Header.Set("Content-Type", contentType)
+	bodyReq.HttpRequest.ContentLength = int64(len(body))
+	bodyReq.HttpRequest.Body = peekBody{bufio.NewReader(strings.NewReader(body))}
+	return bodyReq
+}
+
+func TestBuildReqBody(t *testing.T) {
+	defer SetReqBodyPeekSize(defaultReqBodyPeekSize, nil)
+	SetReqBodyPeekSize(64, map[string]int{"pn_large": 1024, "pn_huge": 8192})
+
+	form := "op=Login&user=alice"
+	graphql := `{"operationName":"GetUser","variables":{"id":1001,"admin":false,"tags":["a","b"]}}`
+	jsonrpc := `{"jsonrpc":"2.0","method":"eth_sendTransaction","params":[],"id":1}`
+	large := `{"method":"Upload","data":"` + strings.Repeat("x", 100) + `"}`
+	// body larger than read buffer of connection (4096) could not be peeked
+	full := `{"method":"Upload","data":"` + strings.Repeat("x", 4000) + `"}`
+	huge := `{"method":"Upload","data":"` + strings.Repeat("x", 5000) + `"}`
+
+	cases := []struct {
+		cond        string
+		product     string
+		contentType string
+		body        string
+		match       bool
+	}{
+		{"req_body_form_value_in(\"op\", \"login|logout\", true)", "pn", "application/x-www-form-urlencoded", form, true},
+		{"req_body_form_value_in(\"op\", \"login|logout\", false)", "pn", "application/x-www-form-urlencoded", form, false},
+		{"req_body_form_value_in(\"user\", \"alice\", false)", "pn", "Application/X-WWW-Form-Urlencoded; charset=utf-8", form, true},
+		{"req_body_form_value_in(\"op\", \"Login\", false)", "pn", "text/plain", form, false},
+		{"req_body_json_path_in(\"operationName\", \"GetUser\", false)", "pn", "application/json", graphql, false},
+		{"req_body_json_path_in(\"operationName\", \"GetUser\", false)", "pn_large", "application/json", graphql, true},
+		{"req_body_json_path_in(\"variables.id\", \"1001\", false)", "pn_large", "application/json", graphql, true},
+		{"req_body_json_path_in(\"variables.admin\", \"false\", false)", "pn_large", "application/json", graphql, true},
+		{"req_body_json_path_in(\"variables.tags.1\", \"b\", false)", "pn_large", "application/json", graphql, true},
+		{"req_body_json_path_in(\"variables.tags.2\", \"b\", false)", "pn_large", "application/json", graphql, false},
+		{"req_body_json_path_in(\"variables\", \"\", false)", "pn_large", "application/json", graphql, false},
+		{"req_body_json_path_in(\"method\", \"ETH_SENDTRANSACTION\", true)", "pn", "application/json", jsonrpc, false},
+		{"req_body_json_path_in(\"method\", \"ETH_SENDTRANSACTION\", true)", "pn_large", "application/json", jsonrpc, true},
+		{"req_body_json_path_in(\"method\", \"Upload\", false)", "pn", "application/json", large, false},
+		{"req_body_json_path_in(\"method\", \"Upload\", false)", "pn_large", "application/json", large, true},
+		{"req_body_json_path_in(\"method\", \"Upload\", false)", "pn_huge", "application/json", full, true},
+		{"req_body_json_path_in(\"method\", \"Upload\", false)", "pn_huge", "application/json", huge, false},
+		{"req_body_json_path_in(\"method\", \"Login\", false)", "pn", "application/json", form, false},
+		{"req_body_regmatch(\"op=(Login|Logout)\")", "pn", "application/x-www-form-urlencoded", form, true},
+		{"req_body_regmatch(\"op=Logout\")", "pn", "application/x-www-form-urlencoded", form, false},
+	}
+
+	for _, c := range cases {
+		cond, err := Build(c.cond)
+		if err != nil {
+			t.Fatalf("build failed, %s: %s", c.cond, err)
+		}
+		bodyReq := newBodyRequest(c.product, c.contentType, c.body)
+		if cond.Match(bodyReq) != c.match {
+			t.Errorf("%s should return %v for body %s of %s", c.cond, c.match, c.body, c.product)
+		}
+
+		// body is not consumed
+		data, _ := ioutil.ReadAll(bodyReq.HttpRequest.Body)
+		if string(data) != c.body {
+			t.Errorf("body should not be consumed by %s", c.cond)
+		}
+	}
+
+	// invalid params
+	for _, cond := range []string{
+		"req_body_json_path_in(\"\", \"a\", false)",
+		"req_body_json_path_in(\"a..b\", \"a\", false)",
+		"req_body_regmatch(\"(a\")",
+	} {
+		if _, err := Build(cond); err == nil {
+			t.Errorf("build %s should fail", cond)
+		}
+	}
+}
+
+func TestBuildSesTls(t *testing.T) {
+	clientCert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "client-1", Organization: []string{"Example"}},
+		Issuer:         pkix.Name{CommonName: "Example CA", Organization: []string{"Example"}},
+		DNSNames:       []string{"client-1.example.org"},
+		EmailAddresses: []string{"client-1@example.org"},
+		IPAddresses:    []net.IP{net.ParseIP("10.1.1.1")},
+	}
+	clientCert.URIs = []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/ns/prod/sa/client-1"}}
+
+	tlsReq := bfe_basic.Request{
+		Session: &bfe_basic.Session{
+			IsSecure: true,
+			TlsState: &bfe_tls.ConnectionState{
+				Version:          bfe_tls.VersionTLS12,
+				CipherSuite:      bfe_tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+				ServerName:       "www.example.org",
+				PeerCertificates: []*x509.Certificate{clientCert},
+				VerifiedChains:   [][]*x509.Certificate{{clientCert}},
+			},
+		},
+		HttpRequest: &bfe_http.Request{},
+	}
+
+	cases := []struct {
+		cond  string
+		match bool
+	}{
+		{"ses_tls_sni_in(\"WWW.example.org|example.org\")", true},
+		{"ses_tls_sni_in(\"example.org\")", false},
+		{"ses_tls_version_in(\"TLSv1.2\")", true},
+		{"ses_tls_version_in(\"tlsv1.0|tlsv1.1\")", false},
+		{"ses_tls_cipher_in(\"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256\")", true},
+		{"ses_tls_cipher_in(\"TLS_RSA_WITH_AES_128_CBC_SHA\")", false},
+		{"ses_tls_client_cert_present()", true},
+		{"ses_tls_client_cert_subject_cn_in(\"client-1|client-2\", false)", true},
+		{"ses_tls_client_cert_subject_cn_in(\"CLIENT-1\", false)", false},
+		{"ses_tls_client_cert_subject_cn_in(\"CLIENT-1\", true)", true},
+		{"ses_tls_client_cert_subject_regmatch(\"^CN=client-[0-9]+,O=Example$\")", true},
+		{"ses_tls_client_cert_issuer_cn_in(\"Example CA\", false)", true},
+		{"ses_tls_client_cert_issuer_regmatch(\"O=Other\")", false},
+		{"ses_tls_client_cert_san_in(\"client-1.example.org\", false)", true},
+		{"ses_tls_client_cert_san_in(\"CLIENT-1@EXAMPLE.ORG\", true)", true},
+		{"ses_tls_client_cert_san_in(\"10.1.1.1\", false)", true},
+		{"ses_tls_client_cert_san_in(\"spiffe://example.org/ns/prod/sa/client-1\", false)", true},
+		{"ses_tls_client_cert_san_in(\"client-2.example.org\", false)", false},
+	}
+
+	for _, c := range cases {
+		cond, err := Build(c.cond)
+		if err != nil {
+			t.Fatalf("build failed, %s: %s", c.cond, err)
+		}
+		if cond.Match(&tlsReq) != c.match {
+			t.Errorf("%s should return %v", c.cond, c.match)
+		}
+	}
+
+	// client cert not verified
+	tlsReq.Session.TlsState.VerifiedChains = nil
+	for _, c := range []string{
+		"ses_tls_client_cert_present()",
+		"ses_tls_client_cert_subject_cn_in(\"client-1\", false)",
+	} {
+		cond, _ := Build(c)
+		if cond.Match(&tlsReq) {
+			t.Errorf("%s should not match unverified client cert", c)
+		}
+	}
+
+	// not tls connection
+	plainReq := bfe_basic.Request{
+		Session:     &bfe_basic.Session{},
+		HttpRequest: &bfe_http.Request{},
+	}
+	for _, c := range cases {
+		cond, _ := Build(c.cond)
+		if cond.Match(&plainReq) {
+			t.Errorf("%s should not match plain request", c.cond)
+		}
+	}
+}
+
+func TestBuildBfeTimeRange(t *testing.T) {
+	timeReq := bfe_basic.Request{
+		Session:     &bfe_basic.Session{IsTrustIP: true},
+		HttpRequest: &bfe_http.Request{Header: make(bfe_http.Header)},
+	}
+
+	cases := []struct {
+		cond  string
+		time  string // mocked time by X-Bfe-Debug-Time
+		match bool
+	}{
+		// absolute time range
+		{"bfe_time_range(\"20190204203000H\", \"20190204204500H\")", "20190204203000H", true},
+		{"bfe_time_range(\"20190204203000H\", \"20190204204500H\")", "20190204124500Z", true},
+		{"bfe_time_range(\"20190204203000H\", \"20190204204500H\")", "20190204204501H", false},
+		// periodic time range
+		{"bfe_periodic_time_range(\"090000H\", \"180000H\")", "20190204120000H", true},
+		{"bfe_periodic_time_range(\"090000H\", \"180000H\")", "20190204120000Z", false},
+		{"bfe_periodic_time_range(\"220000H\", \"060000H\")", "20190204230000H", true},
+		{"bfe_periodic_time_range(\"220000H\", \"060000H\")", "20190205055959H", true},
+		{"bfe_periodic_time_range(\"220000H\", \"060000H\")", "20190205120000H", false},
+		// day of week, 2019-02-04 is Monday
+		{"bfe_weekday_in(\"Mon|Tue\", \"H\")", "20190204080000H", true},
+		{"bfe_weekday_in(\"Mon|Tue\", \"H\")", "20190203230000Z", true},
+		{"bfe_weekday_in(\"sat|sun\", \"H\")", "20190204080000H", false},
+		// IANA time zone, dst of Europe/Berlin starts at 2019-03-31 02:00 (UTC+1 => UTC+2)
+		{"bfe_time_range(\"20190331013000Europe/Berlin\", \"20190331033000Europe/Berlin\")", "20190331013000Z", true},
+		{"bfe_time_range(\"20190331013000Europe/Berlin\", \"20190331033000Europe/Berlin\")", "20190331013001Z", false},
+		{"bfe_periodic_time_range(\"090000Europe/Berlin\", \"180000Europe/Berlin\")", "20190330080000Z", true},
+		{"bfe_periodic_time_range(\"090000Europe/Berlin\", \"180000Europe/Berlin\")", "20190330073000Z", false},
+		{"bfe_periodic_time_range(\"090000Europe/Berlin\", \"180000Europe/Berlin\")", "20190331073000Z", true},
+		{"bfe_periodic_time_range(\"090000Europe/Berlin\", \"180000Europe/Berlin\")", "20190331163000Z", false},
+		{"bfe_weekday_in(\"Sun\", \"Europe/Berlin\")", "20190330230000Z", true},
+		{"bfe_weekday_in(\"Sun\", \"Europe/Berlin\")", "20190331215959Z", true},
+		{"bfe_weekday_in(\"Sun\", \"Europe/Berlin\")", "20190331220000Z", false},
+		{"bfe_weekday_in(\"Sun\", \"A\")", "20190331220000Z", true},
+		// IANA time zone with half-hour offset (UTC+5:30)
+		{"bfe_periodic_time_range(\"090000Asia/Kolkata\", \"180000Asia/Kolkata\")", "20190204033000Z", true},
+		{"bfe_periodic_time_range(\"090000Asia/Kolkata\", \"180000Asia/Kolkata\")", "20190204032959Z", false},
+		// invalid debug time
+		{"bfe_weekday_in(\"Mon|Tue\", \"H\")", "2019020408H", false},
+		{"bfe_weekday_in(\"Mon|Tue\", \"H\")", "20190204080000", false},
+	}
+
+	for _, c := range cases {
+		cond, err := Build(c.cond)
+		if err != nil {
+			t.Fatalf("build failed, %s: %s", c.cond, err)
+		}
+		timeReq.HttpRequest.Header.Set(HeaderBfeDebugTime, c.time)
+		if cond.Match(&timeReq) != c.match {
+			t.Errorf("%s at %s should return %v", c.cond, c.time, c.match)
+		}
+	}
+
+	// debug time is ignored for untrusted ip
+	cond, _ := Build("bfe_time_range(\"20190204203000H\", \"20190204204500H\")")
+	timeReq.Session.IsTrustIP = false
+	timeReq.HttpRequest.Header.Set(HeaderBfeDebugTime, "20190204203000H")
+	if cond.Match(&timeReq) {
+		t.Errorf("debug time should be ignored for untrusted ip")
+	}
+
+	// invalid params
+	for _, cond := range []string{
+		"bfe_time_range(\"20190204203000H\", \"20190204204500J\")",
+		"bfe_time_range(\"201902042030H\", \"20190204204500H\")",
+		"bfe_time_range(\"20190204204500H\", \"20190204203000H\")",
+		"bfe_periodic_time_range(\"090000H\", \"180000Z\")",
+		"bfe_periodic_time_range(\"250000H\", \"180000H\")",
+		"bfe_weekday_in(\"Mon|Holiday\", \"H\")",
+		"bfe_weekday_in(\"Mon\", \"Mars/Olympus\")",
+		"bfe_weekday_in(\"Mon\", \"Local\")",
+		"bfe_weekday_in(\"Mon\", \"\")",
+		"bfe_time_range(\"20190204203000\", \"20190204204500H\")",
+		"bfe_periodic_time_range(\"090000Asia/Kolkata\", \"180000E\")",
+	} {
+		if _, err := Build(cond); err == nil {
+			t.Errorf("build %s should fail", cond)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// dictionary of named conditions
+
+package condition
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic/condition/parser"
+)
+
+var condNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]*$`)
+
+// CondDict is dictionary of named conditions, which could be referenced
+// by condition expressions in form of $name. Named condition of product
+// is only visible to the product, and overrides global one with same name.
+type CondDict struct {
+	global   map[string]Condition            // global named conditions
+	products map[string]map[string]Condition // product => named conditions
+}
+
+var condDict atomic.Value // *CondDict
+
+// condRefs holds named conditions referenced by conditions built, in form
+// of product => names. Conditions are not released explicitly when rules
+// are reloaded, so names referenced since startup are all treated as in use.
+var condRefs = struct {
+	lock sync.Mutex
+	refs map[string]map[string]bool
+}{refs: make(map[string]map[string]bool)}
+
+func init() {
+	condDict.Store(&CondDict{
+		global:   make(map[string]Condition),
+		products: make(map[string]map[string]Condition),
+	})
+}
+
+// NewCondDict builds dictionary of named conditions. References between
+// named conditions are resolved, and circular references are not allowed.
+//
+// Params:
+//     - global: global named conditions, name => condition expression
+//     - products: named conditions of products, product => (name => condition expression)
+func NewCondDict(global map[string]string, products map[string]map[string]string) (*CondDict, error) {
+	dict := &CondDict{
+		products: make(map[string]map[string]Condition),
+	}
+
+	var err error
+	dict.global, err = buildNamedConds(global, nil)
+	if err != nil {
+		return nil, fmt.Errorf("global: %s", err)
+	}
+
+	for product, exprs := range products {
+		dict.products[product], err = buildNamedConds(exprs, dict.global)
+		if err != nil {
+			return nil, fmt.Errorf("product[%s]: %s", product, err)
+		}
+	}
+
+	return dict, nil
+}
+
+// SetCondDict replaces dictionary of named conditions. Conditions built
+// before are not affected, so rules should be reloaded to use new dictionary.
+// Named conditions referenced are not checked, see UpdateCondDict.
+func SetCondDict(dict *CondDict) {
+	condDict.Store(dict)
+}
+
+// UpdateCondDict replaces dictionary of named conditions, if all named
+// conditions referenced by conditions built are defined in new dictionary.
+// Otherwise, dictionary is not replaced and error is returned.
+func UpdateCondDict(dict *CondDict) error {
+	condRefs.lock.Lock()
+	defer condRefs.lock.Unlock()
+
+	if err := dict.checkRefs(condRefs.refs); err != nil {
+		return err
+	}
+
+	condDict.Store(dict)
+	return nil
+}
+
+// addCondRefs records named conditions referenced by condition of product.
+// Caller should hold condRefs.lock.
+func addCondRefs(product string, names []string) {
+	refs, ok := condRefs.refs[product]
+	if !ok {
+		refs = make(map[string]bool)
+		condRefs.refs[product] = refs
+	}
+	for _, name := range names {
+		refs[name] = true
+	}
+}
+
+// checkRefs checks whether named conditions referenced are all defined.
+func (d *CondDict) checkRefs(refs map[string]map[string]bool) error {
+	products := make([]string, 0, len(refs))
+	for product := range refs {
+		products = append(products, product)
+	}
+	sort.Strings(products)
+
+	for _, product := range products {
+		names := make([]string, 0, len(refs[product]))
+		for name := range refs[product] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if _, ok := d.lookup(product, name); !ok {
+				return fmt.Errorf("condition [%s] used by product [%s] not found", name, product)
+			}
+		}
+	}
+
+	return nil
+}
+
+// lookup returns named condition for product.
+func (d *CondDict) lookup(product string, name string) (Condition, bool) {
+	if cond, ok := d.products[product][name]; ok {
+		return cond, true
+	}
+
+	cond, ok := d.global[name]
+	return cond, ok
+}
+
+// namedCondBuilder builds named conditions with references resolved
+type namedCondBuilder struct {
+	exprs    map[string]string    // name => condition expression
+	base     map[string]Condition // named conditions referenced if not in exprs
+	conds    map[string]Condition // built named conditions
+	visiting []string             // names being built, for detecting cycle
+}
+
+func buildNamedConds(exprs map[string]string, base map[string]Condition) (map[string]Condition, error) {
+	b := &namedCondBuilder{
+		exprs: exprs,
+		base:  base,
+		conds: make(map[string]Condition),
+	}
+
+	for name := range exprs {
+		if !condNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("invalid condition name [%s]", name)
+		}
+	}
+
+	for name := range exprs {
+		if _, err := b.build(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.conds, nil
+}
+
+func (b *namedCondBuilder) build(name string) (Condition, error) {
+	if cond, ok := b.conds[name]; ok {
+		return cond, nil
+	}
+
+	expr, ok := b.exprs[name]
+	if !ok {
+		if cond, ok := b.base[name]; ok {
+			return cond, nil
+		}
+		return nil, fmt.Errorf("found unresolved variable %s", name)
+	}
+
+	for i, n := range b.visiting {
+		if n == name {
+			cycle := append(b.visiting[i:], name)
+			return nil, fmt.Errorf("found circular reference %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	b.visiting = append(b.visiting, name)
+	defer func() { b.visiting = b.visiting[:len(b.visiting)-1] }()
+
+	node, _, err := parser.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("condition [%s]: %s", name, err)
+	}
+
+	cond, err := build(node, b.build)
+	if err != nil {
+		return nil, fmt.Errorf("condition [%s]: %s", name, err)
+	}
+
+	b.conds[name] = cond
+	return cond, nil
+}
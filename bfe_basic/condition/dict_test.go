@@ -0,0 +1,236 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package condition
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+)
+
+func newDictRequest(clientIP string, path string) *bfe_basic.Request {
+	dictReq := &bfe_basic.Request{
+		Session:     &bfe_basic.Session{},
+		HttpRequest: &bfe_http.Request{Host: "www.example.org"},
+		ClientAddr:  &net.TCPAddr{IP: net.ParseIP(clientIP)},
+	}
+	dictReq.HttpRequest.URL, _ = url.Parse(path)
+	return dictReq
+}
+
+func TestCondDict(t *testing.T) {
+	global := map[string]string{
+		"internal_users": `req_cip_range("10.0.0.0", "10.255.255.255")`,
+		"admin_path":     `req_path_prefix_in("/admin", false)`,
+		"internal_admin": `$internal_users && $admin_path`,
+	}
+	products := map[string]map[string]string{
+		"pn": {
+			// override global one
+			"admin_path": `req_path_prefix_in("/manage", false)`,
+			"allowed":    `$internal_admin || !$internal_users`,
+		},
+	}
+
+	dict, err := NewCondDict(global, products)
+	if err != nil {
+		t.Fatalf("NewCondDict(): %s", err)
+	}
+	SetCondDict(dict)
+	defer SetCondDict(&CondDict{})
+
+	cases := []struct {
+		cond     string
+		product  string
+		clientIP string
+		path     string
+		match    bool
+	}{
+		{`$internal_admin`, "", "10.1.1.1", "/admin/a", true},
+		{`$internal_admin`, "", "10.1.1.1", "/manage/a", false},
+		{`$internal_admin`, "", "1.1.1.1", "/admin/a", false},
+		{`$internal_users && req_path_prefix_in("/admin", false)`, "", "10.1.1.1", "/admin", true},
+
+		// named conditions of product
+		{`$admin_path`, "pn", "10.1.1.1", "/manage/a", true},
+		{`$admin_path`, "pn", "10.1.1.1", "/admin/a", false},
+		{`$allowed`, "pn", "1.1.1.1", "/", true},
+		{`$allowed`, "pn", "10.1.1.1", "/admin/a", true},
+		{`$allowed`, "pn", "10.1.1.1", "/other", false},
+
+		// product without named conditions uses global ones
+		{`$admin_path`, "pn_other", "10.1.1.1", "/admin/a", true},
+	}
+
+	for _, c := range cases {
+		cond, err := BuildWithProduct(c.cond, c.product)
+		if err != nil {
+			t.Fatalf("BuildWithProduct(%s, %s): %s", c.cond, c.product, err)
+		}
+		if cond.Match(newDictRequest(c.clientIP, c.path)) != c.match {
+			t.Errorf("%s of %s should return %v for %s %s", c.cond, c.product, c.match, c.clientIP, c.path)
+		}
+	}
+
+	// named condition of product is invisible to others
+	if _, err := BuildWithProduct(`$allowed`, "pn_other"); err == nil {
+		t.Errorf("$allowed should be unresolved for pn_other")
+	}
+	if _, err := Build(`$allowed`); err == nil {
+		t.Errorf("$allowed should be unresolved for global")
+	}
+
+	// conditions built before are not affected by new dictionary
+	cond, _ := Build(`$internal_admin`)
+	SetCondDict(&CondDict{})
+	if !cond.Match(newDictRequest("10.1.1.1", "/admin/a")) {
+		t.Errorf("condition built before should not be affected by new dictionary")
+	}
+	if _, err := Build(`$internal_admin`); err == nil {
+		t.Errorf("$internal_admin should be unresolved in new dictionary")
+	}
+}
+
+func TestCondDictError(t *testing.T) {
+	cases := []struct {
+		global   map[string]string
+		products map[string]map[string]string
+		err      string
+	}{
+		{
+			map[string]string{"a": `$b && req_method_in("GET")`, "b": `!$c`, "c": `$a`},
+			nil,
+			"circular reference",
+		},
+		{
+			map[string]string{"a": `$a`},
+			nil,
+			"circular reference a -> a",
+		},
+		{
+			map[string]string{"a": `req_method_in("GET")`},
+			map[string]map[string]string{"pn": {"a": `$a || req_method_in("POST")`}},
+			"circular reference a -> a",
+		},
+		{
+			map[string]string{"a": `$b`},
+			nil,
+			"unresolved variable b",
+		},
+		{
+			// global condition can't reference product one
+			map[string]string{"a": `$b`},
+			map[string]map[string]string{"pn": {"b": `req_method_in("GET")`}},
+			"unresolved variable b",
+		},
+		{
+			map[string]string{"a": `req_method_in(`},
+			nil,
+			"condition [a]",
+		},
+		{
+			map[string]string{"a b": `req_method_in("GET")`},
+			nil,
+			"invalid condition name",
+		},
+	}
+
+	for i, c := range cases {
+		_, err := NewCondDict(c.global, c.products)
+		if err == nil {
+			t.Errorf("case %d: NewCondDict() should fail", i)
+			continue
+		}
+		if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("case %d: error [%s] should contain [%s]", i, err, c.err)
+		}
+	}
+}
+
+func TestUpdateCondDict(t *testing.T) {
+	condRefs.refs = make(map[string]map[string]bool)
+	defer func() {
+		condRefs.refs = make(map[string]map[string]bool)
+		SetCondDict(&CondDict{})
+	}()
+
+	global := map[string]string{
+		"internal_users": `req_cip_range("10.0.0.0", "10.255.255.255")`,
+		"admin_path":     `req_path_prefix_in("/admin", false)`,
+	}
+	products := map[string]map[string]string{
+		"pn": {"api_path": `req_path_prefix_in("/api", false)`},
+	}
+	dict, _ := NewCondDict(global, products)
+	if err := UpdateCondDict(dict); err != nil {
+		t.Fatalf("UpdateCondDict(): %s", err)
+	}
+
+	// rules using named conditions are loaded
+	if _, err := Build(`$internal_users`); err != nil {
+		t.Fatalf("Build(): %s", err)
+	}
+	if _, err := BuildWithProduct(`$api_path && $admin_path`, "pn"); err != nil {
+		t.Fatalf("BuildWithProduct(): %s", err)
+	}
+
+	cases := []struct {
+		global   map[string]string
+		products map[string]map[string]string
+		err      string
+	}{
+		{
+			// global condition used by rule is removed
+			map[string]string{"admin_path": global["admin_path"]},
+			products,
+			"condition [internal_users] used by product [] not found",
+		},
+		{
+			// product condition used by rule is removed
+			global,
+			nil,
+			"condition [api_path] used by product [pn] not found",
+		},
+	}
+	for i, c := range cases {
+		newDict, _ := NewCondDict(c.global, c.products)
+		err := UpdateCondDict(newDict)
+		if err == nil || err.Error() != c.err {
+			t.Errorf("case %d: UpdateCondDict() error [%v] should be [%s]", i, err, c.err)
+		}
+	}
+
+	// dictionary is kept if update failed
+	if _, err := BuildWithProduct(`$api_path`, "pn"); err != nil {
+		t.Errorf("dictionary should not be replaced: %s", err)
+	}
+
+	// names used may be moved between product and global dictionary, and
+	// names not used may be removed
+	newDict, _ := NewCondDict(map[string]string{
+		"internal_users": global["internal_users"],
+		"api_path":       products["pn"]["api_path"],
+	}, map[string]map[string]string{
+		"pn": {"admin_path": global["admin_path"]},
+	})
+	if err := UpdateCondDict(newDict); err != nil {
+		t.Errorf("UpdateCondDict(): %s", err)
+	}
+}
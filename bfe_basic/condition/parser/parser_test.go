@@ -50,6 +50,21 @@ func TestParserParse(t *testing.T) {
 			[]string{"x"},
 			false,
 		},
+		{
+			`$internal_users && req_path_prefix_in("/admin", false) || !$admin-host`,
+			[]string{"internal_users", "admin-host"},
+			false,
+		},
+		{
+			`$ internal_users && req_path_prefix_in("/admin", false)`,
+			nil,
+			true,
+		},
+		{
+			`$1x && req_path_prefix_in("/admin", false)`,
+			nil,
+			true,
+		},
 	}
 
 	for _, testCase := range testCases {
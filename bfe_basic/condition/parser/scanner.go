@@ -439,6 +439,15 @@ scanAgain:
 				tok = ILLEGAL
 				lit = string(ch)
 			}
+		case '$':
+			// condition variable, eg. $internal_users
+			if isLetter(s.ch) {
+				tok = IDENT
+				lit = s.scanIdentifier()
+			} else {
+				tok = ILLEGAL
+				lit = string(ch)
+			}
 		case '/':
 			if s.ch == '/' {
 				tok = COMMENT
@@ -41,11 +41,13 @@ var funcProtos = map[string][]Token{
 	"req_query_value_prefix_in":  []Token{STRING, STRING, BOOL},
 	"req_query_value_suffix_in":  []Token{STRING, STRING, BOOL},
 	"req_query_value_regmatch":   []Token{STRING, STRING},
+	"req_query_value_hash_in":    []Token{STRING, STRING, BOOL},
 	"req_url_regmatch":           []Token{STRING},
 	"req_cookie_key_in":          []Token{STRING},
 	"req_cookie_value_in":        []Token{STRING, STRING, BOOL},
 	"req_cookie_value_prefix_in": []Token{STRING, STRING, BOOL},
 	"req_cookie_value_suffix_in": []Token{STRING, STRING, BOOL},
+	"req_cookie_value_hash_in":   []Token{STRING, STRING, BOOL},
 	"req_port_in":                []Token{STRING},
 	"req_tag_match":              []Token{STRING, STRING},
 	"req_ua_regmatch":            []Token{STRING},
@@ -54,14 +56,38 @@ var funcProtos = map[string][]Token{
 	"req_header_value_prefix_in": []Token{STRING, STRING, BOOL},
 	"req_header_value_suffix_in": []Token{STRING, STRING, BOOL},
 	"req_header_value_regmatch":  []Token{STRING, STRING},
+	"req_header_value_hash_in":   []Token{STRING, STRING, BOOL},
 	"req_method_in":              []Token{STRING},
+	"req_body_form_value_in":     []Token{STRING, STRING, BOOL},
+	"req_body_json_path_in":      []Token{STRING, STRING, BOOL},
+	"req_body_regmatch":          []Token{STRING},
 	"req_cip_range":              []Token{STRING, STRING},
+	"req_cip_hash_in":            []Token{STRING},
+	"req_cip_country_in":         []Token{STRING, BOOL},
+	"req_cip_region_in":          []Token{STRING, BOOL},
+	"req_cip_city_in":            []Token{STRING, BOOL},
+	"req_cip_isp_in":             []Token{STRING, BOOL},
+	"req_jwt_claim_in":           []Token{STRING, STRING, BOOL},
 	"req_vip_range":              []Token{STRING, STRING},
 	"res_code_in":                []Token{STRING},
 	"res_header_key_in":          []Token{STRING},
 	"res_header_value_in":        []Token{STRING, STRING, BOOL},
 	"ses_vip_range":              []Token{STRING, STRING},
 	"ses_sip_range":              []Token{STRING, STRING},
+	"bfe_time_range":             []Token{STRING, STRING},
+	"bfe_periodic_time_range":    []Token{STRING, STRING},
+	"bfe_weekday_in":             []Token{STRING, STRING},
+
+	// tls session
+	"ses_tls_sni_in":                       []Token{STRING},
+	"ses_tls_version_in":                   []Token{STRING},
+	"ses_tls_cipher_in":                    []Token{STRING},
+	"ses_tls_client_cert_present":          nil,
+	"ses_tls_client_cert_subject_cn_in":    []Token{STRING, BOOL},
+	"ses_tls_client_cert_subject_regmatch": []Token{STRING},
+	"ses_tls_client_cert_issuer_cn_in":     []Token{STRING, BOOL},
+	"ses_tls_client_cert_issuer_regmatch":  []Token{STRING},
+	"ses_tls_client_cert_san_in":           []Token{STRING, BOOL},
 }
 
 func prototypeCheck(expr *CallExpr) error {
@@ -18,17 +18,27 @@ package condition
 
 import (
 	"bytes"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"net"
+	"net/url"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
+)
+
+import (
+	"github.com/spaolacci/murmur3"
 )
 
 import (
 	"github.com/baidu/bfe/bfe_basic"
 	"github.com/baidu/bfe/bfe_basic/condition/parser"
+	"github.com/baidu/bfe/bfe_tls"
 	"github.com/baidu/bfe/bfe_util/net_util"
 )
 
@@ -327,6 +337,25 @@ func (im *InMatcher) Match(v interface{}) bool {
 	return in(vs, im.patterns)
 }
 
+// AnyMatcher matches string list if any of them is matched
+type AnyMatcher struct {
+	matcher Matcher
+}
+
+func (am *AnyMatcher) Match(v interface{}) bool {
+	vs, ok := v.([]string)
+	if !ok {
+		return false
+	}
+
+	for _, s := range vs {
+		if am.matcher.Match(s) {
+			return true
+		}
+	}
+	return false
+}
+
 type ExactMatcher struct {
 	pattern  string
 	foldCase bool
@@ -535,6 +564,163 @@ func (uaf *UAFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
 	return req.HttpRequest.Header.Get("User-Agent"), nil
 }
 
+const (
+	// default max size of request body peeked by body primitives
+	defaultReqBodyPeekSize = 4096
+)
+
+// reqBodyPeekConf is config for peeking request body by body primitives
+type reqBodyPeekConf struct {
+	defaultSize  int            // default max size of peeked body
+	productSizes map[string]int // product => max size of peeked body
+}
+
+var reqBodyPeek atomic.Value // *reqBodyPeekConf
+
+func init() {
+	reqBodyPeek.Store(&reqBodyPeekConf{defaultSize: defaultReqBodyPeekSize})
+}
+
+// SetReqBodyPeekSize sets max size of request body peeked by body primitives.
+// Product not in productSizes uses defaultSize. Request with larger body
+// does not match body primitives.
+func SetReqBodyPeekSize(defaultSize int, productSizes map[string]int) {
+	sizes := make(map[string]int, len(productSizes))
+	for product, size := range productSizes {
+		sizes[product] = size
+	}
+	reqBodyPeek.Store(&reqBodyPeekConf{defaultSize: defaultSize, productSizes: sizes})
+}
+
+func reqBodyPeekSize(product string) int {
+	conf := reqBodyPeek.Load().(*reqBodyPeekConf)
+	if size, ok := conf.productSizes[product]; ok {
+		return size
+	}
+	return conf.defaultSize
+}
+
+// peekReqBody returns request body without consuming it, so that the body
+// is still forwarded to backend.
+func peekReqBody(req *bfe_basic.Request) ([]byte, error) {
+	if req == nil || req.HttpRequest == nil {
+		return nil, fmt.Errorf("fetcher: nil pointer")
+	}
+
+	return req.PeekReqBody(reqBodyPeekSize(req.Route.Product))
+}
+
+// ReqBodyFetcher fetches request body
+type ReqBodyFetcher struct{}
+
+func (bf *ReqBodyFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	body, err := peekReqBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(body), nil
+}
+
+// ReqBodyFormValueFetcher fetches first value for the given name in
+// request body of type application/x-www-form-urlencoded
+type ReqBodyFormValueFetcher struct {
+	key string
+}
+
+func (ff *ReqBodyFormValueFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if req == nil || req.HttpRequest == nil {
+		return nil, fmt.Errorf("fetcher: nil pointer")
+	}
+
+	contentType := req.HttpRequest.Header.Get("Content-Type")
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	if !strings.EqualFold(mediaType, "application/x-www-form-urlencoded") {
+		return nil, fmt.Errorf("fetcher: not form body")
+	}
+
+	body, err := peekReqBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+
+	return form.Get(ff.key), nil
+}
+
+// ReqBodyJsonPathFetcher fetches value in json request body by path.
+// Path is names of object members or indexes of array elements, joined
+// by '.', eg. "params.method" or "items.0.id". Value of string, number,
+// bool or null is fetched as string, and object or array is not fetched.
+type ReqBodyJsonPathFetcher struct {
+	path []string
+}
+
+func NewReqBodyJsonPathFetcher(path string) (*ReqBodyJsonPathFetcher, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("json path is empty")
+	}
+
+	names := strings.Split(path, ".")
+	for _, name := range names {
+		if len(name) == 0 {
+			return nil, fmt.Errorf("json path[%s] has empty name", path)
+		}
+	}
+
+	return &ReqBodyJsonPathFetcher{path: names}, nil
+}
+
+func (jf *ReqBodyJsonPathFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	body, err := peekReqBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	for _, name := range jf.path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			member, ok := v[name]
+			if !ok {
+				return nil, fmt.Errorf("fetcher: json member %s not found", name)
+			}
+			value = member
+		case []interface{}:
+			index, err := strconv.Atoi(name)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, fmt.Errorf("fetcher: json element %s not found", name)
+			}
+			value = v[index]
+		default:
+			return nil, fmt.Errorf("fetcher: json value %s not found", name)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case nil:
+		return "null", nil
+	default:
+		return nil, fmt.Errorf("fetcher: json value is not scalar")
+	}
+}
+
 type ResHeaderKeyInFetcher struct {
 	keys []string
 }
@@ -588,6 +774,132 @@ func (m *SecureProtoMatcher) Match(req *bfe_basic.Request) bool {
 	return req.Session.IsSecure
 }
 
+// TlsSniFetcher fetches server name indicated by client in tls handshake
+type TlsSniFetcher struct{}
+
+func (sf *TlsSniFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	state, err := tlsState(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return state.ServerName, nil
+}
+
+// TlsVersionFetcher fetches tls version in OpenSSL format, eg. TLSv1.2
+type TlsVersionFetcher struct{}
+
+func (vf *TlsVersionFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	state, err := tlsState(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return bfe_tls.VersionTextForOpenSSL(state.Version), nil
+}
+
+// TlsCipherFetcher fetches tls cipher suite, eg. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+type TlsCipherFetcher struct{}
+
+func (cf *TlsCipherFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	state, err := tlsState(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return bfe_tls.CipherSuiteText(state.CipherSuite), nil
+}
+
+func tlsState(req *bfe_basic.Request) (*bfe_tls.ConnectionState, error) {
+	if req == nil || req.Session == nil {
+		return nil, fmt.Errorf("fetcher: nil pointer")
+	}
+
+	if req.Session.TlsState == nil {
+		return nil, fmt.Errorf("fetcher: not tls connection")
+	}
+
+	return req.Session.TlsState, nil
+}
+
+// tlsClientCert returns client certificate verified in tls handshake
+func tlsClientCert(req *bfe_basic.Request) (*x509.Certificate, error) {
+	state, err := tlsState(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(state.PeerCertificates) == 0 || len(state.VerifiedChains) == 0 {
+		return nil, fmt.Errorf("fetcher: no verified client cert")
+	}
+
+	return state.PeerCertificates[0], nil
+}
+
+// TlsClientCertMatcher matches if verified client certificate is present
+type TlsClientCertMatcher struct{}
+
+func (m *TlsClientCertMatcher) Match(req *bfe_basic.Request) bool {
+	_, err := tlsClientCert(req)
+	return err == nil
+}
+
+// fields of client certificate
+const (
+	CertSubjectCN = iota // common name of subject
+	CertSubject          // distinguished name of subject, eg. CN=client,O=example
+	CertIssuerCN         // common name of issuer
+	CertIssuer           // distinguished name of issuer
+)
+
+// TlsClientCertFetcher fetches field of client certificate
+type TlsClientCertFetcher struct {
+	field int
+}
+
+func (cf *TlsClientCertFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	cert, err := tlsClientCert(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cf.field {
+	case CertSubjectCN:
+		return cert.Subject.CommonName, nil
+	case CertSubject:
+		return cert.Subject.String(), nil
+	case CertIssuerCN:
+		return cert.Issuer.CommonName, nil
+	case CertIssuer:
+		return cert.Issuer.String(), nil
+	default:
+		return nil, fmt.Errorf("fetcher: unknown cert field %d", cf.field)
+	}
+}
+
+// TlsClientCertSANFetcher fetches subject alternative names of client
+// certificate, including dns names, email addresses, ip addresses and uris
+type TlsClientCertSANFetcher struct{}
+
+func (sf *TlsClientCertSANFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	cert, err := tlsClientCert(req)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(cert.DNSNames)+len(cert.EmailAddresses)+len(cert.IPAddresses)+len(cert.URIs))
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+
+	return names, nil
+}
+
 // CIPFetcher fetches client addr
 type CIPFetcher struct{}
 
@@ -599,6 +911,85 @@ func (ip *CIPFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
 	return req.ClientAddr.IP, nil
 }
 
+const (
+	GeoCountry = iota
+	GeoRegion
+	GeoCity
+	GeoISP
+)
+
+// CIPGeoFetcher fetches geo location of client ip (set by mod_geo)
+type CIPGeoFetcher struct {
+	field int
+}
+
+func (gf *CIPGeoFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if req == nil {
+		return nil, fmt.Errorf("fetcher: nil pointer")
+	}
+
+	info := req.GeoInfo()
+	if info == nil {
+		return nil, fmt.Errorf("fetcher: no geo info")
+	}
+
+	switch gf.field {
+	case GeoCountry:
+		return info.Country, nil
+	case GeoRegion:
+		return info.Region, nil
+	case GeoCity:
+		return info.City, nil
+	case GeoISP:
+		return info.ISP, nil
+	default:
+		return nil, fmt.Errorf("fetcher: unknown geo field %d", gf.field)
+	}
+}
+
+// JwtClaimFetcher fetches claim of validated jwt (set by mod_auth_jwt)
+// as string list. Array claim is flattened, and claim of other types are
+// converted to string.
+type JwtClaimFetcher struct {
+	claim string
+}
+
+func (jf *JwtClaimFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if req == nil {
+		return nil, fmt.Errorf("fetcher: nil pointer")
+	}
+
+	claims := req.JwtClaims()
+	if claims == nil {
+		return nil, fmt.Errorf("fetcher: no jwt claims")
+	}
+
+	value, ok := claims[jf.claim]
+	if !ok {
+		return nil, fmt.Errorf("fetcher: no jwt claim %s", jf.claim)
+	}
+
+	if values, ok := value.([]interface{}); ok {
+		strs := make([]string, 0, len(values))
+		for _, v := range values {
+			strs = append(strs, claimString(v))
+		}
+		return strs, nil
+	}
+	return []string{claimString(value)}, nil
+}
+
+func claimString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
 // SIPFetcher fetches remote socket addr
 type SIPFetcher struct{}
 
@@ -720,3 +1111,312 @@ func NewHostMatcher(patterns string) (*HostMatcher, error) {
 		patterns: p,
 	}, nil
 }
+
+const (
+	// number of buckets for hash primitives, bucket of value is in [0, 9999]
+	HashBucketNum = 10000
+)
+
+// GetHashBucket returns hash bucket of data. murmur3 is used, so bucket
+// of the same data is stable across instances and restarts.
+func GetHashBucket(data []byte) uint32 {
+	return murmur3.Sum32(data) % HashBucketNum
+}
+
+type hashRange struct {
+	start uint32
+	end   uint32
+}
+
+// HashMatcher matches hash bucket of value against bucket ranges
+type HashMatcher struct {
+	ranges   []hashRange
+	foldCase bool
+}
+
+// NewHashMatcher creates a HashMatcher.
+//
+// Params:
+//     - patterns: bucket ranges joined by '|', eg. "0-100|1000-1100|9999"
+//     - foldCase: whether value is case insensitive
+func NewHashMatcher(patterns string, foldCase bool) (*HashMatcher, error) {
+	ranges := make([]hashRange, 0)
+	for _, p := range strings.Split(patterns, "|") {
+		bounds := strings.SplitN(strings.TrimSpace(p), "-", 2)
+
+		start, err := strconv.ParseUint(strings.TrimSpace(bounds[0]), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash pattern: %s", p)
+		}
+		end := start
+		if len(bounds) == 2 {
+			end, err = strconv.ParseUint(strings.TrimSpace(bounds[1]), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid hash pattern: %s", p)
+			}
+		}
+
+		if start > end || end >= HashBucketNum {
+			return nil, fmt.Errorf("invalid hash pattern: %s, should be in [0, %d]", p, HashBucketNum-1)
+		}
+		ranges = append(ranges, hashRange{uint32(start), uint32(end)})
+	}
+
+	return &HashMatcher{
+		ranges:   ranges,
+		foldCase: foldCase,
+	}, nil
+}
+
+func (hm *HashMatcher) Match(v interface{}) bool {
+	var data []byte
+	switch v := v.(type) {
+	case string:
+		if len(v) == 0 {
+			return false
+		}
+		if hm.foldCase {
+			v = strings.ToUpper(v)
+		}
+		data = []byte(v)
+	case net.IP:
+		data = []byte(v.String())
+	default:
+		return false
+	}
+
+	bucket := GetHashBucket(data)
+	for _, r := range hm.ranges {
+		if bucket >= r.start && bucket <= r.end {
+			return true
+		}
+	}
+
+	return false
+}
+
+const (
+	// header for mocking current time in time primitives, for test
+	HeaderBfeDebugTime = "X-Bfe-Debug-Time"
+)
+
+// parseTimeZone parses time zone, which is either military time zone letter,
+// eg. H for UTC+8, Z for UTC, or IANA time zone name, eg. Asia/Shanghai.
+// Time zone with daylight saving time should be given by IANA name.
+func parseTimeZone(zone string) (*time.Location, error) {
+	if len(zone) != 1 {
+		return parseTimeZoneName(zone)
+	}
+
+	var offset int
+	switch c := zone[0]; {
+	case c == 'Z':
+		offset = 0
+	case c >= 'A' && c <= 'I':
+		offset = int(c-'A') + 1
+	case c >= 'K' && c <= 'M':
+		offset = int(c-'K') + 10
+	case c >= 'N' && c <= 'Y':
+		offset = -(int(c-'N') + 1)
+	default:
+		return nil, fmt.Errorf("invalid time zone: %s", zone)
+	}
+
+	return time.FixedZone(zone, offset*3600), nil
+}
+
+// parseTimeZoneName loads time zone by IANA name, eg. Europe/Berlin.
+func parseTimeZoneName(name string) (*time.Location, error) {
+	// "" and "Local" are accepted by time.LoadLocation, but depend on
+	// environment of bfe
+	if len(name) == 0 || name == "Local" {
+		return nil, fmt.Errorf("invalid time zone: %q", name)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone: %s", err)
+	}
+	return loc, nil
+}
+
+// parseTime parses time in format yyyymmddhhmmssZ, eg. 20190204203000H or
+// 20190204203000Asia/Shanghai.
+func parseTime(value string) (time.Time, error) {
+	layout := "20060102150405"
+	if len(value) <= len(layout) {
+		return time.Time{}, fmt.Errorf("invalid time: %s, format should be yyyymmddhhmmssZ", value)
+	}
+
+	loc, err := parseTimeZone(value[len(layout):])
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.ParseInLocation(layout, value[:len(layout)], loc)
+}
+
+// parseClock parses time of day in format hhmmssZ, eg. 203000H or
+// 203000Asia/Shanghai.
+//
+// Returns:
+//     (seconds since midnight, time zone, error)
+func parseClock(value string) (int, *time.Location, error) {
+	layout := "150405"
+	if len(value) <= len(layout) {
+		return 0, nil, fmt.Errorf("invalid time of day: %s, format should be hhmmssZ", value)
+	}
+
+	loc, err := parseTimeZone(value[len(layout):])
+	if err != nil {
+		return 0, nil, err
+	}
+	t, err := time.Parse(layout, value[:len(layout)])
+	if err != nil {
+		return 0, nil, err
+	}
+	return t.Hour()*3600 + t.Minute()*60 + t.Second(), loc, nil
+}
+
+// BfeTimeFetcher fetches current time. For request from trusted ip, time
+// in X-Bfe-Debug-Time header (yyyymmddhhmmssZ) is used if exists.
+type BfeTimeFetcher struct{}
+
+func (tf *BfeTimeFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if req == nil || req.Session == nil || req.HttpRequest == nil {
+		return nil, fmt.Errorf("fetcher: nil pointer")
+	}
+
+	if req.Session.IsTrustIP {
+		if value := req.HttpRequest.Header.Get(HeaderBfeDebugTime); value != "" {
+			return parseTime(value)
+		}
+	}
+
+	return time.Now(), nil
+}
+
+// TimeMatcher matches time in [startTime, endTime]
+type TimeMatcher struct {
+	startTime time.Time
+	endTime   time.Time
+}
+
+func NewTimeMatcher(startTime string, endTime string) (*TimeMatcher, error) {
+	start, err := parseTime(startTime)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTime(endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	if end.Before(start) {
+		return nil, fmt.Errorf("startTime[%s] must <= endTime[%s]", startTime, endTime)
+	}
+
+	return &TimeMatcher{
+		startTime: start,
+		endTime:   end,
+	}, nil
+}
+
+func (tm *TimeMatcher) Match(v interface{}) bool {
+	t, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+
+	return !t.Before(tm.startTime) && !t.After(tm.endTime)
+}
+
+// PeriodicTimeMatcher matches time of day in [startTime, endTime]. If
+// startTime is after endTime, the range crosses midnight.
+type PeriodicTimeMatcher struct {
+	start int // seconds since midnight
+	end   int // seconds since midnight
+	loc   *time.Location
+}
+
+func NewPeriodicTimeMatcher(startTime string, endTime string) (*PeriodicTimeMatcher, error) {
+	start, startLoc, err := parseClock(startTime)
+	if err != nil {
+		return nil, err
+	}
+	end, endLoc, err := parseClock(endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	if startLoc.String() != endLoc.String() {
+		return nil, fmt.Errorf("startTime[%s] and endTime[%s] has different time zone", startTime, endTime)
+	}
+
+	return &PeriodicTimeMatcher{
+		start: start,
+		end:   end,
+		loc:   startLoc,
+	}, nil
+}
+
+func (pm *PeriodicTimeMatcher) Match(v interface{}) bool {
+	t, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+
+	t = t.In(pm.loc)
+	clock := t.Hour()*3600 + t.Minute()*60 + t.Second()
+	if pm.start <= pm.end {
+		return clock >= pm.start && clock <= pm.end
+	}
+	return clock >= pm.start || clock <= pm.end
+}
+
+var weekdays = map[string]time.Weekday{
+	"SUN": time.Sunday,
+	"MON": time.Monday,
+	"TUE": time.Tuesday,
+	"WED": time.Wednesday,
+	"THU": time.Thursday,
+	"FRI": time.Friday,
+	"SAT": time.Saturday,
+}
+
+// WeekdayMatcher matches day of week in given time zone
+type WeekdayMatcher struct {
+	weekdays [7]bool
+	loc      *time.Location
+}
+
+// NewWeekdayMatcher creates a WeekdayMatcher.
+//
+// Params:
+//     - patterns: days of week joined by '|', eg. "Mon|Tue|Wed|Thu|Fri"
+//     - zone: military time zone letter or IANA time zone name, eg. "H", "Asia/Shanghai"
+func NewWeekdayMatcher(patterns string, zone string) (*WeekdayMatcher, error) {
+	loc, err := parseTimeZone(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	wm := &WeekdayMatcher{loc: loc}
+	for _, p := range strings.Split(patterns, "|") {
+		day, ok := weekdays[strings.ToUpper(strings.TrimSpace(p))]
+		if !ok {
+			return nil, fmt.Errorf("invalid day of week: %s", p)
+		}
+		wm.weekdays[day] = true
+	}
+
+	return wm, nil
+}
+
+func (wm *WeekdayMatcher) Match(v interface{}) bool {
+	t, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+
+	return wm.weekdays[t.In(wm.loc).Weekday()]
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bfe_basic
+
+const (
+	// key of geo info in request context
+	ReqCtxGeoInfo = "bfe_basic.geo_info"
+)
+
+// GeoInfo holds geo location of client ip
+type GeoInfo struct {
+	Country string // country code or name, e.g. "CN"
+	Region  string // region (province/state)
+	City    string // city
+	ISP     string // internet service provider
+}
+
+// SetGeoInfo sets geo location of client ip for request.
+func (r *Request) SetGeoInfo(info *GeoInfo) {
+	r.SetContext(ReqCtxGeoInfo, info)
+}
+
+// GeoInfo returns geo location of client ip, or nil if not found.
+func (r *Request) GeoInfo() *GeoInfo {
+	info, _ := r.GetContext(ReqCtxGeoInfo).(*GeoInfo)
+	return info
+}
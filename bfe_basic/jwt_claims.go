@@ -0,0 +1,31 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bfe_basic
+
+const (
+	// key of jwt claims in request context
+	ReqCtxJwtClaims = "bfe_basic.jwt_claims"
+)
+
+// SetJwtClaims sets claims of validated jwt for request.
+func (r *Request) SetJwtClaims(claims map[string]interface{}) {
+	r.SetContext(ReqCtxJwtClaims, claims)
+}
+
+// JwtClaims returns claims of validated jwt, or nil if not found.
+func (r *Request) JwtClaims() map[string]interface{} {
+	claims, _ := r.GetContext(ReqCtxJwtClaims).(map[string]interface{})
+	return claims
+}
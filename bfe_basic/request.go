@@ -17,6 +17,7 @@
 package bfe_basic
 
 import (
+	"errors"
 	"net"
 	"net/url"
 )
@@ -26,6 +27,12 @@ import (
 	"github.com/baidu/bfe/bfe_http"
 )
 
+var (
+	ErrReqBodyUnknownSize = errors.New("size of request body unknown")
+	ErrReqBodyTooLarge    = errors.New("request body too large")
+	ErrReqBodyNotPeekable = errors.New("request body not peekable")
+)
+
 type BackendInfo struct {
 	ClusterName    string // name of cluster
 	SubclusterName string // name of sub-cluster
@@ -147,6 +154,42 @@ func (req *Request) Cookie(name string) (*bfe_http.Cookie, bool) {
 	return req.CookieMap.Get(name)
 }
 
+// PeekReqBody returns request body without consuming it, which is cached
+// in ReqBody. Body is peeked only if Content-Length of request is known and
+// not larger than maxSize (and bfe_http.MaxReqBodyPeekSize).
+func (req *Request) PeekReqBody(maxSize int) ([]byte, error) {
+	if req.ReqBodyPeeked {
+		return req.ReqBody, nil
+	}
+
+	httpReq := req.HttpRequest
+	if httpReq.ContentLength < 0 {
+		return nil, ErrReqBodyUnknownSize
+	}
+	if httpReq.ContentLength > int64(maxSize) ||
+		httpReq.ContentLength > bfe_http.MaxReqBodyPeekSize {
+		return nil, ErrReqBodyTooLarge
+	}
+
+	var body []byte
+	if httpReq.ContentLength > 0 {
+		peeker, ok := httpReq.Body.(bfe_http.Peeker)
+		if !ok {
+			return nil, ErrReqBodyNotPeekable
+		}
+		data, err := peeker.Peek(int(httpReq.ContentLength))
+		if err != nil {
+			return nil, err
+		}
+		// data is only valid before next read of body
+		body = append([]byte(nil), data...)
+	}
+
+	req.ReqBody = body
+	req.ReqBodyPeeked = true
+	return body, nil
+}
+
 func (req *Request) SetRequestTransport(backend *backend.BfeBackend,
 	transport bfe_http.RoundTripper) {
 	req.Trans.Backend = backend
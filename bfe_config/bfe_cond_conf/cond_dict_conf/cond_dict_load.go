@@ -0,0 +1,106 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// load dictionary of named conditions from json file
+
+package cond_dict_conf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic/condition"
+)
+
+type CondExprs map[string]string // name => condition expression
+
+type ProductCondExprs map[string]CondExprs // product => named conditions
+
+type CondDictConf struct {
+	Version string           // version of the config
+	Global  CondExprs        // global named conditions, visible to all products
+	Config  ProductCondExprs // named conditions of each product
+}
+
+type CondDict struct {
+	Version string              // version of the config
+	Dict    *condition.CondDict // dictionary of named conditions
+}
+
+func (conf *CondDictConf) LoadAndCheck(filename string) (string, error) {
+	// open the file
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// decode the file
+	decoder := json.NewDecoder(file)
+	if err := decoder.Decode(conf); err != nil {
+		return "", err
+	}
+
+	// check config
+	if err := CondDictConfCheck(*conf); err != nil {
+		return "", err
+	}
+
+	return conf.Version, nil
+}
+
+func CondDictConfCheck(conf CondDictConf) error {
+	if conf.Version == "" {
+		return errors.New("no Version")
+	}
+
+	for product, exprs := range conf.Config {
+		if len(product) == 0 {
+			return errors.New("empty product name in Config")
+		}
+		if exprs == nil {
+			return fmt.Errorf("no named conditions for product:%s", product)
+		}
+	}
+
+	return nil
+}
+
+// CondDictConfLoad loads dictionary of named conditions from file. All
+// references between named conditions are resolved and checked.
+func CondDictConfLoad(filename string) (CondDict, error) {
+	var condDict CondDict
+
+	var config CondDictConf
+	if _, err := config.LoadAndCheck(filename); err != nil {
+		return condDict, err
+	}
+
+	products := make(map[string]map[string]string, len(config.Config))
+	for product, exprs := range config.Config {
+		products[product] = exprs
+	}
+
+	dict, err := condition.NewCondDict(config.Global, products)
+	if err != nil {
+		return condDict, err
+	}
+
+	condDict.Version = config.Version
+	condDict.Dict = dict
+	return condDict, nil
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cond_dict_conf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCondDictConfLoad_1(t *testing.T) {
+	config, err := CondDictConfLoad("./testdata/cond_dict_1.data")
+	if err != nil {
+		t.Fatalf("get err from CondDictConfLoad():%s", err)
+	}
+
+	if config.Version != "20200101000000" {
+		t.Errorf("config.Version should be '20200101000000'")
+	}
+	if config.Dict == nil {
+		t.Errorf("config.Dict should not be nil")
+	}
+}
+
+func TestCondDictConfLoad_2(t *testing.T) {
+	_, err := CondDictConfLoad("./testdata/cond_dict_2.data")
+	if err == nil || !strings.Contains(err.Error(), "circular reference") {
+		t.Errorf("CondDictConfLoad() should return circular reference error, got %v", err)
+	}
+}
+
+func TestCondDictConfLoad_3(t *testing.T) {
+	_, err := CondDictConfLoad("./testdata/cond_dict_3.data")
+	if err == nil {
+		t.Errorf("CondDictConfLoad() should return error for no Version")
+	}
+}
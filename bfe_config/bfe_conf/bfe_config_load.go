@@ -30,6 +30,12 @@ type BfeConfig struct {
 
 	// session cache config
 	SessionTicket ConfigSessionTicket
+
+	// default config for peeking request body by condition primitives
+	ReqBodyPeek ConfigReqBodyPeek
+
+	// config for peeking request body of products (product => config)
+	ProductReqBodyPeek map[string]*ConfigReqBodyPeek
 }
 
 // BfeConfigLoad loades config from config file.
@@ -60,5 +66,13 @@ func BfeConfigLoad(filePath string, confRoot string) (BfeConfig, error) {
 		return cfg, err
 	}
 
+	if err = cfg.ReqBodyPeek.Check(confRoot); err != nil {
+		return cfg, err
+	}
+
+	if err = ProductReqBodyPeekCheck(cfg.ProductReqBodyPeek, cfg.ReqBodyPeek); err != nil {
+		return cfg, err
+	}
+
 	return cfg, nil
 }
@@ -41,6 +41,10 @@ func TestBfeConfigLoad_case1(t *testing.T) {
 		t.Error("err in HostRuleConf")
 	}
 
+	if config.Server.CondDictConf != "/home/bfe/conf/route_conf/cond_dict.data" {
+		t.Error("err in CondDictConf")
+	}
+
 	if config.Server.Modules == nil {
 		t.Error("Modules should not be nil")
 		return
@@ -61,4 +65,21 @@ func TestBfeConfigLoad_case1(t *testing.T) {
 	if config.Server.ClusterConf != "/home/bfe/conf/cluster_conf/cluster_conf.data" {
 		t.Error("err in ClusterConf")
 	}
+
+	if config.ReqBodyPeek.MaxSize != 2048 {
+		t.Error("config.ReqBodyPeek.MaxSize should be 2048")
+	}
+
+	if len(config.ProductReqBodyPeek) != 2 {
+		t.Fatalf("len(ProductReqBodyPeek) should be 2")
+	}
+
+	if config.ProductReqBodyPeek["pn_api"].MaxSize != 4096 {
+		t.Error("MaxSize of pn_api should be 4096")
+	}
+
+	// default value is used if not set
+	if config.ProductReqBodyPeek["pn_web"].MaxSize != 2048 {
+		t.Error("MaxSize of pn_web should be 2048")
+	}
 }
@@ -57,6 +57,7 @@ type ConfigBasic struct {
 	GslbConf         string // path of gslb.data
 	ClusterConf      string // path of cluster_conf.data
 	NameConf         string // path of name_conf.data
+	CondDictConf     string // path of cond_dict.data
 
 	// interval
 	MonitorInterval int // interval for getting diff of proxy-state
@@ -225,5 +226,12 @@ func dataFileConfCheck(cfg *ConfigBasic, confRoot string) error {
 		cfg.NameConf = bfe_util.ConfPathProc(cfg.NameConf, confRoot)
 	}
 
+	// check CondDictConf (optional)
+	if cfg.CondDictConf == "" {
+		log.Logger.Warn("CondDictConf not set, ignore optional condition dictionary")
+	} else {
+		cfg.CondDictConf = bfe_util.ConfPathProc(cfg.CondDictConf, confRoot)
+	}
+
 	return nil
 }
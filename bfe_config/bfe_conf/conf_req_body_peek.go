@@ -0,0 +1,71 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package bfe_conf
+
+import (
+	"fmt"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_http"
+)
+
+const (
+	// default max size of request body peeked by condition primitives,
+	// which is the size of read buffer of http connection
+	DefaultReqBodyPeekSize = bfe_http.MaxReqBodyPeekSize
+)
+
+type ConfigReqBodyPeek struct {
+	// max size (in bytes) of request body peeked by condition primitives.
+	// Request with larger body does not match body primitives. It should
+	// not be larger than the read buffer size of connection (4096).
+	MaxSize int
+}
+
+func (cfg *ConfigReqBodyPeek) Check(confRoot string) error {
+	return ConfReqBodyPeekCheck(cfg, confRoot)
+}
+
+func ConfReqBodyPeekCheck(cfg *ConfigReqBodyPeek, confRoot string) error {
+	if cfg.MaxSize < 0 || cfg.MaxSize > bfe_http.MaxReqBodyPeekSize {
+		return fmt.Errorf("MaxSize[%d] should be in [0, %d]", cfg.MaxSize, bfe_http.MaxReqBodyPeekSize)
+	}
+	if cfg.MaxSize == 0 {
+		log.Logger.Warn("ReqBodyPeek.MaxSize not set, use default value(%d)", DefaultReqBodyPeekSize)
+		cfg.MaxSize = DefaultReqBodyPeekSize
+	}
+
+	return nil
+}
+
+// ProductReqBodyPeekCheck checks config of peeking request body for products.
+// Product without MaxSize uses the default value in defaultCfg.
+func ProductReqBodyPeekCheck(cfgs map[string]*ConfigReqBodyPeek, defaultCfg ConfigReqBodyPeek) error {
+	for product, cfg := range cfgs {
+		if cfg.MaxSize < 0 || cfg.MaxSize > bfe_http.MaxReqBodyPeekSize {
+			return fmt.Errorf("ProductReqBodyPeek[%s]: MaxSize[%d] should be in [0, %d]",
+				product, cfg.MaxSize, bfe_http.MaxReqBodyPeekSize)
+		}
+		if cfg.MaxSize == 0 {
+			cfg.MaxSize = defaultCfg.MaxSize
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bfe_conf
+
+import (
+	"testing"
+)
+
+func TestConfReqBodyPeekCheck(t *testing.T) {
+	cfg := ConfigReqBodyPeek{}
+	if err := cfg.Check(""); err != nil || cfg.MaxSize != DefaultReqBodyPeekSize {
+		t.Errorf("default MaxSize should be used, got %d, %v", cfg.MaxSize, err)
+	}
+
+	// larger than read buffer of connection
+	for _, size := range []int{-1, 4097, 8192} {
+		cfg := ConfigReqBodyPeek{MaxSize: size}
+		if err := cfg.Check(""); err == nil {
+			t.Errorf("MaxSize %d should be invalid", size)
+		}
+	}
+
+	cfgs := map[string]*ConfigReqBodyPeek{"pn": {MaxSize: 8192}}
+	if err := ProductReqBodyPeekCheck(cfgs, ConfigReqBodyPeek{MaxSize: 1024}); err == nil {
+		t.Errorf("MaxSize 8192 of product should be invalid")
+	}
+}
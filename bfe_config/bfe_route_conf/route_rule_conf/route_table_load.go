@@ -83,7 +83,7 @@ func convert(fileConf *RouteTableFile) (*RouteTableConf, error) {
 			}
 
 			rules[i].ClusterName = *ruleFile.ClusterName
-			cond, err := condition.Build(*ruleFile.Cond)
+			cond, err := condition.BuildWithProduct(*ruleFile.Cond, product)
 			if err != nil {
 				return nil, fmt.Errorf("error build [%s] [%s]", *ruleFile.Cond, err)
 			}
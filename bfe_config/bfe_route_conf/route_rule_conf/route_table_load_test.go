@@ -20,6 +20,10 @@ import (
 	"testing"
 )
 
+import (
+	"github.com/baidu/bfe/bfe_basic/condition"
+)
+
 func TestLoad(t *testing.T) {
 	pwd, _ := os.Getwd()
 	fn := fmt.Sprintf("%s/testdata/route_rule.data", pwd)
@@ -32,3 +36,30 @@ func TestLoad(t *testing.T) {
 		t.Errorf("product-2 condition len is not 2")
 	}
 }
+
+func TestLoadWithCondDict(t *testing.T) {
+	pwd, _ := os.Getwd()
+	fn := fmt.Sprintf("%s/testdata/route_rule_cond_dict.data", pwd)
+
+	// named condition not defined
+	if _, err := RouteConfLoad(fn); err == nil {
+		t.Errorf("route conf load should fail for unresolved variable")
+	}
+
+	dict, err := condition.NewCondDict(nil, map[string]map[string]string{
+		"product-a": {"static": "req_header_key_in(\"X-Static\")"},
+	})
+	if err != nil {
+		t.Fatalf("NewCondDict(): %s", err)
+	}
+	condition.SetCondDict(dict)
+	defer condition.SetCondDict(&condition.CondDict{})
+
+	rt, err := RouteConfLoad(fn)
+	if err != nil {
+		t.Fatalf("route conf load error %s", err)
+	}
+	if len(rt.RuleMap["product-a"]) != 2 {
+		t.Errorf("product-a condition len is not 2")
+	}
+}
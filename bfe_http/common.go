@@ -401,6 +401,10 @@ func (w *CloseWatcher) Stop() {
 	w.done <- true
 }
 
+// max size of request body which could be peeked, it is limited by
+// the size of read buffer of client connection
+const MaxReqBodyPeekSize = 4096
+
 // common interface for peeking data
 type Peeker interface {
 	Peek(n int) ([]byte, error)
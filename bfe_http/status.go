@@ -58,6 +58,7 @@ const (
 	StatusRequestedRangeNotSatisfiable = 416
 	StatusExpectationFailed            = 417
 	StatusTeapot                       = 418
+	StatusTooManyRequests              = 429
 
 	StatusInternalServerError     = 500
 	StatusNotImplemented          = 501
@@ -69,7 +70,6 @@ const (
 	// New HTTP status codes from RFC 6585. Not exported yet in Go 1.1.
 	// See discussion at https://codereview.appspot.com/7678043/
 	statusPreconditionRequired          = 428
-	statusTooManyRequests               = 429
 	statusRequestHeaderFieldsTooLarge   = 431
 	statusNetworkAuthenticationRequired = 511
 )
@@ -122,7 +122,7 @@ var StatusText = map[int]string{
 	StatusHTTPVersionNotSupported: "HTTP Version Not Supported",
 
 	statusPreconditionRequired:          "Precondition Required",
-	statusTooManyRequests:               "Too Many Requests",
+	StatusTooManyRequests:               "Too Many Requests",
 	statusRequestHeaderFieldsTooLarge:   "Request Header Fields Too Large",
 	statusNetworkAuthenticationRequired: "Network Authentication Required",
 }
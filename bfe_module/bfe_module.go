@@ -27,6 +27,11 @@ import (
 	"github.com/baidu/go-lib/web-monitor/web_monitor"
 )
 
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+)
+
 type BfeModule interface {
 	// Name return name of module.
 	Name() string
@@ -40,6 +45,41 @@ type BfeModule interface {
 	Init(cbs *BfeCallbacks, whs *web_monitor.WebHandlers, cr string) error
 }
 
+// BfeModuleState is an optional interface for module, which exposes
+// state of module, e.g. for exporting in prometheus format.
+type BfeModuleState interface {
+	// State returns pointer to module state, which is a struct with
+	// *metrics.Counter fields.
+	State() interface{}
+}
+
+// ClusterInvoker sends request to backend of cluster, by balance and
+// transport of bfe server.
+type ClusterInvoker interface {
+	// InvokeCluster sends outreq to a backend of given cluster.
+	//
+	// Params:
+	//      - cluster: name of cluster
+	//      - req: request used for selecting backend, e.g. for session sticky
+	//      - outreq: request to send. Body of response should be closed by caller
+	InvokeCluster(cluster string, req *bfe_basic.Request, outreq *bfe_http.Request) (*bfe_http.Response, error)
+}
+
+// BfeModuleInvoker is an optional interface for module, which needs to
+// send request to backend cluster, e.g. sub-request for authorization.
+type BfeModuleInvoker interface {
+	// SetClusterInvoker sets invoker for module. It is called before Init().
+	SetClusterInvoker(invoker ClusterInvoker)
+}
+
+const (
+	// ApiTokenHeader is request header carrying token for web api of module.
+	// Token in header is passed to web handlers in param ApiTokenParam, and
+	// token in query string is dropped since query string may be logged.
+	ApiTokenHeader = "X-Bfe-Api-Token"
+	ApiTokenParam  = "token"
+)
+
 // moduleMap holds mappings from mod_name to module.
 var moduleMap = make(map[string]BfeModule)
 
@@ -57,6 +97,7 @@ func AddModule(module BfeModule) {
 
 type BfeModules struct {
 	workModules map[string]BfeModule // work modules, configure in bfe conf file
+	invoker     ClusterInvoker       // invoker for sending request to cluster
 }
 
 // NewBfeModules create new BfeModules
@@ -79,11 +120,27 @@ func (bm *BfeModules) RegisterModule(name string) error {
 	return nil
 }
 
+// SetClusterInvoker sets invoker for modules which send request to cluster.
+func (bm *BfeModules) SetClusterInvoker(invoker ClusterInvoker) {
+	bm.invoker = invoker
+}
+
 // GetModule get work module by name.
 func (bm *BfeModules) GetModule(name string) BfeModule {
 	return bm.workModules[name]
 }
 
+// ModulesEnabled returns enabled modules, in the order of init.
+func (bm *BfeModules) ModulesEnabled() []BfeModule {
+	modules := make([]BfeModule, 0, len(modulesEnabled))
+	for _, name := range modulesEnabled {
+		if module, ok := bm.workModules[name]; ok {
+			modules = append(modules, module)
+		}
+	}
+	return modules
+}
+
 // Init initializes bfe modules.
 //
 // Params:
@@ -97,6 +154,11 @@ func (bm *BfeModules) Init(cbs *BfeCallbacks, whs *web_monitor.WebHandlers, cr s
 		// check whether this module is enabled
 		module, ok := bm.workModules[name]
 		if ok {
+			// set cluster invoker for this module
+			if m, ok := module.(BfeModuleInvoker); ok && bm.invoker != nil {
+				m.SetClusterInvoker(bm.invoker)
+			}
+
 			// do init for this module
 			err := module.Init(cbs, whs, cr)
 			if err != nil {
@@ -18,11 +18,26 @@ package bfe_modules
 
 import (
 	"github.com/baidu/bfe/bfe_module"
+	"github.com/baidu/bfe/bfe_modules/mod_access"
+	"github.com/baidu/bfe/bfe_modules/mod_auth_basic"
+	"github.com/baidu/bfe/bfe_modules/mod_auth_jwt"
+	"github.com/baidu/bfe/bfe_modules/mod_auth_request"
 	"github.com/baidu/bfe/bfe_modules/mod_block"
+	"github.com/baidu/bfe/bfe_modules/mod_cache"
+	"github.com/baidu/bfe/bfe_modules/mod_compress"
+	"github.com/baidu/bfe/bfe_modules/mod_cors"
+	"github.com/baidu/bfe/bfe_modules/mod_errors"
+	"github.com/baidu/bfe/bfe_modules/mod_fault"
+	"github.com/baidu/bfe/bfe_modules/mod_geo"
 	"github.com/baidu/bfe/bfe_modules/mod_header"
+	"github.com/baidu/bfe/bfe_modules/mod_limit"
 	"github.com/baidu/bfe/bfe_modules/mod_logid"
+	"github.com/baidu/bfe/bfe_modules/mod_mirror"
+	"github.com/baidu/bfe/bfe_modules/mod_prison"
 	"github.com/baidu/bfe/bfe_modules/mod_redirect"
 	"github.com/baidu/bfe/bfe_modules/mod_rewrite"
+	"github.com/baidu/bfe/bfe_modules/mod_static"
+	"github.com/baidu/bfe/bfe_modules/mod_tag"
 	"github.com/baidu/bfe/bfe_modules/mod_trust_clientip"
 )
 
@@ -35,10 +50,44 @@ var moduleList = []bfe_module.BfeModule{
 	// Requirement: After mod_trust_clientip
 	mod_logid.NewModuleLogId(),
 
+	// mod_geo
+	// Requirement: After mod_trust_clientip
+	mod_geo.NewModuleGeo(),
+
+	// mod_tag
+	// Requirement: After mod_trust_clientip, mod_logid, mod_geo
+	mod_tag.NewModuleTag(),
+
 	// mod_block
 	// Requirement: After mod_dict_client, mod_logid
 	mod_block.NewModuleBlock(),
 
+	// mod_limit
+	// Requirement: After mod_trust_clientip, mod_logid
+	mod_limit.NewModuleLimit(),
+
+	// mod_prison
+	// Requirement: After mod_trust_clientip, mod_logid
+	mod_prison.NewModulePrison(),
+
+	// mod_cors
+	// Requirement: After mod_block, mod_limit, mod_prison
+	//              Before mod_auth_basic, mod_auth_jwt, mod_auth_request, mod_cache
+	mod_cors.NewModuleCors(),
+
+	// mod_auth_basic
+	// Requirement: After mod_block, mod_limit, mod_prison, mod_cors, Before mod_auth_request, mod_static
+	mod_auth_basic.NewModuleAuthBasic(),
+
+	// mod_auth_jwt
+	// Requirement: After mod_block, mod_limit, mod_prison, mod_cors, Before mod_auth_request, mod_static
+	mod_auth_jwt.NewModuleAuthJwt(),
+
+	// mod_auth_request
+	// Requirement: After mod_block, mod_limit, mod_prison, mod_cors, mod_auth_basic, mod_auth_jwt
+	//              Before mod_static
+	mod_auth_request.NewModuleAuthRequest(),
+
 	// mod_redirect
 	// Requirement: After mod_dict_client, mod_logid
 	mod_redirect.NewModuleRedirect(),
@@ -47,8 +96,37 @@ var moduleList = []bfe_module.BfeModule{
 	// Requirement: After mod_dict_client
 	mod_rewrite.NewModuleReWrite(),
 
+	// mod_mirror
+	// Requirement: After mod_block, mod_limit, mod_cors, Before mod_cache
+	mod_mirror.NewModuleMirror(),
+
+	// mod_fault
+	// Requirement: After mod_block, mod_limit, Before mod_cache
+	mod_fault.NewModuleFault(),
+
+	// mod_errors
+	// Requirement: Before mod_cache, mod_header, mod_compress
+	mod_errors.NewModuleErrors(),
+
+	// mod_static
+	// Requirement: After mod_block, mod_limit, mod_prison, mod_cors, mod_auth_basic,
+	//              mod_auth_jwt, mod_auth_request
+	mod_static.NewModuleStatic(),
+
+	// mod_cache
+	// Requirement: Before mod_header, mod_compress
+	mod_cache.NewModuleCache(),
+
 	// mod_header
 	mod_header.NewModuleHeader(),
+
+	// mod_compress
+	// Requirement: After mod_header
+	mod_compress.NewModuleCompress(),
+
+	// mod_access
+	// Requirement: After mod_logid
+	mod_access.NewModuleAccess(),
 }
 
 // init modules list
@@ -0,0 +1,148 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_access
+
+import (
+	"fmt"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	gcfg "gopkg.in/gcfg.v1"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_util"
+	"github.com/baidu/bfe/bfe_util/access_log"
+)
+
+type ConfModAccess struct {
+	Basic struct {
+		LogDir           string // dir of access log files
+		RequestLogPrefix string // prefix of request log file name
+		SessionLogPrefix string // prefix of session log file name
+		RotateWhen       string // time rotate policy, M/H/D/MIDNIGHT/NONE
+		BackupCount      int    // max number of rotated files to keep
+		MaxFileSize      int    // max size of log file (in MB), 0 means no limit
+	}
+
+	Template struct {
+		RequestTemplate string // template of request log
+		SessionTemplate string // template of session log
+	}
+
+	Log struct {
+		OpenDebug bool // whether open debug
+	}
+}
+
+// ConfLoad loads config from config file
+func ConfLoad(filePath string, confRoot string) (*ConfModAccess, error) {
+	var cfg ConfModAccess
+	var err error
+
+	// read config from file
+	err = gcfg.ReadFileInto(&cfg, filePath)
+	if err != nil {
+		return &cfg, err
+	}
+
+	// check conf of mod_access
+	err = cfg.Check(confRoot)
+	if err != nil {
+		return &cfg, err
+	}
+
+	return &cfg, nil
+}
+
+func (cfg *ConfModAccess) Check(confRoot string) error {
+	return ConfModAccessCheck(cfg, confRoot)
+}
+
+func ConfModAccessCheck(cfg *ConfModAccess, confRoot string) error {
+	if cfg.Basic.LogDir == "" {
+		log.Logger.Warn("ModAccess.LogDir not set, use default value")
+		cfg.Basic.LogDir = "../log"
+	}
+	cfg.Basic.LogDir = bfe_util.ConfPathProc(cfg.Basic.LogDir, confRoot)
+
+	if cfg.Basic.RequestLogPrefix == "" {
+		log.Logger.Warn("ModAccess.RequestLogPrefix not set, use default value")
+		cfg.Basic.RequestLogPrefix = "access"
+	}
+
+	if cfg.Basic.SessionLogPrefix == "" {
+		log.Logger.Warn("ModAccess.SessionLogPrefix not set, use default value")
+		cfg.Basic.SessionLogPrefix = "session"
+	}
+
+	if cfg.Basic.RotateWhen == "" {
+		log.Logger.Warn("ModAccess.RotateWhen not set, use default value")
+		cfg.Basic.RotateWhen = access_log.RotateMidnight
+	}
+
+	if cfg.Basic.BackupCount == 0 {
+		log.Logger.Warn("ModAccess.BackupCount not set, use default value")
+		cfg.Basic.BackupCount = 7
+	}
+
+	if cfg.Basic.MaxFileSize < 0 {
+		return fmt.Errorf("ModAccess.MaxFileSize should not be negative")
+	}
+
+	logConf := cfg.RequestLogConfig()
+	if err := logConf.Check(); err != nil {
+		return fmt.Errorf("ModAccess.Basic: %s", err)
+	}
+
+	if cfg.Template.RequestTemplate == "" {
+		log.Logger.Warn("ModAccess.RequestTemplate not set, use default value")
+		cfg.Template.RequestTemplate = DefaultRequestTemplate
+	}
+	if _, err := ParseTemplate(cfg.Template.RequestTemplate, DomainRequest); err != nil {
+		return fmt.Errorf("ModAccess.RequestTemplate: %s", err)
+	}
+
+	if cfg.Template.SessionTemplate == "" {
+		log.Logger.Warn("ModAccess.SessionTemplate not set, use default value")
+		cfg.Template.SessionTemplate = DefaultSessionTemplate
+	}
+	if _, err := ParseTemplate(cfg.Template.SessionTemplate, DomainSession); err != nil {
+		return fmt.Errorf("ModAccess.SessionTemplate: %s", err)
+	}
+
+	return nil
+}
+
+// RequestLogConfig returns log config for request log.
+func (cfg *ConfModAccess) RequestLogConfig() access_log.LogConfig {
+	return cfg.logConfig(cfg.Basic.RequestLogPrefix)
+}
+
+// SessionLogConfig returns log config for session log.
+func (cfg *ConfModAccess) SessionLogConfig() access_log.LogConfig {
+	return cfg.logConfig(cfg.Basic.SessionLogPrefix)
+}
+
+func (cfg *ConfModAccess) logConfig(prefix string) access_log.LogConfig {
+	return access_log.LogConfig{
+		LogDir:      cfg.Basic.LogDir,
+		LogPrefix:   prefix,
+		RotateWhen:  cfg.Basic.RotateWhen,
+		BackupCount: cfg.Basic.BackupCount,
+		MaxFileSize: int64(cfg.Basic.MaxFileSize) * 1024 * 1024,
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_access
+
+import (
+	"testing"
+)
+
+func TestConfLoad(t *testing.T) {
+	config, err := ConfLoad("./testdata/mod_access/mod_access.conf", "./testdata")
+	if err != nil {
+		t.Fatalf("ConfLoad(): %s", err)
+	}
+
+	if config.Basic.LogDir != "testdata/log" {
+		t.Errorf("LogDir should be testdata/log, got %s", config.Basic.LogDir)
+	}
+	if config.Basic.RotateWhen != "NONE" {
+		t.Errorf("RotateWhen should be NONE, got %s", config.Basic.RotateWhen)
+	}
+	if config.Basic.BackupCount != 2 {
+		t.Errorf("BackupCount should be 2, got %d", config.Basic.BackupCount)
+	}
+}
+
+func TestConfLoadInvalidTemplate(t *testing.T) {
+	// unknown variable
+	if _, err := ConfLoad("./testdata/conf_mod_access/mod_access_1.conf", ""); err == nil {
+		t.Errorf("ConfLoad() should fail for unknown variable")
+	}
+
+	// request variable in session template
+	if _, err := ConfLoad("./testdata/conf_mod_access/mod_access_2.conf", ""); err == nil {
+		t.Errorf("ConfLoad() should fail for request variable in session template")
+	}
+}
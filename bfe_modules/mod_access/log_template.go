@@ -0,0 +1,597 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// template for access log
+//
+// A template is plain text with variables. A variable is in form of
+// $name or $name{key}, e.g. "$time $client_ip $req_header{Host}".
+// Use $$ for a literal $.
+
+package mod_access
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+)
+
+// domain of template
+const (
+	DomainRequest = iota // template for request log
+	DomainSession        // template for session log
+)
+
+const (
+	DefaultRequestTemplate = "$time $client_ip $log_id $product $host \"$request_line\" " +
+		"$status_code $res_body_len $res_time $cluster $backend $err_code"
+	DefaultSessionTemplate = "$ses_start_time $ses_id $ses_remote_addr $ses_proto " +
+		"$ses_req_num $ses_read_total $ses_write_total $ses_duration $ses_err_code"
+)
+
+const (
+	timeFormat = "2006-01-02 15:04:05"
+	emptyValue = "-"
+)
+
+type requestVarFunc func(req *bfe_basic.Request, key string) string
+type sessionVarFunc func(s *bfe_basic.Session, key string) string
+
+type requestVar struct {
+	handler requestVarFunc
+	withKey bool // whether $name{key} is required
+}
+
+type sessionVar struct {
+	handler sessionVarFunc
+}
+
+// variables for request log
+var requestVars = map[string]requestVar{
+	"time":           {reqTime, false},
+	"log_id":         {reqLogId, false},
+	"client_ip":      {reqClientIP, false},
+	"remote_addr":    {reqRemoteAddr, false},
+	"host":           {reqHost, false},
+	"method":         {reqMethod, false},
+	"uri":            {reqURI, false},
+	"proto":          {reqProto, false},
+	"request_line":   {reqLine, false},
+	"status_code":    {reqStatusCode, false},
+	"req_header_len": {reqHeaderLen, false},
+	"req_body_len":   {reqBodyLen, false},
+	"res_header_len": {resHeaderLen, false},
+	"res_body_len":   {resBodyLen, false},
+	"product":        {reqProduct, false},
+	"cluster":        {reqCluster, false},
+	"subcluster":     {reqSubcluster, false},
+	"backend":        {reqBackend, false},
+	"retry_num":      {reqRetryNum, false},
+	"err_code":       {reqErrCode, false},
+	"err_msg":        {reqErrMsg, false},
+	"res_time":       {reqResTime, false},
+	"backend_time":   {reqBackendTime, false},
+	"cluster_time":   {reqClusterTime, false},
+	"req_header":     {reqHeader, true},
+	"res_header":     {resHeader, true},
+	"req_cookie":     {reqCookie, true},
+	"req_query":      {reqQuery, true},
+	"req_tag":        {reqTag, true},
+}
+
+// variables for session log, also available in request log
+var sessionVars = map[string]sessionVar{
+	"ses_id":          {sesId},
+	"ses_start_time":  {sesStartTime},
+	"ses_end_time":    {sesEndTime},
+	"ses_duration":    {sesDuration},
+	"ses_remote_addr": {sesRemoteAddr},
+	"ses_proto":       {sesProto},
+	"ses_is_secure":   {sesIsSecure},
+	"ses_is_trust_ip": {sesIsTrustIP},
+	"ses_vip":         {sesVip},
+	"ses_vport":       {sesVport},
+	"ses_product":     {sesProduct},
+	"ses_req_num":     {sesReqNum},
+	"ses_read_total":  {sesReadTotal},
+	"ses_write_total": {sesWriteTotal},
+	"ses_err_code":    {sesErrCode},
+	"ses_err_msg":     {sesErrMsg},
+}
+
+// logFmtItem is an item of log template, either plain text or a variable.
+type logFmtItem struct {
+	text       string         // plain text
+	key        string         // key of variable, for $name{key}
+	reqHandler requestVarFunc // handler for request variable
+	sesHandler sessionVarFunc // handler for session variable
+}
+
+type LogTemplate []logFmtItem
+
+// ParseTemplate parses log template for given domain.
+func ParseTemplate(tmpl string, domain int) (LogTemplate, error) {
+	var items LogTemplate
+	var text bytes.Buffer
+
+	flushText := func() {
+		if text.Len() > 0 {
+			items = append(items, logFmtItem{text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(tmpl); {
+		if tmpl[i] != '$' {
+			text.WriteByte(tmpl[i])
+			i++
+			continue
+		}
+
+		// escaped $
+		if i+1 < len(tmpl) && tmpl[i+1] == '$' {
+			text.WriteByte('$')
+			i += 2
+			continue
+		}
+
+		// parse variable name
+		start := i + 1
+		end := start
+		for end < len(tmpl) && isNameChar(tmpl[end]) {
+			end++
+		}
+		if end == start {
+			return nil, fmt.Errorf("variable name missing at offset %d", i)
+		}
+		name := tmpl[start:end]
+
+		// parse variable key
+		key := ""
+		if end < len(tmpl) && tmpl[end] == '{' {
+			closing := bytes.IndexByte([]byte(tmpl[end:]), '}')
+			if closing < 0 {
+				return nil, fmt.Errorf("'}' missing for variable %s", name)
+			}
+			key = tmpl[end+1 : end+closing]
+			end = end + closing + 1
+		}
+
+		item, err := newVarItem(name, key, domain)
+		if err != nil {
+			return nil, err
+		}
+
+		flushText()
+		items = append(items, item)
+		i = end
+	}
+	flushText()
+
+	return items, nil
+}
+
+func isNameChar(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '_'
+}
+
+func newVarItem(name string, key string, domain int) (logFmtItem, error) {
+	if v, ok := sessionVars[name]; ok {
+		if key != "" {
+			return logFmtItem{}, fmt.Errorf("variable %s should not have key", name)
+		}
+		return logFmtItem{sesHandler: v.handler}, nil
+	}
+
+	v, ok := requestVars[name]
+	if !ok {
+		return logFmtItem{}, fmt.Errorf("unknown variable %s", name)
+	}
+	if domain != DomainRequest {
+		return logFmtItem{}, fmt.Errorf("variable %s is not allowed in session log", name)
+	}
+	if v.withKey && key == "" {
+		return logFmtItem{}, fmt.Errorf("variable %s should be in form of %s{key}", name, name)
+	}
+	if !v.withKey && key != "" {
+		return logFmtItem{}, fmt.Errorf("variable %s should not have key", name)
+	}
+
+	return logFmtItem{key: key, reqHandler: v.handler}, nil
+}
+
+// FormatRequest generates request log line.
+func (t LogTemplate) FormatRequest(req *bfe_basic.Request) []byte {
+	var buf bytes.Buffer
+
+	for _, item := range t {
+		switch {
+		case item.reqHandler != nil:
+			buf.WriteString(valueOrEmpty(item.reqHandler(req, item.key)))
+		case item.sesHandler != nil:
+			if req.Session == nil {
+				buf.WriteString(emptyValue)
+				continue
+			}
+			buf.WriteString(valueOrEmpty(item.sesHandler(req.Session, item.key)))
+		default:
+			buf.WriteString(item.text)
+		}
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes()
+}
+
+// FormatSession generates session log line.
+func (t LogTemplate) FormatSession(s *bfe_basic.Session) []byte {
+	var buf bytes.Buffer
+
+	for _, item := range t {
+		if item.sesHandler != nil {
+			buf.WriteString(valueOrEmpty(item.sesHandler(s, item.key)))
+		} else {
+			buf.WriteString(item.text)
+		}
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes()
+}
+
+func valueOrEmpty(value string) string {
+	if value == "" {
+		return emptyValue
+	}
+	return value
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(timeFormat)
+}
+
+// durationMs returns duration from start to end in ms.
+func durationMs(start, end time.Time) string {
+	if start.IsZero() || end.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(end.Sub(start).Nanoseconds()/1000000, 10)
+}
+
+// escapeValue escapes value from client or backend, so that it could not
+// break log line or forge other fields. Control characters, space, '"' and
+// '\' are escaped as \xHH.
+func escapeValue(value string) string {
+	i := 0
+	for i < len(value) && !needEscape(value[i]) {
+		i++
+	}
+	if i == len(value) {
+		return value
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(value[:i])
+	for ; i < len(value); i++ {
+		c := value[i]
+		if needEscape(c) {
+			fmt.Fprintf(&buf, "\\x%02X", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+func needEscape(c byte) bool {
+	return c <= ' ' || c == 0x7f || c == '"' || c == '\\'
+}
+
+func reqTime(req *bfe_basic.Request, key string) string {
+	if req.Stat == nil {
+		return ""
+	}
+	return formatTime(req.Stat.ReadReqStart)
+}
+
+func reqLogId(req *bfe_basic.Request, key string) string {
+	return req.LogId
+}
+
+func reqClientIP(req *bfe_basic.Request, key string) string {
+	if req.ClientAddr != nil {
+		return req.ClientAddr.IP.String()
+	}
+	if req.RemoteAddr != nil {
+		return req.RemoteAddr.IP.String()
+	}
+	return ""
+}
+
+func reqRemoteAddr(req *bfe_basic.Request, key string) string {
+	if req.RemoteAddr == nil {
+		return ""
+	}
+	return req.RemoteAddr.String()
+}
+
+func reqHost(req *bfe_basic.Request, key string) string {
+	if req.HttpRequest == nil {
+		return ""
+	}
+	return escapeValue(req.HttpRequest.Host)
+}
+
+func reqMethod(req *bfe_basic.Request, key string) string {
+	if req.HttpRequest == nil {
+		return ""
+	}
+	return req.HttpRequest.Method
+}
+
+func reqURI(req *bfe_basic.Request, key string) string {
+	if req.HttpRequest == nil {
+		return ""
+	}
+	if req.HttpRequest.RequestURI != "" {
+		return req.HttpRequest.RequestURI
+	}
+	if req.HttpRequest.URL != nil {
+		return req.HttpRequest.URL.RequestURI()
+	}
+	return ""
+}
+
+func reqProto(req *bfe_basic.Request, key string) string {
+	if req.HttpRequest == nil {
+		return ""
+	}
+	return req.HttpRequest.Proto
+}
+
+func reqLine(req *bfe_basic.Request, key string) string {
+	if req.HttpRequest == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s %s %s", reqMethod(req, key), reqURI(req, key), reqProto(req, key))
+}
+
+func reqStatusCode(req *bfe_basic.Request, key string) string {
+	if req.HttpResponse != nil {
+		return strconv.Itoa(req.HttpResponse.StatusCode)
+	}
+	if req.BfeStatusCode != 0 {
+		return strconv.Itoa(req.BfeStatusCode)
+	}
+	return ""
+}
+
+func reqHeaderLen(req *bfe_basic.Request, key string) string {
+	if req.Stat == nil {
+		return ""
+	}
+	return strconv.Itoa(req.Stat.HeaderLenIn)
+}
+
+func reqBodyLen(req *bfe_basic.Request, key string) string {
+	if req.Stat == nil {
+		return ""
+	}
+	return strconv.Itoa(req.Stat.BodyLenIn)
+}
+
+func resHeaderLen(req *bfe_basic.Request, key string) string {
+	if req.Stat == nil {
+		return ""
+	}
+	return strconv.Itoa(req.Stat.HeaderLenOut)
+}
+
+func resBodyLen(req *bfe_basic.Request, key string) string {
+	if req.Stat == nil {
+		return ""
+	}
+	return strconv.Itoa(req.Stat.BodyLenOut)
+}
+
+func reqProduct(req *bfe_basic.Request, key string) string {
+	return req.Route.Product
+}
+
+func reqCluster(req *bfe_basic.Request, key string) string {
+	if req.Backend.ClusterName != "" {
+		return req.Backend.ClusterName
+	}
+	return req.Route.ClusterName
+}
+
+func reqSubcluster(req *bfe_basic.Request, key string) string {
+	return req.Backend.SubclusterName
+}
+
+func reqBackend(req *bfe_basic.Request, key string) string {
+	if req.Backend.BackendAddr == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", req.Backend.BackendAddr, req.Backend.BackendPort)
+}
+
+func reqRetryNum(req *bfe_basic.Request, key string) string {
+	return strconv.Itoa(req.RetryTime)
+}
+
+func reqErrCode(req *bfe_basic.Request, key string) string {
+	if req.ErrCode == nil {
+		return ""
+	}
+	return req.ErrCode.Error()
+}
+
+func reqErrMsg(req *bfe_basic.Request, key string) string {
+	if req.ErrMsg == "" {
+		return ""
+	}
+	return strconv.Quote(req.ErrMsg)
+}
+
+func reqResTime(req *bfe_basic.Request, key string) string {
+	if req.Stat == nil {
+		return ""
+	}
+	end := req.Stat.ResponseEnd
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return durationMs(req.Stat.ReadReqStart, end)
+}
+
+func reqBackendTime(req *bfe_basic.Request, key string) string {
+	if req.Stat == nil {
+		return ""
+	}
+	return durationMs(req.Stat.BackendStart, req.Stat.BackendEnd)
+}
+
+func reqClusterTime(req *bfe_basic.Request, key string) string {
+	if req.Stat == nil {
+		return ""
+	}
+	return durationMs(req.Stat.ClusterStart, req.Stat.ClusterEnd)
+}
+
+func reqHeader(req *bfe_basic.Request, key string) string {
+	if req.HttpRequest == nil {
+		return ""
+	}
+	return escapeValue(req.HttpRequest.Header.Get(key))
+}
+
+func resHeader(req *bfe_basic.Request, key string) string {
+	if req.HttpResponse == nil {
+		return ""
+	}
+	return escapeValue(req.HttpResponse.Header.Get(key))
+}
+
+func reqCookie(req *bfe_basic.Request, key string) string {
+	if req.HttpRequest == nil {
+		return ""
+	}
+	cookie, ok := req.Cookie(key)
+	if !ok {
+		return ""
+	}
+	return escapeValue(cookie.Value)
+}
+
+func reqQuery(req *bfe_basic.Request, key string) string {
+	if req.HttpRequest == nil || req.HttpRequest.URL == nil {
+		return ""
+	}
+	return escapeValue(req.CachedQuery().Get(key))
+}
+
+func reqTag(req *bfe_basic.Request, key string) string {
+	return strings.Join(req.GetTags(key), ",")
+}
+
+func sesId(s *bfe_basic.Session, key string) string {
+	return strconv.FormatUint(s.SessionId, 10)
+}
+
+func sesStartTime(s *bfe_basic.Session, key string) string {
+	return formatTime(s.StartTime)
+}
+
+func sesEndTime(s *bfe_basic.Session, key string) string {
+	return formatTime(s.EndTime)
+}
+
+func sesDuration(s *bfe_basic.Session, key string) string {
+	if s.EndTime.IsZero() {
+		return durationMs(s.StartTime, time.Now())
+	}
+	return strconv.FormatInt(s.Overhead.Nanoseconds()/1000000, 10)
+}
+
+func sesRemoteAddr(s *bfe_basic.Session, key string) string {
+	if s.RemoteAddr == nil {
+		return ""
+	}
+	return s.RemoteAddr.String()
+}
+
+func sesProto(s *bfe_basic.Session, key string) string {
+	return s.Proto
+}
+
+func sesIsSecure(s *bfe_basic.Session, key string) string {
+	return strconv.FormatBool(s.IsSecure)
+}
+
+func sesIsTrustIP(s *bfe_basic.Session, key string) string {
+	return strconv.FormatBool(s.IsTrustIP)
+}
+
+func sesVip(s *bfe_basic.Session, key string) string {
+	if s.Vip == nil {
+		return ""
+	}
+	return s.Vip.String()
+}
+
+func sesVport(s *bfe_basic.Session, key string) string {
+	return strconv.Itoa(s.Vport)
+}
+
+func sesProduct(s *bfe_basic.Session, key string) string {
+	return s.Product
+}
+
+func sesReqNum(s *bfe_basic.Session, key string) string {
+	return strconv.FormatInt(atomic.LoadInt64(&s.ReqNum), 10)
+}
+
+func sesReadTotal(s *bfe_basic.Session, key string) string {
+	return strconv.FormatInt(atomic.LoadInt64(&s.ReadTotal), 10)
+}
+
+func sesWriteTotal(s *bfe_basic.Session, key string) string {
+	return strconv.FormatInt(atomic.LoadInt64(&s.WriteTotal), 10)
+}
+
+func sesErrCode(s *bfe_basic.Session, key string) string {
+	errCode, _ := s.GetError()
+	if errCode == nil {
+		return ""
+	}
+	return errCode.Error()
+}
+
+func sesErrMsg(s *bfe_basic.Session, key string) string {
+	_, errMsg := s.GetError()
+	if errMsg == "" {
+		return ""
+	}
+	return strconv.Quote(errMsg)
+}
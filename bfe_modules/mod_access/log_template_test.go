@@ -0,0 +1,139 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_access
+
+import (
+	"net"
+	"net/url"
+	"testing"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+)
+
+func prepareRequest() *bfe_basic.Request {
+	req := new(bfe_basic.Request)
+	req.Session = new(bfe_basic.Session)
+	req.Session.SessionId = 100
+	req.Session.ReqNum = 2
+	req.Session.RemoteAddr, _ = net.ResolveTCPAddr("tcp", "10.1.1.1:8080")
+	req.RemoteAddr = req.Session.RemoteAddr
+	req.Context = make(map[interface{}]interface{})
+
+	req.HttpRequest = new(bfe_http.Request)
+	req.HttpRequest.Method = "GET"
+	req.HttpRequest.Host = "example.org"
+	req.HttpRequest.RequestURI = "/index.html?a=1"
+	req.HttpRequest.URL, _ = url.Parse("/index.html?a=1")
+	req.HttpRequest.Proto = "HTTP/1.1"
+	req.HttpRequest.Header = make(bfe_http.Header)
+	req.HttpRequest.Header.Set("User-Agent", "curl")
+	req.LogId = "12345"
+
+	req.HttpResponse = new(bfe_http.Response)
+	req.HttpResponse.StatusCode = 200
+	req.HttpResponse.Header = make(bfe_http.Header)
+	return req
+}
+
+func TestParseTemplate(t *testing.T) {
+	cases := []struct {
+		tmpl   string
+		domain int
+		ok     bool
+	}{
+		{DefaultRequestTemplate, DomainRequest, true},
+		{DefaultSessionTemplate, DomainSession, true},
+		{"$host $$ $req_header{Host}", DomainRequest, true},
+		{"$host", DomainSession, false},
+		{"$unknown", DomainRequest, false},
+		{"$req_header", DomainRequest, false},
+		{"$host{Host}", DomainRequest, false},
+		{"$req_header{Host", DomainRequest, false},
+		{"100$", DomainRequest, false},
+	}
+
+	for _, c := range cases {
+		_, err := ParseTemplate(c.tmpl, c.domain)
+		if (err == nil) != c.ok {
+			t.Errorf("ParseTemplate(%q): unexpected result %v", c.tmpl, err)
+		}
+	}
+}
+
+func TestFormatRequest(t *testing.T) {
+	tmpl, err := ParseTemplate("$log_id \"$request_line\" $status_code $req_header{User-Agent} "+
+		"$req_query{a} $res_header{Server} $ses_id $ses_req_num $$", DomainRequest)
+	if err != nil {
+		t.Fatalf("ParseTemplate(): %s", err)
+	}
+
+	line := string(tmpl.FormatRequest(prepareRequest()))
+	expect := "12345 \"GET /index.html?a=1 HTTP/1.1\" 200 curl 1 - 100 2 $\n"
+	if line != expect {
+		t.Errorf("FormatRequest() should be %q, got %q", expect, line)
+	}
+}
+
+func TestFormatSession(t *testing.T) {
+	tmpl, err := ParseTemplate("$ses_id $ses_remote_addr $ses_err_code", DomainSession)
+	if err != nil {
+		t.Fatalf("ParseTemplate(): %s", err)
+	}
+
+	line := string(tmpl.FormatSession(prepareRequest().Session))
+	expect := "100 10.1.1.1:8080 -\n"
+	if line != expect {
+		t.Errorf("FormatSession() should be %q, got %q", expect, line)
+	}
+}
+
+func TestFormatRequestTag(t *testing.T) {
+	tmpl, err := ParseTemplate("$req_tag{client_type} $req_tag{release}", DomainRequest)
+	if err != nil {
+		t.Fatalf("ParseTemplate(): %s", err)
+	}
+
+	req := prepareRequest()
+	req.Tags.TagTable = make(map[string][]string)
+	req.AddTags("client_type", []string{"bot", "internal"})
+
+	line := string(tmpl.FormatRequest(req))
+	expect := "bot,internal -\n"
+	if line != expect {
+		t.Errorf("FormatRequest() should be %q, got %q", expect, line)
+	}
+}
+
+func TestFormatRequestEscape(t *testing.T) {
+	tmpl, err := ParseTemplate("$host $req_header{User-Agent} $req_query{q} $status_code", DomainRequest)
+	if err != nil {
+		t.Fatalf("ParseTemplate(): %s", err)
+	}
+
+	req := prepareRequest()
+	req.HttpRequest.Host = "example.org\r\n"
+	req.HttpRequest.Header.Set("User-Agent", "curl 200 \"fake\"")
+	req.HttpRequest.URL, _ = url.Parse("/index.html?q=%0A2019-01-01%2000:00:00%09x")
+
+	line := string(tmpl.FormatRequest(req))
+	expect := "example.org\\x0D\\x0A curl\\x20200\\x20\\x22fake\\x22 " +
+		"\\x0A2019-01-01\\x2000:00:00\\x09x 200\n"
+	if line != expect {
+		t.Errorf("FormatRequest() should be %q, got %q", expect, line)
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// module for request log and session log
+
+package mod_access
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/web-monitor/metrics"
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+	"github.com/baidu/bfe/bfe_util/access_log"
+)
+
+const (
+	ModAccess = "mod_access"
+)
+
+var (
+	openDebug = false
+)
+
+type ModuleAccessState struct {
+	ReqLogTotal     *metrics.Counter // request log written
+	ReqLogFail      *metrics.Counter // request log failed to write
+	ReqLogDrop      *metrics.Counter // request log dropped for buffer full
+	SessionLogTotal *metrics.Counter // session log written
+	SessionLogFail  *metrics.Counter // session log failed to write
+	SessionLogDrop  *metrics.Counter // session log dropped for buffer full
+}
+
+type ModuleAccess struct {
+	name    string            // name of module
+	state   ModuleAccessState // module state
+	metrics metrics.Metrics
+
+	confRoot string // root dir of config
+	confPath string // path of module config file
+
+	lock       sync.RWMutex
+	reqTmpl    LogTemplate          // template of request log
+	sesTmpl    LogTemplate          // template of session log
+	reqWriter  io.WriteCloser       // writer for request log
+	sesWriter  io.WriteCloser       // writer for session log
+	reqLogConf access_log.LogConfig // config of request log writer
+	sesLogConf access_log.LogConfig // config of session log writer
+}
+
+func NewModuleAccess() *ModuleAccess {
+	m := new(ModuleAccess)
+	m.name = ModAccess
+	m.metrics.Init(&m.state, ModAccess, 0)
+
+	return m
+}
+
+func (m *ModuleAccess) Name() string {
+	return m.name
+}
+
+func (m *ModuleAccess) State() interface{} {
+	return &m.state
+}
+
+// loadConf loads module config, updates templates and log writers.
+func (m *ModuleAccess) loadConf(query url.Values) error {
+	// get path
+	path := query.Get("path")
+	if path == "" {
+		// use default
+		path = m.confPath
+	}
+
+	// load file
+	conf, err := ConfLoad(path, m.confRoot)
+	if err != nil {
+		return fmt.Errorf("err in ConfLoad(%s):%s", path, err)
+	}
+
+	reqTmpl, err := ParseTemplate(conf.Template.RequestTemplate, DomainRequest)
+	if err != nil {
+		return fmt.Errorf("err in ParseTemplate(RequestTemplate):%s", err)
+	}
+	sesTmpl, err := ParseTemplate(conf.Template.SessionTemplate, DomainSession)
+	if err != nil {
+		return fmt.Errorf("err in ParseTemplate(SessionTemplate):%s", err)
+	}
+
+	// old log writers are closed after lock released, since buffered logs
+	// are written to file when closed
+	var oldWriters []io.WriteCloser
+	defer func() {
+		for _, w := range oldWriters {
+			w.Close()
+		}
+	}()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// create new log writers only if log config changed
+	reqConf, sesConf := conf.RequestLogConfig(), conf.SessionLogConfig()
+	var reqWriter, sesWriter io.WriteCloser
+	if m.reqWriter == nil || m.reqLogConf != reqConf {
+		if reqWriter, err = access_log.NewLogWriter(reqConf); err != nil {
+			return fmt.Errorf("err in NewLogWriter(request log):%s", err)
+		}
+	}
+	if m.sesWriter == nil || m.sesLogConf != sesConf {
+		if sesWriter, err = access_log.NewLogWriter(sesConf); err != nil {
+			if reqWriter != nil {
+				reqWriter.Close()
+			}
+			return fmt.Errorf("err in NewLogWriter(session log):%s", err)
+		}
+	}
+
+	if reqWriter != nil {
+		if m.reqWriter != nil {
+			oldWriters = append(oldWriters, m.reqWriter)
+		}
+		m.reqWriter = reqWriter
+		m.reqLogConf = reqConf
+	}
+	if sesWriter != nil {
+		if m.sesWriter != nil {
+			oldWriters = append(oldWriters, m.sesWriter)
+		}
+		m.sesWriter = sesWriter
+		m.sesLogConf = sesConf
+	}
+
+	m.reqTmpl = reqTmpl
+	m.sesTmpl = sesTmpl
+	openDebug = conf.Log.OpenDebug
+
+	return nil
+}
+
+// requestLogHandler writes request log after request finish.
+func (m *ModuleAccess) requestLogHandler(req *bfe_basic.Request, res *bfe_http.Response) int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	line := m.reqTmpl.FormatRequest(req)
+	if _, err := m.reqWriter.Write(line); err != nil {
+		if err == access_log.ErrBufferFull {
+			m.state.ReqLogDrop.Inc(1)
+			return bfe_module.BFE_HANDLER_GOON
+		}
+		log.Logger.Warn("%s write request log err: %s", m.name, err)
+		m.state.ReqLogFail.Inc(1)
+		return bfe_module.BFE_HANDLER_GOON
+	}
+
+	if openDebug {
+		log.Logger.Debug("%s request log: %s", m.name, line)
+	}
+	m.state.ReqLogTotal.Inc(1)
+	return bfe_module.BFE_HANDLER_GOON
+}
+
+// sessionLogHandler writes session log after connection finish.
+func (m *ModuleAccess) sessionLogHandler(session *bfe_basic.Session) int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	line := m.sesTmpl.FormatSession(session)
+	if _, err := m.sesWriter.Write(line); err != nil {
+		if err == access_log.ErrBufferFull {
+			m.state.SessionLogDrop.Inc(1)
+			return bfe_module.BFE_HANDLER_GOON
+		}
+		log.Logger.Warn("%s write session log err: %s", m.name, err)
+		m.state.SessionLogFail.Inc(1)
+		return bfe_module.BFE_HANDLER_GOON
+	}
+
+	if openDebug {
+		log.Logger.Debug("%s session log: %s", m.name, line)
+	}
+	m.state.SessionLogTotal.Inc(1)
+	return bfe_module.BFE_HANDLER_GOON
+}
+
+func (m *ModuleAccess) getState(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetAll()
+	return s.Format(params)
+}
+
+func (m *ModuleAccess) getStateDiff(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetDiff()
+	return s.Format(params)
+}
+
+func (m *ModuleAccess) monitorHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name:           m.getState,
+		m.name + ".diff": m.getStateDiff,
+	}
+	return handlers
+}
+
+func (m *ModuleAccess) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHandlers,
+	cr string) error {
+	var err error
+
+	m.confRoot = cr
+	m.confPath = bfe_module.ModConfPath(cr, m.name)
+
+	// load module config
+	if err = m.loadConf(nil); err != nil {
+		return fmt.Errorf("%s: loadConf() err %s", m.name, err.Error())
+	}
+
+	// register handler
+	err = cbs.AddFilter(bfe_module.HANDLE_REQUEST_FINISH, m.requestLogHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.requestLogHandler): %s", m.name, err.Error())
+	}
+
+	err = cbs.AddFilter(bfe_module.HANDLE_FINISH, m.sessionLogHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.sessionLogHandler): %s", m.name, err.Error())
+	}
+
+	// register web handler for monitor
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_MONITOR, m.monitorHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.monitorHandlers): %s", m.name, err.Error())
+	}
+
+	// register web handler for reload
+	err = whs.RegisterHandler(web_monitor.WEB_HANDLE_RELOAD, m.name, m.loadConf)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): RegisterHandler(m.loadConf): %s", m.name, err.Error())
+	}
+
+	return nil
+}
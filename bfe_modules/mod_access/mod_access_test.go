@@ -0,0 +1,71 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_access
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_module"
+)
+
+func TestModuleAccess(t *testing.T) {
+	defer os.RemoveAll("./testdata/log")
+
+	m := NewModuleAccess()
+	err := m.Init(bfe_module.NewBfeCallbacks(), web_monitor.NewWebHandlers(), "./testdata")
+	if err != nil {
+		t.Fatalf("Init(): %s", err)
+	}
+
+	req := prepareRequest()
+	if ret := m.requestLogHandler(req, req.HttpResponse); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("requestLogHandler() should return GOON")
+	}
+	if ret := m.sessionLogHandler(req.Session); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("sessionLogHandler() should return GOON")
+	}
+
+	// reload with the same config
+	if err := m.loadConf(nil); err != nil {
+		t.Errorf("loadConf(): %s", err)
+	}
+	if m.state.ReqLogTotal.Get() != 1 || m.state.SessionLogTotal.Get() != 1 {
+		t.Errorf("unexpected state: %v", m.state)
+	}
+
+	// wait for logs written to file
+	m.reqWriter.Close()
+	m.sesWriter.Close()
+
+	data, _ := ioutil.ReadFile("./testdata/log/access.log")
+	expect := "12345 example.org \"GET /index.html?a=1 HTTP/1.1\" 200 curl 100\n"
+	if string(data) != expect {
+		t.Errorf("request log should be %q, got %q", expect, data)
+	}
+
+	data, _ = ioutil.ReadFile("./testdata/log/session.log")
+	expect = "100 10.1.1.1:8080 2\n"
+	if string(data) != expect {
+		t.Errorf("session log should be %q, got %q", expect, data)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_auth_basic
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+import (
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// prefix of password hash generated by "htpasswd -s"
+	shaPrefix = "{SHA}"
+
+	// max number of verified credentials cached for each user table
+	maxVerifiedCacheSize = 1024
+)
+
+type passwordHash struct {
+	bcrypt bool   // whether hash is bcrypt hash, otherwise sha1 hash
+	hash   []byte // password hash
+}
+
+// match checks whether password matches the hash.
+func (h passwordHash) match(password string) bool {
+	if h.bcrypt {
+		return bcrypt.CompareHashAndPassword(h.hash, []byte(password)) == nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	return subtle.ConstantTimeCompare(h.hash, sum[:]) == 1
+}
+
+func passwordHashParse(s string) (passwordHash, error) {
+	var h passwordHash
+
+	// sha1 hash: {SHA}base64(sha1(password))
+	if strings.HasPrefix(s, shaPrefix) {
+		hash, err := base64.StdEncoding.DecodeString(s[len(shaPrefix):])
+		if err != nil || len(hash) != sha1.Size {
+			return h, fmt.Errorf("invalid sha1 hash")
+		}
+		h.hash = hash
+		return h, nil
+	}
+
+	// bcrypt hash: $2y$cost$salthash
+	if strings.HasPrefix(s, "$2") {
+		if _, err := bcrypt.Cost([]byte(s)); err != nil {
+			return h, fmt.Errorf("invalid bcrypt hash: %s", err)
+		}
+		h.bcrypt = true
+		h.hash = []byte(s)
+		return h, nil
+	}
+
+	return h, fmt.Errorf("unsupported password hash, only bcrypt and sha1 are supported")
+}
+
+// UserTable holds users loaded from htpasswd file.
+type UserTable struct {
+	users map[string]passwordHash // username => password hash
+
+	// bcrypt is designed to be slow, so verified credentials are cached
+	lock     sync.Mutex
+	verified map[[sha256.Size]byte]bool
+}
+
+func newUserTable() *UserTable {
+	t := new(UserTable)
+	t.users = make(map[string]passwordHash)
+	t.verified = make(map[[sha256.Size]byte]bool)
+	return t
+}
+
+// Len returns number of users.
+func (t *UserTable) Len() int {
+	return len(t.users)
+}
+
+// Verify checks whether username and password are valid.
+func (t *UserTable) Verify(username string, password string) bool {
+	h, ok := t.users[username]
+	if !ok {
+		return false
+	}
+	if !h.bcrypt {
+		return h.match(password)
+	}
+
+	key := sha256.Sum256([]byte(username + "\x00" + password))
+	t.lock.Lock()
+	verified := t.verified[key]
+	t.lock.Unlock()
+	if verified {
+		return true
+	}
+
+	if !h.match(password) {
+		return false
+	}
+
+	t.lock.Lock()
+	if len(t.verified) >= maxVerifiedCacheSize {
+		t.verified = make(map[[sha256.Size]byte]bool)
+	}
+	t.verified[key] = true
+	t.lock.Unlock()
+
+	return true
+}
+
+// ApiKeyTable holds api keys loaded from api key file.
+type ApiKeyTable struct {
+	keys map[[sha256.Size]byte]string // sha256 of api key => name of api key
+}
+
+func newApiKeyTable() *ApiKeyTable {
+	t := new(ApiKeyTable)
+	t.keys = make(map[[sha256.Size]byte]string)
+	return t
+}
+
+// Len returns number of api keys.
+func (t *ApiKeyTable) Len() int {
+	return len(t.keys)
+}
+
+// Lookup returns name of given api key.
+func (t *ApiKeyTable) Lookup(key string) (string, bool) {
+	// keys are indexed by sha256, so lookup time does not depend on key
+	name, ok := t.keys[sha256.Sum256([]byte(key))]
+	return name, ok
+}
+
+// credentialFileLoad reads "name:secret" lines from file.
+// Empty lines and lines begin with "#" are ignored.
+func credentialFileLoad(filename string, handler func(name, secret string) error) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		segs := strings.SplitN(line, ":", 2)
+		if len(segs) != 2 || len(segs[0]) == 0 || len(segs[1]) == 0 {
+			return fmt.Errorf("line %d: format should be name:secret", lineNum)
+		}
+
+		if err := handler(segs[0], segs[1]); err != nil {
+			return fmt.Errorf("line %d: %s", lineNum, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// UserTableLoad loads users from htpasswd file (bcrypt or sha1).
+func UserTableLoad(filename string) (*UserTable, error) {
+	table := newUserTable()
+
+	err := credentialFileLoad(filename, func(username, secret string) error {
+		if _, ok := table.users[username]; ok {
+			return fmt.Errorf("duplicate user: %s", username)
+		}
+
+		h, err := passwordHashParse(secret)
+		if err != nil {
+			return fmt.Errorf("user %s: %s", username, err)
+		}
+		table.users[username] = h
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return table, nil
+}
+
+// ApiKeyTableLoad loads api keys from file, format of line is "name:key".
+func ApiKeyTableLoad(filename string) (*ApiKeyTable, error) {
+	table := newApiKeyTable()
+
+	err := credentialFileLoad(filename, func(name, key string) error {
+		sum := sha256.Sum256([]byte(key))
+		if _, ok := table.keys[sum]; ok {
+			return fmt.Errorf("duplicate api key of %s", name)
+		}
+		table.keys[sum] = name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return table, nil
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_auth_basic
+
+import (
+	"testing"
+)
+
+func TestUserTableLoad(t *testing.T) {
+	table, err := UserTableLoad("./testdata/mod_auth_basic/htpasswd")
+	if err != nil {
+		t.Fatalf("UserTableLoad(): %s", err)
+	}
+	if table.Len() != 2 {
+		t.Errorf("table.Len() should be 2, got %d", table.Len())
+	}
+
+	cases := []struct {
+		username string
+		password string
+		ok       bool
+	}{
+		{"alice", "alice-secret", true},
+		{"alice", "alice-secret", true}, // verified cache
+		{"alice", "bob-secret", false},
+		{"bob", "bob-secret", true},
+		{"bob", "", false},
+		{"carol", "alice-secret", false},
+	}
+	for _, c := range cases {
+		if ok := table.Verify(c.username, c.password); ok != c.ok {
+			t.Errorf("Verify(%s, %s) should be %v", c.username, c.password, c.ok)
+		}
+	}
+}
+
+func TestUserTableLoadInvalid(t *testing.T) {
+	files := []string{
+		"./testdata/htpasswd_1", // unsupported hash
+		"./testdata/htpasswd_2", // duplicate user
+		"./testdata/api_keys_2", // invalid format
+		"./testdata/no_exist",   // file not exist
+	}
+
+	for _, file := range files {
+		if _, err := UserTableLoad(file); err == nil {
+			t.Errorf("err should not be nil for %s", file)
+		}
+	}
+}
+
+func TestApiKeyTableLoad(t *testing.T) {
+	table, err := ApiKeyTableLoad("./testdata/mod_auth_basic/api_keys")
+	if err != nil {
+		t.Fatalf("ApiKeyTableLoad(): %s", err)
+	}
+	if table.Len() != 2 {
+		t.Errorf("table.Len() should be 2, got %d", table.Len())
+	}
+
+	if name, ok := table.Lookup("c9f0f895fb98ab9159f51fd0297e236d"); !ok || name != "ci" {
+		t.Errorf("Lookup() should return ci, got %s", name)
+	}
+	if _, ok := table.Lookup("c9f0f895fb98ab9159f51fd0297e236"); ok {
+		t.Errorf("Lookup() should fail for unknown key")
+	}
+}
+
+func TestApiKeyTableLoadInvalid(t *testing.T) {
+	files := []string{
+		"./testdata/api_keys_1", // duplicate key
+		"./testdata/api_keys_2", // invalid format
+	}
+
+	for _, file := range files {
+		if _, err := ApiKeyTableLoad(file); err == nil {
+			t.Errorf("err should not be nil for %s", file)
+		}
+	}
+}
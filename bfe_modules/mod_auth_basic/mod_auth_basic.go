@@ -0,0 +1,252 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// module for http basic and api key authentication
+
+package mod_auth_basic
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/web-monitor/metrics"
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+const (
+	ModAuthBasic = "mod_auth_basic"
+)
+
+var (
+	ERR_AUTH_BASIC = errors.New("AUTH_BASIC")
+)
+
+var (
+	openDebug = false
+)
+
+type ModuleAuthBasicState struct {
+	ReqTotal         *metrics.Counter // all request in
+	ReqToCheck       *metrics.Counter // request with condition satisfied
+	AuthSuccess      *metrics.Counter // request authenticated
+	AuthNoCredential *metrics.Counter // request without credential
+	AuthFail         *metrics.Counter // request with invalid credential
+}
+
+type ModuleAuthBasic struct {
+	name    string               // name of module
+	state   ModuleAuthBasicState // module state
+	metrics metrics.Metrics
+
+	confRoot        string            // root dir of config
+	productRulePath string            // path of auth rule data file
+	ruleTable       *ProductRuleTable // table for product auth rules
+}
+
+func NewModuleAuthBasic() *ModuleAuthBasic {
+	m := new(ModuleAuthBasic)
+	m.name = ModAuthBasic
+	m.metrics.Init(&m.state, ModAuthBasic, 0)
+
+	m.ruleTable = NewProductRuleTable()
+
+	return m
+}
+
+func (m *ModuleAuthBasic) Name() string {
+	return m.name
+}
+
+func (m *ModuleAuthBasic) State() interface{} {
+	return &m.state
+}
+
+// loadProductRuleConf load from config file, credential files are reloaded too.
+func (m *ModuleAuthBasic) loadProductRuleConf(query url.Values) error {
+	// get path
+	path := query.Get("path")
+	if path == "" {
+		// use default
+		path = m.productRulePath
+	}
+
+	// load file
+	conf, err := ProductRuleConfLoad(path, m.confRoot)
+	if err != nil {
+		return fmt.Errorf("err in ProductRuleConfLoad(%s):%s", path, err)
+	}
+
+	m.ruleTable.Update(conf)
+	return nil
+}
+
+// authenticate checks credential of request, returns name of user (or api key).
+// found is false if no credential is provided.
+func authenticate(req *bfe_basic.Request, rule *authRule) (name string, found bool, ok bool) {
+	httpReq := req.HttpRequest
+
+	// check api key
+	if rule.ApiKeys != nil {
+		if key := httpReq.Header.Get(rule.ApiKeyHeader); len(key) != 0 {
+			found = true
+			if name, ok = rule.ApiKeys.Lookup(key); ok {
+				return name, found, ok
+			}
+		}
+	}
+
+	// check username and password
+	if rule.Users != nil {
+		if username, password, exist := httpReq.BasicAuth(); exist {
+			found = true
+			if rule.Users.Verify(username, password) {
+				return username, found, true
+			}
+		}
+	}
+
+	return "", found, false
+}
+
+// createUnauthorizedResp creates 401 response with WWW-Authenticate header.
+func createUnauthorizedResp(req *bfe_basic.Request, rule *authRule) *bfe_http.Response {
+	res := bfe_basic.CreateInternalResp(req, bfe_http.StatusUnauthorized)
+	if rule.Users != nil {
+		res.Header.Set("WWW-Authenticate", fmt.Sprintf("Basic realm=\"%s\"", rule.Realm))
+	} else {
+		res.Header.Set("WWW-Authenticate", fmt.Sprintf("ApiKey realm=\"%s\"", rule.Realm))
+	}
+	return res
+}
+
+// authHandler is a handler for authenticating request.
+func (m *ModuleAuthBasic) authHandler(req *bfe_basic.Request) (int, *bfe_http.Response) {
+	m.state.ReqTotal.Inc(1)
+
+	// find auth rules for given request
+	rules, ok := m.ruleTable.Search(req.Route.Product)
+	if !ok {
+		if openDebug {
+			log.Logger.Debug("%s product %s not found, just pass",
+				m.name, req.Route.Product)
+		}
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	for i := range *rules {
+		rule := &(*rules)[i]
+		if !rule.Cond.Match(req) {
+			continue
+		}
+		m.state.ReqToCheck.Inc(1)
+
+		name, found, ok := authenticate(req, rule)
+		if !ok {
+			if found {
+				m.state.AuthFail.Inc(1)
+			} else {
+				m.state.AuthNoCredential.Inc(1)
+			}
+			if openDebug {
+				log.Logger.Debug("%s authentication failed (remote:%s, found:%v)",
+					m.name, req.RemoteAddr, found)
+			}
+			req.ErrCode = ERR_AUTH_BASIC
+			return bfe_module.BFE_HANDLER_RESPONSE, createUnauthorizedResp(req, rule)
+		}
+
+		m.state.AuthSuccess.Inc(1)
+		if len(rule.UserHeader) != 0 {
+			req.HttpRequest.Header.Set(rule.UserHeader, name)
+		}
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	return bfe_module.BFE_HANDLER_GOON, nil
+}
+
+func (m *ModuleAuthBasic) getState(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetAll()
+	return s.Format(params)
+}
+
+func (m *ModuleAuthBasic) getStateDiff(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetDiff()
+	return s.Format(params)
+}
+
+func (m *ModuleAuthBasic) monitorHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name:           m.getState,
+		m.name + ".diff": m.getStateDiff,
+	}
+	return handlers
+}
+
+func (m *ModuleAuthBasic) reloadHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name + ".product_rule_table": m.loadProductRuleConf,
+	}
+	return handlers
+}
+
+func (m *ModuleAuthBasic) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHandlers,
+	cr string) error {
+	var conf *ConfModAuthBasic
+	var err error
+
+	// load module config
+	confPath := bfe_module.ModConfPath(cr, m.name)
+	if conf, err = ConfLoad(confPath, cr); err != nil {
+		return fmt.Errorf("%s: conf load err %s", m.name, err.Error())
+	}
+
+	m.confRoot = cr
+	m.productRulePath = conf.Basic.ProductRulePath
+	openDebug = conf.Log.OpenDebug
+
+	// load conf data
+	if err = m.loadProductRuleConf(nil); err != nil {
+		return fmt.Errorf("%s: loadProductRuleConf() err %s", m.name, err.Error())
+	}
+
+	// register handler
+	err = cbs.AddFilter(bfe_module.HANDLE_FOUND_PRODUCT, m.authHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.authHandler): %s", m.name, err.Error())
+	}
+
+	// register web handler for monitor
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_MONITOR, m.monitorHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.monitorHandlers): %s", m.name, err.Error())
+	}
+	// register web handler for reload
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_RELOAD, m.reloadHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.reloadHandlers): %s", m.name, err.Error())
+	}
+
+	return nil
+}
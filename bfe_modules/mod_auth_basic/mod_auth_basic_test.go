@@ -0,0 +1,151 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_auth_basic
+
+import (
+	"net/url"
+	"testing"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+func prepareModule(t *testing.T) *ModuleAuthBasic {
+	m := NewModuleAuthBasic()
+	err := m.Init(bfe_module.NewBfeCallbacks(), web_monitor.NewWebHandlers(), "./testdata")
+	if err != nil {
+		t.Fatalf("Init(): %s", err)
+	}
+	return m
+}
+
+func prepareRequest(path string) *bfe_basic.Request {
+	request := new(bfe_basic.Request)
+	request.HttpRequest = new(bfe_http.Request)
+	request.HttpRequest.Header = make(bfe_http.Header)
+	request.HttpRequest.URL, _ = url.Parse(path)
+	request.Session = new(bfe_basic.Session)
+	request.Context = make(map[interface{}]interface{})
+	request.Route = bfe_basic.RequestRoute{Product: "pn"}
+	return request
+}
+
+func checkUnauthorized(t *testing.T, ret int, res *bfe_http.Response, challenge string) {
+	if ret != bfe_module.BFE_HANDLER_RESPONSE || res == nil {
+		t.Fatalf("authHandler() should return response")
+	}
+	if res.StatusCode != bfe_http.StatusUnauthorized {
+		t.Errorf("status code should be 401, got %d", res.StatusCode)
+	}
+	if res.Header.Get("WWW-Authenticate") != challenge {
+		t.Errorf("WWW-Authenticate should be %s, got %s", challenge, res.Header.Get("WWW-Authenticate"))
+	}
+}
+
+func TestAuthHandlerBasic(t *testing.T) {
+	m := prepareModule(t)
+
+	// no credential
+	req := prepareRequest("/dashboard/index.html")
+	ret, res := m.authHandler(req)
+	checkUnauthorized(t, ret, res, "Basic realm=\"dashboard\"")
+	if req.ErrCode != ERR_AUTH_BASIC {
+		t.Errorf("ErrCode should be ERR_AUTH_BASIC")
+	}
+
+	// wrong password
+	req = prepareRequest("/dashboard/index.html")
+	req.HttpRequest.SetBasicAuth("alice", "wrong")
+	ret, res = m.authHandler(req)
+	checkUnauthorized(t, ret, res, "Basic realm=\"dashboard\"")
+
+	// valid password, spoofed user header is overwritten
+	req = prepareRequest("/dashboard/index.html")
+	req.HttpRequest.SetBasicAuth("alice", "alice-secret")
+	req.HttpRequest.Header.Set("X-Auth-User", "root")
+	if ret, _ = m.authHandler(req); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Fatalf("authHandler() should return GOON")
+	}
+	if user := req.HttpRequest.Header.Get("X-Auth-User"); user != "alice" {
+		t.Errorf("X-Auth-User should be alice, got %s", user)
+	}
+
+	if m.state.ReqToCheck.Get() != 3 || m.state.AuthNoCredential.Get() != 1 ||
+		m.state.AuthFail.Get() != 1 || m.state.AuthSuccess.Get() != 1 {
+		t.Errorf("unexpected state: %+v", m.state)
+	}
+}
+
+func TestAuthHandlerApiKey(t *testing.T) {
+	m := prepareModule(t)
+
+	req := prepareRequest("/api/v1/status")
+	req.HttpRequest.Header.Set("X-Api-Key", "unknown")
+	ret, res := m.authHandler(req)
+	checkUnauthorized(t, ret, res, "ApiKey realm=\"bfe\"")
+
+	req = prepareRequest("/api/v1/status")
+	req.HttpRequest.Header.Set("X-Api-Key", "8f14e45fceea167a5a36dedd4bea2543")
+	if ret, _ = m.authHandler(req); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Fatalf("authHandler() should return GOON")
+	}
+	if user := req.HttpRequest.Header.Get("X-Auth-User"); user != "monitor" {
+		t.Errorf("X-Auth-User should be monitor, got %s", user)
+	}
+}
+
+func TestAuthHandlerMixed(t *testing.T) {
+	m := prepareModule(t)
+
+	// either api key or password is accepted
+	req := prepareRequest("/admin")
+	req.HttpRequest.Header.Set("X-Api-Key", "c9f0f895fb98ab9159f51fd0297e236d")
+	if ret, _ := m.authHandler(req); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("authHandler() should return GOON for valid api key")
+	}
+
+	req = prepareRequest("/admin")
+	req.HttpRequest.Header.Set("X-Api-Key", "unknown")
+	req.HttpRequest.SetBasicAuth("bob", "bob-secret")
+	if ret, _ := m.authHandler(req); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("authHandler() should return GOON for valid password")
+	}
+
+	req = prepareRequest("/admin")
+	ret, res := m.authHandler(req)
+	checkUnauthorized(t, ret, res, "Basic realm=\"bfe\"")
+}
+
+func TestAuthHandlerNoRule(t *testing.T) {
+	m := prepareModule(t)
+
+	req := prepareRequest("/index.html")
+	if ret, _ := m.authHandler(req); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("authHandler() should return GOON")
+	}
+
+	req = prepareRequest("/dashboard")
+	req.Route.Product = "unknown"
+	if ret, _ := m.authHandler(req); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("authHandler() should return GOON")
+	}
+}
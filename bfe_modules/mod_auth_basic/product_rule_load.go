@@ -0,0 +1,282 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_auth_basic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic/condition"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_util"
+)
+
+const (
+	DefaultRealm        = "bfe"
+	DefaultApiKeyHeader = "X-Api-Key"
+)
+
+type authRuleFile struct {
+	Cond         *string // condition for authentication
+	Realm        *string // realm in WWW-Authenticate header, optional
+	UserFile     *string // path of htpasswd file, optional
+	ApiKeyFile   *string // path of api key file, optional
+	ApiKeyHeader *string // header carrying api key, optional
+	UserHeader   *string // header to pass authenticated user to backend, optional
+}
+
+type authRule struct {
+	Cond         condition.Condition // condition for authentication
+	Realm        string              // realm in WWW-Authenticate header
+	Users        *UserTable          // users for basic authentication, maybe nil
+	ApiKeys      *ApiKeyTable        // api keys, maybe nil
+	ApiKeyHeader string              // header carrying api key
+	UserHeader   string              // header to pass authenticated user to backend
+}
+
+type authRuleFileList []authRuleFile
+type authRuleList []authRule
+
+type ProductRulesFile map[string]*authRuleFileList // product => list of auth rules
+type ProductRules map[string]*authRuleList
+
+type productRuleConfFile struct {
+	Version *string // version of the config
+	Config  *ProductRulesFile
+}
+
+type productRuleConf struct {
+	Version string       // version of the config
+	Config  ProductRules // product rules for authentication
+}
+
+// credentialCache avoids loading the same credential file more than once
+type credentialCache struct {
+	confRoot string
+	users    map[string]*UserTable
+	apiKeys  map[string]*ApiKeyTable
+}
+
+func newCredentialCache(confRoot string) *credentialCache {
+	c := new(credentialCache)
+	c.confRoot = confRoot
+	c.users = make(map[string]*UserTable)
+	c.apiKeys = make(map[string]*ApiKeyTable)
+	return c
+}
+
+func (c *credentialCache) userTable(path string) (*UserTable, error) {
+	path = bfe_util.ConfPathProc(path, c.confRoot)
+	if table, ok := c.users[path]; ok {
+		return table, nil
+	}
+
+	table, err := UserTableLoad(path)
+	if err != nil {
+		return nil, fmt.Errorf("UserTableLoad(%s): %s", path, err)
+	}
+	c.users[path] = table
+	return table, nil
+}
+
+func (c *credentialCache) apiKeyTable(path string) (*ApiKeyTable, error) {
+	path = bfe_util.ConfPathProc(path, c.confRoot)
+	if table, ok := c.apiKeys[path]; ok {
+		return table, nil
+	}
+
+	table, err := ApiKeyTableLoad(path)
+	if err != nil {
+		return nil, fmt.Errorf("ApiKeyTableLoad(%s): %s", path, err)
+	}
+	c.apiKeys[path] = table
+	return table, nil
+}
+
+func authRuleCheck(conf authRuleFile) error {
+	// check Cond
+	if conf.Cond == nil {
+		return errors.New("no Cond")
+	}
+
+	// check credentials
+	if (conf.UserFile == nil || len(*conf.UserFile) == 0) &&
+		(conf.ApiKeyFile == nil || len(*conf.ApiKeyFile) == 0) {
+		return errors.New("no UserFile or ApiKeyFile")
+	}
+
+	// check Realm
+	if conf.Realm != nil && strings.ContainsAny(*conf.Realm, "\"\\\r\n") {
+		return fmt.Errorf("invalid Realm: %s", *conf.Realm)
+	}
+
+	// check headers
+	if conf.ApiKeyHeader != nil && len(*conf.ApiKeyHeader) == 0 {
+		return errors.New("ApiKeyHeader is empty")
+	}
+	if conf.UserHeader != nil && len(*conf.UserHeader) == 0 {
+		return errors.New("UserHeader is empty")
+	}
+
+	return nil
+}
+
+func authRuleListCheck(conf *authRuleFileList) error {
+	for index, rule := range *conf {
+		err := authRuleCheck(rule)
+		if err != nil {
+			return fmt.Errorf("authRule:%d, %s", index, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRulesCheck(conf *ProductRulesFile) error {
+	for product, ruleList := range *conf {
+		if ruleList == nil {
+			return fmt.Errorf("no authRuleList for product:%s", product)
+		}
+
+		err := authRuleListCheck(ruleList)
+		if err != nil {
+			return fmt.Errorf("ProductRules:%s, %s", product, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRuleConfCheck(conf productRuleConfFile) error {
+	var err error
+
+	// check Version
+	if conf.Version == nil {
+		return errors.New("no Version")
+	}
+
+	// check Config
+	if conf.Config == nil {
+		return errors.New("no Config")
+	}
+
+	err = productRulesCheck(conf.Config)
+	if err != nil {
+		return fmt.Errorf("Config:%s", err.Error())
+	}
+
+	return nil
+}
+
+func ruleConvert(ruleFile authRuleFile, credentials *credentialCache, product string) (authRule, error) {
+	var err error
+	rule := authRule{}
+
+	rule.Cond, err = condition.BuildWithProduct(*ruleFile.Cond, product)
+	if err != nil {
+		return rule, err
+	}
+
+	rule.Realm = DefaultRealm
+	if ruleFile.Realm != nil {
+		rule.Realm = *ruleFile.Realm
+	}
+
+	if ruleFile.UserFile != nil && len(*ruleFile.UserFile) != 0 {
+		if rule.Users, err = credentials.userTable(*ruleFile.UserFile); err != nil {
+			return rule, err
+		}
+	}
+
+	if ruleFile.ApiKeyFile != nil && len(*ruleFile.ApiKeyFile) != 0 {
+		if rule.ApiKeys, err = credentials.apiKeyTable(*ruleFile.ApiKeyFile); err != nil {
+			return rule, err
+		}
+	}
+
+	rule.ApiKeyHeader = DefaultApiKeyHeader
+	if ruleFile.ApiKeyHeader != nil {
+		rule.ApiKeyHeader = bfe_http.CanonicalHeaderKey(*ruleFile.ApiKeyHeader)
+	}
+
+	if ruleFile.UserHeader != nil {
+		rule.UserHeader = bfe_http.CanonicalHeaderKey(*ruleFile.UserHeader)
+	}
+
+	return rule, nil
+}
+
+func ruleListConvert(ruleFileList *authRuleFileList, credentials *credentialCache, product string) (*authRuleList, error) {
+	ruleList := new(authRuleList)
+	*ruleList = make([]authRule, 0)
+
+	for _, ruleFile := range *ruleFileList {
+		rule, err := ruleConvert(ruleFile, credentials, product)
+		if err != nil {
+			return nil, err
+		}
+		*ruleList = append(*ruleList, rule)
+	}
+
+	return ruleList, nil
+}
+
+// ProductRuleConfLoad load auth rule config from file, together with
+// credential files referenced by rules. Relative path of credential
+// file is relative to confRoot.
+func ProductRuleConfLoad(filename string, confRoot string) (productRuleConf, error) {
+	var conf productRuleConf
+	var err error
+
+	// open the file
+	file, err := os.Open(filename)
+	if err != nil {
+		return conf, err
+	}
+	defer file.Close()
+
+	// decode the file
+	decoder := json.NewDecoder(file)
+	var config productRuleConfFile
+	err = decoder.Decode(&config)
+	if err != nil {
+		return conf, err
+	}
+
+	// check config
+	err = productRuleConfCheck(config)
+	if err != nil {
+		return conf, err
+	}
+
+	// convert config
+	credentials := newCredentialCache(confRoot)
+	conf.Version = *config.Version
+	conf.Config = make(ProductRules)
+	for product, ruleFileList := range *config.Config {
+		ruleList, err := ruleListConvert(ruleFileList, credentials, product)
+		if err != nil {
+			return conf, err
+		}
+		conf.Config[product] = ruleList
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_auth_basic
+
+import (
+	"testing"
+)
+
+func TestAuthRuleConfLoad(t *testing.T) {
+	config, err := ProductRuleConfLoad("./testdata/mod_auth_basic/auth_basic_rules.data", "./testdata")
+	if err != nil {
+		t.Fatalf("get err from ProductRuleConfLoad():%s", err.Error())
+	}
+
+	rules := *config.Config["pn"]
+	if len(rules) != 3 {
+		t.Fatalf("len(config.Config['pn']) should be 3")
+	}
+
+	if rules[0].Realm != "dashboard" || rules[0].Users == nil || rules[0].ApiKeys != nil ||
+		rules[0].UserHeader != "X-Auth-User" {
+		t.Errorf("unexpected rule 0: %+v", rules[0])
+	}
+	if rules[1].Realm != DefaultRealm || rules[1].Users != nil || rules[1].ApiKeys == nil ||
+		rules[1].ApiKeyHeader != "X-Api-Key" {
+		t.Errorf("unexpected rule 1: %+v", rules[1])
+	}
+
+	// credential file is loaded only once
+	if rules[0].Users != rules[2].Users || rules[1].ApiKeys != rules[2].ApiKeys {
+		t.Errorf("credential tables should be shared by rules")
+	}
+}
+
+func TestAuthRuleConfLoadInvalid(t *testing.T) {
+	files := []string{
+		"./testdata/auth_basic_rules_1.data", // no UserFile or ApiKeyFile
+		"./testdata/auth_basic_rules_2.data", // UserFile not exist
+		"./testdata/auth_basic_rules_3.data", // invalid Realm
+		"./testdata/auth_basic_rules_4.data", // unsupported hash
+	}
+
+	for _, file := range files {
+		if _, err := ProductRuleConfLoad(file, "./testdata"); err == nil {
+			t.Errorf("err should not be nil for %s", file)
+		}
+	}
+}
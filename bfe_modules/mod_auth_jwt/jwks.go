@@ -0,0 +1,212 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_auth_jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgHS256 = "HS256"
+)
+
+// jwkFile is a json web key, see RFC 7517
+type jwkFile struct {
+	Kty string // key type: RSA, EC or oct
+	Kid string // key id, optional
+	Alg string // algorithm, optional
+	Use string // public key use, optional
+
+	N string // modulus of RSA key
+	E string // exponent of RSA key
+
+	Crv string // curve of EC key
+	X   string // x coordinate of EC key
+	Y   string // y coordinate of EC key
+
+	K string // symmetric key
+}
+
+type jwksFile struct {
+	Keys []jwkFile
+}
+
+// JWK is a key for verifying jwt
+type JWK struct {
+	Kid string      // key id
+	Alg string      // algorithm of key
+	Key interface{} // *rsa.PublicKey, *ecdsa.PublicKey or []byte
+}
+
+// KeySet is a set of keys loaded from jwks file
+type KeySet struct {
+	keys []*JWK
+}
+
+// Len returns number of keys.
+func (s *KeySet) Len() int {
+	return len(s.keys)
+}
+
+// Lookup returns keys for given key id and algorithm.
+// If kid is empty, all keys for the algorithm are returned.
+func (s *KeySet) Lookup(kid string, alg string) []*JWK {
+	var keys []*JWK
+	for _, key := range s.keys {
+		if key.Alg != alg {
+			continue
+		}
+		if len(kid) != 0 && key.Kid != kid {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// decodeSegment decodes base64url encoded string, with or without padding.
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := decodeSegment(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func rsaKeyParse(conf jwkFile) (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(conf.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid n: %s", err)
+	}
+	e, err := decodeBigInt(conf.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid e: %s", err)
+	}
+	if !e.IsInt64() || e.Int64() > 1<<31-1 || e.Int64() < 3 {
+		return nil, errors.New("invalid e")
+	}
+	if n.BitLen() < 2048 {
+		return nil, fmt.Errorf("RSA key too short: %d bits", n.BitLen())
+	}
+
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func ecKeyParse(conf jwkFile) (*ecdsa.PublicKey, error) {
+	if conf.Crv != "P-256" {
+		return nil, fmt.Errorf("unsupported curve: %s", conf.Crv)
+	}
+
+	x, err := decodeBigInt(conf.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x: %s", err)
+	}
+	y, err := decodeBigInt(conf.Y)
+	if err != nil {
+		return nil, fmt.Errorf("invalid y: %s", err)
+	}
+
+	curve := elliptic.P256()
+	if !curve.IsOnCurve(x, y) {
+		return nil, errors.New("point not on curve")
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func jwkParse(conf jwkFile) (*JWK, error) {
+	key := &JWK{Kid: conf.Kid}
+
+	if len(conf.Use) != 0 && conf.Use != "sig" {
+		return nil, fmt.Errorf("unsupported use: %s", conf.Use)
+	}
+
+	var err error
+	switch conf.Kty {
+	case "RSA":
+		key.Alg = AlgRS256
+		key.Key, err = rsaKeyParse(conf)
+	case "EC":
+		key.Alg = AlgES256
+		key.Key, err = ecKeyParse(conf)
+	case "oct":
+		key.Alg = AlgHS256
+		var k []byte
+		if k, err = decodeSegment(conf.K); err == nil && len(k) < 32 {
+			err = fmt.Errorf("HMAC key too short: %d bytes", len(k))
+		}
+		key.Key = k
+	default:
+		return nil, fmt.Errorf("unsupported kty: %s", conf.Kty)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// algorithm is determined by key type, to avoid algorithm confusion
+	if len(conf.Alg) != 0 && conf.Alg != key.Alg {
+		return nil, fmt.Errorf("unsupported alg %s for kty %s", conf.Alg, conf.Kty)
+	}
+
+	return key, nil
+}
+
+// KeySetLoad loads keys from jwks file.
+func KeySetLoad(filename string) (*KeySet, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var conf jwksFile
+	decoder := json.NewDecoder(file)
+	if err := decoder.Decode(&conf); err != nil {
+		return nil, err
+	}
+
+	if len(conf.Keys) == 0 {
+		return nil, errors.New("no keys")
+	}
+
+	set := new(KeySet)
+	for i, keyConf := range conf.Keys {
+		key, err := jwkParse(keyConf)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %s", i, err)
+		}
+		set.keys = append(set.keys, key)
+	}
+
+	return set, nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_auth_jwt
+
+import (
+	"testing"
+)
+
+func TestKeySetLoad(t *testing.T) {
+	keys := loadTestKeySet(t)
+	if keys.Len() != 3 {
+		t.Fatalf("keys.Len() should be 3, got %d", keys.Len())
+	}
+
+	if found := keys.Lookup("rsa-1", AlgRS256); len(found) != 1 {
+		t.Errorf("Lookup(rsa-1, RS256) should return 1 key, got %d", len(found))
+	}
+	if found := keys.Lookup("rsa-1", AlgHS256); len(found) != 0 {
+		t.Errorf("Lookup(rsa-1, HS256) should return no key, got %d", len(found))
+	}
+	if found := keys.Lookup("", AlgES256); len(found) != 1 {
+		t.Errorf("Lookup('', ES256) should return 1 key, got %d", len(found))
+	}
+}
+
+func TestKeySetLoadInvalid(t *testing.T) {
+	files := []string{
+		"./testdata/jwks_2.json", // HMAC key too short
+		"./testdata/jwks_3.json", // alg mismatch with kty
+		"./testdata/jwks_4.json", // no keys
+		"./testdata/jwks_5.json", // not exist
+	}
+
+	for _, file := range files {
+		if _, err := KeySetLoad(file); err == nil {
+			t.Errorf("err should not be nil for %s", file)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_auth_jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	errTokenMalformed   = errors.New("token malformed")
+	errTokenAlgorithm   = errors.New("token algorithm not supported")
+	errTokenNoKey       = errors.New("no key for token")
+	errTokenSignature   = errors.New("token signature invalid")
+	errTokenExpired     = errors.New("token expired")
+	errTokenNotValidYet = errors.New("token not valid yet")
+	errTokenIssuer      = errors.New("token issuer mismatch")
+	errTokenAudience    = errors.New("token audience mismatch")
+)
+
+type jwtHeader struct {
+	Alg string // algorithm
+	Kid string // key id, optional
+	Typ string // type, optional
+}
+
+// Token is a parsed json web token, see RFC 7519
+type Token struct {
+	Header    jwtHeader
+	Claims    map[string]interface{}
+	signed    string // signing input: header.payload
+	signature []byte
+}
+
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// keep precision of numeric claims
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// ParseToken parses jwt in compact serialization, signature is not verified.
+func ParseToken(s string) (*Token, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return nil, errTokenMalformed
+	}
+
+	token := new(Token)
+	header, err := decodeSegment(parts[0])
+	if err != nil || decodeJSON(header, &token.Header) != nil {
+		return nil, errTokenMalformed
+	}
+	payload, err := decodeSegment(parts[1])
+	if err != nil || decodeJSON(payload, &token.Claims) != nil || token.Claims == nil {
+		return nil, errTokenMalformed
+	}
+	if token.signature, err = decodeSegment(parts[2]); err != nil {
+		return nil, errTokenMalformed
+	}
+	token.signed = parts[0] + "." + parts[1]
+
+	return token, nil
+}
+
+func verifySignature(key *JWK, signed string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signed))
+
+	switch k := key.Key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PublicKey:
+		// signature is r || s, each is 32 bytes for P-256
+		if len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(k, digest[:], r, s)
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		return hmac.Equal(mac.Sum(nil), signature)
+	}
+
+	return false
+}
+
+// Verify verifies signature of token with keys.
+func (t *Token) Verify(keys *KeySet) error {
+	switch t.Header.Alg {
+	case AlgRS256, AlgES256, AlgHS256:
+	default:
+		return errTokenAlgorithm
+	}
+
+	candidates := keys.Lookup(t.Header.Kid, t.Header.Alg)
+	if len(candidates) == 0 {
+		return errTokenNoKey
+	}
+
+	for _, key := range candidates {
+		if verifySignature(key, t.signed, t.signature) {
+			return nil
+		}
+	}
+	return errTokenSignature
+}
+
+// numericClaim returns value of NumericDate claim, e.g. exp, nbf.
+func (t *Token) numericClaim(name string) (float64, bool, error) {
+	value, ok := t.Claims[name]
+	if !ok {
+		return 0, false, nil
+	}
+
+	num, ok := value.(json.Number)
+	if !ok {
+		return 0, true, errTokenMalformed
+	}
+	f, err := num.Float64()
+	if err != nil {
+		return 0, true, errTokenMalformed
+	}
+	return f, true, nil
+}
+
+// hasAudience checks whether audience of token contains aud.
+func (t *Token) hasAudience(aud string) bool {
+	switch v := t.Claims["aud"].(type) {
+	case string:
+		return v == aud
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == aud {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckClaims checks registered claims: exp, nbf, iss and aud.
+// issuer and audience are not checked if empty.
+func (t *Token) CheckClaims(issuer string, audience string, skew time.Duration, now time.Time) error {
+	ts := float64(now.UnixNano()) / float64(time.Second)
+	leeway := skew.Seconds()
+
+	exp, ok, err := t.numericClaim("exp")
+	if err != nil {
+		return err
+	}
+	if ok && ts >= exp+leeway {
+		return errTokenExpired
+	}
+
+	nbf, ok, err := t.numericClaim("nbf")
+	if err != nil {
+		return err
+	}
+	if ok && ts+leeway < nbf {
+		return errTokenNotValidYet
+	}
+
+	if len(issuer) != 0 {
+		if iss, _ := t.Claims["iss"].(string); iss != issuer {
+			return errTokenIssuer
+		}
+	}
+
+	if len(audience) != 0 && !t.hasAudience(audience) {
+		return errTokenAudience
+	}
+
+	return nil
+}
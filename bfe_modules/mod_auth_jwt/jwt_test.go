@@ -0,0 +1,209 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_auth_jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+var testHmacKey = []byte("0123456789abcdef0123456789abcdef")
+
+func loadPrivateKey(t *testing.T, filename string) interface{} {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("ReadFile(%s): %s", filename, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("no pem block in %s", filename)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	}
+	if err != nil {
+		t.Fatalf("parse private key in %s: %s", filename, err)
+	}
+	return key
+}
+
+// signToken creates a signed token for test.
+func signToken(t *testing.T, alg string, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	var err error
+	switch alg {
+	case AlgRS256:
+		key := loadPrivateKey(t, "./testdata/rsa_key.pem").(*rsa.PrivateKey)
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case AlgES256:
+		key := loadPrivateKey(t, "./testdata/ec_key.pem").(*ecdsa.PrivateKey)
+		r, s, e := ecdsa.Sign(rand.Reader, key, digest[:])
+		err = e
+		sig = make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[32-len(rb):32], rb)
+		copy(sig[64-len(sb):], sb)
+	case AlgHS256:
+		mac := hmac.New(sha256.New, testHmacKey)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	default:
+		sig = []byte("sig")
+	}
+	if err != nil {
+		t.Fatalf("sign token: %s", err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func loadTestKeySet(t *testing.T) *KeySet {
+	keys, err := KeySetLoad("./testdata/jwks.json")
+	if err != nil {
+		t.Fatalf("KeySetLoad(): %s", err)
+	}
+	return keys
+}
+
+func TestTokenVerify(t *testing.T) {
+	keys := loadTestKeySet(t)
+	claims := map[string]interface{}{"sub": "alice"}
+
+	cases := []struct {
+		token string
+		err   error
+	}{
+		{signToken(t, AlgRS256, "rsa-1", claims), nil},
+		{signToken(t, AlgES256, "ec-1", claims), nil},
+		{signToken(t, AlgHS256, "hmac-1", claims), nil},
+		{signToken(t, AlgHS256, "", claims), nil},
+		{signToken(t, AlgRS256, "rsa-2", claims), errTokenNoKey},
+		{signToken(t, AlgRS256, "ec-1", claims), errTokenNoKey},
+		{signToken(t, "none", "", claims), errTokenAlgorithm},
+	}
+
+	for i, c := range cases {
+		token, err := ParseToken(c.token)
+		if err != nil {
+			t.Fatalf("case %d: ParseToken(): %s", i, err)
+		}
+		if err = token.Verify(keys); err != c.err {
+			t.Errorf("case %d: Verify() should return %v, got %v", i, c.err, err)
+		}
+	}
+
+	// tampered payload
+	token := signToken(t, AlgRS256, "rsa-1", claims)
+	forged := signToken(t, AlgRS256, "rsa-1", map[string]interface{}{"sub": "root"})
+	parts, forgedParts := splitToken(token), splitToken(forged)
+	tampered := parts[0] + "." + forgedParts[1] + "." + parts[2]
+	parsed, err := ParseToken(tampered)
+	if err != nil {
+		t.Fatalf("ParseToken(): %s", err)
+	}
+	if err = parsed.Verify(keys); err != errTokenSignature {
+		t.Errorf("Verify() should return errTokenSignature, got %v", err)
+	}
+}
+
+func splitToken(token string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(token); i++ {
+		if token[i] == '.' {
+			parts = append(parts, token[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, token[start:])
+}
+
+func TestParseTokenMalformed(t *testing.T) {
+	tokens := []string{
+		"",
+		"abc",
+		"a.b",
+		"a.b.c.d",
+		"!!.e30.c2ln",
+		"e30.!!.c2ln",
+		"e30.W10.c2ln", // payload is not object
+		"e30.e30.!!",
+	}
+
+	for _, token := range tokens {
+		if _, err := ParseToken(token); err != errTokenMalformed {
+			t.Errorf("ParseToken(%q) should return errTokenMalformed, got %v", token, err)
+		}
+	}
+}
+
+func TestTokenCheckClaims(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+
+	cases := []struct {
+		claims   map[string]interface{}
+		issuer   string
+		audience string
+		err      error
+	}{
+		{map[string]interface{}{}, "", "", nil},
+		{map[string]interface{}{"exp": 1500000001}, "", "", nil},
+		{map[string]interface{}{"exp": 1499999990}, "", "", nil}, // within clock skew
+		{map[string]interface{}{"exp": 1499999970}, "", "", errTokenExpired},
+		{map[string]interface{}{"exp": "1500000001"}, "", "", errTokenMalformed},
+		{map[string]interface{}{"nbf": 1500000000}, "", "", nil},
+		{map[string]interface{}{"nbf": 1500000010}, "", "", nil}, // within clock skew
+		{map[string]interface{}{"nbf": 1500000100}, "", "", errTokenNotValidYet},
+		{map[string]interface{}{"iss": "a"}, "a", "", nil},
+		{map[string]interface{}{"iss": "b"}, "a", "", errTokenIssuer},
+		{map[string]interface{}{}, "a", "", errTokenIssuer},
+		{map[string]interface{}{"aud": "api"}, "", "api", nil},
+		{map[string]interface{}{"aud": []string{"web", "api"}}, "", "api", nil},
+		{map[string]interface{}{"aud": []string{"web"}}, "", "api", errTokenAudience},
+		{map[string]interface{}{}, "", "api", errTokenAudience},
+	}
+
+	for i, c := range cases {
+		token, err := ParseToken(signToken(t, AlgHS256, "", c.claims))
+		if err != nil {
+			t.Fatalf("case %d: ParseToken(): %s", i, err)
+		}
+		if err = token.CheckClaims(c.issuer, c.audience, 30*time.Second, now); err != c.err {
+			t.Errorf("case %d: CheckClaims() should return %v, got %v", i, c.err, err)
+		}
+	}
+}
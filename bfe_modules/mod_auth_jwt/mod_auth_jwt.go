@@ -0,0 +1,314 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// module for jwt (json web token) authentication
+
+package mod_auth_jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/web-monitor/metrics"
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+const (
+	ModAuthJwt = "mod_auth_jwt"
+)
+
+var (
+	ERR_AUTH_JWT = errors.New("AUTH_JWT")
+)
+
+var (
+	openDebug = false
+)
+
+type ModuleAuthJwtState struct {
+	ReqTotal           *metrics.Counter // all request in
+	ReqToCheck         *metrics.Counter // request with condition satisfied
+	TokenValid         *metrics.Counter // request with valid token
+	TokenMissing       *metrics.Counter // request without token
+	TokenInvalid       *metrics.Counter // request with malformed token or invalid signature
+	TokenExpired       *metrics.Counter // request with expired (or not yet valid) token
+	TokenClaimMismatch *metrics.Counter // request with unexpected issuer or audience
+}
+
+type ModuleAuthJwt struct {
+	name    string             // name of module
+	state   ModuleAuthJwtState // module state
+	metrics metrics.Metrics
+
+	confRoot        string            // root dir of config
+	productRulePath string            // path of jwt rule data file
+	ruleTable       *ProductRuleTable // table for product jwt rules
+}
+
+func NewModuleAuthJwt() *ModuleAuthJwt {
+	m := new(ModuleAuthJwt)
+	m.name = ModAuthJwt
+	m.metrics.Init(&m.state, ModAuthJwt, 0)
+
+	m.ruleTable = NewProductRuleTable()
+
+	return m
+}
+
+func (m *ModuleAuthJwt) Name() string {
+	return m.name
+}
+
+func (m *ModuleAuthJwt) State() interface{} {
+	return &m.state
+}
+
+// loadProductRuleConf load from config file, jwks files are reloaded too.
+func (m *ModuleAuthJwt) loadProductRuleConf(query url.Values) error {
+	// get path
+	path := query.Get("path")
+	if path == "" {
+		// use default
+		path = m.productRulePath
+	}
+
+	// load file
+	conf, err := ProductRuleConfLoad(path, m.confRoot)
+	if err != nil {
+		return fmt.Errorf("err in ProductRuleConfLoad(%s):%s", path, err)
+	}
+
+	m.ruleTable.Update(conf)
+	return nil
+}
+
+// getBearerToken gets token from Authorization header of request.
+func getBearerToken(req *bfe_basic.Request) (string, bool) {
+	auth := req.HttpRequest.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	token := strings.TrimSpace(auth[len(prefix):])
+	return token, len(token) != 0
+}
+
+// authenticate validates token with given rule.
+func authenticate(tokenStr string, rule *authJwtRule, now time.Time) (*Token, error) {
+	token, err := ParseToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = token.Verify(rule.Keys); err != nil {
+		return nil, err
+	}
+
+	if err = token.CheckClaims(rule.Issuer, rule.Audience, rule.ClockSkew, now); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// claimValue converts claim to value of header.
+func claimValue(claim interface{}) string {
+	switch v := claim.(type) {
+	case string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, claimValue(item))
+		}
+		return strings.Join(values, ",")
+	case map[string]interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// setClaimHeaders passes claims to backend by request headers.
+func setClaimHeaders(req *bfe_basic.Request, rule *authJwtRule, token *Token) {
+	header := req.HttpRequest.Header
+	for claim, name := range rule.ClaimHeaders {
+		// remove header provided by client
+		header.Del(name)
+
+		value, ok := token.Claims[claim]
+		if !ok || value == nil {
+			continue
+		}
+		str := claimValue(value)
+		if strings.ContainsAny(str, "\r\n") {
+			continue
+		}
+		header.Set(name, str)
+	}
+}
+
+// createUnauthorizedResp creates 401 response with WWW-Authenticate header.
+func createUnauthorizedResp(req *bfe_basic.Request, rule *authJwtRule, found bool) *bfe_http.Response {
+	res := bfe_basic.CreateInternalResp(req, bfe_http.StatusUnauthorized)
+	if found {
+		res.Header.Set("WWW-Authenticate",
+			fmt.Sprintf("Bearer realm=\"%s\", error=\"invalid_token\"", rule.Realm))
+	} else {
+		res.Header.Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=\"%s\"", rule.Realm))
+	}
+	return res
+}
+
+// updateFailState updates module state for given validation error.
+func (m *ModuleAuthJwt) updateFailState(err error) {
+	switch err {
+	case errTokenExpired, errTokenNotValidYet:
+		m.state.TokenExpired.Inc(1)
+	case errTokenIssuer, errTokenAudience:
+		m.state.TokenClaimMismatch.Inc(1)
+	default:
+		m.state.TokenInvalid.Inc(1)
+	}
+}
+
+// authHandler is a handler for validating jwt of request.
+func (m *ModuleAuthJwt) authHandler(req *bfe_basic.Request) (int, *bfe_http.Response) {
+	m.state.ReqTotal.Inc(1)
+
+	// find jwt rules for given request
+	rules, ok := m.ruleTable.Search(req.Route.Product)
+	if !ok {
+		if openDebug {
+			log.Logger.Debug("%s product %s not found, just pass",
+				m.name, req.Route.Product)
+		}
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	for i := range *rules {
+		rule := &(*rules)[i]
+		if !rule.Cond.Match(req) {
+			continue
+		}
+		m.state.ReqToCheck.Inc(1)
+
+		tokenStr, found := getBearerToken(req)
+		if !found {
+			m.state.TokenMissing.Inc(1)
+			if openDebug {
+				log.Logger.Debug("%s no token (remote:%s)", m.name, req.RemoteAddr)
+			}
+			req.ErrCode = ERR_AUTH_JWT
+			return bfe_module.BFE_HANDLER_RESPONSE, createUnauthorizedResp(req, rule, false)
+		}
+
+		token, err := authenticate(tokenStr, rule, time.Now())
+		if err != nil {
+			m.updateFailState(err)
+			if openDebug {
+				log.Logger.Debug("%s invalid token (remote:%s): %s", m.name, req.RemoteAddr, err)
+			}
+			req.ErrCode = ERR_AUTH_JWT
+			return bfe_module.BFE_HANDLER_RESPONSE, createUnauthorizedResp(req, rule, true)
+		}
+
+		m.state.TokenValid.Inc(1)
+		req.SetJwtClaims(token.Claims)
+		setClaimHeaders(req, rule, token)
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	return bfe_module.BFE_HANDLER_GOON, nil
+}
+
+func (m *ModuleAuthJwt) getState(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetAll()
+	return s.Format(params)
+}
+
+func (m *ModuleAuthJwt) getStateDiff(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetDiff()
+	return s.Format(params)
+}
+
+func (m *ModuleAuthJwt) monitorHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name:           m.getState,
+		m.name + ".diff": m.getStateDiff,
+	}
+	return handlers
+}
+
+func (m *ModuleAuthJwt) reloadHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name + ".product_rule_table": m.loadProductRuleConf,
+	}
+	return handlers
+}
+
+func (m *ModuleAuthJwt) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHandlers,
+	cr string) error {
+	var conf *ConfModAuthJwt
+	var err error
+
+	// load module config
+	confPath := bfe_module.ModConfPath(cr, m.name)
+	if conf, err = ConfLoad(confPath, cr); err != nil {
+		return fmt.Errorf("%s: conf load err %s", m.name, err.Error())
+	}
+
+	m.confRoot = cr
+	m.productRulePath = conf.Basic.ProductRulePath
+	openDebug = conf.Log.OpenDebug
+
+	// load conf data
+	if err = m.loadProductRuleConf(nil); err != nil {
+		return fmt.Errorf("%s: loadProductRuleConf() err %s", m.name, err.Error())
+	}
+
+	// register handler, claims are set before route rules are matched
+	err = cbs.AddFilter(bfe_module.HANDLE_FOUND_PRODUCT, m.authHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.authHandler): %s", m.name, err.Error())
+	}
+
+	// register web handler for monitor
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_MONITOR, m.monitorHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.monitorHandlers): %s", m.name, err.Error())
+	}
+	// register web handler for reload
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_RELOAD, m.reloadHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.reloadHandlers): %s", m.name, err.Error())
+	}
+
+	return nil
+}
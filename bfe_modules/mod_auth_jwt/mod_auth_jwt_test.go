@@ -0,0 +1,203 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_auth_jwt
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_config/bfe_route_conf/host_rule_conf"
+	"github.com/baidu/bfe/bfe_config/bfe_route_conf/route_rule_conf"
+	"github.com/baidu/bfe/bfe_config/bfe_route_conf/vip_rule_conf"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+	"github.com/baidu/bfe/bfe_route"
+)
+
+func prepareModule(t *testing.T) *ModuleAuthJwt {
+	m := NewModuleAuthJwt()
+	err := m.Init(bfe_module.NewBfeCallbacks(), web_monitor.NewWebHandlers(), "./testdata")
+	if err != nil {
+		t.Fatalf("Init(): %s", err)
+	}
+	return m
+}
+
+func prepareRequest(path string, token string) *bfe_basic.Request {
+	request := new(bfe_basic.Request)
+	request.HttpRequest = new(bfe_http.Request)
+	request.HttpRequest.Header = make(bfe_http.Header)
+	request.HttpRequest.URL, _ = url.Parse(path)
+	request.Session = new(bfe_basic.Session)
+	request.Context = make(map[interface{}]interface{})
+	request.Route = bfe_basic.RequestRoute{Product: "pn"}
+	if len(token) != 0 {
+		request.HttpRequest.Header.Set("Authorization", "Bearer "+token)
+	}
+	return request
+}
+
+func checkUnauthorized(t *testing.T, ret int, res *bfe_http.Response, challenge string) {
+	if ret != bfe_module.BFE_HANDLER_RESPONSE || res == nil {
+		t.Fatalf("authHandler() should return response")
+	}
+	if res.StatusCode != bfe_http.StatusUnauthorized {
+		t.Errorf("status code should be 401, got %d", res.StatusCode)
+	}
+	if res.Header.Get("WWW-Authenticate") != challenge {
+		t.Errorf("WWW-Authenticate should be %s, got %s", challenge, res.Header.Get("WWW-Authenticate"))
+	}
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":    "https://auth.example.org",
+		"aud":    "api",
+		"sub":    "alice",
+		"groups": []string{"dev", "ops"},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestAuthHandler(t *testing.T) {
+	m := prepareModule(t)
+
+	// condition not satisfied
+	req := prepareRequest("/index.html", "")
+	if ret, _ := m.authHandler(req); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("authHandler() should return GOON")
+	}
+
+	// no token
+	req = prepareRequest("/api/v1/status", "")
+	ret, res := m.authHandler(req)
+	checkUnauthorized(t, ret, res, "Bearer realm=\"api\"")
+	if req.ErrCode != ERR_AUTH_JWT {
+		t.Errorf("ErrCode should be ERR_AUTH_JWT")
+	}
+
+	// malformed token
+	req = prepareRequest("/api/v1/status", "abc")
+	ret, res = m.authHandler(req)
+	checkUnauthorized(t, ret, res, "Bearer realm=\"api\", error=\"invalid_token\"")
+
+	// expired token
+	claims := validClaims()
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	req = prepareRequest("/api/v1/status", signToken(t, AlgRS256, "rsa-1", claims))
+	ret, res = m.authHandler(req)
+	checkUnauthorized(t, ret, res, "Bearer realm=\"api\", error=\"invalid_token\"")
+
+	// audience mismatch
+	claims = validClaims()
+	claims["aud"] = "web"
+	req = prepareRequest("/api/v1/status", signToken(t, AlgES256, "ec-1", claims))
+	ret, res = m.authHandler(req)
+	checkUnauthorized(t, ret, res, "Bearer realm=\"api\", error=\"invalid_token\"")
+
+	// valid token, spoofed claim header is overwritten
+	req = prepareRequest("/api/v1/status", signToken(t, AlgES256, "ec-1", validClaims()))
+	req.HttpRequest.Header.Set("X-Jwt-Sub", "root")
+	if ret, _ = m.authHandler(req); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Fatalf("authHandler() should return GOON")
+	}
+	if sub := req.HttpRequest.Header.Get("X-Jwt-Sub"); sub != "alice" {
+		t.Errorf("X-Jwt-Sub should be alice, got %s", sub)
+	}
+	if groups := req.HttpRequest.Header.Get("X-Jwt-Groups"); groups != "dev,ops" {
+		t.Errorf("X-Jwt-Groups should be dev,ops, got %s", groups)
+	}
+	if claims := req.JwtClaims(); claims == nil || claims["sub"] != "alice" {
+		t.Errorf("jwt claims should be saved in request context")
+	}
+
+	if m.state.ReqToCheck.Get() != 5 || m.state.TokenMissing.Get() != 1 ||
+		m.state.TokenInvalid.Get() != 1 || m.state.TokenExpired.Get() != 1 ||
+		m.state.TokenClaimMismatch.Get() != 1 || m.state.TokenValid.Get() != 1 {
+		t.Errorf("unexpected state: %+v", m.state)
+	}
+}
+
+func TestGetBearerToken(t *testing.T) {
+	cases := []struct {
+		auth  string
+		token string
+		found bool
+	}{
+		{"Bearer abc", "abc", true},
+		{"bearer abc", "abc", true},
+		{"Bearer ", "", false},
+		{"Basic YWxpY2U6c2VjcmV0", "", false},
+		{"", "", false},
+	}
+
+	for _, c := range cases {
+		req := prepareRequest("/", "")
+		req.HttpRequest.Header.Set("Authorization", c.auth)
+		token, found := getBearerToken(req)
+		if token != c.token || found != c.found {
+			t.Errorf("getBearerToken(%q) should return (%s, %v), got (%s, %v)",
+				c.auth, c.token, c.found, token, found)
+		}
+	}
+}
+
+func TestRouteByClaims(t *testing.T) {
+	cbs := bfe_module.NewBfeCallbacks()
+	m := NewModuleAuthJwt()
+	if err := m.Init(cbs, web_monitor.NewWebHandlers(), "./testdata"); err != nil {
+		t.Fatalf("Init(): %s", err)
+	}
+
+	routeConf, err := route_rule_conf.RouteConfLoad("./testdata/route_rule.data")
+	if err != nil {
+		t.Fatalf("RouteConfLoad(): %s", err)
+	}
+	var hostTable bfe_route.HostTable
+	hostTable.Update(host_rule_conf.HostConf{}, vip_rule_conf.VipConf{}, routeConf)
+
+	cases := []struct {
+		tenant  string
+		cluster string
+	}{
+		{"acme", "cluster_acme"},
+		{"other", "cluster_default"},
+	}
+	for _, c := range cases {
+		claims := validClaims()
+		claims["tenant"] = c.tenant
+		req := prepareRequest("/api/v1/status", signToken(t, AlgES256, "ec-1", claims))
+
+		// claims are set at HANDLE_FOUND_PRODUCT, before route rules are matched
+		ret, _ := cbs.GetHandlerList(bfe_module.HANDLE_FOUND_PRODUCT).FilterRequest(req)
+		if ret != bfe_module.BFE_HANDLER_GOON {
+			t.Fatalf("FilterRequest() should return GOON")
+		}
+		if err := hostTable.LookupCluster(req); err != nil {
+			t.Fatalf("LookupCluster(): %s", err)
+		}
+		if req.Route.ClusterName != c.cluster {
+			t.Errorf("tenant %s should be routed to %s, got %s", c.tenant, c.cluster, req.Route.ClusterName)
+		}
+	}
+}
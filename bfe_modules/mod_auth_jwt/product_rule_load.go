@@ -0,0 +1,263 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_auth_jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic/condition"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_util"
+)
+
+const (
+	DefaultRealm = "bfe"
+)
+
+type authJwtRuleFile struct {
+	Cond         *string           // condition for jwt validation
+	KeyFile      *string           // path of jwks file
+	Issuer       *string           // expected issuer (iss), optional
+	Audience     *string           // expected audience (aud), optional
+	ClockSkew    *int              // allowed clock skew in seconds for exp/nbf, optional
+	ClaimHeaders map[string]string // claim => request header to pass claim to backend, optional
+	Realm        *string           // realm in WWW-Authenticate header, optional
+}
+
+type authJwtRule struct {
+	Cond         condition.Condition // condition for jwt validation
+	Keys         *KeySet             // keys for verifying signature
+	Issuer       string              // expected issuer, empty means not checked
+	Audience     string              // expected audience, empty means not checked
+	ClockSkew    time.Duration       // allowed clock skew
+	ClaimHeaders map[string]string   // claim => request header
+	Realm        string              // realm in WWW-Authenticate header
+}
+
+type authJwtRuleFileList []authJwtRuleFile
+type authJwtRuleList []authJwtRule
+
+type ProductRulesFile map[string]*authJwtRuleFileList // product => list of jwt rules
+type ProductRules map[string]*authJwtRuleList
+
+type productRuleConfFile struct {
+	Version *string // version of the config
+	Config  *ProductRulesFile
+}
+
+type productRuleConf struct {
+	Version string       // version of the config
+	Config  ProductRules // product rules for jwt validation
+}
+
+func authJwtRuleCheck(conf authJwtRuleFile) error {
+	// check Cond
+	if conf.Cond == nil {
+		return errors.New("no Cond")
+	}
+
+	// check KeyFile
+	if conf.KeyFile == nil || len(*conf.KeyFile) == 0 {
+		return errors.New("no KeyFile")
+	}
+
+	// check ClockSkew
+	if conf.ClockSkew != nil && *conf.ClockSkew < 0 {
+		return fmt.Errorf("invalid ClockSkew: %d", *conf.ClockSkew)
+	}
+
+	// check ClaimHeaders
+	for claim, header := range conf.ClaimHeaders {
+		if len(claim) == 0 || len(header) == 0 {
+			return fmt.Errorf("invalid ClaimHeaders: %s => %s", claim, header)
+		}
+	}
+
+	// check Realm
+	if conf.Realm != nil && strings.ContainsAny(*conf.Realm, "\"\\\r\n") {
+		return fmt.Errorf("invalid Realm: %s", *conf.Realm)
+	}
+
+	return nil
+}
+
+func authJwtRuleListCheck(conf *authJwtRuleFileList) error {
+	for index, rule := range *conf {
+		err := authJwtRuleCheck(rule)
+		if err != nil {
+			return fmt.Errorf("authJwtRule:%d, %s", index, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRulesCheck(conf *ProductRulesFile) error {
+	for product, ruleList := range *conf {
+		if ruleList == nil {
+			return fmt.Errorf("no authJwtRuleList for product:%s", product)
+		}
+
+		err := authJwtRuleListCheck(ruleList)
+		if err != nil {
+			return fmt.Errorf("ProductRules:%s, %s", product, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRuleConfCheck(conf productRuleConfFile) error {
+	var err error
+
+	// check Version
+	if conf.Version == nil {
+		return errors.New("no Version")
+	}
+
+	// check Config
+	if conf.Config == nil {
+		return errors.New("no Config")
+	}
+
+	err = productRulesCheck(conf.Config)
+	if err != nil {
+		return fmt.Errorf("Config:%s", err.Error())
+	}
+
+	return nil
+}
+
+// keySetCache avoids loading the same jwks file more than once
+type keySetCache struct {
+	confRoot string
+	keySets  map[string]*KeySet
+}
+
+func (c *keySetCache) keySet(path string) (*KeySet, error) {
+	path = bfe_util.ConfPathProc(path, c.confRoot)
+	if keys, ok := c.keySets[path]; ok {
+		return keys, nil
+	}
+
+	keys, err := KeySetLoad(path)
+	if err != nil {
+		return nil, fmt.Errorf("KeySetLoad(%s): %s", path, err)
+	}
+	c.keySets[path] = keys
+	return keys, nil
+}
+
+func ruleConvert(ruleFile authJwtRuleFile, keySets *keySetCache, product string) (authJwtRule, error) {
+	var err error
+	rule := authJwtRule{}
+
+	rule.Cond, err = condition.BuildWithProduct(*ruleFile.Cond, product)
+	if err != nil {
+		return rule, err
+	}
+
+	rule.Keys, err = keySets.keySet(*ruleFile.KeyFile)
+	if err != nil {
+		return rule, err
+	}
+
+	if ruleFile.Issuer != nil {
+		rule.Issuer = *ruleFile.Issuer
+	}
+	if ruleFile.Audience != nil {
+		rule.Audience = *ruleFile.Audience
+	}
+	if ruleFile.ClockSkew != nil {
+		rule.ClockSkew = time.Duration(*ruleFile.ClockSkew) * time.Second
+	}
+
+	rule.ClaimHeaders = make(map[string]string)
+	for claim, header := range ruleFile.ClaimHeaders {
+		rule.ClaimHeaders[claim] = bfe_http.CanonicalHeaderKey(header)
+	}
+
+	rule.Realm = DefaultRealm
+	if ruleFile.Realm != nil {
+		rule.Realm = *ruleFile.Realm
+	}
+
+	return rule, nil
+}
+
+func ruleListConvert(ruleFileList *authJwtRuleFileList, keySets *keySetCache, product string) (*authJwtRuleList, error) {
+	ruleList := new(authJwtRuleList)
+	*ruleList = make([]authJwtRule, 0)
+
+	for _, ruleFile := range *ruleFileList {
+		rule, err := ruleConvert(ruleFile, keySets, product)
+		if err != nil {
+			return nil, err
+		}
+		*ruleList = append(*ruleList, rule)
+	}
+
+	return ruleList, nil
+}
+
+// ProductRuleConfLoad load jwt rule config from file, together with
+// jwks files referenced by rules. Relative path of jwks file is
+// relative to confRoot.
+func ProductRuleConfLoad(filename string, confRoot string) (productRuleConf, error) {
+	var conf productRuleConf
+	var err error
+
+	// open the file
+	file, err := os.Open(filename)
+	if err != nil {
+		return conf, err
+	}
+	defer file.Close()
+
+	// decode the file
+	decoder := json.NewDecoder(file)
+	var config productRuleConfFile
+	err = decoder.Decode(&config)
+	if err != nil {
+		return conf, err
+	}
+
+	// check config
+	err = productRuleConfCheck(config)
+	if err != nil {
+		return conf, err
+	}
+
+	// convert config
+	keySets := &keySetCache{confRoot: confRoot, keySets: make(map[string]*KeySet)}
+	conf.Version = *config.Version
+	conf.Config = make(ProductRules)
+	for product, ruleFileList := range *config.Config {
+		ruleList, err := ruleListConvert(ruleFileList, keySets, product)
+		if err != nil {
+			return conf, err
+		}
+		conf.Config[product] = ruleList
+	}
+
+	return conf, nil
+}
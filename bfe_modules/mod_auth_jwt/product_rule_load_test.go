@@ -0,0 +1,60 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_auth_jwt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuthJwtRuleConfLoad(t *testing.T) {
+	config, err := ProductRuleConfLoad("./testdata/auth_jwt_rules_1.data", "./testdata")
+	if err != nil {
+		t.Fatalf("get err from ProductRuleConfLoad():%s", err.Error())
+	}
+
+	rules := *config.Config["pn"]
+	if len(rules) != 2 {
+		t.Fatalf("len(config.Config['pn']) should be 2")
+	}
+
+	if rules[0].Issuer != "https://auth.example.org" || rules[0].Audience != "api" ||
+		rules[0].ClockSkew != 30*time.Second || rules[0].Realm != DefaultRealm ||
+		rules[0].ClaimHeaders["sub"] != "X-Jwt-Sub" {
+		t.Errorf("unexpected rule 0: %+v", rules[0])
+	}
+	if rules[1].Issuer != "" || rules[1].Audience != "" || rules[1].Realm != "admin" {
+		t.Errorf("unexpected rule 1: %+v", rules[1])
+	}
+
+	// jwks file is loaded only once
+	if rules[0].Keys != rules[1].Keys {
+		t.Errorf("key set should be shared by rules")
+	}
+}
+
+func TestAuthJwtRuleConfLoadInvalid(t *testing.T) {
+	files := []string{
+		"./testdata/auth_jwt_rules_2.data", // no KeyFile
+		"./testdata/auth_jwt_rules_3.data", // invalid jwks file
+		"./testdata/auth_jwt_rules_4.data", // negative ClockSkew
+	}
+
+	for _, file := range files {
+		if _, err := ProductRuleConfLoad(file, "./testdata"); err == nil {
+			t.Errorf("err should not be nil for %s", file)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// LRU cache for auth results
+
+package mod_auth_request
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_http"
+)
+
+// authResult is result of auth request.
+type authResult struct {
+	statusCode int             // status code of auth response
+	header     bfe_http.Header // header of auth response
+	body       []byte          // body of auth response, only kept for denied request
+}
+
+type cacheEntry struct {
+	key        string
+	result     *authResult
+	expireTime time.Time
+}
+
+// AuthCache is a LRU cache for auth results, bounded by number of entries.
+type AuthCache struct {
+	lock       sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List // front is most recently used
+}
+
+// NewAuthCache creates AuthCache with at most maxEntries entries.
+func NewAuthCache(maxEntries int) *AuthCache {
+	c := new(AuthCache)
+	c.maxEntries = maxEntries
+	c.entries = make(map[string]*list.Element)
+	c.lru = list.New()
+	return c
+}
+
+// Get gets unexpired result for key.
+func (c *AuthCache) Get(key string, now time.Time) (*authResult, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if !now.Before(entry.expireTime) {
+		c.remove(elem)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	return entry.result, true
+}
+
+// Set adds result for key, least recently used entry is evicted if
+// number of entries exceeds limit.
+func (c *AuthCache) Set(key string, result *authResult, expireTime time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+
+	for c.lru.Len() >= c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+
+	entry := &cacheEntry{key: key, result: result, expireTime: expireTime}
+	c.entries[key] = c.lru.PushFront(entry)
+}
+
+// Clear deletes all entries.
+func (c *AuthCache) Clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// Len returns number of entries.
+func (c *AuthCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.lru.Len()
+}
+
+func (c *AuthCache) remove(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	c.lru.Remove(elem)
+	delete(c.entries, entry.key)
+}
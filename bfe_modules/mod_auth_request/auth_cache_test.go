@@ -0,0 +1,55 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_auth_request
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuthCache(t *testing.T) {
+	c := NewAuthCache(2)
+	now := time.Now()
+
+	c.Set("a", &authResult{statusCode: 200}, now.Add(time.Second))
+	c.Set("b", &authResult{statusCode: 401}, now.Add(time.Second))
+
+	// a becomes most recently used
+	if result, ok := c.Get("a", now); !ok || result.statusCode != 200 {
+		t.Errorf("a should be found")
+	}
+
+	// b is evicted
+	c.Set("c", &authResult{statusCode: 403}, now.Add(time.Second))
+	if _, ok := c.Get("b", now); ok {
+		t.Errorf("b should be evicted")
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() should be 2, got %d", c.Len())
+	}
+
+	// a is expired
+	if _, ok := c.Get("a", now.Add(time.Second)); ok {
+		t.Errorf("a should be expired")
+	}
+	if c.Len() != 1 {
+		t.Errorf("Len() should be 1, got %d", c.Len())
+	}
+
+	c.Clear()
+	if _, ok := c.Get("c", now); ok || c.Len() != 0 {
+		t.Errorf("cache should be empty after Clear()")
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// module for authorization by sub-request to auth service
+
+package mod_auth_request
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"time"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/web-monitor/metrics"
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+const (
+	ModAuthRequest = "mod_auth_request"
+)
+
+const (
+	// max size of auth response body returned to client
+	maxAuthBodySize = 64 * 1024
+)
+
+var (
+	ERR_AUTH_REQUEST = errors.New("AUTH_REQUEST")
+)
+
+var (
+	openDebug = false
+)
+
+// headers of auth response not returned to client
+var skipHeaders = []string{
+	"Connection",
+	"Content-Length",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Te",
+	"Trailers",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+type ModuleAuthRequestState struct {
+	ReqTotal   *metrics.Counter // all request in
+	ReqToCheck *metrics.Counter // request with condition satisfied
+	AuthAllow  *metrics.Counter // request allowed by auth service
+	AuthDeny   *metrics.Counter // request denied by auth service
+	AuthError  *metrics.Counter // request failed to check by auth service
+	CacheHit   *metrics.Counter // auth result found in cache
+	CacheMiss  *metrics.Counter // auth result not found in cache
+}
+
+type ModuleAuthRequest struct {
+	name    string                 // name of module
+	state   ModuleAuthRequestState // module state
+	metrics metrics.Metrics
+
+	productRulePath string                    // path of auth request rule data file
+	ruleTable       *ProductRuleTable         // table for product auth request rules
+	cache           *AuthCache                // cache for auth results
+	invoker         bfe_module.ClusterInvoker // invoker for sending sub-request
+}
+
+func NewModuleAuthRequest() *ModuleAuthRequest {
+	m := new(ModuleAuthRequest)
+	m.name = ModAuthRequest
+	m.metrics.Init(&m.state, ModAuthRequest, 0)
+
+	m.ruleTable = NewProductRuleTable()
+
+	return m
+}
+
+func (m *ModuleAuthRequest) Name() string {
+	return m.name
+}
+
+func (m *ModuleAuthRequest) State() interface{} {
+	return &m.state
+}
+
+// SetClusterInvoker sets invoker for sending sub-request to auth service.
+func (m *ModuleAuthRequest) SetClusterInvoker(invoker bfe_module.ClusterInvoker) {
+	m.invoker = invoker
+}
+
+// loadProductRuleConf load from config file, cached auth results are cleared.
+func (m *ModuleAuthRequest) loadProductRuleConf(query url.Values) error {
+	// get path
+	path := query.Get("path")
+	if path == "" {
+		// use default
+		path = m.productRulePath
+	}
+
+	// load file
+	conf, err := ProductRuleConfLoad(path)
+	if err != nil {
+		return fmt.Errorf("err in ProductRuleConfLoad(%s):%s", path, err)
+	}
+
+	m.ruleTable.Update(conf)
+	if m.cache != nil {
+		m.cache.Clear()
+	}
+	return nil
+}
+
+// newAuthRequest creates sub-request with method, path and selected headers
+// of original request.
+func newAuthRequest(req *bfe_basic.Request, rule *authRequestRule) *bfe_http.Request {
+	httpReq := req.HttpRequest
+
+	outreq := new(bfe_http.Request)
+	outreq.Method = httpReq.Method
+	outreq.URL = &url.URL{
+		Path:     httpReq.URL.Path,
+		RawPath:  httpReq.URL.RawPath,
+		RawQuery: httpReq.URL.RawQuery,
+	}
+	outreq.Proto = "HTTP/1.1"
+	outreq.ProtoMajor = 1
+	outreq.ProtoMinor = 1
+	outreq.Host = httpReq.Host
+	outreq.Header = make(bfe_http.Header)
+	outreq.State = new(bfe_http.RequestState)
+
+	for _, key := range rule.ForwardHeaders {
+		if values, ok := httpReq.Header[key]; ok {
+			outreq.Header[key] = append([]string(nil), values...)
+		}
+	}
+
+	return outreq
+}
+
+// cacheKey returns key of auth result for given sub-request.
+func cacheKey(req *bfe_basic.Request, rule *authRequestRule, outreq *bfe_http.Request) string {
+	h := sha256.New()
+	for _, s := range []string{req.Route.Product, rule.Cluster, outreq.Method,
+		outreq.Host, outreq.URL.RequestURI()} {
+		io.WriteString(h, s)
+		h.Write([]byte{0})
+	}
+	for _, key := range rule.ForwardHeaders {
+		io.WriteString(h, key)
+		h.Write([]byte{0})
+		for _, value := range outreq.Header[key] {
+			io.WriteString(h, value)
+			h.Write([]byte{0})
+		}
+	}
+	return string(h.Sum(nil))
+}
+
+// invokeAuth sends sub-request to auth service and returns auth result.
+func (m *ModuleAuthRequest) invokeAuth(req *bfe_basic.Request, rule *authRequestRule,
+	outreq *bfe_http.Request) (*authResult, error) {
+	if m.invoker == nil {
+		return nil, errors.New("no cluster invoker")
+	}
+
+	res, err := m.invoker.InvokeCluster(rule.Cluster, req, outreq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	result := &authResult{statusCode: res.StatusCode, header: make(bfe_http.Header)}
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		// only keep headers copied to upstream request
+		for _, key := range rule.UpstreamHeaders {
+			if values, ok := res.Header[key]; ok {
+				result.header[key] = values
+			}
+		}
+		io.Copy(ioutil.Discard, io.LimitReader(res.Body, maxAuthBodySize))
+
+	case res.StatusCode == bfe_http.StatusUnauthorized || res.StatusCode == bfe_http.StatusForbidden:
+		for key, values := range res.Header {
+			result.header[key] = values
+		}
+		for _, key := range skipHeaders {
+			result.header.Del(key)
+		}
+		result.body, err = ioutil.ReadAll(io.LimitReader(res.Body, maxAuthBodySize))
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unexpected status code of auth response: %d", res.StatusCode)
+	}
+
+	return result, nil
+}
+
+// authCheck gets auth result from cache, or from auth service.
+func (m *ModuleAuthRequest) authCheck(req *bfe_basic.Request, rule *authRequestRule) (*authResult, error) {
+	outreq := newAuthRequest(req, rule)
+
+	var key string
+	if rule.CacheTTL > 0 {
+		key = cacheKey(req, rule, outreq)
+		if result, ok := m.cache.Get(key, time.Now()); ok {
+			m.state.CacheHit.Inc(1)
+			return result, nil
+		}
+		m.state.CacheMiss.Inc(1)
+	}
+
+	result, err := m.invokeAuth(req, rule, outreq)
+	if err != nil {
+		return nil, err
+	}
+
+	if rule.CacheTTL > 0 {
+		m.cache.Set(key, result, time.Now().Add(rule.CacheTTL))
+	}
+	return result, nil
+}
+
+// createDenyResp creates response from auth result for denied request.
+func createDenyResp(req *bfe_basic.Request, result *authResult) *bfe_http.Response {
+	res := bfe_basic.CreateInternalResp(req, result.statusCode)
+	for key, values := range result.header {
+		res.Header[key] = append([]string(nil), values...)
+	}
+	if len(result.body) != 0 {
+		res.ContentLength = int64(len(result.body))
+		res.Body = ioutil.NopCloser(bytes.NewReader(result.body))
+	}
+	return res
+}
+
+// authHandler is a handler for authorizing request by auth service.
+func (m *ModuleAuthRequest) authHandler(req *bfe_basic.Request) (int, *bfe_http.Response) {
+	m.state.ReqTotal.Inc(1)
+
+	// find auth request rules for given request
+	rules, ok := m.ruleTable.Search(req.Route.Product)
+	if !ok {
+		if openDebug {
+			log.Logger.Debug("%s product %s not found, just pass",
+				m.name, req.Route.Product)
+		}
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	for i := range *rules {
+		rule := &(*rules)[i]
+		if !rule.Cond.Match(req) {
+			continue
+		}
+		m.state.ReqToCheck.Inc(1)
+
+		result, err := m.authCheck(req, rule)
+		if err != nil {
+			m.state.AuthError.Inc(1)
+			log.Logger.Info("%s auth request to %s failed: %s", m.name, rule.Cluster, err)
+			req.ErrCode = ERR_AUTH_REQUEST
+			req.ErrMsg = err.Error()
+			return bfe_module.BFE_HANDLER_RESPONSE, bfe_basic.CreateInternalSrvErrResp(req)
+		}
+
+		if result.statusCode >= 200 && result.statusCode < 300 {
+			m.state.AuthAllow.Inc(1)
+			// headers provided by client are removed
+			for _, key := range rule.UpstreamHeaders {
+				req.HttpRequest.Header.Del(key)
+				if values, ok := result.header[key]; ok {
+					req.HttpRequest.Header[key] = append([]string(nil), values...)
+				}
+			}
+			return bfe_module.BFE_HANDLER_GOON, nil
+		}
+
+		m.state.AuthDeny.Inc(1)
+		if openDebug {
+			log.Logger.Debug("%s request denied (remote:%s, status:%d)",
+				m.name, req.RemoteAddr, result.statusCode)
+		}
+		req.ErrCode = ERR_AUTH_REQUEST
+		return bfe_module.BFE_HANDLER_RESPONSE, createDenyResp(req, result)
+	}
+
+	return bfe_module.BFE_HANDLER_GOON, nil
+}
+
+func (m *ModuleAuthRequest) getState(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetAll()
+	return s.Format(params)
+}
+
+func (m *ModuleAuthRequest) getStateDiff(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetDiff()
+	return s.Format(params)
+}
+
+func (m *ModuleAuthRequest) monitorHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name:           m.getState,
+		m.name + ".diff": m.getStateDiff,
+	}
+	return handlers
+}
+
+func (m *ModuleAuthRequest) reloadHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name + ".product_rule_table": m.loadProductRuleConf,
+	}
+	return handlers
+}
+
+func (m *ModuleAuthRequest) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHandlers,
+	cr string) error {
+	var conf *ConfModAuthRequest
+	var err error
+
+	// load module config
+	confPath := bfe_module.ModConfPath(cr, m.name)
+	if conf, err = ConfLoad(confPath, cr); err != nil {
+		return fmt.Errorf("%s: conf load err %s", m.name, err.Error())
+	}
+
+	m.productRulePath = conf.Basic.ProductRulePath
+	m.cache = NewAuthCache(conf.Basic.CacheMaxEntries)
+	openDebug = conf.Log.OpenDebug
+
+	// load conf data
+	if err = m.loadProductRuleConf(nil); err != nil {
+		return fmt.Errorf("%s: loadProductRuleConf() err %s", m.name, err.Error())
+	}
+
+	// register handler
+	err = cbs.AddFilter(bfe_module.HANDLE_FOUND_PRODUCT, m.authHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.authHandler): %s", m.name, err.Error())
+	}
+
+	// register web handler for monitor
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_MONITOR, m.monitorHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.monitorHandlers): %s", m.name, err.Error())
+	}
+	// register web handler for reload
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_RELOAD, m.reloadHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.reloadHandlers): %s", m.name, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_auth_request
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+// fakeInvoker is an auth service for test
+type fakeInvoker struct {
+	calls  int
+	outreq *bfe_http.Request
+}
+
+func (f *fakeInvoker) InvokeCluster(cluster string, req *bfe_basic.Request,
+	outreq *bfe_http.Request) (*bfe_http.Response, error) {
+	f.calls++
+	f.outreq = outreq
+
+	res := new(bfe_http.Response)
+	res.Header = make(bfe_http.Header)
+	res.Body = ioutil.NopCloser(strings.NewReader(""))
+
+	switch outreq.Header.Get("Authorization") {
+	case "":
+		res.StatusCode = bfe_http.StatusUnauthorized
+		res.Header.Set("WWW-Authenticate", "Bearer realm=\"auth\"")
+		res.Header.Set("Connection", "keep-alive")
+		res.Body = ioutil.NopCloser(strings.NewReader("login required"))
+	case "Bearer alice":
+		res.StatusCode = bfe_http.StatusOK
+		res.Header.Set("X-Auth-User", "alice")
+		res.Header.Set("X-Other", "other")
+	case "Bearer bob":
+		res.StatusCode = bfe_http.StatusForbidden
+	case "Bearer broken":
+		return nil, errors.New("connection refused")
+	default:
+		res.StatusCode = bfe_http.StatusInternalServerError
+	}
+	return res, nil
+}
+
+func prepareModule(t *testing.T) (*ModuleAuthRequest, *fakeInvoker) {
+	m := NewModuleAuthRequest()
+	invoker := new(fakeInvoker)
+	m.SetClusterInvoker(invoker)
+	err := m.Init(bfe_module.NewBfeCallbacks(), web_monitor.NewWebHandlers(), "./testdata")
+	if err != nil {
+		t.Fatalf("Init(): %s", err)
+	}
+	return m, invoker
+}
+
+func prepareRequest(path string, auth string) *bfe_basic.Request {
+	request := new(bfe_basic.Request)
+	request.HttpRequest = new(bfe_http.Request)
+	request.HttpRequest.Method = "POST"
+	request.HttpRequest.Host = "example.org"
+	request.HttpRequest.Header = make(bfe_http.Header)
+	request.HttpRequest.URL, _ = url.Parse(path)
+	request.Session = new(bfe_basic.Session)
+	request.Context = make(map[interface{}]interface{})
+	request.Route = bfe_basic.RequestRoute{Product: "pn"}
+	if len(auth) != 0 {
+		request.HttpRequest.Header.Set("Authorization", auth)
+	}
+	return request
+}
+
+func TestAuthHandlerAllow(t *testing.T) {
+	m, invoker := prepareModule(t)
+
+	req := prepareRequest("/api/v1/users?id=1", "Bearer alice")
+	req.HttpRequest.Header.Set("X-Auth-User", "root")
+	req.HttpRequest.Header.Set("X-Not-Forwarded", "1")
+	if ret, _ := m.authHandler(req); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Fatalf("authHandler() should return GOON")
+	}
+
+	// check sub-request
+	outreq := invoker.outreq
+	if outreq.Method != "POST" || outreq.Host != "example.org" ||
+		outreq.URL.RequestURI() != "/api/v1/users?id=1" {
+		t.Errorf("unexpected sub-request: %s %s %s", outreq.Method, outreq.Host, outreq.URL.RequestURI())
+	}
+	if outreq.Header.Get("Authorization") != "Bearer alice" || outreq.Header.Get("X-Not-Forwarded") != "" {
+		t.Errorf("unexpected header of sub-request: %v", outreq.Header)
+	}
+
+	// check headers copied to request
+	header := req.HttpRequest.Header
+	if header.Get("X-Auth-User") != "alice" || header.Get("X-Other") != "" {
+		t.Errorf("unexpected header of request: %v", header)
+	}
+
+	// spoofed header is removed, even if not returned by auth service
+	req = prepareRequest("/api/v1/users", "Bearer alice")
+	req.HttpRequest.Header.Set("X-Auth-User", "root")
+	invoker.calls = 0
+	m.authHandler(req)
+	if invoker.calls != 1 {
+		t.Errorf("auth service should be invoked if cache is disabled")
+	}
+
+	if m.state.AuthAllow.Get() != 2 {
+		t.Errorf("AuthAllow should be 2")
+	}
+}
+
+func TestAuthHandlerDeny(t *testing.T) {
+	m, _ := prepareModule(t)
+
+	// 401 is passed back
+	req := prepareRequest("/api/v1/users", "")
+	ret, res := m.authHandler(req)
+	if ret != bfe_module.BFE_HANDLER_RESPONSE || res.StatusCode != bfe_http.StatusUnauthorized {
+		t.Fatalf("authHandler() should return 401")
+	}
+	if res.Header.Get("WWW-Authenticate") != "Bearer realm=\"auth\"" || res.Header.Get("Connection") != "" {
+		t.Errorf("unexpected header of response: %v", res.Header)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != "login required" {
+		t.Errorf("unexpected body of response: %s", body)
+	}
+	if req.ErrCode != ERR_AUTH_REQUEST {
+		t.Errorf("ErrCode should be ERR_AUTH_REQUEST")
+	}
+
+	// 403 is passed back
+	req = prepareRequest("/api/v1/users", "Bearer bob")
+	ret, res = m.authHandler(req)
+	if ret != bfe_module.BFE_HANDLER_RESPONSE || res.StatusCode != bfe_http.StatusForbidden {
+		t.Fatalf("authHandler() should return 403")
+	}
+
+	// error of auth service
+	for _, auth := range []string{"Bearer broken", "Bearer unknown"} {
+		req = prepareRequest("/api/v1/users", auth)
+		ret, res = m.authHandler(req)
+		if ret != bfe_module.BFE_HANDLER_RESPONSE || res.StatusCode != bfe_http.StatusInternalServerError {
+			t.Fatalf("authHandler() should return 500 for %s", auth)
+		}
+	}
+
+	if m.state.AuthDeny.Get() != 2 || m.state.AuthError.Get() != 2 {
+		t.Errorf("unexpected state: %+v", m.state)
+	}
+}
+
+func TestAuthHandlerCache(t *testing.T) {
+	m, invoker := prepareModule(t)
+
+	for i := 0; i < 3; i++ {
+		req := prepareRequest("/cached/a", "Bearer alice")
+		if ret, _ := m.authHandler(req); ret != bfe_module.BFE_HANDLER_GOON {
+			t.Fatalf("authHandler() should return GOON")
+		}
+		if req.HttpRequest.Header.Get("X-Auth-User") != "alice" {
+			t.Errorf("X-Auth-User should be alice")
+		}
+	}
+	if invoker.calls != 1 {
+		t.Errorf("auth service should be invoked once, got %d", invoker.calls)
+	}
+
+	// different key
+	req := prepareRequest("/cached/a", "Bearer bob")
+	if ret, _ := m.authHandler(req); ret != bfe_module.BFE_HANDLER_RESPONSE {
+		t.Fatalf("authHandler() should return RESPONSE")
+	}
+	if invoker.calls != 2 {
+		t.Errorf("auth service should be invoked twice, got %d", invoker.calls)
+	}
+
+	if m.state.CacheHit.Get() != 2 || m.state.CacheMiss.Get() != 2 {
+		t.Errorf("unexpected state: %+v", m.state)
+	}
+
+	// cache is cleared after reload
+	if err := m.loadProductRuleConf(nil); err != nil {
+		t.Fatalf("loadProductRuleConf(): %s", err)
+	}
+	if m.cache.Len() != 0 {
+		t.Errorf("cache should be cleared after reload")
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_auth_request
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic/condition"
+	"github.com/baidu/bfe/bfe_http"
+)
+
+type authRequestRuleFile struct {
+	Cond            *string  // condition for auth request
+	Cluster         *string  // cluster of auth service
+	ForwardHeaders  []string // request headers sent to auth service, optional
+	UpstreamHeaders []string // headers of auth response copied to request, optional
+	CacheTTL        *int     // ttl (in seconds) of cached auth result, optional
+}
+
+type authRequestRule struct {
+	Cond            condition.Condition // condition for auth request
+	Cluster         string              // cluster of auth service
+	ForwardHeaders  []string            // request headers sent to auth service
+	UpstreamHeaders []string            // headers of auth response copied to request
+	CacheTTL        time.Duration       // ttl of cached auth result, 0 means no cache
+}
+
+type authRequestRuleFileList []authRequestRuleFile
+type authRequestRuleList []authRequestRule
+
+type ProductRulesFile map[string]*authRequestRuleFileList // product => list of auth request rules
+type ProductRules map[string]*authRequestRuleList
+
+type productRuleConfFile struct {
+	Version *string // version of the config
+	Config  *ProductRulesFile
+}
+
+type productRuleConf struct {
+	Version string       // version of the config
+	Config  ProductRules // product rules for auth request
+}
+
+func authRequestRuleCheck(conf authRequestRuleFile) error {
+	// check Cond
+	if conf.Cond == nil {
+		return errors.New("no Cond")
+	}
+
+	// check Cluster
+	if conf.Cluster == nil || len(*conf.Cluster) == 0 {
+		return errors.New("no Cluster")
+	}
+
+	// check ForwardHeaders and UpstreamHeaders
+	for _, header := range conf.ForwardHeaders {
+		if len(header) == 0 {
+			return errors.New("empty header in ForwardHeaders")
+		}
+	}
+	for _, header := range conf.UpstreamHeaders {
+		if len(header) == 0 {
+			return errors.New("empty header in UpstreamHeaders")
+		}
+	}
+
+	// check CacheTTL
+	if conf.CacheTTL != nil && *conf.CacheTTL < 0 {
+		return fmt.Errorf("invalid CacheTTL: %d", *conf.CacheTTL)
+	}
+
+	return nil
+}
+
+func authRequestRuleListCheck(conf *authRequestRuleFileList) error {
+	for index, rule := range *conf {
+		err := authRequestRuleCheck(rule)
+		if err != nil {
+			return fmt.Errorf("authRequestRule:%d, %s", index, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRulesCheck(conf *ProductRulesFile) error {
+	for product, ruleList := range *conf {
+		if ruleList == nil {
+			return fmt.Errorf("no authRequestRuleList for product:%s", product)
+		}
+
+		err := authRequestRuleListCheck(ruleList)
+		if err != nil {
+			return fmt.Errorf("ProductRules:%s, %s", product, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRuleConfCheck(conf productRuleConfFile) error {
+	var err error
+
+	// check Version
+	if conf.Version == nil {
+		return errors.New("no Version")
+	}
+
+	// check Config
+	if conf.Config == nil {
+		return errors.New("no Config")
+	}
+
+	err = productRulesCheck(conf.Config)
+	if err != nil {
+		return fmt.Errorf("Config:%s", err.Error())
+	}
+
+	return nil
+}
+
+func canonicalHeaderKeys(headers []string) []string {
+	keys := make([]string, 0, len(headers))
+	for _, header := range headers {
+		keys = append(keys, bfe_http.CanonicalHeaderKey(header))
+	}
+	return keys
+}
+
+func ruleConvert(ruleFile authRequestRuleFile, product string) (authRequestRule, error) {
+	var err error
+	rule := authRequestRule{}
+
+	rule.Cond, err = condition.BuildWithProduct(*ruleFile.Cond, product)
+	if err != nil {
+		return rule, err
+	}
+
+	rule.Cluster = *ruleFile.Cluster
+	rule.ForwardHeaders = canonicalHeaderKeys(ruleFile.ForwardHeaders)
+	rule.UpstreamHeaders = canonicalHeaderKeys(ruleFile.UpstreamHeaders)
+	if ruleFile.CacheTTL != nil {
+		rule.CacheTTL = time.Duration(*ruleFile.CacheTTL) * time.Second
+	}
+
+	return rule, nil
+}
+
+func ruleListConvert(ruleFileList *authRequestRuleFileList, product string) (*authRequestRuleList, error) {
+	ruleList := new(authRequestRuleList)
+	*ruleList = make([]authRequestRule, 0)
+
+	for _, ruleFile := range *ruleFileList {
+		rule, err := ruleConvert(ruleFile, product)
+		if err != nil {
+			return nil, err
+		}
+		*ruleList = append(*ruleList, rule)
+	}
+
+	return ruleList, nil
+}
+
+// ProductRuleConfLoad load auth request rule config from file.
+func ProductRuleConfLoad(filename string) (productRuleConf, error) {
+	var conf productRuleConf
+	var err error
+
+	// open the file
+	file, err := os.Open(filename)
+	if err != nil {
+		return conf, err
+	}
+	defer file.Close()
+
+	// decode the file
+	decoder := json.NewDecoder(file)
+	var config productRuleConfFile
+	err = decoder.Decode(&config)
+	if err != nil {
+		return conf, err
+	}
+
+	// check config
+	err = productRuleConfCheck(config)
+	if err != nil {
+		return conf, err
+	}
+
+	// convert config
+	conf.Version = *config.Version
+	conf.Config = make(ProductRules)
+	for product, ruleFileList := range *config.Config {
+		ruleList, err := ruleListConvert(ruleFileList, product)
+		if err != nil {
+			return conf, err
+		}
+		conf.Config[product] = ruleList
+	}
+
+	return conf, nil
+}
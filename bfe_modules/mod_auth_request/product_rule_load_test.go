@@ -0,0 +1,55 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_auth_request
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuthRequestRuleConfLoad(t *testing.T) {
+	config, err := ProductRuleConfLoad("./testdata/mod_auth_request/auth_request_rules.data")
+	if err != nil {
+		t.Fatalf("get err from ProductRuleConfLoad():%s", err.Error())
+	}
+
+	rules := *config.Config["pn"]
+	if len(rules) != 2 {
+		t.Fatalf("len(config.Config['pn']) should be 2")
+	}
+
+	rule := rules[0]
+	if rule.Cluster != "cluster_auth" || rule.CacheTTL != 0 || len(rule.ForwardHeaders) != 2 ||
+		rule.ForwardHeaders[0] != "Authorization" || rule.UpstreamHeaders[0] != "X-Auth-User" {
+		t.Errorf("unexpected rule 0: %+v", rule)
+	}
+	if rules[1].CacheTTL != 10*time.Second {
+		t.Errorf("CacheTTL of rule 1 should be 10s")
+	}
+}
+
+func TestAuthRequestRuleConfLoadInvalid(t *testing.T) {
+	files := []string{
+		"./testdata/auth_request_rules_1.data", // no Cluster
+		"./testdata/auth_request_rules_2.data", // negative CacheTTL
+		"./testdata/auth_request_rules_3.data", // empty header
+	}
+
+	for _, file := range files {
+		if _, err := ProductRuleConfLoad(file); err == nil {
+			t.Errorf("err should not be nil for %s", file)
+		}
+	}
+}
@@ -17,6 +17,28 @@ package mod_block
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_util"
+)
+
+// commands of block action
+const (
+	ActionClose    = "CLOSE"    // close the connection
+	ActionResponse = "RESPONSE" // return response with content of local file
+	ActionRedirect = "REDIRECT" // redirect to location
+	ActionTag      = "TAG"      // tag request and pass, for dry run
+)
+
+const (
+	// max size of response file
+	maxFileSize = 1024 * 1024
 )
 
 type ActionFile struct {
@@ -27,6 +49,11 @@ type ActionFile struct {
 type Action struct {
 	Cmd    string   // command of action
 	Params []string // params of action
+
+	StatusCode  int    // status code of response, for RESPONSE
+	ContentType string // content type of response, for RESPONSE
+	Body        []byte // body of response, for RESPONSE
+	Location    string // location of redirect, for REDIRECT
 }
 
 func ActionFileCheck(conf *ActionFile) error {
@@ -39,7 +66,15 @@ func ActionFileCheck(conf *ActionFile) error {
 
 	// validate command, and get how many params should exist for each command
 	switch *conf.Cmd {
-	case "CLOSE":
+	case ActionClose:
+		paramsLenCheck = 0
+	case ActionResponse:
+		// params: status code, content type, file path
+		paramsLenCheck = 3
+	case ActionRedirect:
+		// params: location
+		paramsLenCheck = 1
+	case ActionTag:
 		paramsLenCheck = 0
 	default:
 		return fmt.Errorf("invalid cmd:%s", *conf.Cmd)
@@ -57,12 +92,65 @@ func ActionFileCheck(conf *ActionFile) error {
 		}
 	}
 
+	// check value of params
+	switch *conf.Cmd {
+	case ActionResponse:
+		code, err := strconv.Atoi(conf.Params[0])
+		if err != nil || code < 200 || code > 599 {
+			return fmt.Errorf("invalid status code:%s", conf.Params[0])
+		}
+		if len(conf.Params[1]) == 0 {
+			return errors.New("no content type")
+		}
+		if len(conf.Params[2]) == 0 {
+			return errors.New("no file path")
+		}
+	case ActionRedirect:
+		if len(conf.Params[0]) == 0 {
+			return errors.New("no location")
+		}
+		if _, err := url.Parse(conf.Params[0]); err != nil {
+			return fmt.Errorf("invalid location:%s", err)
+		}
+	}
+
 	return nil
 }
 
-func actionConvert(actionFile ActionFile) Action {
+// loadResponseFile loads content of response file. Relative path is
+// relative to confRoot.
+func loadResponseFile(path string, confRoot string) ([]byte, error) {
+	path = bfe_util.ConfPathProc(path, confRoot)
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() || fi.Size() > maxFileSize {
+		return nil, fmt.Errorf("%s is not a regular file or larger than %d bytes", path, maxFileSize)
+	}
+
+	return ioutil.ReadFile(path)
+}
+
+func actionConvert(actionFile ActionFile, confRoot string) (Action, error) {
+	var err error
 	action := Action{}
 	action.Cmd = *actionFile.Cmd
 	action.Params = actionFile.Params
-	return action
+
+	switch action.Cmd {
+	case ActionResponse:
+		action.StatusCode, _ = strconv.Atoi(action.Params[0])
+		action.ContentType = action.Params[1]
+		action.Body, err = loadResponseFile(action.Params[2], confRoot)
+		if err != nil {
+			return action, fmt.Errorf("load response file: %s", err)
+		}
+	case ActionRedirect:
+		action.StatusCode = bfe_http.StatusFound
+		action.Location = action.Params[0]
+	}
+
+	return action, nil
 }
@@ -27,6 +27,7 @@ type ConfModBlock struct {
 	Basic struct {
 		ProductRulePath string // path of product block rule data
 		IPBlacklistPath string // path of ip blacklist data
+		RuntimeApiToken string // token for runtime ip blacklist api, api is disabled if not set
 	}
 
 	Log struct {
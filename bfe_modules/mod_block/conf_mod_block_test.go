@@ -33,6 +33,9 @@ func Test_conf_mod_block_case1(t *testing.T) {
 	if config.Basic.IPBlacklistPath != "/home/bfe/conf/ip.data" {
 		t.Error("IPBlacklistPath should be /home/bfe/conf/ip.data")
 	}
+	if config.Basic.RuntimeApiToken != "test_token" {
+		t.Error("RuntimeApiToken should be test_token")
+	}
 }
 
 /* load config from config file    */
@@ -47,4 +50,7 @@ func Test_conf_mod_block_case2(t *testing.T) {
 	if config.Basic.IPBlacklistPath != "mod_block/ip_blacklist.data" {
 		t.Error("IPBlacklistPath should be mod_block/ip_blacklist.data")
 	}
+	if config.Basic.RuntimeApiToken != "" {
+		t.Error("RuntimeApiToken should be empty")
+	}
 }
@@ -15,9 +15,15 @@
 package mod_block
 
 import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/url"
+	"strconv"
+	"time"
 )
 
 import (
@@ -42,19 +48,40 @@ var (
 	ERR_BLACKLIST = errors.New("BLACKLIST")
 )
 
+var (
+	errRuntimeApiDisabled = errors.New("runtime api is disabled")
+	errRuntimeApiDenied   = errors.New("invalid token")
+)
+
 var (
 	openDebug = false
 )
 
 type ModuleBlockState struct {
-	ConnTotal    *metrics.Counter // all connnetion checked
-	ConnAccept   *metrics.Counter // connection passed
-	ConnRefuse   *metrics.Counter // connection refused
-	ReqTotal     *metrics.Counter // all request in
-	ReqToCheck   *metrics.Counter // request to check
-	ReqAccept    *metrics.Counter // request accepted
-	ReqRefuse    *metrics.Counter // request refused
-	WrongCommand *metrics.Counter // request with condition satisfied, but wrong command
+	ConnTotal         *metrics.Counter // all connnetion checked
+	ConnAccept        *metrics.Counter // connection passed
+	ConnRefuse        *metrics.Counter // connection refused
+	ConnRefuseRuntime *metrics.Counter // connection refused by runtime ip blacklist
+	ReqTotal          *metrics.Counter // all request in
+	ReqToCheck        *metrics.Counter // request to check
+	ReqAccept         *metrics.Counter // request accepted
+	ReqRefuse         *metrics.Counter // request refused by closing connection
+	ReqResponse       *metrics.Counter // request refused with custom response
+	ReqRedirect       *metrics.Counter // request refused with redirect
+	ReqTag            *metrics.Counter // request tagged by dry run rules
+	WrongCommand      *metrics.Counter // request with condition satisfied, but wrong command
+	RuntimeIPAdd      *metrics.Counter // entries added to runtime ip blacklist
+	RuntimeIPDel      *metrics.Counter // entries deleted from runtime ip blacklist
+	RuntimeApiDenied  *metrics.Counter // runtime api calls denied for invalid token
+}
+
+// RuleHitsStatus is hits of block rules, product => rule name => hits.
+type RuleHitsStatus map[string]map[string]int64
+
+// RuntimeIPTableStatus is status of runtime ip blacklist.
+type RuntimeIPTableStatus struct {
+	Num     int              // number of entries not expired
+	Entries []RuntimeIPEntry // entries not expired
 }
 
 type BlockInfo struct {
@@ -62,15 +89,18 @@ type BlockInfo struct {
 }
 
 type ModuleBlock struct {
-	name    string           // name of module
-	state   ModuleBlockState // module state
-	metrics metrics.Metrics
+	name     string           // name of module
+	state    ModuleBlockState // module state
+	metrics  metrics.Metrics
+	confRoot string // root path of config
 
 	productRulePath string // path of block rule data file
 	ipBlacklistPath string // path of ip blacklist data file
+	runtimeApiToken string // token for runtime ip blacklist api
 
-	ruleTable *ProductRuleTable // table for product block rules
-	ipTable   *ipdict.IPTable   // table for global ip blacklist
+	ruleTable      *ProductRuleTable // table for product block rules
+	ipTable        *ipdict.IPTable   // table for global ip blacklist
+	runtimeIPTable *RuntimeIPTable   // table for runtime ip blacklist
 }
 
 func NewModuleBlock() *ModuleBlock {
@@ -80,6 +110,7 @@ func NewModuleBlock() *ModuleBlock {
 
 	m.ruleTable = NewProductRuleTable()
 	m.ipTable = ipdict.NewIPTable()
+	m.runtimeIPTable = NewRuntimeIPTable()
 
 	return m
 }
@@ -88,6 +119,10 @@ func (m *ModuleBlock) Name() string {
 	return m.name
 }
 
+func (m *ModuleBlock) State() interface{} {
+	return &m.state
+}
+
 // loadGlobalIPTable loades global ip blacklist.
 func (m *ModuleBlock) loadGlobalIPTable(query url.Values) error {
 	// get reload file path
@@ -117,7 +152,7 @@ func (m *ModuleBlock) loadProductRuleConf(query url.Values) error {
 	}
 
 	// load file
-	conf, err := ProductRuleConfLoad(path)
+	conf, err := ProductRuleConfLoad(path, m.confRoot)
 	if err != nil {
 		return fmt.Errorf("err in ProductRuleConfLoad(%s):%s", path, err)
 	}
@@ -143,6 +178,15 @@ func (m *ModuleBlock) globalBlockHandler(session *bfe_basic.Session) int {
 		return bfe_module.BFE_HANDLER_CLOSE
 	}
 
+	if m.runtimeIPTable.Search(clientIP, time.Now()) {
+		session.SetError(ERR_BLACKLIST, "connection blocked by runtime blacklist")
+		log.Logger.Debug("%s refuse connection by runtime blacklist (remote: %v)",
+			m.name, session.RemoteAddr)
+		m.state.ConnRefuse.Inc(1)
+		m.state.ConnRefuseRuntime.Inc(1)
+		return bfe_module.BFE_HANDLER_CLOSE
+	}
+
 	if openDebug {
 		log.Logger.Debug("%s accept connection (remote: %v)",
 			m.name, session.RemoteAddr)
@@ -173,6 +217,14 @@ func (m *ModuleBlock) productBlockHandler(request *bfe_basic.Request) (
 	return m.productRulesProcess(request, rules)
 }
 
+func createBlockResp(req *bfe_basic.Request, action Action) *bfe_http.Response {
+	res := bfe_basic.CreateInternalResp(req, action.StatusCode)
+	res.Header.Set("Content-Type", action.ContentType)
+	res.ContentLength = int64(len(action.Body))
+	res.Body = ioutil.NopCloser(bytes.NewReader(action.Body))
+	return res
+}
+
 func (m *ModuleBlock) productRulesProcess(req *bfe_basic.Request, rules *blockRuleList) (
 	int, *bfe_http.Response) {
 	for _, rule := range *rules {
@@ -186,17 +238,45 @@ func (m *ModuleBlock) productRulesProcess(req *bfe_basic.Request, rules *blockRu
 			blockInfo := &BlockInfo{BlockRuleName: rule.Name}
 			req.SetContext(CtxBlockInfo, blockInfo)
 
+			rule.Hits.Inc(1)
+
 			switch rule.Action.Cmd {
-			case "CLOSE":
+			case ActionClose:
 				req.ErrCode = ERR_BLACKLIST
 				log.Logger.Debug("%s block connection (rule:%v, remote:%s)",
 					m.name, rule, req.RemoteAddr)
 				m.state.ReqRefuse.Inc(1)
 				return bfe_module.BFE_HANDLER_CLOSE, nil
+
+			case ActionResponse:
+				req.ErrCode = ERR_BLACKLIST
+				log.Logger.Debug("%s block with response (rule:%s, remote:%s)",
+					m.name, rule.Name, req.RemoteAddr)
+				m.state.ReqResponse.Inc(1)
+				return bfe_module.BFE_HANDLER_RESPONSE, createBlockResp(req, rule.Action)
+
+			case ActionRedirect:
+				req.ErrCode = ERR_BLACKLIST
+				req.Redirect.Url = rule.Action.Location
+				req.Redirect.Code = rule.Action.StatusCode
+				log.Logger.Debug("%s block with redirect (rule:%s, remote:%s)",
+					m.name, rule.Name, req.RemoteAddr)
+				m.state.ReqRedirect.Inc(1)
+				return bfe_module.BFE_HANDLER_REDIRECT, nil
+
+			case ActionTag:
+				// dry run: tag request and check next rule
+				req.AddTags(ModBlock, []string{rule.Name})
+				if openDebug {
+					log.Logger.Debug("%s tag request (rule:%s, remote:%s)",
+						m.name, rule.Name, req.RemoteAddr)
+				}
+				m.state.ReqTag.Inc(1)
+
 			default:
 				if openDebug {
 					log.Logger.Debug("%s unknown block command (%s), just pass",
-						rule.Action.Cmd)
+						m.name, rule.Action.Cmd)
 				}
 				m.state.WrongCommand.Inc(1)
 			}
@@ -210,6 +290,111 @@ func (m *ModuleBlock) productRulesProcess(req *bfe_basic.Request, rules *blockRu
 	return bfe_module.BFE_HANDLER_GOON, nil
 }
 
+// checkRuntimeApiToken checks token of runtime ip blacklist api. Token is
+// set in header X-Bfe-Api-Token of api request.
+func (m *ModuleBlock) checkRuntimeApiToken(query url.Values) error {
+	if len(m.runtimeApiToken) == 0 {
+		return errRuntimeApiDisabled
+	}
+
+	token := query.Get(bfe_module.ApiTokenParam)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(m.runtimeApiToken)) != 1 {
+		m.state.RuntimeApiDenied.Inc(1)
+		return errRuntimeApiDenied
+	}
+
+	return nil
+}
+
+// addRuntimeIP adds ip or cidr to runtime ip blacklist.
+// Params of query:
+//     - ip: ip or cidr, eg. 10.0.0.1, 10.0.0.0/24
+//     - ttl: time to live of entry, in seconds
+func (m *ModuleBlock) addRuntimeIP(query url.Values) error {
+	if err := m.checkRuntimeApiToken(query); err != nil {
+		return err
+	}
+
+	ip := query.Get("ip")
+	if ip == "" {
+		return errors.New("no ip")
+	}
+	ttl, err := strconv.Atoi(query.Get("ttl"))
+	if err != nil || ttl <= 0 {
+		return fmt.Errorf("invalid ttl: %s", query.Get("ttl"))
+	}
+
+	entry, err := m.runtimeIPTable.Add(ip, time.Duration(ttl)*time.Second, time.Now())
+	if err != nil {
+		return fmt.Errorf("err in add runtime ip(%s):%s", ip, err)
+	}
+
+	log.Logger.Info("%s add runtime ip %s, expire at %s", m.name, entry.IPNet,
+		entry.ExpireTime.Format(time.RFC3339))
+	m.state.RuntimeIPAdd.Inc(1)
+	return nil
+}
+
+// delRuntimeIP deletes ip or cidr from runtime ip blacklist.
+// Params of query:
+//     - ip: ip or cidr, eg. 10.0.0.1, 10.0.0.0/24
+func (m *ModuleBlock) delRuntimeIP(query url.Values) error {
+	if err := m.checkRuntimeApiToken(query); err != nil {
+		return err
+	}
+
+	ip := query.Get("ip")
+	if ip == "" {
+		return errors.New("no ip")
+	}
+
+	found, err := m.runtimeIPTable.Del(ip, time.Now())
+	if err != nil {
+		return fmt.Errorf("err in del runtime ip(%s):%s", ip, err)
+	}
+	if !found {
+		return fmt.Errorf("runtime ip(%s) not found", ip)
+	}
+
+	log.Logger.Info("%s del runtime ip %s", m.name, ip)
+	m.state.RuntimeIPDel.Inc(1)
+	return nil
+}
+
+// getRuntimeIPTable returns entries of runtime ip blacklist.
+func (m *ModuleBlock) getRuntimeIPTable(query url.Values) ([]byte, error) {
+	if err := m.checkRuntimeApiToken(query); err != nil {
+		return nil, err
+	}
+
+	entries := m.runtimeIPTable.Entries(time.Now())
+	status := RuntimeIPTableStatus{Num: len(entries), Entries: entries}
+	return json.Marshal(status)
+}
+
+// getRuleHits returns hits of block rules, which are filtered by product
+// if param product is specified.
+func (m *ModuleBlock) getRuleHits(params map[string][]string) ([]byte, error) {
+	var product string
+	if values, ok := params["product"]; ok && len(values) != 0 {
+		product = values[0]
+	}
+
+	status := make(RuleHitsStatus)
+	for name, rules := range m.ruleTable.GetRules() {
+		if product != "" && name != product {
+			continue
+		}
+
+		status[name] = make(map[string]int64)
+		for _, rule := range *rules {
+			status[name][rule.Name] = rule.Hits.Get()
+		}
+	}
+
+	return json.Marshal(status)
+}
+
 func (m *ModuleBlock) getState(params map[string][]string) ([]byte, error) {
 	s := m.metrics.GetAll()
 	return s.Format(params)
@@ -222,8 +407,10 @@ func (m *ModuleBlock) getStateDiff(params map[string][]string) ([]byte, error) {
 
 func (m *ModuleBlock) monitorHandlers() map[string]interface{} {
 	handlers := map[string]interface{}{
-		m.name:           m.getState,
-		m.name + ".diff": m.getStateDiff,
+		m.name:                       m.getState,
+		m.name + ".diff":             m.getStateDiff,
+		m.name + ".rule_hits":        m.getRuleHits,
+		m.name + ".runtime_ip_table": m.getRuntimeIPTable,
 	}
 	return handlers
 }
@@ -232,6 +419,8 @@ func (m *ModuleBlock) reloadHandlers() map[string]interface{} {
 	handlers := map[string]interface{}{
 		m.name + ".global_ip_table":    m.loadGlobalIPTable,
 		m.name + ".product_rule_table": m.loadProductRuleConf,
+		m.name + ".runtime_ip_add":     m.addRuntimeIP,
+		m.name + ".runtime_ip_del":     m.delRuntimeIP,
 	}
 	return handlers
 }
@@ -247,8 +436,10 @@ func (m *ModuleBlock) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHan
 		return fmt.Errorf("%s: conf load err %s", m.name, err.Error())
 	}
 
+	m.confRoot = cr
 	m.productRulePath = conf.Basic.ProductRulePath
 	m.ipBlacklistPath = conf.Basic.IPBlacklistPath
+	m.runtimeApiToken = conf.Basic.RuntimeApiToken
 	openDebug = conf.Log.OpenDebug
 
 	// load conf data
@@ -265,7 +456,7 @@ func (m *ModuleBlock) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHan
 		return fmt.Errorf("%s.Init(): AddFilter(m.globalBlockHandler): %s", m.name, err.Error())
 	}
 
-	err = cbs.AddFilter(bfe_module.HANDLE_AFTER_LOCATION, m.productBlockHandler)
+	err = cbs.AddFilter(bfe_module.HANDLE_FOUND_PRODUCT, m.productBlockHandler)
 	if err != nil {
 		return fmt.Errorf("%s.Init(): AddFilter(m.productBlockHandler): %s", m.name, err.Error())
 	}
@@ -15,6 +15,8 @@
 package mod_block
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"net"
 	"net/url"
 	"testing"
@@ -77,6 +79,92 @@ func TestGlobalBlock(t *testing.T) {
 	}
 }
 
+func TestRuntimeIPBlacklist(t *testing.T) {
+	m := prepareModule()
+	s := new(bfe_basic.Session)
+	s.RemoteAddr, _ = net.ResolveTCPAddr("tcp", "172.16.1.10:8098")
+
+	// token is required
+	query := url.Values{"ip": {"172.16.0.0/16"}, "ttl": {"60"}}
+	if err := m.addRuntimeIP(query); err == nil {
+		t.Fatalf("addRuntimeIP() should fail without token")
+	}
+	query.Set("token", "wrong_token")
+	if err := m.addRuntimeIP(query); err == nil {
+		t.Fatalf("addRuntimeIP() should fail with wrong token")
+	}
+	if m.state.RuntimeApiDenied.Get() != 2 {
+		t.Errorf("RuntimeApiDenied should be 2")
+	}
+
+	// invalid ttl
+	query.Set("token", "test_token")
+	query.Set("ttl", "-1")
+	if err := m.addRuntimeIP(query); err == nil {
+		t.Fatalf("addRuntimeIP() should fail with invalid ttl")
+	}
+
+	// add cidr
+	query.Set("ttl", "60")
+	if err := m.addRuntimeIP(query); err != nil {
+		t.Fatalf("addRuntimeIP(): %s", err)
+	}
+	if status := m.globalBlockHandler(s); status != bfe_module.BFE_HANDLER_CLOSE {
+		t.Errorf("Should block session")
+	}
+
+	// runtime entries survive reload of ip blacklist file
+	if err := m.loadGlobalIPTable(nil); err != nil {
+		t.Fatalf("loadGlobalIPTable(): %s", err)
+	}
+	if status := m.globalBlockHandler(s); status != bfe_module.BFE_HANDLER_CLOSE {
+		t.Errorf("Should block session after reload")
+	}
+
+	// entries in runtime ip table
+	data, err := m.getRuntimeIPTable(url.Values{"token": {"test_token"}})
+	if err != nil {
+		t.Fatalf("getRuntimeIPTable(): %s", err)
+	}
+	var tableStatus RuntimeIPTableStatus
+	if err := json.Unmarshal(data, &tableStatus); err != nil {
+		t.Fatalf("json.Unmarshal(): %s", err)
+	}
+	if tableStatus.Num != 1 || tableStatus.Entries[0].IPNet != "172.16.0.0/16" {
+		t.Errorf("unexpected runtime ip table: %s", data)
+	}
+
+	// del cidr
+	query = url.Values{"token": {"test_token"}, "ip": {"172.16.0.0/16"}}
+	if err := m.delRuntimeIP(query); err != nil {
+		t.Fatalf("delRuntimeIP(): %s", err)
+	}
+	if err := m.delRuntimeIP(query); err == nil {
+		t.Errorf("delRuntimeIP() should fail for ip not found")
+	}
+	if status := m.globalBlockHandler(s); status != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("Should not block session")
+	}
+
+	if m.state.ConnRefuseRuntime.Get() != 2 || m.state.RuntimeIPAdd.Get() != 1 ||
+		m.state.RuntimeIPDel.Get() != 1 {
+		t.Errorf("unexpected state: %+v", m.state)
+	}
+}
+
+func TestRuntimeApiDisabled(t *testing.T) {
+	m := prepareModule()
+	m.runtimeApiToken = ""
+
+	query := url.Values{"token": {""}, "ip": {"172.16.0.0/16"}, "ttl": {"60"}}
+	if err := m.addRuntimeIP(query); err != errRuntimeApiDisabled {
+		t.Errorf("addRuntimeIP() should fail if runtime api is disabled")
+	}
+	if _, err := m.getRuntimeIPTable(query); err != errRuntimeApiDisabled {
+		t.Errorf("getRuntimeIPTable() should fail if runtime api is disabled")
+	}
+}
+
 func TestProductBlock(t *testing.T) {
 	m := prepareModule()
 
@@ -112,6 +200,101 @@ func TestProductBlock(t *testing.T) {
 	}
 }
 
+func prepareProductRequest(host string, path string) *bfe_basic.Request {
+	req := prepareRequest()
+	req.HttpRequest = &bfe_http.Request{
+		Host: host,
+		URL:  &url.URL{Path: path},
+	}
+	req.Route = bfe_basic.RequestRoute{Product: "pn"}
+	req.Tags.TagTable = make(map[string][]string)
+	return req
+}
+
+func TestProductBlockActions(t *testing.T) {
+	m := prepareModule()
+
+	// RESPONSE
+	req := prepareProductRequest("r.example.org", "/")
+	status, res := m.productBlockHandler(req)
+	if status != bfe_module.BFE_HANDLER_RESPONSE || res == nil {
+		t.Fatalf("Should block request with response")
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != 403 || res.Header.Get("Content-Type") != "text/html" ||
+		string(body) != "<html><body>Access denied</body></html>\n" {
+		t.Errorf("unexpected response: %d %v %s", res.StatusCode, res.Header, body)
+	}
+	if req.ErrCode != ERR_BLACKLIST {
+		t.Errorf("ErrCode should be ERR_BLACKLIST")
+	}
+
+	// REDIRECT
+	req = prepareProductRequest("c.example.org", "/")
+	status, _ = m.productBlockHandler(req)
+	if status != bfe_module.BFE_HANDLER_REDIRECT {
+		t.Fatalf("Should block request with redirect")
+	}
+	if req.Redirect.Url != "https://challenge.example.org/verify" || req.Redirect.Code != 302 {
+		t.Errorf("unexpected redirect: %+v", req.Redirect)
+	}
+
+	// TAG: request is tagged and checked by following rules
+	req = prepareProductRequest("m.example.org", "/dry/a")
+	status, _ = m.productBlockHandler(req)
+	if status != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("Should not block request")
+	}
+	if tags := req.GetTags(ModBlock); len(tags) != 1 || tags[0] != "pn_dry_run_rule" {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+
+	req = prepareProductRequest("r.example.org", "/dry/a")
+	status, _ = m.productBlockHandler(req)
+	if status != bfe_module.BFE_HANDLER_RESPONSE {
+		t.Errorf("Should block request with response")
+	}
+
+	if m.state.ReqResponse.Get() != 2 || m.state.ReqRedirect.Get() != 1 || m.state.ReqTag.Get() != 2 ||
+		m.state.ReqAccept.Get() != 1 {
+		t.Errorf("unexpected state: %+v", m.state)
+	}
+}
+
+func TestRuleHits(t *testing.T) {
+	m := prepareModule()
+
+	for _, host := range []string{"n.example.org", "r.example.org", "r.example.org"} {
+		m.productBlockHandler(prepareProductRequest(host, "/"))
+	}
+
+	checkHits := func(expect map[string]int64) {
+		data, err := m.getRuleHits(map[string][]string{"product": {"pn"}})
+		if err != nil {
+			t.Fatalf("getRuleHits(): %s", err)
+		}
+		var status RuleHitsStatus
+		if err := json.Unmarshal(data, &status); err != nil {
+			t.Fatalf("json.Unmarshal(): %s", err)
+		}
+		if len(status) != 1 {
+			t.Fatalf("unexpected rule hits: %s", data)
+		}
+		for name, hits := range expect {
+			if status["pn"][name] != hits {
+				t.Errorf("hits of %s should be %d: %s", name, hits, data)
+			}
+		}
+	}
+	checkHits(map[string]int64{"pn_block_rule": 1, "pn_response_rule": 2, "pn_redirect_rule": 0})
+
+	// hits are kept after reload
+	if err := m.loadProductRuleConf(nil); err != nil {
+		t.Fatalf("loadProductRuleConf(): %s", err)
+	}
+	checkHits(map[string]int64{"pn_block_rule": 1, "pn_response_rule": 2, "pn_redirect_rule": 0})
+}
+
 func TestModuleMisc(t *testing.T) {
 	m := prepareModule()
 	if s, _ := m.getState(nil); s == nil {
@@ -21,6 +21,10 @@ import (
 	"os"
 )
 
+import (
+	"github.com/baidu/go-lib/web-monitor/metrics"
+)
+
 import (
 	"github.com/baidu/bfe/bfe_basic/condition"
 )
@@ -35,6 +39,7 @@ type blockRule struct {
 	Cond   condition.Condition // condition for block
 	Name   string              // block rule name
 	Action Action              // action for block
+	Hits   *metrics.Counter    // counter for request matched
 }
 
 type blockRuleFileList []blockRuleFile
@@ -130,25 +135,29 @@ func productRuleConfCheck(conf productRuleConfFile) error {
 	return nil
 }
 
-func ruleConvert(ruleFile blockRuleFile) (blockRule, error) {
+func ruleConvert(ruleFile blockRuleFile, confRoot string, product string) (blockRule, error) {
 	rule := blockRule{}
 
-	cond, err := condition.Build(*ruleFile.Cond)
+	cond, err := condition.BuildWithProduct(*ruleFile.Cond, product)
 	if err != nil {
 		return rule, err
 	}
 	rule.Cond = cond
 	rule.Name = *ruleFile.Name
-	rule.Action = actionConvert(*ruleFile.Action)
+	rule.Action, err = actionConvert(*ruleFile.Action, confRoot)
+	if err != nil {
+		return rule, fmt.Errorf("blockRule:%s, %s", rule.Name, err)
+	}
+	rule.Hits = new(metrics.Counter)
 	return rule, nil
 }
 
-func ruleListConvert(ruleFileList *blockRuleFileList) (*blockRuleList, error) {
+func ruleListConvert(ruleFileList *blockRuleFileList, confRoot string, product string) (*blockRuleList, error) {
 	ruleList := new(blockRuleList)
 	*ruleList = make([]blockRule, 0)
 
 	for _, ruleFile := range *ruleFileList {
-		rule, err := ruleConvert(ruleFile)
+		rule, err := ruleConvert(ruleFile, confRoot, product)
 		if err != nil {
 			return nil, err
 		}
@@ -158,8 +167,10 @@ func ruleListConvert(ruleFileList *blockRuleFileList) (*blockRuleList, error) {
 	return ruleList, nil
 }
 
-// ProductRuleConfLoad load block rule config from file.
-func ProductRuleConfLoad(filename string) (productRuleConf, error) {
+// ProductRuleConfLoad load block rule config from file, together with
+// response files referenced by rules. Relative path of response file is
+// relative to confRoot.
+func ProductRuleConfLoad(filename string, confRoot string) (productRuleConf, error) {
 	var conf productRuleConf
 	var err error
 
@@ -188,9 +199,9 @@ func ProductRuleConfLoad(filename string) (productRuleConf, error) {
 	conf.Version = *config.Version
 	conf.Config = make(ProductRules)
 	for product, ruleFileList := range *config.Config {
-		ruleList, err := ruleListConvert(ruleFileList)
+		ruleList, err := ruleListConvert(ruleFileList, confRoot, product)
 		if err != nil {
-			return conf, err
+			return conf, fmt.Errorf("ProductRules:%s, %s", product, err)
 		}
 		conf.Config[product] = ruleList
 	}
@@ -19,7 +19,7 @@ import (
 )
 
 func TestBlockConfLoad_1(t *testing.T) {
-	config, err := ProductRuleConfLoad("./testdata/block_rules_1.conf")
+	config, err := ProductRuleConfLoad("./testdata/block_rules_1.conf", "./testdata")
 	if err != nil {
 		t.Errorf("get err from ProductRuleConfLoad():%s", err.Error())
 		return
@@ -32,7 +32,7 @@ func TestBlockConfLoad_1(t *testing.T) {
 }
 
 func TestBlockConfLoad_2(t *testing.T) {
-	_, err := ProductRuleConfLoad("./testdata/block_rules_2.conf")
+	_, err := ProductRuleConfLoad("./testdata/block_rules_2.conf", "./testdata")
 	if err == nil {
 		t.Error("err should not be nil")
 		return
@@ -40,9 +40,56 @@ func TestBlockConfLoad_2(t *testing.T) {
 }
 
 func TestBlockConfLoad_3(t *testing.T) {
-	_, err := ProductRuleConfLoad("./testdata/block_rules_3.conf")
+	_, err := ProductRuleConfLoad("./testdata/block_rules_3.conf", "./testdata")
 	if err == nil {
 		t.Error("err should not be nil")
 		return
 	}
 }
+
+func TestBlockConfLoad_4(t *testing.T) {
+	// invalid status code
+	_, err := ProductRuleConfLoad("./testdata/block_rules_4.conf", "./testdata")
+	if err == nil {
+		t.Error("err should not be nil")
+		return
+	}
+}
+
+func TestBlockConfLoad_5(t *testing.T) {
+	// response file not exist
+	_, err := ProductRuleConfLoad("./testdata/block_rules_5.conf", "./testdata")
+	if err == nil {
+		t.Error("err should not be nil")
+		return
+	}
+}
+
+func TestBlockConfLoad_6(t *testing.T) {
+	config, err := ProductRuleConfLoad("./testdata/block_rules_6.conf", "./testdata")
+	if err != nil {
+		t.Errorf("get err from ProductRuleConfLoad():%s", err.Error())
+		return
+	}
+
+	rules := *config.Config["pn"]
+	if len(rules) != 3 {
+		t.Errorf("len(config.Config['pn']) should be 3")
+		return
+	}
+
+	action := rules[0].Action
+	if action.StatusCode != 403 || action.ContentType != "text/html" ||
+		string(action.Body) != "<html><body>Access denied</body></html>\n" {
+		t.Errorf("unexpected RESPONSE action: %+v", action)
+	}
+
+	action = rules[1].Action
+	if action.StatusCode != 302 || action.Location != "https://challenge.example.org/verify" {
+		t.Errorf("unexpected REDIRECT action: %+v", action)
+	}
+
+	if rules[2].Action.Cmd != ActionTag || rules[2].Hits == nil {
+		t.Errorf("unexpected TAG rule: %+v", rules[2])
+	}
+}
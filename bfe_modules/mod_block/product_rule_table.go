@@ -18,6 +18,10 @@ import (
 	"sync"
 )
 
+import (
+	"github.com/baidu/go-lib/web-monitor/metrics"
+)
+
 type ProductRuleTable struct {
 	lock         sync.RWMutex
 	version      string
@@ -30,11 +34,31 @@ func NewProductRuleTable() *ProductRuleTable {
 	return t
 }
 
+// Update updates product rules. Hit counters of rules with the same
+// product and name are kept.
 func (t *ProductRuleTable) Update(conf productRuleConf) {
 	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for product, rules := range conf.Config {
+		oldRules, ok := t.productRules[product]
+		if !ok {
+			continue
+		}
+
+		oldHits := make(map[string]*metrics.Counter)
+		for _, rule := range *oldRules {
+			oldHits[rule.Name] = rule.Hits
+		}
+		for i := range *rules {
+			if hits, ok := oldHits[(*rules)[i].Name]; ok {
+				(*rules)[i].Hits = hits
+			}
+		}
+	}
+
 	t.version = conf.Version
 	t.productRules = conf.Config
-	t.lock.Unlock()
 }
 
 func (t *ProductRuleTable) Search(product string) (*blockRuleList, bool) {
@@ -45,3 +69,12 @@ func (t *ProductRuleTable) Search(product string) (*blockRuleList, bool) {
 	rules, ok := productRules[product]
 	return rules, ok
 }
+
+// GetRules returns all product rules.
+func (t *ProductRuleTable) GetRules() ProductRules {
+	t.lock.RLock()
+	productRules := t.productRules
+	t.lock.RUnlock()
+
+	return productRules
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// runtime ip blacklist with ttl entries
+
+package mod_block
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxRuntimeIPNum = 100000 // max number of entries in runtime ip table
+)
+
+var (
+	errRuntimeIPTableFull = errors.New("runtime ip table is full")
+)
+
+// RuntimeIPEntry is an entry of runtime ip table.
+type RuntimeIPEntry struct {
+	IPNet      string    // ip or cidr, eg. 10.0.0.1/32, 10.0.0.0/24
+	AddTime    time.Time // time when entry is added
+	ExpireTime time.Time // time when entry expires
+}
+
+type runtimeIPRecord struct {
+	ipNet      *net.IPNet
+	addTime    time.Time
+	expireTime time.Time
+}
+
+func (r *runtimeIPRecord) expired(now time.Time) bool {
+	return !now.Before(r.expireTime)
+}
+
+func (r *runtimeIPRecord) entry() RuntimeIPEntry {
+	return RuntimeIPEntry{
+		IPNet:      r.ipNet.String(),
+		AddTime:    r.addTime,
+		ExpireTime: r.expireTime,
+	}
+}
+
+// prefixLen is mask size of cidr, e.g. {24, 32} for ipv4 cidr /24.
+type prefixLen struct {
+	ones int
+	bits int
+}
+
+// runtimeIPRecords holds records with the same prefix length, key is
+// network address of cidr.
+type runtimeIPRecords map[string]*runtimeIPRecord
+
+// RuntimeIPTable holds ips and cidrs added at runtime. Entries expire
+// after ttl and are purged lazily.
+//
+// Entries are grouped by prefix length, so Search costs one map lookup
+// for each prefix length in table (at most 33 for ipv4, 129 for ipv6),
+// instead of a scan of all entries.
+type RuntimeIPTable struct {
+	lock    sync.RWMutex
+	records map[prefixLen]runtimeIPRecords // prefix length => records
+	masks   map[prefixLen]net.IPMask       // prefix length => mask
+	num     int                            // number of records
+}
+
+// NewRuntimeIPTable creates a RuntimeIPTable.
+func NewRuntimeIPTable() *RuntimeIPTable {
+	t := new(RuntimeIPTable)
+	t.records = make(map[prefixLen]runtimeIPRecords)
+	t.masks = make(map[prefixLen]net.IPMask)
+	return t
+}
+
+// parseIPNet parses ip or cidr. Single ip is converted to ip/32 or ip/128.
+func parseIPNet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		return ipNet, nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid ip: %s", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// ipNetKey returns prefix length and key of cidr in table.
+func ipNetKey(ipNet *net.IPNet) (prefixLen, string) {
+	ones, bits := ipNet.Mask.Size()
+	return prefixLen{ones, bits}, string(ipNet.IP)
+}
+
+// Add adds ip or cidr to table. The entry is replaced if it exists.
+//
+// Params:
+//     - ipStr: ip or cidr
+//     - ttl: time to live of entry
+//     - now: current time
+//
+// Returns:
+//     entry added, and error if ipStr or ttl is invalid
+func (t *RuntimeIPTable) Add(ipStr string, ttl time.Duration, now time.Time) (RuntimeIPEntry, error) {
+	var entry RuntimeIPEntry
+
+	ipNet, err := parseIPNet(ipStr)
+	if err != nil {
+		return entry, err
+	}
+	if ttl <= 0 {
+		return entry, fmt.Errorf("invalid ttl: %s", ttl)
+	}
+
+	record := &runtimeIPRecord{ipNet: ipNet, addTime: now, expireTime: now.Add(ttl)}
+	plen, key := ipNetKey(ipNet)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.records[plen][key]; !ok && t.num >= maxRuntimeIPNum {
+		t.purge(now)
+		if t.num >= maxRuntimeIPNum {
+			return entry, errRuntimeIPTableFull
+		}
+	}
+
+	records, ok := t.records[plen]
+	if !ok {
+		records = make(runtimeIPRecords)
+		t.records[plen] = records
+		t.masks[plen] = ipNet.Mask
+	}
+	if _, ok := records[key]; !ok {
+		t.num++
+	}
+	records[key] = record
+
+	return record.entry(), nil
+}
+
+// Del deletes ip or cidr from table.
+//
+// Returns:
+//     whether entry exists before deleted, and error if ipStr is invalid
+func (t *RuntimeIPTable) Del(ipStr string, now time.Time) (bool, error) {
+	ipNet, err := parseIPNet(ipStr)
+	if err != nil {
+		return false, err
+	}
+	plen, key := ipNetKey(ipNet)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	record, ok := t.records[plen][key]
+	if !ok {
+		return false, nil
+	}
+	t.delete(plen, key)
+
+	return !record.expired(now), nil
+}
+
+// Search checks whether ip is in table.
+func (t *RuntimeIPTable) Search(ip net.IP, now time.Time) bool {
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 8 * net.IPv4len
+	}
+
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	for plen, records := range t.records {
+		if plen.bits != bits {
+			continue
+		}
+		record, ok := records[string(ip.Mask(t.masks[plen]))]
+		if ok && !record.expired(now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Entries returns entries not expired, sorted by ip.
+func (t *RuntimeIPTable) Entries(now time.Time) []RuntimeIPEntry {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.purge(now)
+
+	entries := make([]RuntimeIPEntry, 0, t.num)
+	for _, records := range t.records {
+		for _, record := range records {
+			entries = append(entries, record.entry())
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].IPNet < entries[j].IPNet
+	})
+	return entries
+}
+
+// delete removes record from table, records of prefix length is removed
+// if it becomes empty.
+func (t *RuntimeIPTable) delete(plen prefixLen, key string) {
+	records := t.records[plen]
+	delete(records, key)
+	t.num--
+
+	if len(records) == 0 {
+		delete(t.records, plen)
+		delete(t.masks, plen)
+	}
+}
+
+// purge removes expired entries.
+func (t *RuntimeIPTable) purge(now time.Time) {
+	for plen, records := range t.records {
+		for key, record := range records {
+			if record.expired(now) {
+				t.delete(plen, key)
+			}
+		}
+	}
+}
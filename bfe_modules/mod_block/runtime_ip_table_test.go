@@ -0,0 +1,151 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_block
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRuntimeIPTableAdd(t *testing.T) {
+	table := NewRuntimeIPTable()
+	now := time.Now()
+
+	// invalid ip or ttl
+	for _, ip := range []string{"", "10.0.0", "10.0.0.0/33", "abc"} {
+		if _, err := table.Add(ip, time.Minute, now); err == nil {
+			t.Errorf("Add(%s) should fail", ip)
+		}
+	}
+	if _, err := table.Add("10.0.0.1", 0, now); err == nil {
+		t.Errorf("Add() should fail for zero ttl")
+	}
+
+	// single ip and cidr
+	entry, err := table.Add("10.0.0.1", time.Minute, now)
+	if err != nil {
+		t.Fatalf("Add(): %s", err)
+	}
+	if entry.IPNet != "10.0.0.1/32" || !entry.ExpireTime.Equal(now.Add(time.Minute)) {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if _, err := table.Add("192.168.1.77/24", 2*time.Minute, now); err != nil {
+		t.Fatalf("Add(): %s", err)
+	}
+	if _, err := table.Add("1::1", time.Minute, now); err != nil {
+		t.Fatalf("Add(): %s", err)
+	}
+
+	cases := []struct {
+		ip     string
+		offset time.Duration
+		found  bool
+	}{
+		{"10.0.0.1", 0, true},
+		{"10.0.0.2", 0, false},
+		{"::ffff:10.0.0.1", 0, true},
+		{"192.168.1.200", 0, true},
+		{"192.168.2.1", 0, false},
+		{"1::1", 0, true},
+		{"1::2", 0, false},
+		{"10.0.0.1", time.Minute, false},
+		{"192.168.1.200", time.Minute, true},
+		{"192.168.1.200", 2 * time.Minute, false},
+	}
+	for _, c := range cases {
+		if found := table.Search(net.ParseIP(c.ip), now.Add(c.offset)); found != c.found {
+			t.Errorf("Search(%s) at +%s should be %v", c.ip, c.offset, c.found)
+		}
+	}
+
+	// entries are sorted, and expired entries are purged
+	entries := table.Entries(now)
+	if len(entries) != 3 || entries[0].IPNet != "10.0.0.1/32" || entries[1].IPNet != "192.168.1.0/24" ||
+		entries[2].IPNet != "1::1/128" {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+	if entries = table.Entries(now.Add(time.Minute)); len(entries) != 1 {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestRuntimeIPTableDel(t *testing.T) {
+	table := NewRuntimeIPTable()
+	now := time.Now()
+
+	table.Add("10.0.0.1", time.Minute, now)
+	table.Add("10.0.0.0/8", time.Minute, now)
+
+	if _, err := table.Del("abc", now); err == nil {
+		t.Errorf("Del() should fail for invalid ip")
+	}
+	if found, _ := table.Del("10.0.0.2", now); found {
+		t.Errorf("Del(10.0.0.2) should return false")
+	}
+	if found, _ := table.Del("10.0.0.1", now); !found {
+		t.Errorf("Del(10.0.0.1) should return true")
+	}
+	if !table.Search(net.ParseIP("10.0.0.1"), now) {
+		t.Errorf("10.0.0.1 should be found in 10.0.0.0/8")
+	}
+	if found, _ := table.Del("10.1.2.3/8", now); !found {
+		t.Errorf("Del(10.1.2.3/8) should return true")
+	}
+	if table.Search(net.ParseIP("10.0.0.1"), now) {
+		t.Errorf("10.0.0.1 should not be found")
+	}
+}
+
+func TestRuntimeIPTablePrefixLen(t *testing.T) {
+	table := NewRuntimeIPTable()
+	now := time.Now()
+
+	// nested cidrs with different prefix length
+	table.Add("10.1.0.0/16", time.Minute, now)
+	table.Add("10.1.2.0/24", 2*time.Minute, now)
+	table.Add("2001:db8::/32", time.Minute, now)
+
+	cases := []struct {
+		ip     string
+		offset time.Duration
+		found  bool
+	}{
+		{"10.1.2.3", 0, true},
+		{"10.1.3.3", 0, true},
+		{"10.2.0.1", 0, false},
+		{"10.1.2.3", time.Minute, true},
+		{"10.1.3.3", time.Minute, false},
+		{"2001:db8:1::1", 0, true},
+		{"2001:db9::1", 0, false},
+		// ipv4 is not matched by ipv6 cidr with the same bytes
+		{"32.1.13.184", 0, false},
+	}
+	for _, c := range cases {
+		if found := table.Search(net.ParseIP(c.ip), now.Add(c.offset)); found != c.found {
+			t.Errorf("Search(%s) at +%s should be %v", c.ip, c.offset, c.found)
+		}
+	}
+
+	// empty prefix length is removed
+	table.Del("10.1.2.0/24", now)
+	if table.num != 2 || len(table.records) != 2 || len(table.masks) != 2 {
+		t.Errorf("unexpected table: num %d, prefix len %d", table.num, len(table.records))
+	}
+	table.Entries(now.Add(time.Minute))
+	if table.num != 0 || len(table.records) != 0 {
+		t.Errorf("expired entries should be purged: num %d", table.num)
+	}
+}
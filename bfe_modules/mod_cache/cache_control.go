@@ -0,0 +1,224 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// cache control of request and response
+
+package mod_cache
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_http"
+)
+
+// status codes of cacheable response
+var cacheableStatus = map[int]bool{
+	bfe_http.StatusOK:                   true,
+	bfe_http.StatusNonAuthoritativeInfo: true,
+	bfe_http.StatusMultipleChoices:      true,
+	bfe_http.StatusMovedPermanently:     true,
+	bfe_http.StatusNotFound:             true,
+	bfe_http.StatusGone:                 true,
+}
+
+// header fields returned in 304 response
+var notModifiedFields = []string{
+	"Cache-Control",
+	"Content-Location",
+	"Date",
+	"ETag",
+	"Expires",
+	"Last-Modified",
+	"Vary",
+}
+
+// cacheControl is directives of Cache-Control header, directive => argument
+type cacheControl map[string]string
+
+func parseCacheControl(header bfe_http.Header) cacheControl {
+	cc := make(cacheControl)
+
+	for _, value := range header["Cache-Control"] {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if len(item) == 0 {
+				continue
+			}
+
+			directive, arg := item, ""
+			if i := strings.Index(item, "="); i >= 0 {
+				directive, arg = item[:i], strings.Trim(item[i+1:], "\" ")
+			}
+			cc[strings.ToLower(strings.TrimSpace(directive))] = arg
+		}
+	}
+
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// seconds returns delta-seconds argument of directive.
+func (cc cacheControl) seconds(directive string) (int64, bool) {
+	arg, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+
+	seconds, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return seconds, true
+}
+
+// requestNoCache checks whether request asks for response from origin server.
+func requestNoCache(header bfe_http.Header) bool {
+	cc := parseCacheControl(header)
+	if cc.has("no-cache") || cc.has("no-store") {
+		return true
+	}
+	if maxAge, ok := cc.seconds("max-age"); ok && maxAge == 0 {
+		return true
+	}
+
+	// Pragma is used only if Cache-Control is absent
+	if len(cc) == 0 && bfe_http.HasToken(header.Get("Pragma"), "no-cache") {
+		return true
+	}
+
+	return false
+}
+
+// responseAge returns value of Age header (in seconds).
+func responseAge(header bfe_http.Header) int64 {
+	age, err := strconv.ParseInt(header.Get("Age"), 10, 64)
+	if err != nil || age < 0 {
+		return 0
+	}
+	return age
+}
+
+// responseTTL returns remaining freshness lifetime of response.
+//
+// Params:
+//     - header: header of response
+//     - now: current time
+//     - rule: cache rule for response
+//
+// Returns:
+//     (ttl, cacheable)
+func responseTTL(header bfe_http.Header, now time.Time, rule *cacheRule) (time.Duration, bool) {
+	cc := parseCacheControl(header)
+	if cc.has("no-store") || cc.has("no-cache") || cc.has("private") {
+		return 0, false
+	}
+
+	var lifetime time.Duration
+	if seconds, ok := cc.seconds("s-maxage"); ok {
+		lifetime = time.Duration(seconds) * time.Second
+	} else if seconds, ok := cc.seconds("max-age"); ok {
+		lifetime = time.Duration(seconds) * time.Second
+	} else if expires := header.Get("Expires"); len(expires) != 0 {
+		expireTime, err := bfe_http.ParseTime(expires)
+		if err != nil {
+			// invalid Expires means already expired
+			return 0, false
+		}
+		date, err := bfe_http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = now
+		}
+		lifetime = expireTime.Sub(date)
+	} else {
+		// no explicit expiration time
+		lifetime = rule.DefaultTTL
+	}
+
+	if rule.MaxTTL > 0 && lifetime > rule.MaxTTL {
+		lifetime = rule.MaxTTL
+	}
+
+	ttl := lifetime - time.Duration(responseAge(header))*time.Second
+	if ttl <= 0 {
+		return 0, false
+	}
+	return ttl, true
+}
+
+// notModified checks conditional request with If-None-Match and
+// If-Modified-Since against cached response.
+func notModified(reqHeader bfe_http.Header, resHeader bfe_http.Header) bool {
+	// If-Modified-Since is ignored if If-None-Match is present
+	if inm := reqHeader.Get("If-None-Match"); len(inm) != 0 {
+		etag := resHeader.Get("ETag")
+		if len(etag) == 0 {
+			return false
+		}
+
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || weakMatch(tag, etag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := reqHeader.Get("If-Modified-Since"); len(ims) != 0 {
+		modifiedSince, err := bfe_http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		lastModified, err := bfe_http.ParseTime(resHeader.Get("Last-Modified"))
+		if err != nil {
+			return false
+		}
+		return !lastModified.After(modifiedSince)
+	}
+
+	return false
+}
+
+// weakMatch compares two entity tags with weak comparison.
+func weakMatch(a string, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// varyFields returns fields of Vary header. The second return value is
+// false if response varies on "*".
+func varyFields(header bfe_http.Header) ([]string, bool) {
+	fields := make([]string, 0)
+
+	for _, value := range header["Vary"] {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "*" {
+				return nil, false
+			}
+			if len(field) != 0 {
+				fields = append(fields, bfe_http.CanonicalHeaderKey(field))
+			}
+		}
+	}
+
+	return fields, true
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_cache
+
+import (
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_http"
+)
+
+func TestResponseTTL(t *testing.T) {
+	now := time.Now()
+	rule := &cacheRule{DefaultTTL: 10 * time.Second, MaxTTL: time.Hour}
+
+	cases := []struct {
+		header    map[string]string
+		ttl       time.Duration
+		cacheable bool
+	}{
+		{map[string]string{}, 10 * time.Second, true},
+		{map[string]string{"Cache-Control": "max-age=60"}, 60 * time.Second, true},
+		{map[string]string{"Cache-Control": "max-age=60, s-maxage=120"}, 120 * time.Second, true},
+		{map[string]string{"Cache-Control": "max-age=60", "Age": "20"}, 40 * time.Second, true},
+		{map[string]string{"Cache-Control": "max-age=86400"}, time.Hour, true},
+		{map[string]string{"Cache-Control": "private, max-age=60"}, 0, false},
+		{map[string]string{"Cache-Control": "no-store"}, 0, false},
+		{map[string]string{"Cache-Control": "max-age=0"}, 0, false},
+		{map[string]string{
+			"Date":    now.UTC().Format(bfe_http.TimeFormat),
+			"Expires": now.Add(30 * time.Second).UTC().Format(bfe_http.TimeFormat),
+		}, 30 * time.Second, true},
+		{map[string]string{"Expires": "0"}, 0, false},
+	}
+
+	for i, c := range cases {
+		header := make(bfe_http.Header)
+		for key, value := range c.header {
+			header.Set(key, value)
+		}
+
+		ttl, cacheable := responseTTL(header, now, rule)
+		if cacheable != c.cacheable || (cacheable && (ttl-c.ttl > time.Second || c.ttl-ttl > time.Second)) {
+			t.Errorf("case %d: responseTTL() = (%v, %v), expect (%v, %v)",
+				i, ttl, cacheable, c.ttl, c.cacheable)
+		}
+	}
+}
+
+func TestRequestNoCache(t *testing.T) {
+	cases := map[string]bool{
+		"":           false,
+		"no-cache":   true,
+		"max-age=0":  true,
+		"max-age=10": false,
+	}
+
+	for value, expect := range cases {
+		header := make(bfe_http.Header)
+		header.Set("Cache-Control", value)
+		if requestNoCache(header) != expect {
+			t.Errorf("requestNoCache(%q) should be %v", value, expect)
+		}
+	}
+
+	header := make(bfe_http.Header)
+	header.Set("Pragma", "no-cache")
+	if !requestNoCache(header) {
+		t.Errorf("requestNoCache() should be true for Pragma: no-cache")
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	lastModified := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	resHeader := make(bfe_http.Header)
+	resHeader.Set("ETag", "\"abc\"")
+	resHeader.Set("Last-Modified", lastModified.Format(bfe_http.TimeFormat))
+
+	cases := []struct {
+		field  string
+		value  string
+		expect bool
+	}{
+		{"If-None-Match", "\"abc\"", true},
+		{"If-None-Match", "W/\"abc\"", true},
+		{"If-None-Match", "\"xyz\", \"abc\"", true},
+		{"If-None-Match", "*", true},
+		{"If-None-Match", "\"xyz\"", false},
+		{"If-Modified-Since", lastModified.Format(bfe_http.TimeFormat), true},
+		{"If-Modified-Since", lastModified.Add(-time.Hour).Format(bfe_http.TimeFormat), false},
+		{"If-Modified-Since", "invalid", false},
+	}
+
+	for _, c := range cases {
+		reqHeader := make(bfe_http.Header)
+		reqHeader.Set(c.field, c.value)
+		if notModified(reqHeader, resHeader) != c.expect {
+			t.Errorf("notModified(%s: %s) should be %v", c.field, c.value, c.expect)
+		}
+	}
+}
+
+func TestVaryFields(t *testing.T) {
+	header := make(bfe_http.Header)
+	header.Add("Vary", "accept-encoding, Origin")
+	fields, ok := varyFields(header)
+	if !ok || len(fields) != 2 || fields[0] != "Accept-Encoding" || fields[1] != "Origin" {
+		t.Errorf("unexpected vary fields: %v", fields)
+	}
+
+	header.Add("Vary", "*")
+	if _, ok := varyFields(header); ok {
+		t.Errorf("response varies on * should not be cacheable")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// key of cached response
+
+package mod_cache
+
+import (
+	"bytes"
+	"strings"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+)
+
+type CacheKeyFile struct {
+	Headers []string // request headers included in key
+	Cookies []string // request cookies included in key
+}
+
+// CacheKey defines how cache key is generated from request.
+// Host, path and query of request are always included in key.
+type CacheKey struct {
+	Headers []string // request headers included in key
+	Cookies []string // request cookies included in key
+}
+
+func cacheKeyConvert(keyFile *CacheKeyFile) CacheKey {
+	var key CacheKey
+	if keyFile == nil {
+		return key
+	}
+
+	for _, header := range keyFile.Headers {
+		key.Headers = append(key.Headers, bfe_http.CanonicalHeaderKey(header))
+	}
+	key.Cookies = keyFile.Cookies
+	return key
+}
+
+// urlKey returns host + path + query of request.
+func urlKey(req *bfe_basic.Request) string {
+	return strings.ToLower(req.HttpRequest.Host) + req.HttpRequest.URL.RequestURI()
+}
+
+// Get gets cache key for request.
+func (k CacheKey) Get(req *bfe_basic.Request, urlKey string) string {
+	var buf bytes.Buffer
+
+	buf.WriteString(req.Route.Product)
+	buf.WriteByte(0)
+	buf.WriteString(urlKey)
+
+	for _, header := range k.Headers {
+		buf.WriteString("\x00h:")
+		buf.WriteString(header)
+		buf.WriteByte('=')
+		buf.WriteString(strings.Join(req.HttpRequest.Header[header], ","))
+	}
+
+	for _, name := range k.Cookies {
+		buf.WriteString("\x00c:")
+		buf.WriteString(name)
+		buf.WriteByte('=')
+		if cookie, ok := req.Cookie(name); ok {
+			buf.WriteString(cookie.Value)
+		}
+	}
+
+	return buf.String()
+}
+
+// varyKey returns key of response variant for request.
+func varyKey(key string, fields []string, header bfe_http.Header) string {
+	var buf bytes.Buffer
+
+	buf.WriteString(key)
+	buf.WriteString("\x00vary")
+	for _, field := range fields {
+		buf.WriteByte(0)
+		buf.WriteString(field)
+		buf.WriteByte('=')
+		buf.WriteString(strings.Join(header[field], ","))
+	}
+
+	return buf.String()
+}
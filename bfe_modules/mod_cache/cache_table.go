@@ -0,0 +1,230 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// sharded LRU table for cached responses
+
+package mod_cache
+
+import (
+	"container/list"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_http"
+)
+
+const (
+	cacheShardNum = 64 // number of shards in cache table
+
+	entryOverhead = 256 // estimated memory overhead of an entry
+)
+
+// cacheEntry is a cached response, or a vary marker which records
+// the Vary header of responses for the key.
+type cacheEntry struct {
+	key     string // cache key
+	product string // product name
+	urlKey  string // host + path + query of request
+
+	varyFields []string // fields of Vary header, only for vary marker
+
+	statusCode int             // status code of response
+	header     bfe_http.Header // header of response
+	body       []byte          // body of response
+	initAge    int64           // Age of response when stored (in seconds)
+
+	storeTime  time.Time // time when stored
+	expireTime time.Time // time when expired
+
+	memSize int64 // estimated memory used by entry
+}
+
+func (e *cacheEntry) isVaryMarker() bool {
+	return e.varyFields != nil
+}
+
+// size returns estimated memory used by entry.
+func (e *cacheEntry) size() int64 {
+	size := int64(len(e.key)+len(e.product)+len(e.urlKey)+len(e.body)) + entryOverhead
+	for key, values := range e.header {
+		size += int64(len(key))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+	for _, field := range e.varyFields {
+		size += int64(len(field))
+	}
+	return size
+}
+
+type cacheShard struct {
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // front is most recently used
+	size    int64      // memory used by entries
+	maxSize int64      // max memory for entries
+}
+
+// CacheTable is a memory-bounded LRU table for cached responses.
+type CacheTable struct {
+	maxSize int64 // max memory for all entries
+	shards  [cacheShardNum]cacheShard
+}
+
+// NewCacheTable creates a CacheTable with max memory of maxSize bytes.
+func NewCacheTable(maxSize int64) *CacheTable {
+	t := new(CacheTable)
+	t.maxSize = maxSize
+
+	for i := range t.shards {
+		t.shards[i].entries = make(map[string]*list.Element)
+		t.shards[i].lru = list.New()
+		t.shards[i].maxSize = maxSize / cacheShardNum
+	}
+
+	return t
+}
+
+// Get gets unexpired entry for key.
+func (t *CacheTable) Get(key string, now time.Time) (*cacheEntry, bool) {
+	shard := &t.shards[shardIndex(key)]
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	elem, ok := shard.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if !now.Before(entry.expireTime) {
+		shard.remove(elem)
+		return nil, false
+	}
+
+	shard.lru.MoveToFront(elem)
+	return entry, true
+}
+
+// Set adds entry to table, least recently used entries are evicted if
+// memory exceeds limit. It returns false if entry is too large.
+func (t *CacheTable) Set(entry *cacheEntry) bool {
+	shard := &t.shards[shardIndex(entry.key)]
+	entry.memSize = entry.size()
+	if entry.memSize > shard.maxSize {
+		return false
+	}
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	if elem, ok := shard.entries[entry.key]; ok {
+		shard.remove(elem)
+	}
+
+	for shard.size+entry.memSize > shard.maxSize {
+		shard.remove(shard.lru.Back())
+	}
+
+	shard.entries[entry.key] = shard.lru.PushFront(entry)
+	shard.size += entry.memSize
+	return true
+}
+
+// Delete deletes entry for key.
+func (t *CacheTable) Delete(key string) {
+	shard := &t.shards[shardIndex(key)]
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	if elem, ok := shard.entries[key]; ok {
+		shard.remove(elem)
+	}
+}
+
+// PurgePrefix deletes entries whose urlKey has given prefix.
+// Entries of all products are checked if product is empty.
+//
+// Returns:
+//     number of entries deleted
+func (t *CacheTable) PurgePrefix(product string, prefix string) int {
+	num := 0
+
+	for i := range t.shards {
+		shard := &t.shards[i]
+		shard.lock.Lock()
+		for _, elem := range shard.entries {
+			entry := elem.Value.(*cacheEntry)
+			if len(product) != 0 && entry.product != product {
+				continue
+			}
+			if strings.HasPrefix(entry.urlKey, prefix) {
+				shard.remove(elem)
+				num++
+			}
+		}
+		shard.lock.Unlock()
+	}
+
+	return num
+}
+
+// Len returns number of entries in table.
+func (t *CacheTable) Len() int {
+	n := 0
+	for i := range t.shards {
+		shard := &t.shards[i]
+		shard.lock.Lock()
+		n += len(shard.entries)
+		shard.lock.Unlock()
+	}
+	return n
+}
+
+// Size returns memory used by entries in table.
+func (t *CacheTable) Size() int64 {
+	var size int64
+	for i := range t.shards {
+		shard := &t.shards[i]
+		shard.lock.Lock()
+		size += shard.size
+		shard.lock.Unlock()
+	}
+	return size
+}
+
+// MaxSize returns max memory for entries in table.
+func (t *CacheTable) MaxSize() int64 {
+	return t.maxSize
+}
+
+func (s *cacheShard) remove(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	s.lru.Remove(elem)
+	delete(s.entries, entry.key)
+	s.size -= entry.memSize
+}
+
+func shardIndex(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32() % cacheShardNum
+}
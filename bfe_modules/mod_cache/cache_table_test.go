@@ -0,0 +1,105 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newEntry(key string, body string, now time.Time) *cacheEntry {
+	return &cacheEntry{
+		key:        key,
+		product:    "pn",
+		urlKey:     key,
+		body:       []byte(body),
+		storeTime:  now,
+		expireTime: now.Add(time.Minute),
+	}
+}
+
+func TestCacheTableGetSet(t *testing.T) {
+	table := NewCacheTable(1024 * 1024)
+	now := time.Now()
+
+	table.Set(newEntry("www.example.org/a", "hello", now))
+	entry, ok := table.Get("www.example.org/a", now)
+	if !ok || string(entry.body) != "hello" {
+		t.Errorf("entry should be found")
+	}
+
+	// expired
+	if _, ok := table.Get("www.example.org/a", now.Add(time.Hour)); ok {
+		t.Errorf("expired entry should not be found")
+	}
+	if table.Len() != 0 || table.Size() != 0 {
+		t.Errorf("expired entry should be removed")
+	}
+}
+
+func TestCacheTableEvict(t *testing.T) {
+	// 1024 bytes for each shard
+	table := NewCacheTable(1024 * cacheShardNum)
+	now := time.Now()
+
+	// find keys in the same shard
+	keys := make([]string, 0)
+	for i := 0; len(keys) < 3; i++ {
+		key := fmt.Sprintf("www.example.org/%d", i)
+		if shardIndex(key) == shardIndex("www.example.org/0") {
+			keys = append(keys, key)
+		}
+	}
+
+	body := string(make([]byte, 100))
+	table.Set(newEntry(keys[0], body, now))
+	table.Set(newEntry(keys[1], body, now))
+
+	// keys[0] is recently used
+	table.Get(keys[0], now)
+	table.Set(newEntry(keys[2], body, now))
+
+	if _, ok := table.Get(keys[1], now); ok {
+		t.Errorf("least recently used entry should be evicted")
+	}
+	if _, ok := table.Get(keys[0], now); !ok {
+		t.Errorf("recently used entry should not be evicted")
+	}
+
+	// too large
+	if table.Set(newEntry(keys[0], string(make([]byte, 2048)), now)) {
+		t.Errorf("large entry should not be stored")
+	}
+}
+
+func TestCacheTablePurge(t *testing.T) {
+	table := NewCacheTable(1024 * 1024)
+	now := time.Now()
+
+	table.Set(newEntry("www.example.org/static/a.js", "a", now))
+	table.Set(newEntry("www.example.org/static/b.js", "b", now))
+	table.Set(newEntry("www.example.org/index.html", "c", now))
+
+	if num := table.PurgePrefix("other", "www.example.org/static/"); num != 0 {
+		t.Errorf("entries of other product should not be purged")
+	}
+	if num := table.PurgePrefix("pn", "www.example.org/static/"); num != 2 {
+		t.Errorf("2 entries should be purged, not %d", num)
+	}
+	if table.Len() != 1 {
+		t.Errorf("1 entry should be left")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// reader for capturing response body
+
+package mod_cache
+
+import (
+	"bytes"
+	"io"
+)
+
+// captureReader reads from src and keeps a copy of data read.
+// onEOF is called with data read if src reaches EOF without data
+// exceeding maxSize, otherwise onExceed is called.
+type captureReader struct {
+	src      io.ReadCloser
+	buf      bytes.Buffer
+	maxSize  int64
+	finished bool
+
+	onEOF    func(body []byte)
+	onExceed func()
+}
+
+func newCaptureReader(src io.ReadCloser, maxSize int64, sizeHint int64,
+	onEOF func(body []byte), onExceed func()) *captureReader {
+	r := new(captureReader)
+	r.src = src
+	r.maxSize = maxSize
+	r.onEOF = onEOF
+	r.onExceed = onExceed
+
+	if sizeHint > 0 && sizeHint <= maxSize {
+		r.buf.Grow(int(sizeHint))
+	}
+
+	return r
+}
+
+func (r *captureReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	if r.finished {
+		return n, err
+	}
+
+	if n > 0 {
+		if int64(r.buf.Len()+n) > r.maxSize {
+			r.finished = true
+			r.buf = bytes.Buffer{}
+			r.onExceed()
+			return n, err
+		}
+		r.buf.Write(p[:n])
+	}
+
+	if err == io.EOF {
+		r.finished = true
+		r.onEOF(r.buf.Bytes())
+	}
+
+	return n, err
+}
+
+func (r *captureReader) Close() error {
+	return r.src.Close()
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_cache
+
+import (
+	"github.com/baidu/go-lib/log"
+	gcfg "gopkg.in/gcfg.v1"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_util"
+)
+
+const (
+	DefaultMaxMemory     = 256  // in MB
+	DefaultMaxObjectSize = 1024 // in KB
+)
+
+type ConfModCache struct {
+	Basic struct {
+		ProductRulePath string // path of product cache rule data
+		MaxMemory       int    // max memory for cached responses (in MB)
+		MaxObjectSize   int    // max body size of cached response (in KB)
+	}
+
+	Log struct {
+		OpenDebug bool // whether open debug
+	}
+}
+
+// ConfLoad loads config from config file
+func ConfLoad(filePath string, confRoot string) (*ConfModCache, error) {
+	var cfg ConfModCache
+	var err error
+
+	// read config from file
+	err = gcfg.ReadFileInto(&cfg, filePath)
+	if err != nil {
+		return &cfg, err
+	}
+
+	// check conf of mod_cache
+	err = cfg.Check(confRoot)
+	if err != nil {
+		return &cfg, err
+	}
+
+	return &cfg, nil
+}
+
+func (cfg *ConfModCache) Check(confRoot string) error {
+	return ConfModCacheCheck(cfg, confRoot)
+}
+
+func ConfModCacheCheck(cfg *ConfModCache, confRoot string) error {
+	if cfg.Basic.ProductRulePath == "" {
+		log.Logger.Warn("ModCache.ProductRulePath not set, use default value")
+		cfg.Basic.ProductRulePath = "mod_cache/cache_rules.data"
+	}
+	cfg.Basic.ProductRulePath = bfe_util.ConfPathProc(cfg.Basic.ProductRulePath, confRoot)
+
+	if cfg.Basic.MaxMemory <= 0 {
+		log.Logger.Warn("ModCache.MaxMemory not set, use default value")
+		cfg.Basic.MaxMemory = DefaultMaxMemory
+	}
+
+	if cfg.Basic.MaxObjectSize <= 0 {
+		log.Logger.Warn("ModCache.MaxObjectSize not set, use default value")
+		cfg.Basic.MaxObjectSize = DefaultMaxObjectSize
+	}
+
+	return nil
+}
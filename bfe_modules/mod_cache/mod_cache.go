@@ -0,0 +1,448 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// module for caching response
+
+package mod_cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/web-monitor/metrics"
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+const (
+	ModCache     = "mod_cache"
+	CtxCacheInfo = "mod_cache.cache_info"
+)
+
+var (
+	openDebug = false
+)
+
+// header fields not stored in cache
+var uncachedFields = []string{
+	"Age",
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+type ModuleCacheState struct {
+	ReqTotal         *metrics.Counter // all request in
+	ReqToCheck       *metrics.Counter // request with condition satisfied
+	ReqBypass        *metrics.Counter // request not served from cache, eg. no-cache
+	CacheHit         *metrics.Counter // request served from cache
+	CacheMiss        *metrics.Counter // request not found in cache
+	CacheNotModified *metrics.Counter // request served from cache with 304
+	ResStore         *metrics.Counter // response stored in cache
+	ResNotCacheable  *metrics.Counter // response not cacheable
+	ResTooLarge      *metrics.Counter // response too large to cache
+	CachePurge       *metrics.Counter // entries purged
+}
+
+// cacheInfo is cache info of request, passed from HANDLE_AFTER_LOCATION
+// to HANDLE_READ_BACKEND.
+type cacheInfo struct {
+	rule   *cacheRule // cache rule matched
+	key    string     // cache key
+	urlKey string     // host + path + query of request
+	hit    bool       // whether served from cache
+}
+
+type CacheTableStatus struct {
+	Entries  int     // number of entries in cache
+	Size     int64   // memory used by entries
+	MaxSize  int64   // max memory for entries
+	HitRatio float64 // ratio of CacheHit to requests looked up
+}
+
+type ModuleCache struct {
+	name    string           // name of module
+	state   ModuleCacheState // module state
+	metrics metrics.Metrics
+
+	productRulePath string            // path of cache rule data file
+	ruleTable       *ProductRuleTable // table for product cache rules
+	cacheTable      *CacheTable       // table for cached responses
+	maxObjectSize   int64             // max body size of cached response
+}
+
+func NewModuleCache() *ModuleCache {
+	m := new(ModuleCache)
+	m.name = ModCache
+	m.metrics.Init(&m.state, ModCache, 0)
+
+	m.ruleTable = NewProductRuleTable()
+
+	return m
+}
+
+func (m *ModuleCache) Name() string {
+	return m.name
+}
+
+func (m *ModuleCache) State() interface{} {
+	return &m.state
+}
+
+// loadProductRuleConf load from config file.
+func (m *ModuleCache) loadProductRuleConf(query url.Values) error {
+	// get path
+	path := query.Get("path")
+	if path == "" {
+		// use default
+		path = m.productRulePath
+	}
+
+	// load file
+	conf, err := ProductRuleConfLoad(path)
+	if err != nil {
+		return fmt.Errorf("err in ProductRuleConfLoad(%s):%s", path, err)
+	}
+
+	m.ruleTable.Update(conf)
+	return nil
+}
+
+// purgeCache purges cached responses by prefix of host + path + query.
+func (m *ModuleCache) purgeCache(query url.Values) error {
+	prefix := query.Get("prefix")
+	if prefix == "" {
+		return fmt.Errorf("no prefix")
+	}
+	product := query.Get("product")
+
+	num := m.cacheTable.PurgePrefix(product, prefix)
+	m.state.CachePurge.Inc(num)
+	log.Logger.Info("%s purge %d entries (product:%s, prefix:%s)", m.name, num, product, prefix)
+	return nil
+}
+
+// cacheHitHandler is a handler for serving request from cache.
+func (m *ModuleCache) cacheHitHandler(req *bfe_basic.Request) (int, *bfe_http.Response) {
+	m.state.ReqTotal.Inc(1)
+
+	// find cache rules for given request
+	rules, ok := m.ruleTable.Search(req.Route.Product)
+	if !ok {
+		if openDebug {
+			log.Logger.Debug("%s product %s not found, just pass",
+				m.name, req.Route.Product)
+		}
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	var rule *cacheRule
+	for i := range *rules {
+		if (*rules)[i].Cond.Match(req) {
+			rule = &(*rules)[i]
+			break
+		}
+	}
+	if rule == nil {
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+	m.state.ReqToCheck.Inc(1)
+
+	method := req.HttpRequest.Method
+	if method != "GET" && method != "HEAD" {
+		m.state.ReqBypass.Inc(1)
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	info := new(cacheInfo)
+	info.rule = rule
+	info.urlKey = urlKey(req)
+	info.key = rule.Key.Get(req, info.urlKey)
+	req.SetContext(CtxCacheInfo, info)
+
+	// Note: response for request with no-cache will be stored again
+	if requestNoCache(req.HttpRequest.Header) {
+		m.state.ReqBypass.Inc(1)
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	now := time.Now()
+	entry, ok := m.lookup(info.key, req.HttpRequest.Header, now)
+	if !ok {
+		m.state.CacheMiss.Inc(1)
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	if openDebug {
+		log.Logger.Debug("%s cache hit: %s", m.name, info.urlKey)
+	}
+	info.hit = true
+	m.state.CacheHit.Inc(1)
+	return bfe_module.BFE_HANDLER_RESPONSE, m.createResponse(req, entry, now)
+}
+
+// lookup finds cached response for key, and for the variant of request if
+// response varies on request header.
+func (m *ModuleCache) lookup(key string, header bfe_http.Header, now time.Time) (*cacheEntry, bool) {
+	entry, ok := m.cacheTable.Get(key, now)
+	if ok && entry.isVaryMarker() {
+		entry, ok = m.cacheTable.Get(varyKey(key, entry.varyFields, header), now)
+	}
+	return entry, ok
+}
+
+// createResponse creates response from cached entry.
+func (m *ModuleCache) createResponse(req *bfe_basic.Request, entry *cacheEntry,
+	now time.Time) *bfe_http.Response {
+	age := entry.initAge + int64(now.Sub(entry.storeTime)/time.Second)
+
+	res := new(bfe_http.Response)
+	res.Header = make(bfe_http.Header)
+
+	if notModified(req.HttpRequest.Header, entry.header) {
+		m.state.CacheNotModified.Inc(1)
+		res.StatusCode = bfe_http.StatusNotModified
+		for _, field := range notModifiedFields {
+			field = bfe_http.CanonicalHeaderKey(field)
+			if values, ok := entry.header[field]; ok {
+				res.Header[field] = values
+			}
+		}
+		res.Header.Set("Age", strconv.FormatInt(age, 10))
+		res.Body = bfe_http.EofReader
+		return res
+	}
+
+	res.StatusCode = entry.statusCode
+	res.Header = entry.header.Clone()
+	res.Header.Set("Age", strconv.FormatInt(age, 10))
+	res.Header.Set("Content-Length", strconv.Itoa(len(entry.body)))
+	res.ContentLength = int64(len(entry.body))
+	if req.HttpRequest.Method == "HEAD" {
+		res.Body = bfe_http.EofReader
+	} else {
+		res.Body = ioutil.NopCloser(bytes.NewReader(entry.body))
+	}
+	return res
+}
+
+// cacheStoreHandler is a handler for storing response to cache.
+func (m *ModuleCache) cacheStoreHandler(req *bfe_basic.Request, res *bfe_http.Response) int {
+	info, ok := req.GetContext(CtxCacheInfo).(*cacheInfo)
+	if !ok || info.hit || req.HttpRequest.Method != "GET" {
+		return bfe_module.BFE_HANDLER_GOON
+	}
+
+	now := time.Now()
+	if !storable(req, res) {
+		m.state.ResNotCacheable.Inc(1)
+		return bfe_module.BFE_HANDLER_GOON
+	}
+
+	ttl, ok := responseTTL(res.Header, now, info.rule)
+	if !ok {
+		m.state.ResNotCacheable.Inc(1)
+		return bfe_module.BFE_HANDLER_GOON
+	}
+
+	fields, ok := varyFields(res.Header)
+	if !ok {
+		m.state.ResNotCacheable.Inc(1)
+		return bfe_module.BFE_HANDLER_GOON
+	}
+
+	if res.ContentLength > m.maxObjectSize {
+		m.state.ResTooLarge.Inc(1)
+		return bfe_module.BFE_HANDLER_GOON
+	}
+
+	entry := &cacheEntry{
+		key:        info.key,
+		product:    req.Route.Product,
+		urlKey:     info.urlKey,
+		statusCode: res.StatusCode,
+		header:     res.Header.Clone(),
+		initAge:    responseAge(res.Header),
+		storeTime:  now,
+		expireTime: now.Add(ttl),
+	}
+	for _, field := range uncachedFields {
+		entry.header.Del(field)
+	}
+
+	// response varies on request header, add a vary marker for key
+	var marker *cacheEntry
+	if len(fields) != 0 {
+		marker = &cacheEntry{
+			key:        info.key,
+			product:    entry.product,
+			urlKey:     entry.urlKey,
+			varyFields: fields,
+			storeTime:  entry.storeTime,
+			expireTime: entry.expireTime,
+		}
+		entry.key = varyKey(info.key, fields, req.HttpRequest.Header)
+	}
+
+	// store response after the whole body is read
+	res.Body = newCaptureReader(res.Body, m.maxObjectSize, res.ContentLength,
+		func(body []byte) {
+			entry.body = body
+			m.store(marker, entry)
+		},
+		func() {
+			m.state.ResTooLarge.Inc(1)
+		})
+
+	return bfe_module.BFE_HANDLER_GOON
+}
+
+func (m *ModuleCache) store(marker *cacheEntry, entry *cacheEntry) {
+	if marker != nil && !m.cacheTable.Set(marker) {
+		m.state.ResTooLarge.Inc(1)
+		return
+	}
+
+	if !m.cacheTable.Set(entry) {
+		m.state.ResTooLarge.Inc(1)
+		return
+	}
+
+	if openDebug {
+		log.Logger.Debug("%s cache store: %s", m.name, entry.urlKey)
+	}
+	m.state.ResStore.Inc(1)
+}
+
+// storable checks whether response could be stored.
+func storable(req *bfe_basic.Request, res *bfe_http.Response) bool {
+	if res == nil || res.Body == nil || !cacheableStatus[res.StatusCode] {
+		return false
+	}
+
+	if parseCacheControl(req.HttpRequest.Header).has("no-store") {
+		return false
+	}
+
+	// response for authorized request or with cookie is not shared
+	if len(req.HttpRequest.Header.Get("Authorization")) != 0 ||
+		len(res.Header.Get("Set-Cookie")) != 0 {
+		return false
+	}
+
+	return true
+}
+
+func (m *ModuleCache) getState(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetAll()
+	return s.Format(params)
+}
+
+func (m *ModuleCache) getStateDiff(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetDiff()
+	return s.Format(params)
+}
+
+func (m *ModuleCache) getCacheTableStatus(params map[string][]string) ([]byte, error) {
+	var status CacheTableStatus
+	status.Entries = m.cacheTable.Len()
+	status.Size = m.cacheTable.Size()
+	status.MaxSize = m.cacheTable.MaxSize()
+
+	hit, miss := m.state.CacheHit.Get(), m.state.CacheMiss.Get()
+	if hit+miss > 0 {
+		status.HitRatio = float64(hit) / float64(hit+miss)
+	}
+
+	return json.Marshal(status)
+}
+
+func (m *ModuleCache) monitorHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name:                  m.getState,
+		m.name + ".diff":        m.getStateDiff,
+		m.name + ".cache_table": m.getCacheTableStatus,
+	}
+	return handlers
+}
+
+func (m *ModuleCache) reloadHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name + ".product_rule_table": m.loadProductRuleConf,
+		m.name + ".purge":              m.purgeCache,
+	}
+	return handlers
+}
+
+func (m *ModuleCache) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHandlers,
+	cr string) error {
+	var conf *ConfModCache
+	var err error
+
+	// load module config
+	confPath := bfe_module.ModConfPath(cr, m.name)
+	if conf, err = ConfLoad(confPath, cr); err != nil {
+		return fmt.Errorf("%s: conf load err %s", m.name, err.Error())
+	}
+
+	m.productRulePath = conf.Basic.ProductRulePath
+	m.cacheTable = NewCacheTable(int64(conf.Basic.MaxMemory) * 1024 * 1024)
+	m.maxObjectSize = int64(conf.Basic.MaxObjectSize) * 1024
+	openDebug = conf.Log.OpenDebug
+
+	// load conf data
+	if err = m.loadProductRuleConf(nil); err != nil {
+		return fmt.Errorf("%s: loadProductRuleConf() err %s", m.name, err.Error())
+	}
+
+	// register handler
+	err = cbs.AddFilter(bfe_module.HANDLE_AFTER_LOCATION, m.cacheHitHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.cacheHitHandler): %s", m.name, err.Error())
+	}
+
+	err = cbs.AddFilter(bfe_module.HANDLE_READ_BACKEND, m.cacheStoreHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.cacheStoreHandler): %s", m.name, err.Error())
+	}
+
+	// register web handler for monitor
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_MONITOR, m.monitorHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.monitorHandlers): %s", m.name, err.Error())
+	}
+	// register web handler for reload
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_RELOAD, m.reloadHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.reloadHandlers): %s", m.name, err.Error())
+	}
+
+	return nil
+}
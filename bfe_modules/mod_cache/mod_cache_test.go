@@ -0,0 +1,231 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_cache
+
+import (
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+func prepareModule() *ModuleCache {
+	m := NewModuleCache()
+	m.Init(bfe_module.NewBfeCallbacks(), web_monitor.NewWebHandlers(), "./testdata")
+	return m
+}
+
+func prepareRequest(method string, path string) *bfe_basic.Request {
+	request := new(bfe_basic.Request)
+	request.HttpRequest = new(bfe_http.Request)
+	request.HttpRequest.Method = method
+	request.HttpRequest.Host = "www.example.org"
+	request.HttpRequest.Header = make(bfe_http.Header)
+	request.HttpRequest.URL, _ = url.Parse(path)
+	request.Session = new(bfe_basic.Session)
+	request.Context = make(map[interface{}]interface{})
+	request.Route = bfe_basic.RequestRoute{Product: "pn"}
+	return request
+}
+
+func prepareResponse(body string) *bfe_http.Response {
+	res := new(bfe_http.Response)
+	res.StatusCode = bfe_http.StatusOK
+	res.Header = make(bfe_http.Header)
+	res.Header.Set("Content-Type", "text/plain")
+	res.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	res.Header.Set("ETag", "\"v1\"")
+	res.ContentLength = int64(len(body))
+	res.Body = ioutil.NopCloser(strings.NewReader(body))
+	return res
+}
+
+// forward sends request through module, with res as backend response.
+func forward(m *ModuleCache, req *bfe_basic.Request, res *bfe_http.Response) (
+	*bfe_http.Response, bool) {
+	ret, cached := m.cacheHitHandler(req)
+	if ret == bfe_module.BFE_HANDLER_RESPONSE {
+		m.cacheStoreHandler(req, cached)
+		return cached, true
+	}
+
+	m.cacheStoreHandler(req, res)
+	ioutil.ReadAll(res.Body)
+	return res, false
+}
+
+func TestCacheHit(t *testing.T) {
+	m := prepareModule()
+
+	// miss and store
+	req := prepareRequest("GET", "/static/a.js?v=1")
+	if _, hit := forward(m, req, prepareResponse("hello")); hit {
+		t.Fatalf("request should not hit cache")
+	}
+
+	// hit
+	req = prepareRequest("GET", "/static/a.js?v=1")
+	res, hit := forward(m, req, nil)
+	if !hit {
+		t.Fatalf("request should hit cache")
+	}
+	if data, _ := ioutil.ReadAll(res.Body); string(data) != "hello" {
+		t.Errorf("unexpected body: %s", data)
+	}
+	if res.Header.Get("Age") == "" || res.Header.Get("Content-Length") != "5" {
+		t.Errorf("Age and Content-Length should be set")
+	}
+
+	// different query
+	req = prepareRequest("GET", "/static/a.js?v=2")
+	if ret, _ := m.cacheHitHandler(req); ret == bfe_module.BFE_HANDLER_RESPONSE {
+		t.Errorf("request with different query should not hit cache")
+	}
+
+	// different header in key
+	req = prepareRequest("GET", "/static/a.js?v=1")
+	req.HttpRequest.Header.Set("X-Lang", "en")
+	if ret, _ := m.cacheHitHandler(req); ret == bfe_module.BFE_HANDLER_RESPONSE {
+		t.Errorf("request with different header should not hit cache")
+	}
+
+	// no-cache
+	req = prepareRequest("GET", "/static/a.js?v=1")
+	req.HttpRequest.Header.Set("Cache-Control", "no-cache")
+	if ret, _ := m.cacheHitHandler(req); ret == bfe_module.BFE_HANDLER_RESPONSE {
+		t.Errorf("request with no-cache should not hit cache")
+	}
+
+	if m.state.CacheHit.Get() != 1 || m.state.ResStore.Get() != 1 {
+		t.Errorf("CacheHit and ResStore should be 1")
+	}
+}
+
+func TestCacheNotModified(t *testing.T) {
+	m := prepareModule()
+	forward(m, prepareRequest("GET", "/static/a.js"), prepareResponse("hello"))
+
+	req := prepareRequest("GET", "/static/a.js")
+	req.HttpRequest.Header.Set("If-None-Match", "\"v1\"")
+	res, hit := forward(m, req, nil)
+	if !hit || res.StatusCode != bfe_http.StatusNotModified {
+		t.Errorf("response should be 304")
+	}
+	if res.Header.Get("ETag") != "\"v1\"" || res.Header.Get("Content-Type") != "" {
+		t.Errorf("unexpected header for 304: %v", res.Header)
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	m := prepareModule()
+
+	req := prepareRequest("GET", "/api/user")
+	req.HttpRequest.Header.Set("Accept-Encoding", "gzip")
+	res := prepareResponse("gzip body")
+	res.Header.Set("Cache-Control", "max-age=60")
+	res.Header.Set("Vary", "Accept-Encoding")
+	forward(m, req, res)
+
+	req = prepareRequest("GET", "/api/user")
+	req.HttpRequest.Header.Set("Accept-Encoding", "gzip")
+	if _, hit := forward(m, req, nil); !hit {
+		t.Errorf("request with same Accept-Encoding should hit cache")
+	}
+
+	req = prepareRequest("GET", "/api/user")
+	if ret, _ := m.cacheHitHandler(req); ret == bfe_module.BFE_HANDLER_RESPONSE {
+		t.Errorf("request with different Accept-Encoding should not hit cache")
+	}
+}
+
+func TestCacheNotStored(t *testing.T) {
+	m := prepareModule()
+
+	// no explicit expiration time, and no DefaultTTL
+	forward(m, prepareRequest("GET", "/api/a"), prepareResponse("hello"))
+
+	// private
+	res := prepareResponse("hello")
+	res.Header.Set("Cache-Control", "private, max-age=60")
+	forward(m, prepareRequest("GET", "/static/b"), res)
+
+	// with cookie
+	res = prepareResponse("hello")
+	res.Header.Set("Set-Cookie", "uid=1")
+	forward(m, prepareRequest("GET", "/static/c"), res)
+
+	// too large (MaxObjectSize is 1KB)
+	forward(m, prepareRequest("GET", "/static/d"), prepareResponse(strings.Repeat("a", 2048)))
+
+	// not GET
+	forward(m, prepareRequest("POST", "/static/e"), prepareResponse("hello"))
+
+	// no rule matched
+	forward(m, prepareRequest("GET", "/other"), prepareResponse("hello"))
+
+	if m.cacheTable.Len() != 0 {
+		t.Errorf("response should not be stored")
+	}
+	if m.state.ResNotCacheable.Get() != 3 || m.state.ResTooLarge.Get() != 1 {
+		t.Errorf("ResNotCacheable should be 3, ResTooLarge should be 1")
+	}
+}
+
+func TestCachePurge(t *testing.T) {
+	m := prepareModule()
+	forward(m, prepareRequest("GET", "/static/a.js"), prepareResponse("a"))
+	forward(m, prepareRequest("GET", "/static/b.js"), prepareResponse("b"))
+
+	if err := m.purgeCache(url.Values{}); err == nil {
+		t.Errorf("purgeCache() should fail without prefix")
+	}
+
+	query := url.Values{}
+	query.Set("prefix", "www.example.org/static/a")
+	if err := m.purgeCache(query); err != nil {
+		t.Errorf("purgeCache() err: %s", err)
+	}
+	if m.cacheTable.Len() != 1 {
+		t.Errorf("1 entry should be left")
+	}
+
+	if s, err := m.getCacheTableStatus(nil); err != nil || !strings.Contains(string(s), "\"Entries\":1") {
+		t.Errorf("unexpected cache table status: %s", s)
+	}
+}
+
+func TestModuleMisc(t *testing.T) {
+	m := prepareModule()
+	if s, _ := m.getState(nil); s == nil {
+		t.Errorf("Should return valid state")
+	}
+	if m.monitorHandlers() == nil {
+		t.Errorf("Should return valid monitor handlers")
+	}
+	if m.reloadHandlers() == nil {
+		t.Errorf("Should return valid reload handlers")
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic/condition"
+)
+
+type cacheRuleFile struct {
+	Cond       *string       // condition for cache
+	Key        *CacheKeyFile // extra request fields included in cache key
+	DefaultTTL *int          // ttl (in seconds) for response without explicit expiration time
+	MaxTTL     *int          // max ttl (in seconds) of cached response, 0 means no limit
+}
+
+type cacheRule struct {
+	Cond       condition.Condition // condition for cache
+	Key        CacheKey            // cache key
+	DefaultTTL time.Duration       // ttl for response without explicit expiration time
+	MaxTTL     time.Duration       // max ttl of cached response, 0 means no limit
+}
+
+type cacheRuleFileList []cacheRuleFile
+type cacheRuleList []cacheRule
+
+type ProductRulesFile map[string]*cacheRuleFileList // product => list of cache rules
+type ProductRules map[string]*cacheRuleList
+
+type productRuleConfFile struct {
+	Version *string // version of the config
+	Config  *ProductRulesFile
+}
+
+type productRuleConf struct {
+	Version string       // version of the config
+	Config  ProductRules // product rules for cache
+}
+
+func cacheRuleCheck(conf cacheRuleFile) error {
+	// check Cond
+	if conf.Cond == nil {
+		return errors.New("no Cond")
+	}
+
+	// check DefaultTTL
+	if conf.DefaultTTL != nil && *conf.DefaultTTL < 0 {
+		return errors.New("DefaultTTL should not be negative")
+	}
+
+	// check MaxTTL
+	if conf.MaxTTL != nil && *conf.MaxTTL < 0 {
+		return errors.New("MaxTTL should not be negative")
+	}
+
+	return nil
+}
+
+func cacheRuleListCheck(conf *cacheRuleFileList) error {
+	for index, rule := range *conf {
+		err := cacheRuleCheck(rule)
+		if err != nil {
+			return fmt.Errorf("cacheRule:%d, %s", index, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRulesCheck(conf *ProductRulesFile) error {
+	for product, ruleList := range *conf {
+		if ruleList == nil {
+			return fmt.Errorf("no cacheRuleList for product:%s", product)
+		}
+
+		err := cacheRuleListCheck(ruleList)
+		if err != nil {
+			return fmt.Errorf("ProductRules:%s, %s", product, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRuleConfCheck(conf productRuleConfFile) error {
+	var err error
+
+	// check Version
+	if conf.Version == nil {
+		return errors.New("no Version")
+	}
+
+	// check Config
+	if conf.Config == nil {
+		return errors.New("no Config")
+	}
+
+	err = productRulesCheck(conf.Config)
+	if err != nil {
+		return fmt.Errorf("Config:%s", err.Error())
+	}
+
+	return nil
+}
+
+func ruleConvert(ruleFile cacheRuleFile, product string) (cacheRule, error) {
+	rule := cacheRule{}
+
+	cond, err := condition.BuildWithProduct(*ruleFile.Cond, product)
+	if err != nil {
+		return rule, err
+	}
+	rule.Cond = cond
+	rule.Key = cacheKeyConvert(ruleFile.Key)
+
+	if ruleFile.DefaultTTL != nil {
+		rule.DefaultTTL = time.Duration(*ruleFile.DefaultTTL) * time.Second
+	}
+	if ruleFile.MaxTTL != nil {
+		rule.MaxTTL = time.Duration(*ruleFile.MaxTTL) * time.Second
+	}
+
+	return rule, nil
+}
+
+func ruleListConvert(ruleFileList *cacheRuleFileList, product string) (*cacheRuleList, error) {
+	ruleList := new(cacheRuleList)
+	*ruleList = make([]cacheRule, 0)
+
+	for _, ruleFile := range *ruleFileList {
+		rule, err := ruleConvert(ruleFile, product)
+		if err != nil {
+			return nil, err
+		}
+		*ruleList = append(*ruleList, rule)
+	}
+
+	return ruleList, nil
+}
+
+// ProductRuleConfLoad load cache rule config from file.
+func ProductRuleConfLoad(filename string) (productRuleConf, error) {
+	var conf productRuleConf
+	var err error
+
+	// open the file
+	file, err := os.Open(filename)
+	if err != nil {
+		return conf, err
+	}
+	defer file.Close()
+
+	// decode the file
+	decoder := json.NewDecoder(file)
+	var config productRuleConfFile
+	err = decoder.Decode(&config)
+	if err != nil {
+		return conf, err
+	}
+
+	// check config
+	err = productRuleConfCheck(config)
+	if err != nil {
+		return conf, err
+	}
+
+	// convert config
+	conf.Version = *config.Version
+	conf.Config = make(ProductRules)
+	for product, ruleFileList := range *config.Config {
+		ruleList, err := ruleListConvert(ruleFileList, product)
+		if err != nil {
+			return conf, err
+		}
+		conf.Config[product] = ruleList
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheRuleConfLoad(t *testing.T) {
+	config, err := ProductRuleConfLoad("./testdata/mod_cache/cache_rules.data")
+	if err != nil {
+		t.Fatalf("get err from ProductRuleConfLoad():%s", err.Error())
+	}
+
+	rules := *config.Config["pn"]
+	if len(rules) != 2 {
+		t.Fatalf("len(config.Config['pn']) should be 2")
+	}
+
+	if rules[0].DefaultTTL != 60*time.Second || rules[0].MaxTTL != time.Hour {
+		t.Errorf("unexpected ttl: %v, %v", rules[0].DefaultTTL, rules[0].MaxTTL)
+	}
+	if len(rules[0].Key.Headers) != 1 || rules[0].Key.Headers[0] != "X-Lang" {
+		t.Errorf("header in key should be canonical: %v", rules[0].Key.Headers)
+	}
+}
+
+func TestCacheRuleConfLoadInvalid(t *testing.T) {
+	files := []string{
+		"./testdata/cache_rules_1.data", // no cond
+		"./testdata/cache_rules_2.data", // negative ttl
+	}
+
+	for _, file := range files {
+		if _, err := ProductRuleConfLoad(file); err == nil {
+			t.Errorf("err should not be nil for %s", file)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// reader for compressing response body
+
+package mod_compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+import (
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	readBufferSize = 32 * 1024
+)
+
+type compressWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressReader reads from src and returns compressed data.
+// Compressed data is flushed after each read from src, so streaming
+// response is not delayed.
+type compressReader struct {
+	src    io.ReadCloser  // uncompressed body
+	writer compressWriter // compressor writing to buf
+	buf    bytes.Buffer   // compressed data not read
+	rbuf   []byte         // buffer for reading from src
+	err    error          // error to return after buf is drained
+}
+
+// newCompressReader creates a compressReader.
+//
+// Params:
+//     - src: uncompressed body
+//     - encoding: content coding, gzip or br
+//     - level: compression level (quality for br)
+func newCompressReader(src io.ReadCloser, encoding string, level int) (*compressReader, error) {
+	var err error
+
+	r := new(compressReader)
+	r.src = src
+	r.rbuf = make([]byte, readBufferSize)
+
+	switch encoding {
+	case EncodingGzip:
+		r.writer, err = gzip.NewWriterLevel(&r.buf, level)
+	case EncodingBrotli:
+		r.writer = brotli.NewWriterLevel(&r.buf, level)
+	default:
+		return nil, errUnknownEncoding
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *compressReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.fill()
+	}
+
+	return r.buf.Read(p)
+}
+
+// fill reads from src and compresses data into buf.
+func (r *compressReader) fill() {
+	n, err := r.src.Read(r.rbuf)
+	if n > 0 {
+		if _, werr := r.writer.Write(r.rbuf[:n]); werr != nil {
+			r.err = werr
+			return
+		}
+	}
+
+	if err == io.EOF {
+		if cerr := r.writer.Close(); cerr != nil {
+			r.err = cerr
+			return
+		}
+		r.err = io.EOF
+		return
+	}
+	if err != nil {
+		r.err = err
+		return
+	}
+
+	if n > 0 {
+		if ferr := r.writer.Flush(); ferr != nil {
+			r.err = ferr
+		}
+	}
+}
+
+func (r *compressReader) Close() error {
+	return r.src.Close()
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/andybalholm/brotli"
+)
+
+func TestCompressReader(t *testing.T) {
+	data := strings.Repeat("hello bfe! ", 10000)
+
+	for _, encoding := range []string{EncodingGzip, EncodingBrotli} {
+		src := ioutil.NopCloser(strings.NewReader(data))
+		r, err := newCompressReader(src, encoding, 6)
+		if err != nil {
+			t.Fatalf("newCompressReader(%s): %s", encoding, err)
+		}
+
+		compressed, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll(%s): %s", encoding, err)
+		}
+		if len(compressed) >= len(data) {
+			t.Errorf("%s: data should be compressed", encoding)
+		}
+
+		var dr io.Reader
+		if encoding == EncodingGzip {
+			if dr, err = gzip.NewReader(bytes.NewReader(compressed)); err != nil {
+				t.Fatalf("gzip.NewReader(): %s", err)
+			}
+		} else {
+			dr = brotli.NewReader(bytes.NewReader(compressed))
+		}
+
+		decompressed, err := ioutil.ReadAll(dr)
+		if err != nil || string(decompressed) != data {
+			t.Errorf("%s: unexpected decompressed data, err: %v", encoding, err)
+		}
+	}
+
+	if _, err := newCompressReader(nil, "deflate", 6); err == nil {
+		t.Errorf("newCompressReader() should fail for unknown encoding")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// content coding negotiation
+
+package mod_compress
+
+import (
+	"strconv"
+	"strings"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_http"
+)
+
+// content codings supported
+const (
+	EncodingGzip   = "gzip"
+	EncodingBrotli = "br"
+)
+
+// parseAcceptEncoding parses Accept-Encoding header of request.
+//
+// Returns:
+//     map of content coding => qvalue
+func parseAcceptEncoding(header bfe_http.Header) map[string]float64 {
+	accepts := make(map[string]float64)
+
+	for _, value := range header["Accept-Encoding"] {
+		for _, item := range strings.Split(value, ",") {
+			params := strings.Split(item, ";")
+			coding := strings.ToLower(strings.TrimSpace(params[0]))
+			if len(coding) == 0 {
+				continue
+			}
+			if coding == "x-gzip" {
+				coding = EncodingGzip
+			}
+
+			qvalue := 1.0
+			for _, param := range params[1:] {
+				param = strings.TrimSpace(param)
+				if !strings.HasPrefix(param, "q=") && !strings.HasPrefix(param, "Q=") {
+					continue
+				}
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil || q < 0 || q > 1 {
+					q = 0
+				}
+				qvalue = q
+			}
+
+			accepts[coding] = qvalue
+		}
+	}
+
+	return accepts
+}
+
+// negotiateEncoding selects a content coding from encodings for request.
+// encodings is in order of preference. Empty string is returned if none
+// of encodings is acceptable.
+func negotiateEncoding(header bfe_http.Header, encodings []string) string {
+	accepts := parseAcceptEncoding(header)
+	if len(accepts) == 0 {
+		return ""
+	}
+
+	selected, maxQvalue := "", 0.0
+	for _, encoding := range encodings {
+		qvalue, ok := accepts[encoding]
+		if !ok {
+			qvalue = accepts["*"]
+		}
+
+		if qvalue > maxQvalue {
+			selected, maxQvalue = encoding, qvalue
+		}
+	}
+
+	return selected
+}
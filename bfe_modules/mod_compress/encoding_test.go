@@ -0,0 +1,53 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_compress
+
+import (
+	"testing"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_http"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	encodings := []string{EncodingBrotli, EncodingGzip}
+
+	cases := []struct {
+		accept string
+		expect string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"x-gzip", "gzip"},
+		{"br;q=0.5, gzip;q=0.8", "gzip"},
+		{"br;q=0, gzip;q=0", ""},
+		{"*", "br"},
+		{"*;q=0.5, gzip", "gzip"},
+		{"identity", ""},
+		{"GZIP;Q=1.0", "gzip"},
+	}
+
+	for _, c := range cases {
+		header := make(bfe_http.Header)
+		if c.accept != "" {
+			header.Set("Accept-Encoding", c.accept)
+		}
+		if encoding := negotiateEncoding(header, encodings); encoding != c.expect {
+			t.Errorf("negotiateEncoding(%q) should be %q, not %q", c.accept, c.expect, encoding)
+		}
+	}
+}
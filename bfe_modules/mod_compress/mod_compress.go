@@ -0,0 +1,301 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// module for compressing response
+
+package mod_compress
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/web-monitor/metrics"
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+const (
+	ModCompress = "mod_compress"
+)
+
+var (
+	openDebug = false
+)
+
+type ModuleCompressState struct {
+	ResTotal        *metrics.Counter // all response in
+	ResToCheck      *metrics.Counter // response to check
+	ResSkip         *metrics.Counter // response not compressible, eg. already encoded
+	ResTypeMismatch *metrics.Counter // response with content type not matched
+	ResTooSmall     *metrics.Counter // response with content length less than MinLength
+	ResNotAccepted  *metrics.Counter // response not compressed, since no acceptable encoding
+	ResGzip         *metrics.Counter // response compressed with gzip
+	ResBrotli       *metrics.Counter // response compressed with br
+	ResCompressErr  *metrics.Counter // response failed to compress
+}
+
+type ModuleCompress struct {
+	name    string              // name of module
+	state   ModuleCompressState // module state
+	metrics metrics.Metrics
+
+	productRulePath string            // path of compress rule data file
+	ruleTable       *ProductRuleTable // table for product compress rules
+}
+
+func NewModuleCompress() *ModuleCompress {
+	m := new(ModuleCompress)
+	m.name = ModCompress
+	m.metrics.Init(&m.state, ModCompress, 0)
+
+	m.ruleTable = NewProductRuleTable()
+
+	return m
+}
+
+func (m *ModuleCompress) Name() string {
+	return m.name
+}
+
+func (m *ModuleCompress) State() interface{} {
+	return &m.state
+}
+
+// loadProductRuleConf load from config file.
+func (m *ModuleCompress) loadProductRuleConf(query url.Values) error {
+	// get path
+	path := query.Get("path")
+	if path == "" {
+		// use default
+		path = m.productRulePath
+	}
+
+	// load file
+	conf, err := ProductRuleConfLoad(path)
+	if err != nil {
+		return fmt.Errorf("err in ProductRuleConfLoad(%s):%s", path, err)
+	}
+
+	m.ruleTable.Update(conf)
+	return nil
+}
+
+// compressHandler is a handler for compressing response.
+func (m *ModuleCompress) compressHandler(req *bfe_basic.Request, res *bfe_http.Response) int {
+	m.state.ResTotal.Inc(1)
+
+	// find compress rules for given request
+	rules, ok := m.ruleTable.Search(req.Route.Product)
+	if !ok {
+		if openDebug {
+			log.Logger.Debug("%s product %s not found, just pass",
+				m.name, req.Route.Product)
+		}
+		return bfe_module.BFE_HANDLER_GOON
+	}
+
+	m.state.ResToCheck.Inc(1)
+	if !compressible(req, res) {
+		m.state.ResSkip.Inc(1)
+		return bfe_module.BFE_HANDLER_GOON
+	}
+
+	for i := range *rules {
+		rule := &(*rules)[i]
+		if rule.Cond.Match(req) {
+			m.compressProcess(req, res, rule)
+			break
+		}
+	}
+
+	return bfe_module.BFE_HANDLER_GOON
+}
+
+func (m *ModuleCompress) compressProcess(req *bfe_basic.Request, res *bfe_http.Response,
+	rule *compressRule) {
+	if !rule.matchContentType(res.Header.Get("Content-Type")) {
+		m.state.ResTypeMismatch.Inc(1)
+		return
+	}
+
+	// Note: ContentLength is -1 if unknown (eg. chunked response)
+	if res.ContentLength >= 0 && res.ContentLength < rule.MinLength {
+		m.state.ResTooSmall.Inc(1)
+		return
+	}
+
+	// response varies on Accept-Encoding from now on
+	addVary(res.Header, "Accept-Encoding")
+
+	encoding := negotiateEncoding(req.HttpRequest.Header, rule.Encodings)
+	if len(encoding) == 0 {
+		m.state.ResNotAccepted.Inc(1)
+		return
+	}
+
+	body, err := newCompressReader(res.Body, encoding, rule.level(encoding))
+	if err != nil {
+		log.Logger.Warn("%s newCompressReader(%s) err: %s", m.name, encoding, err)
+		m.state.ResCompressErr.Inc(1)
+		return
+	}
+
+	// Note: Content-Length is removed, response is sent in chunked encoding
+	// (HTTP/1.1) or as data frames (HTTP/2, SPDY)
+	res.Body = body
+	res.ContentLength = -1
+	res.Header.Del("Content-Length")
+	res.Header.Del("Accept-Ranges")
+	res.Header.Set("Content-Encoding", encoding)
+	weakenETag(res.Header)
+
+	if openDebug {
+		log.Logger.Debug("%s compress response with %s", m.name, encoding)
+	}
+	if encoding == EncodingBrotli {
+		m.state.ResBrotli.Inc(1)
+	} else {
+		m.state.ResGzip.Inc(1)
+	}
+}
+
+// compressible checks whether response could be compressed.
+func compressible(req *bfe_basic.Request, res *bfe_http.Response) bool {
+	if res == nil || res.Body == nil || res.ContentLength == 0 {
+		return false
+	}
+
+	if req.HttpRequest.Method == "HEAD" {
+		return false
+	}
+
+	switch {
+	case res.StatusCode < bfe_http.StatusOK,
+		res.StatusCode == bfe_http.StatusNoContent,
+		res.StatusCode == bfe_http.StatusPartialContent,
+		res.StatusCode == bfe_http.StatusNotModified:
+		return false
+	}
+
+	// already encoded
+	if encoding := res.Header.Get("Content-Encoding"); encoding != "" &&
+		!strings.EqualFold(encoding, "identity") {
+		return false
+	}
+
+	// transformation is not allowed
+	for _, value := range res.Header["Cache-Control"] {
+		if strings.Contains(strings.ToLower(value), "no-transform") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// addVary adds field to Vary header if not present.
+func addVary(header bfe_http.Header, field string) {
+	for _, value := range header["Vary"] {
+		for _, f := range strings.Split(value, ",") {
+			f = strings.TrimSpace(f)
+			if f == "*" || strings.EqualFold(f, field) {
+				return
+			}
+		}
+	}
+
+	header.Add("Vary", field)
+}
+
+// weakenETag converts strong ETag to weak ETag, since compressed
+// response is not byte-for-byte identical with original one.
+func weakenETag(header bfe_http.Header) {
+	etag := header.Get("ETag")
+	if len(etag) != 0 && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+func (m *ModuleCompress) getState(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetAll()
+	return s.Format(params)
+}
+
+func (m *ModuleCompress) getStateDiff(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetDiff()
+	return s.Format(params)
+}
+
+func (m *ModuleCompress) monitorHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name:           m.getState,
+		m.name + ".diff": m.getStateDiff,
+	}
+	return handlers
+}
+
+func (m *ModuleCompress) reloadHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name + ".product_rule_table": m.loadProductRuleConf,
+	}
+	return handlers
+}
+
+func (m *ModuleCompress) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHandlers,
+	cr string) error {
+	var conf *ConfModCompress
+	var err error
+
+	// load module config
+	confPath := bfe_module.ModConfPath(cr, m.name)
+	if conf, err = ConfLoad(confPath, cr); err != nil {
+		return fmt.Errorf("%s: conf load err %s", m.name, err.Error())
+	}
+
+	m.productRulePath = conf.Basic.ProductRulePath
+	openDebug = conf.Log.OpenDebug
+
+	// load conf data
+	if err = m.loadProductRuleConf(nil); err != nil {
+		return fmt.Errorf("%s: loadProductRuleConf() err %s", m.name, err.Error())
+	}
+
+	// register handler
+	err = cbs.AddFilter(bfe_module.HANDLE_READ_BACKEND, m.compressHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.compressHandler): %s", m.name, err.Error())
+	}
+
+	// register web handler for monitor
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_MONITOR, m.monitorHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.monitorHandlers): %s", m.name, err.Error())
+	}
+	// register web handler for reload
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_RELOAD, m.reloadHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.reloadHandlers): %s", m.name, err.Error())
+	}
+
+	return nil
+}
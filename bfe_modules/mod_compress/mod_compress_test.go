@@ -0,0 +1,177 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_compress
+
+import (
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+var body = strings.Repeat("hello bfe! ", 200)
+
+func prepareModule() *ModuleCompress {
+	m := NewModuleCompress()
+	m.Init(bfe_module.NewBfeCallbacks(), web_monitor.NewWebHandlers(), "./testdata")
+	return m
+}
+
+func prepareRequest(path string, acceptEncoding string) *bfe_basic.Request {
+	request := new(bfe_basic.Request)
+	request.HttpRequest = new(bfe_http.Request)
+	request.HttpRequest.Method = "GET"
+	request.HttpRequest.Header = make(bfe_http.Header)
+	request.HttpRequest.Header.Set("Accept-Encoding", acceptEncoding)
+	request.HttpRequest.URL, _ = url.Parse(path)
+	request.Session = new(bfe_basic.Session)
+	request.Context = make(map[interface{}]interface{})
+	request.Route = bfe_basic.RequestRoute{Product: "pn"}
+	return request
+}
+
+func prepareResponse(contentType string, body string) *bfe_http.Response {
+	res := new(bfe_http.Response)
+	res.StatusCode = bfe_http.StatusOK
+	res.Header = make(bfe_http.Header)
+	res.Header.Set("Content-Type", contentType)
+	res.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	res.Header.Set("ETag", "\"abc\"")
+	res.ContentLength = int64(len(body))
+	res.Body = ioutil.NopCloser(strings.NewReader(body))
+	return res
+}
+
+func TestCompressGzip(t *testing.T) {
+	m := prepareModule()
+
+	req := prepareRequest("/gzip", "gzip, br")
+	res := prepareResponse("text/html; charset=utf-8", body)
+	if ret := m.compressHandler(req, res); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("compressHandler() should return GOON")
+	}
+
+	if res.Header.Get("Content-Encoding") != EncodingGzip {
+		t.Errorf("Content-Encoding should be gzip")
+	}
+	if res.Header.Get("Content-Length") != "" || res.ContentLength != -1 {
+		t.Errorf("Content-Length should be removed")
+	}
+	if res.Header.Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Vary should be Accept-Encoding")
+	}
+	if res.Header.Get("ETag") != "W/\"abc\"" {
+		t.Errorf("ETag should be weak")
+	}
+	if data, _ := ioutil.ReadAll(res.Body); len(data) == 0 || len(data) >= len(body) {
+		t.Errorf("body should be compressed")
+	}
+}
+
+func TestCompressBrotli(t *testing.T) {
+	m := prepareModule()
+
+	req := prepareRequest("/", "gzip, br")
+	res := prepareResponse("application/json", body)
+	res.Header.Set("Vary", "Origin")
+	m.compressHandler(req, res)
+
+	if res.Header.Get("Content-Encoding") != EncodingBrotli {
+		t.Errorf("Content-Encoding should be br")
+	}
+	if vary := res.Header["Vary"]; len(vary) != 2 || vary[1] != "Accept-Encoding" {
+		t.Errorf("Vary should contain Origin and Accept-Encoding: %v", vary)
+	}
+}
+
+func TestCompressSkip(t *testing.T) {
+	m := prepareModule()
+
+	// content type not matched
+	req := prepareRequest("/gzip", "gzip")
+	res := prepareResponse("image/png", body)
+	m.compressHandler(req, res)
+	if res.Header.Get("Content-Encoding") != "" || res.Header.Get("Vary") != "" {
+		t.Errorf("image/png should not be compressed")
+	}
+
+	// too small
+	res = prepareResponse("text/html", "hello")
+	m.compressHandler(req, res)
+	if res.Header.Get("Content-Encoding") != "" {
+		t.Errorf("small response should not be compressed")
+	}
+
+	// already encoded
+	res = prepareResponse("text/html", body)
+	res.Header.Set("Content-Encoding", "gzip")
+	res.Header.Set("Vary", "Accept-Encoding")
+	m.compressHandler(req, res)
+	if res.Header.Get("Content-Length") == "" {
+		t.Errorf("encoded response should not be compressed")
+	}
+
+	// partial content
+	res = prepareResponse("text/html", body)
+	res.StatusCode = bfe_http.StatusPartialContent
+	m.compressHandler(req, res)
+	if res.Header.Get("Content-Encoding") != "" {
+		t.Errorf("partial response should not be compressed")
+	}
+
+	// encoding not accepted
+	req = prepareRequest("/gzip", "br")
+	res = prepareResponse("text/html", body)
+	m.compressHandler(req, res)
+	if res.Header.Get("Content-Encoding") != "" {
+		t.Errorf("response should not be compressed")
+	}
+	if res.Header.Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Vary should be Accept-Encoding")
+	}
+
+	// product without rules
+	req = prepareRequest("/gzip", "gzip")
+	req.Route.Product = "unknown"
+	res = prepareResponse("text/html", body)
+	m.compressHandler(req, res)
+	if res.Header.Get("Content-Encoding") != "" {
+		t.Errorf("response should not be compressed")
+	}
+}
+
+func TestModuleMisc(t *testing.T) {
+	m := prepareModule()
+	if s, _ := m.getState(nil); s == nil {
+		t.Errorf("Should return valid state")
+	}
+	if m.monitorHandlers() == nil {
+		t.Errorf("Should return valid monitor handlers")
+	}
+	if m.reloadHandlers() == nil {
+		t.Errorf("Should return valid reload handlers")
+	}
+}
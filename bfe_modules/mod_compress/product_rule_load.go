@@ -0,0 +1,307 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_compress
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+import (
+	"github.com/andybalholm/brotli"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic/condition"
+)
+
+const (
+	DefaultMinLength     = 1024
+	DefaultGzipLevel     = 6
+	DefaultBrotliQuality = 4
+)
+
+var (
+	// default content types to compress
+	DefaultContentTypes = []string{
+		"text/html",
+		"text/plain",
+		"text/css",
+		"text/xml",
+		"text/javascript",
+		"application/javascript",
+		"application/json",
+		"application/xml",
+	}
+
+	// default content codings, in order of preference
+	DefaultEncodings = []string{EncodingBrotli, EncodingGzip}
+)
+
+var (
+	errUnknownEncoding = errors.New("unknown encoding")
+)
+
+type compressRuleFile struct {
+	Cond          *string  // condition for compress
+	Encodings     []string // content codings in order of preference, gzip or br
+	ContentTypes  []string // content types to compress, eg. text/html, text/*
+	MinLength     *int64   // min length of response body to compress
+	GzipLevel     *int     // compression level for gzip, 1-9
+	BrotliQuality *int     // compression quality for br, 0-11
+}
+
+type compressRule struct {
+	Cond          condition.Condition // condition for compress
+	Encodings     []string            // content codings in order of preference
+	ContentTypes  []string            // content types to compress
+	MinLength     int64               // min length of response body to compress
+	GzipLevel     int                 // compression level for gzip
+	BrotliQuality int                 // compression quality for br
+}
+
+type compressRuleFileList []compressRuleFile
+type compressRuleList []compressRule
+
+type ProductRulesFile map[string]*compressRuleFileList // product => list of compress rules
+type ProductRules map[string]*compressRuleList
+
+type productRuleConfFile struct {
+	Version *string // version of the config
+	Config  *ProductRulesFile
+}
+
+type productRuleConf struct {
+	Version string       // version of the config
+	Config  ProductRules // product rules for compress
+}
+
+func compressRuleCheck(conf compressRuleFile) error {
+	// check Cond
+	if conf.Cond == nil {
+		return errors.New("no Cond")
+	}
+
+	// check Encodings
+	for _, encoding := range conf.Encodings {
+		if encoding != EncodingGzip && encoding != EncodingBrotli {
+			return fmt.Errorf("Encodings: %s %s", errUnknownEncoding.Error(), encoding)
+		}
+	}
+
+	// check ContentTypes
+	for _, contentType := range conf.ContentTypes {
+		if !strings.Contains(contentType, "/") {
+			return fmt.Errorf("ContentTypes: invalid content type %s", contentType)
+		}
+	}
+
+	// check MinLength
+	if conf.MinLength != nil && *conf.MinLength < 0 {
+		return errors.New("MinLength should not be negative")
+	}
+
+	// check GzipLevel
+	if conf.GzipLevel != nil &&
+		(*conf.GzipLevel < gzip.BestSpeed || *conf.GzipLevel > gzip.BestCompression) {
+		return fmt.Errorf("GzipLevel should be in [%d, %d]", gzip.BestSpeed, gzip.BestCompression)
+	}
+
+	// check BrotliQuality
+	if conf.BrotliQuality != nil &&
+		(*conf.BrotliQuality < brotli.BestSpeed || *conf.BrotliQuality > brotli.BestCompression) {
+		return fmt.Errorf("BrotliQuality should be in [%d, %d]", brotli.BestSpeed, brotli.BestCompression)
+	}
+
+	return nil
+}
+
+func compressRuleListCheck(conf *compressRuleFileList) error {
+	for index, rule := range *conf {
+		err := compressRuleCheck(rule)
+		if err != nil {
+			return fmt.Errorf("compressRule:%d, %s", index, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRulesCheck(conf *ProductRulesFile) error {
+	for product, ruleList := range *conf {
+		if ruleList == nil {
+			return fmt.Errorf("no compressRuleList for product:%s", product)
+		}
+
+		err := compressRuleListCheck(ruleList)
+		if err != nil {
+			return fmt.Errorf("ProductRules:%s, %s", product, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRuleConfCheck(conf productRuleConfFile) error {
+	var err error
+
+	// check Version
+	if conf.Version == nil {
+		return errors.New("no Version")
+	}
+
+	// check Config
+	if conf.Config == nil {
+		return errors.New("no Config")
+	}
+
+	err = productRulesCheck(conf.Config)
+	if err != nil {
+		return fmt.Errorf("Config:%s", err.Error())
+	}
+
+	return nil
+}
+
+func ruleConvert(ruleFile compressRuleFile, product string) (compressRule, error) {
+	rule := compressRule{}
+
+	cond, err := condition.BuildWithProduct(*ruleFile.Cond, product)
+	if err != nil {
+		return rule, err
+	}
+	rule.Cond = cond
+
+	rule.Encodings = ruleFile.Encodings
+	if len(rule.Encodings) == 0 {
+		rule.Encodings = DefaultEncodings
+	}
+
+	rule.ContentTypes = DefaultContentTypes
+	if len(ruleFile.ContentTypes) != 0 {
+		rule.ContentTypes = make([]string, 0, len(ruleFile.ContentTypes))
+		for _, contentType := range ruleFile.ContentTypes {
+			rule.ContentTypes = append(rule.ContentTypes, strings.ToLower(contentType))
+		}
+	}
+
+	rule.MinLength = DefaultMinLength
+	if ruleFile.MinLength != nil {
+		rule.MinLength = *ruleFile.MinLength
+	}
+
+	rule.GzipLevel = DefaultGzipLevel
+	if ruleFile.GzipLevel != nil {
+		rule.GzipLevel = *ruleFile.GzipLevel
+	}
+
+	rule.BrotliQuality = DefaultBrotliQuality
+	if ruleFile.BrotliQuality != nil {
+		rule.BrotliQuality = *ruleFile.BrotliQuality
+	}
+
+	return rule, nil
+}
+
+func ruleListConvert(ruleFileList *compressRuleFileList, product string) (*compressRuleList, error) {
+	ruleList := new(compressRuleList)
+	*ruleList = make([]compressRule, 0)
+
+	for _, ruleFile := range *ruleFileList {
+		rule, err := ruleConvert(ruleFile, product)
+		if err != nil {
+			return nil, err
+		}
+		*ruleList = append(*ruleList, rule)
+	}
+
+	return ruleList, nil
+}
+
+// matchContentType checks whether content type of response is to compress.
+func (r *compressRule) matchContentType(contentType string) bool {
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	if len(contentType) == 0 {
+		return false
+	}
+
+	for _, t := range r.ContentTypes {
+		if t == contentType {
+			return true
+		}
+
+		// wildcard, eg. text/*
+		if strings.HasSuffix(t, "/*") && strings.HasPrefix(contentType, t[:len(t)-1]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// level returns compression level for encoding.
+func (r *compressRule) level(encoding string) int {
+	if encoding == EncodingBrotli {
+		return r.BrotliQuality
+	}
+	return r.GzipLevel
+}
+
+// ProductRuleConfLoad load compress rule config from file.
+func ProductRuleConfLoad(filename string) (productRuleConf, error) {
+	var conf productRuleConf
+	var err error
+
+	// open the file
+	file, err := os.Open(filename)
+	if err != nil {
+		return conf, err
+	}
+	defer file.Close()
+
+	// decode the file
+	decoder := json.NewDecoder(file)
+	var config productRuleConfFile
+	err = decoder.Decode(&config)
+	if err != nil {
+		return conf, err
+	}
+
+	// check config
+	err = productRuleConfCheck(config)
+	if err != nil {
+		return conf, err
+	}
+
+	// convert config
+	conf.Version = *config.Version
+	conf.Config = make(ProductRules)
+	for product, ruleFileList := range *config.Config {
+		ruleList, err := ruleListConvert(ruleFileList, product)
+		if err != nil {
+			return conf, err
+		}
+		conf.Config[product] = ruleList
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_compress
+
+import (
+	"testing"
+)
+
+func TestCompressRuleConfLoad(t *testing.T) {
+	config, err := ProductRuleConfLoad("./testdata/mod_compress/compress_rules.data")
+	if err != nil {
+		t.Fatalf("get err from ProductRuleConfLoad():%s", err.Error())
+	}
+
+	rules := *config.Config["pn"]
+	if len(rules) != 2 {
+		t.Fatalf("len(config.Config['pn']) should be 2")
+	}
+
+	// rule with explicit values
+	if rules[0].MinLength != 10 || rules[0].GzipLevel != 9 || len(rules[0].Encodings) != 1 {
+		t.Errorf("unexpected rule: %+v", rules[0])
+	}
+
+	// rule with default values
+	if rules[1].MinLength != DefaultMinLength || rules[1].GzipLevel != DefaultGzipLevel ||
+		rules[1].BrotliQuality != DefaultBrotliQuality || len(rules[1].Encodings) != 2 {
+		t.Errorf("unexpected rule: %+v", rules[1])
+	}
+}
+
+func TestCompressRuleConfLoadInvalid(t *testing.T) {
+	files := []string{
+		"./testdata/compress_rules_1.data", // unknown encoding
+		"./testdata/compress_rules_2.data", // invalid gzip level
+		"./testdata/compress_rules_3.data", // no cond
+	}
+
+	for _, file := range files {
+		if _, err := ProductRuleConfLoad(file); err == nil {
+			t.Errorf("err should not be nil for %s", file)
+		}
+	}
+}
+
+func TestMatchContentType(t *testing.T) {
+	rule := compressRule{ContentTypes: []string{"text/*", "application/json"}}
+
+	cases := map[string]bool{
+		"text/html":                       true,
+		"text/plain; charset=utf-8":       true,
+		"Application/JSON; charset=utf-8": true,
+		"application/javascript":          false,
+		"image/png":                       false,
+		"":                                false,
+	}
+	for contentType, expect := range cases {
+		if rule.matchContentType(contentType) != expect {
+			t.Errorf("matchContentType(%q) should be %v", contentType, expect)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// module for cross-origin resource sharing (CORS)
+
+package mod_cors
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/web-monitor/metrics"
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+const (
+	ModCors     = "mod_cors"
+	CtxCorsInfo = "mod_cors.cors_info"
+)
+
+// request headers of cors
+const (
+	HeaderOrigin                      = "Origin"
+	HeaderAccessControlRequestMethod  = "Access-Control-Request-Method"
+	HeaderAccessControlRequestHeaders = "Access-Control-Request-Headers"
+)
+
+// response headers of cors
+const (
+	HeaderAccessControlAllowOrigin      = "Access-Control-Allow-Origin"
+	HeaderAccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	HeaderAccessControlAllowMethods     = "Access-Control-Allow-Methods"
+	HeaderAccessControlAllowHeaders     = "Access-Control-Allow-Headers"
+	HeaderAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
+	HeaderAccessControlMaxAge           = "Access-Control-Max-Age"
+)
+
+var (
+	openDebug = false
+)
+
+type ModuleCorsState struct {
+	ReqTotal         *metrics.Counter // all request in
+	ReqToCheck       *metrics.Counter // cors request with condition satisfied
+	OriginDenied     *metrics.Counter // cors request from origin not allowed
+	PreflightAllowed *metrics.Counter // preflight request allowed
+	PreflightDenied  *metrics.Counter // preflight request denied
+	ResWithCors      *metrics.Counter // response with cors headers added
+}
+
+// corsInfo is cors info of request, passed from HANDLE_FOUND_PRODUCT
+// to HANDLE_READ_BACKEND.
+type corsInfo struct {
+	rule   *corsRule // cors rule matched
+	origin string    // origin of request
+}
+
+type ModuleCors struct {
+	name    string          // name of module
+	state   ModuleCorsState // module state
+	metrics metrics.Metrics
+
+	productRulePath string            // path of cors rule data file
+	ruleTable       *ProductRuleTable // table for product cors rules
+}
+
+func NewModuleCors() *ModuleCors {
+	m := new(ModuleCors)
+	m.name = ModCors
+	m.metrics.Init(&m.state, ModCors, 0)
+
+	m.ruleTable = NewProductRuleTable()
+
+	return m
+}
+
+func (m *ModuleCors) Name() string {
+	return m.name
+}
+
+func (m *ModuleCors) State() interface{} {
+	return &m.state
+}
+
+// loadProductRuleConf load from config file.
+func (m *ModuleCors) loadProductRuleConf(query url.Values) error {
+	// get path
+	path := query.Get("path")
+	if path == "" {
+		// use default
+		path = m.productRulePath
+	}
+
+	// load file
+	conf, err := ProductRuleConfLoad(path)
+	if err != nil {
+		return fmt.Errorf("err in ProductRuleConfLoad(%s):%s", path, err)
+	}
+
+	m.ruleTable.Update(conf)
+	return nil
+}
+
+// originAllowed checks whether origin is allowed by rule.
+func (rule *corsRule) originAllowed(origin string) bool {
+	if rule.AllowAllOrigins {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	for _, allowed := range rule.AllowedOrigins {
+		if origin == allowed {
+			return true
+		}
+	}
+	if len(rule.AllowedOriginSuffixes) != 0 && rule.hostSuffixAllowed(origin) {
+		return true
+	}
+	for _, reg := range rule.AllowedOriginRegexes {
+		if reg.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hostSuffixAllowed checks whether host of origin matches suffixes of rule.
+// Only https origins are allowed unless AllowHttpOrigins is set.
+func (rule *corsRule) hostSuffixAllowed(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || len(u.Host) == 0 {
+		return false
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && rule.AllowHttpOrigins) {
+		return false
+	}
+
+	host := u.Hostname()
+	for _, suffix := range rule.AllowedOriginSuffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// methodAllowed checks whether method is allowed by rule.
+func (rule *corsRule) methodAllowed(method string) bool {
+	method = strings.ToUpper(method)
+	for _, allowed := range rule.AllowedMethods {
+		if method == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// headersAllowed checks whether request headers (value of
+// Access-Control-Request-Headers) are allowed by rule.
+func (rule *corsRule) headersAllowed(headers string) bool {
+	if rule.AllowAllHeaders {
+		return true
+	}
+
+	for _, header := range strings.Split(headers, ",") {
+		header = strings.TrimSpace(header)
+		if len(header) == 0 {
+			continue
+		}
+
+		header = bfe_http.CanonicalHeaderKey(header)
+		allowed := false
+		for _, h := range rule.AllowedHeaders {
+			if header == h {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isPreflight checks whether request is a cors preflight request.
+func isPreflight(req *bfe_http.Request) bool {
+	return req.Method == "OPTIONS" && len(req.Header.Get(HeaderAccessControlRequestMethod)) != 0
+}
+
+// addVary adds field to Vary header of response.
+func addVary(header bfe_http.Header, field string) {
+	for _, value := range header["Vary"] {
+		for _, f := range strings.Split(value, ",") {
+			f = strings.TrimSpace(f)
+			if f == "*" || strings.EqualFold(f, field) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", field)
+}
+
+// setAllowOrigin sets Access-Control-Allow-Origin and Access-Control-Allow-Credentials.
+func setAllowOrigin(header bfe_http.Header, rule *corsRule, origin string) {
+	if rule.AllowAllOrigins && !rule.AllowCredentials {
+		header.Set(HeaderAccessControlAllowOrigin, "*")
+	} else {
+		header.Set(HeaderAccessControlAllowOrigin, origin)
+		addVary(header, HeaderOrigin)
+	}
+
+	if rule.AllowCredentials {
+		header.Set(HeaderAccessControlAllowCredentials, "true")
+	}
+}
+
+// createPreflightResp creates response for allowed preflight request.
+func createPreflightResp(req *bfe_basic.Request, rule *corsRule, origin string) *bfe_http.Response {
+	res := bfe_basic.CreateInternalResp(req, bfe_http.StatusNoContent)
+	header := res.Header
+
+	setAllowOrigin(header, rule, origin)
+	header.Set(HeaderAccessControlAllowMethods, strings.Join(rule.AllowedMethods, ", "))
+
+	reqHeaders := req.HttpRequest.Header.Get(HeaderAccessControlRequestHeaders)
+	if rule.AllowAllHeaders {
+		if len(reqHeaders) != 0 {
+			header.Set(HeaderAccessControlAllowHeaders, reqHeaders)
+		}
+		addVary(header, HeaderAccessControlRequestHeaders)
+	} else if len(rule.AllowedHeaders) != 0 {
+		header.Set(HeaderAccessControlAllowHeaders, strings.Join(rule.AllowedHeaders, ", "))
+	}
+
+	if rule.MaxAge >= 0 {
+		header.Set(HeaderAccessControlMaxAge, strconv.Itoa(rule.MaxAge))
+	}
+
+	return res
+}
+
+// corsRequestHandler is a handler for checking cors request, preflight
+// request is responded directly.
+func (m *ModuleCors) corsRequestHandler(req *bfe_basic.Request) (int, *bfe_http.Response) {
+	m.state.ReqTotal.Inc(1)
+
+	origin := req.HttpRequest.Header.Get(HeaderOrigin)
+	if len(origin) == 0 {
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	// find cors rules for given request
+	rules, ok := m.ruleTable.Search(req.Route.Product)
+	if !ok {
+		if openDebug {
+			log.Logger.Debug("%s product %s not found, just pass",
+				m.name, req.Route.Product)
+		}
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	for i := range *rules {
+		rule := &(*rules)[i]
+		if !rule.Cond.Match(req) {
+			continue
+		}
+		m.state.ReqToCheck.Inc(1)
+
+		preflight := isPreflight(req.HttpRequest)
+		if !rule.originAllowed(origin) {
+			m.state.OriginDenied.Inc(1)
+			if openDebug {
+				log.Logger.Debug("%s origin not allowed: %s", m.name, origin)
+			}
+			if preflight {
+				m.state.PreflightDenied.Inc(1)
+				return bfe_module.BFE_HANDLER_RESPONSE, bfe_basic.CreateForbiddenResp(req)
+			}
+			return bfe_module.BFE_HANDLER_GOON, nil
+		}
+
+		if preflight {
+			header := req.HttpRequest.Header
+			if !rule.methodAllowed(header.Get(HeaderAccessControlRequestMethod)) ||
+				!rule.headersAllowed(header.Get(HeaderAccessControlRequestHeaders)) {
+				m.state.PreflightDenied.Inc(1)
+				if openDebug {
+					log.Logger.Debug("%s preflight not allowed: method %s, headers %s", m.name,
+						header.Get(HeaderAccessControlRequestMethod),
+						header.Get(HeaderAccessControlRequestHeaders))
+				}
+				return bfe_module.BFE_HANDLER_RESPONSE, bfe_basic.CreateForbiddenResp(req)
+			}
+
+			m.state.PreflightAllowed.Inc(1)
+			return bfe_module.BFE_HANDLER_RESPONSE, createPreflightResp(req, rule, origin)
+		}
+
+		req.SetContext(CtxCorsInfo, &corsInfo{rule: rule, origin: origin})
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	return bfe_module.BFE_HANDLER_GOON, nil
+}
+
+// corsResponseHandler is a handler for adding cors headers to response.
+func (m *ModuleCors) corsResponseHandler(req *bfe_basic.Request, res *bfe_http.Response) int {
+	info, ok := req.GetContext(CtxCorsInfo).(*corsInfo)
+	if !ok || res == nil {
+		return bfe_module.BFE_HANDLER_GOON
+	}
+	rule := info.rule
+	header := res.Header
+
+	// cors headers from backend are overwritten
+	header.Del(HeaderAccessControlAllowOrigin)
+	header.Del(HeaderAccessControlAllowCredentials)
+	header.Del(HeaderAccessControlExposeHeaders)
+
+	setAllowOrigin(header, rule, info.origin)
+	if len(rule.ExposedHeaders) != 0 {
+		header.Set(HeaderAccessControlExposeHeaders, strings.Join(rule.ExposedHeaders, ", "))
+	}
+
+	m.state.ResWithCors.Inc(1)
+	return bfe_module.BFE_HANDLER_GOON
+}
+
+func (m *ModuleCors) getState(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetAll()
+	return s.Format(params)
+}
+
+func (m *ModuleCors) getStateDiff(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetDiff()
+	return s.Format(params)
+}
+
+func (m *ModuleCors) monitorHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name:           m.getState,
+		m.name + ".diff": m.getStateDiff,
+	}
+	return handlers
+}
+
+func (m *ModuleCors) reloadHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name + ".product_rule_table": m.loadProductRuleConf,
+	}
+	return handlers
+}
+
+func (m *ModuleCors) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHandlers,
+	cr string) error {
+	var conf *ConfModCors
+	var err error
+
+	// load module config
+	confPath := bfe_module.ModConfPath(cr, m.name)
+	if conf, err = ConfLoad(confPath, cr); err != nil {
+		return fmt.Errorf("%s: conf load err %s", m.name, err.Error())
+	}
+
+	m.productRulePath = conf.Basic.ProductRulePath
+	openDebug = conf.Log.OpenDebug
+
+	// load conf data
+	if err = m.loadProductRuleConf(nil); err != nil {
+		return fmt.Errorf("%s: loadProductRuleConf() err %s", m.name, err.Error())
+	}
+
+	// register handler
+	err = cbs.AddFilter(bfe_module.HANDLE_FOUND_PRODUCT, m.corsRequestHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.corsRequestHandler): %s", m.name, err.Error())
+	}
+
+	err = cbs.AddFilter(bfe_module.HANDLE_READ_BACKEND, m.corsResponseHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.corsResponseHandler): %s", m.name, err.Error())
+	}
+
+	// register web handler for monitor
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_MONITOR, m.monitorHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.monitorHandlers): %s", m.name, err.Error())
+	}
+	// register web handler for reload
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_RELOAD, m.reloadHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.reloadHandlers): %s", m.name, err.Error())
+	}
+
+	return nil
+}
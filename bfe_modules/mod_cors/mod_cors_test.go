@@ -0,0 +1,214 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_cors
+
+import (
+	"net/url"
+	"testing"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+	"github.com/baidu/bfe/bfe_modules/mod_auth_basic"
+)
+
+func prepareModule(t *testing.T) *ModuleCors {
+	m := NewModuleCors()
+	err := m.Init(bfe_module.NewBfeCallbacks(), web_monitor.NewWebHandlers(), "./testdata")
+	if err != nil {
+		t.Fatalf("Init(): %s", err)
+	}
+	return m
+}
+
+func prepareRequest(method string, path string, origin string) *bfe_basic.Request {
+	request := new(bfe_basic.Request)
+	request.HttpRequest = new(bfe_http.Request)
+	request.HttpRequest.Method = method
+	request.HttpRequest.Header = make(bfe_http.Header)
+	request.HttpRequest.URL, _ = url.Parse(path)
+	request.Session = new(bfe_basic.Session)
+	request.Context = make(map[interface{}]interface{})
+	request.Route = bfe_basic.RequestRoute{Product: "pn"}
+	if len(origin) != 0 {
+		request.HttpRequest.Header.Set(HeaderOrigin, origin)
+	}
+	return request
+}
+
+func prepareResponse() *bfe_http.Response {
+	res := new(bfe_http.Response)
+	res.StatusCode = bfe_http.StatusOK
+	res.Header = make(bfe_http.Header)
+	return res
+}
+
+func TestPreflight(t *testing.T) {
+	m := prepareModule(t)
+
+	// allowed preflight
+	req := prepareRequest("OPTIONS", "/api/users", "https://a.example.com")
+	req.HttpRequest.Header.Set(HeaderAccessControlRequestMethod, "PUT")
+	req.HttpRequest.Header.Set(HeaderAccessControlRequestHeaders, "content-type, x-requested-with")
+	ret, res := m.corsRequestHandler(req)
+	if ret != bfe_module.BFE_HANDLER_RESPONSE || res.StatusCode != bfe_http.StatusNoContent {
+		t.Fatalf("corsRequestHandler() should return 204")
+	}
+	expects := map[string]string{
+		HeaderAccessControlAllowOrigin:      "https://a.example.com",
+		HeaderAccessControlAllowCredentials: "true",
+		HeaderAccessControlAllowMethods:     "GET, POST, PUT",
+		HeaderAccessControlAllowHeaders:     "Content-Type, X-Requested-With",
+		HeaderAccessControlMaxAge:           "600",
+		"Vary":                              "Origin",
+	}
+	for key, value := range expects {
+		if res.Header.Get(key) != value {
+			t.Errorf("%s should be %s, got %s", key, value, res.Header.Get(key))
+		}
+	}
+
+	// method not allowed
+	req = prepareRequest("OPTIONS", "/api/users", "https://a.example.com")
+	req.HttpRequest.Header.Set(HeaderAccessControlRequestMethod, "DELETE")
+	ret, res = m.corsRequestHandler(req)
+	if ret != bfe_module.BFE_HANDLER_RESPONSE || res.StatusCode != bfe_http.StatusForbidden {
+		t.Errorf("corsRequestHandler() should return 403 for method not allowed")
+	}
+
+	// header not allowed
+	req = prepareRequest("OPTIONS", "/api/users", "https://a.example.com")
+	req.HttpRequest.Header.Set(HeaderAccessControlRequestMethod, "GET")
+	req.HttpRequest.Header.Set(HeaderAccessControlRequestHeaders, "X-Custom")
+	ret, res = m.corsRequestHandler(req)
+	if ret != bfe_module.BFE_HANDLER_RESPONSE || res.StatusCode != bfe_http.StatusForbidden {
+		t.Errorf("corsRequestHandler() should return 403 for header not allowed")
+	}
+
+	// origin not allowed
+	req = prepareRequest("OPTIONS", "/api/users", "https://evil.org")
+	req.HttpRequest.Header.Set(HeaderAccessControlRequestMethod, "GET")
+	ret, res = m.corsRequestHandler(req)
+	if ret != bfe_module.BFE_HANDLER_RESPONSE || res.StatusCode != bfe_http.StatusForbidden {
+		t.Errorf("corsRequestHandler() should return 403 for origin not allowed")
+	}
+
+	// all origins and headers allowed
+	req = prepareRequest("OPTIONS", "/public/data", "https://any.org")
+	req.HttpRequest.Header.Set(HeaderAccessControlRequestMethod, "GET")
+	req.HttpRequest.Header.Set(HeaderAccessControlRequestHeaders, "X-Custom")
+	ret, res = m.corsRequestHandler(req)
+	if ret != bfe_module.BFE_HANDLER_RESPONSE || res.StatusCode != bfe_http.StatusNoContent {
+		t.Fatalf("corsRequestHandler() should return 204")
+	}
+	if res.Header.Get(HeaderAccessControlAllowOrigin) != "*" ||
+		res.Header.Get(HeaderAccessControlAllowHeaders) != "X-Custom" ||
+		res.Header.Get(HeaderAccessControlAllowCredentials) != "" ||
+		res.Header.Get(HeaderAccessControlMaxAge) != "" {
+		t.Errorf("unexpected header of response: %v", res.Header)
+	}
+
+	if m.state.PreflightAllowed.Get() != 2 || m.state.PreflightDenied.Get() != 3 ||
+		m.state.OriginDenied.Get() != 1 {
+		t.Errorf("unexpected state: %+v", m.state)
+	}
+}
+
+func TestCorsResponse(t *testing.T) {
+	m := prepareModule(t)
+
+	// allowed origin, headers from backend are overwritten
+	req := prepareRequest("GET", "/api/users", "https://www.example.org")
+	if ret, _ := m.corsRequestHandler(req); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Fatalf("corsRequestHandler() should return GOON")
+	}
+	res := prepareResponse()
+	res.Header.Set(HeaderAccessControlAllowOrigin, "*")
+	res.Header.Set("Vary", "Accept-Encoding")
+	m.corsResponseHandler(req, res)
+	if res.Header.Get(HeaderAccessControlAllowOrigin) != "https://www.example.org" ||
+		res.Header.Get(HeaderAccessControlAllowCredentials) != "true" ||
+		res.Header.Get(HeaderAccessControlExposeHeaders) != "X-Request-Id" ||
+		len(res.Header["Vary"]) != 2 {
+		t.Errorf("unexpected header of response: %v", res.Header)
+	}
+
+	// origin not allowed
+	req = prepareRequest("GET", "/api/users", "https://evil.org")
+	if ret, _ := m.corsRequestHandler(req); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Fatalf("corsRequestHandler() should return GOON")
+	}
+	res = prepareResponse()
+	m.corsResponseHandler(req, res)
+	if res.Header.Get(HeaderAccessControlAllowOrigin) != "" {
+		t.Errorf("no cors header should be added for origin not allowed")
+	}
+
+	// request without origin
+	req = prepareRequest("GET", "/api/users", "")
+	m.corsRequestHandler(req)
+	res = prepareResponse()
+	m.corsResponseHandler(req, res)
+	if res.Header.Get(HeaderAccessControlAllowOrigin) != "" {
+		t.Errorf("no cors header should be added for request without origin")
+	}
+
+	// condition not satisfied
+	req = prepareRequest("GET", "/other", "https://www.example.org")
+	m.corsRequestHandler(req)
+	res = prepareResponse()
+	m.corsResponseHandler(req, res)
+	if res.Header.Get(HeaderAccessControlAllowOrigin) != "" {
+		t.Errorf("no cors header should be added if condition not satisfied")
+	}
+
+	if m.state.ReqToCheck.Get() != 2 || m.state.ResWithCors.Get() != 1 {
+		t.Errorf("unexpected state: %+v", m.state)
+	}
+}
+
+func TestPreflightBeforeAuth(t *testing.T) {
+	// register modules in the order of bfe_modules
+	cbs := bfe_module.NewBfeCallbacks()
+	whs := web_monitor.NewWebHandlers()
+	if err := NewModuleCors().Init(cbs, whs, "./testdata"); err != nil {
+		t.Fatalf("mod_cors Init() error: %s", err)
+	}
+	if err := mod_auth_basic.NewModuleAuthBasic().Init(cbs, whs, "./testdata"); err != nil {
+		t.Fatalf("mod_auth_basic Init() error: %s", err)
+	}
+	hl := cbs.GetHandlerList(bfe_module.HANDLE_FOUND_PRODUCT)
+
+	// preflight without credentials is responded by mod_cors
+	req := prepareRequest("OPTIONS", "/api/users", "https://a.example.com")
+	req.HttpRequest.Header.Set(HeaderAccessControlRequestMethod, "PUT")
+	ret, res := hl.FilterRequest(req)
+	if ret != bfe_module.BFE_HANDLER_RESPONSE || res.StatusCode != bfe_http.StatusNoContent {
+		t.Errorf("preflight should be responded with 204")
+	}
+
+	// actual request without credentials is rejected by mod_auth_basic
+	req = prepareRequest("PUT", "/api/users", "https://a.example.com")
+	ret, res = hl.FilterRequest(req)
+	if ret != bfe_module.BFE_HANDLER_RESPONSE || res.StatusCode != bfe_http.StatusUnauthorized {
+		t.Errorf("request without credentials should be responded with 401")
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_cors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic/condition"
+	"github.com/baidu/bfe/bfe_http"
+)
+
+const (
+	AllowAll = "*" // allow all origins or headers
+)
+
+// default methods allowed if AllowedMethods is not set
+var defaultAllowedMethods = []string{"GET", "HEAD", "POST"}
+
+type corsRuleFile struct {
+	Cond                  *string  // condition for cors
+	AllowedOrigins        []string // origins allowed (exact match), "*" means all
+	AllowedOriginSuffixes []string // hosts of origins allowed (suffix match, starts with "."), optional
+	AllowedOriginRegexes  []string // origins allowed (regex match), optional
+	AllowHttpOrigins      bool     // whether http origins are allowed by suffix match, optional
+	AllowedMethods        []string // methods allowed, optional
+	AllowedHeaders        []string // request headers allowed, "*" means all, optional
+	ExposedHeaders        []string // response headers exposed to client, optional
+	AllowCredentials      bool     // whether credentials are allowed, optional
+	MaxAge                *int     // max age (in seconds) of preflight result, optional
+}
+
+type corsRule struct {
+	Cond                  condition.Condition // condition for cors
+	AllowAllOrigins       bool                // whether all origins are allowed
+	AllowedOrigins        []string            // origins allowed (exact match)
+	AllowedOriginSuffixes []string            // hosts of origins allowed (suffix match)
+	AllowedOriginRegexes  []*regexp.Regexp    // origins allowed (regex match)
+	AllowHttpOrigins      bool                // whether http origins are allowed by suffix match
+	AllowedMethods        []string            // methods allowed
+	AllowAllHeaders       bool                // whether all request headers are allowed
+	AllowedHeaders        []string            // request headers allowed
+	ExposedHeaders        []string            // response headers exposed to client
+	AllowCredentials      bool                // whether credentials are allowed
+	MaxAge                int                 // max age of preflight result, -1 means not set
+}
+
+type corsRuleFileList []corsRuleFile
+type corsRuleList []corsRule
+
+type ProductRulesFile map[string]*corsRuleFileList // product => list of cors rules
+type ProductRules map[string]*corsRuleList
+
+type productRuleConfFile struct {
+	Version *string // version of the config
+	Config  *ProductRulesFile
+}
+
+type productRuleConf struct {
+	Version string       // version of the config
+	Config  ProductRules // product rules for cors
+}
+
+func corsRuleCheck(conf corsRuleFile) error {
+	// check Cond
+	if conf.Cond == nil {
+		return errors.New("no Cond")
+	}
+
+	// check origins
+	if len(conf.AllowedOrigins) == 0 && len(conf.AllowedOriginSuffixes) == 0 &&
+		len(conf.AllowedOriginRegexes) == 0 {
+		return errors.New("no AllowedOrigins, AllowedOriginSuffixes or AllowedOriginRegexes")
+	}
+	for _, origin := range conf.AllowedOrigins {
+		if len(origin) == 0 {
+			return errors.New("empty origin in AllowedOrigins")
+		}
+		// credentials should never be allowed for all origins
+		if origin == AllowAll && conf.AllowCredentials {
+			return errors.New("AllowCredentials should not be used with origin \"*\"")
+		}
+	}
+	for _, suffix := range conf.AllowedOriginSuffixes {
+		// suffix should match the whole labels of host, e.g. ".example.org"
+		if len(suffix) < 2 || !strings.HasPrefix(suffix, ".") || strings.ContainsAny(suffix, ":/") {
+			return fmt.Errorf("invalid suffix in AllowedOriginSuffixes: %q", suffix)
+		}
+	}
+
+	// check methods and headers
+	for _, method := range conf.AllowedMethods {
+		if len(method) == 0 {
+			return errors.New("empty method in AllowedMethods")
+		}
+	}
+	for _, header := range conf.AllowedHeaders {
+		if len(header) == 0 {
+			return errors.New("empty header in AllowedHeaders")
+		}
+	}
+	for _, header := range conf.ExposedHeaders {
+		if len(header) == 0 {
+			return errors.New("empty header in ExposedHeaders")
+		}
+	}
+
+	// check MaxAge
+	if conf.MaxAge != nil && *conf.MaxAge < 0 {
+		return fmt.Errorf("invalid MaxAge: %d", *conf.MaxAge)
+	}
+
+	return nil
+}
+
+func corsRuleListCheck(conf *corsRuleFileList) error {
+	for index, rule := range *conf {
+		err := corsRuleCheck(rule)
+		if err != nil {
+			return fmt.Errorf("corsRule:%d, %s", index, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRulesCheck(conf *ProductRulesFile) error {
+	for product, ruleList := range *conf {
+		if ruleList == nil {
+			return fmt.Errorf("no corsRuleList for product:%s", product)
+		}
+
+		err := corsRuleListCheck(ruleList)
+		if err != nil {
+			return fmt.Errorf("ProductRules:%s, %s", product, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRuleConfCheck(conf productRuleConfFile) error {
+	var err error
+
+	// check Version
+	if conf.Version == nil {
+		return errors.New("no Version")
+	}
+
+	// check Config
+	if conf.Config == nil {
+		return errors.New("no Config")
+	}
+
+	err = productRulesCheck(conf.Config)
+	if err != nil {
+		return fmt.Errorf("Config:%s", err.Error())
+	}
+
+	return nil
+}
+
+func ruleConvert(ruleFile corsRuleFile, product string) (corsRule, error) {
+	var err error
+	rule := corsRule{}
+
+	rule.Cond, err = condition.BuildWithProduct(*ruleFile.Cond, product)
+	if err != nil {
+		return rule, err
+	}
+
+	for _, origin := range ruleFile.AllowedOrigins {
+		if origin == AllowAll {
+			rule.AllowAllOrigins = true
+			continue
+		}
+		rule.AllowedOrigins = append(rule.AllowedOrigins, strings.ToLower(origin))
+	}
+	for _, suffix := range ruleFile.AllowedOriginSuffixes {
+		rule.AllowedOriginSuffixes = append(rule.AllowedOriginSuffixes, strings.ToLower(suffix))
+	}
+	for _, expr := range ruleFile.AllowedOriginRegexes {
+		// regex should match the whole origin
+		reg, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return rule, fmt.Errorf("invalid regex %s: %s", expr, err)
+		}
+		rule.AllowedOriginRegexes = append(rule.AllowedOriginRegexes, reg)
+	}
+	rule.AllowHttpOrigins = ruleFile.AllowHttpOrigins
+
+	methods := ruleFile.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultAllowedMethods
+	}
+	for _, method := range methods {
+		rule.AllowedMethods = append(rule.AllowedMethods, strings.ToUpper(method))
+	}
+
+	for _, header := range ruleFile.AllowedHeaders {
+		if header == AllowAll {
+			rule.AllowAllHeaders = true
+			continue
+		}
+		rule.AllowedHeaders = append(rule.AllowedHeaders, bfe_http.CanonicalHeaderKey(header))
+	}
+	for _, header := range ruleFile.ExposedHeaders {
+		rule.ExposedHeaders = append(rule.ExposedHeaders, bfe_http.CanonicalHeaderKey(header))
+	}
+
+	rule.AllowCredentials = ruleFile.AllowCredentials
+	rule.MaxAge = -1
+	if ruleFile.MaxAge != nil {
+		rule.MaxAge = *ruleFile.MaxAge
+	}
+
+	return rule, nil
+}
+
+func ruleListConvert(ruleFileList *corsRuleFileList, product string) (*corsRuleList, error) {
+	ruleList := new(corsRuleList)
+	*ruleList = make([]corsRule, 0)
+
+	for _, ruleFile := range *ruleFileList {
+		rule, err := ruleConvert(ruleFile, product)
+		if err != nil {
+			return nil, err
+		}
+		*ruleList = append(*ruleList, rule)
+	}
+
+	return ruleList, nil
+}
+
+// ProductRuleConfLoad load cors rule config from file.
+func ProductRuleConfLoad(filename string) (productRuleConf, error) {
+	var conf productRuleConf
+	var err error
+
+	// open the file
+	file, err := os.Open(filename)
+	if err != nil {
+		return conf, err
+	}
+	defer file.Close()
+
+	// decode the file
+	decoder := json.NewDecoder(file)
+	var config productRuleConfFile
+	err = decoder.Decode(&config)
+	if err != nil {
+		return conf, err
+	}
+
+	// check config
+	err = productRuleConfCheck(config)
+	if err != nil {
+		return conf, err
+	}
+
+	// convert config
+	conf.Version = *config.Version
+	conf.Config = make(ProductRules)
+	for product, ruleFileList := range *config.Config {
+		ruleList, err := ruleListConvert(ruleFileList, product)
+		if err != nil {
+			return conf, err
+		}
+		conf.Config[product] = ruleList
+	}
+
+	return conf, nil
+}
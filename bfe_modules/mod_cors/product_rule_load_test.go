@@ -0,0 +1,120 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_cors
+
+import (
+	"testing"
+)
+
+func TestCorsRuleConfLoad(t *testing.T) {
+	config, err := ProductRuleConfLoad("./testdata/mod_cors/cors_rules.data")
+	if err != nil {
+		t.Fatalf("get err from ProductRuleConfLoad():%s", err.Error())
+	}
+
+	rules := *config.Config["pn"]
+	if len(rules) != 2 {
+		t.Fatalf("len(config.Config['pn']) should be 2")
+	}
+
+	rule := rules[0]
+	if rule.AllowAllOrigins || rule.AllowAllHeaders || !rule.AllowCredentials || rule.MaxAge != 600 {
+		t.Errorf("unexpected rule 0: %+v", rule)
+	}
+	if rule.AllowedMethods[0] != "GET" || rule.AllowedHeaders[0] != "Content-Type" ||
+		rule.ExposedHeaders[0] != "X-Request-Id" {
+		t.Errorf("unexpected rule 0: %+v", rule)
+	}
+
+	rule = rules[1]
+	if !rule.AllowAllOrigins || !rule.AllowAllHeaders || rule.MaxAge != -1 || len(rule.AllowedMethods) != 3 {
+		t.Errorf("unexpected rule 1: %+v", rule)
+	}
+}
+
+func TestCorsRuleConfLoadInvalid(t *testing.T) {
+	files := []string{
+		"./testdata/cors_rules_1.data", // no origins
+		"./testdata/cors_rules_2.data", // credentials with all origins
+		"./testdata/cors_rules_3.data", // invalid regex
+		"./testdata/cors_rules_4.data", // negative MaxAge
+		"./testdata/cors_rules_5.data", // suffix not start with "."
+	}
+
+	for _, file := range files {
+		if _, err := ProductRuleConfLoad(file); err == nil {
+			t.Errorf("err should not be nil for %s", file)
+		}
+	}
+}
+
+func TestCorsRuleOriginAllowed(t *testing.T) {
+	config, err := ProductRuleConfLoad("./testdata/mod_cors/cors_rules.data")
+	if err != nil {
+		t.Fatalf("get err from ProductRuleConfLoad():%s", err.Error())
+	}
+	rule := (*config.Config["pn"])[0]
+
+	cases := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://www.example.org", true},
+		{"HTTPS://WWW.EXAMPLE.ORG", true},
+		{"http://www.example.org", false},
+		{"https://a.example.com", true},
+		{"https://example.com", false},
+		{"https://a.example.com.evil.org", false},
+		{"https://evilexample.com", false},
+		{"http://a.example.com", false},
+		{"https://a.example.com:8443", true},
+		{"https://a.example.com@evil.org", false},
+		{"https://app12.example.net", true},
+		{"https://app.example.net", false},
+		{"https://app1.example.net.evil.org", false},
+		{"null", false},
+	}
+
+	for _, c := range cases {
+		if rule.originAllowed(c.origin) != c.allowed {
+			t.Errorf("originAllowed(%s) should be %v", c.origin, c.allowed)
+		}
+	}
+}
+
+func TestCorsRuleHttpOriginAllowed(t *testing.T) {
+	config, err := ProductRuleConfLoad("./testdata/cors_rules_6.data")
+	if err != nil {
+		t.Fatalf("get err from ProductRuleConfLoad():%s", err.Error())
+	}
+	rule := (*config.Config["pn"])[0]
+
+	cases := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://www.example.org", true},
+		{"http://www.example.org", true},
+		{"ftp://www.example.org", false},
+		{"http://evilexample.org", false},
+		{"www.example.org", false},
+	}
+
+	for _, c := range cases {
+		if rule.originAllowed(c.origin) != c.allowed {
+			t.Errorf("originAllowed(%s) should be %v", c.origin, c.allowed)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_errors
+
+import (
+	"testing"
+)
+
+func TestConfModErrorsLoad_1(t *testing.T) {
+	config, err := ConfLoad("./testdata/conf_mod_errors/bfe_1.conf", "")
+	if err != nil {
+		t.Fatalf("ConfLoad():err=%s", err.Error())
+	}
+
+	if config.Basic.ProductRulePath != "/home/bfe/conf/errors_rules.data" {
+		t.Error("ProductRulePath should be /home/bfe/conf/errors_rules.data")
+	}
+}
+
+func TestConfModErrorsLoad_2(t *testing.T) {
+	config, _ := ConfLoad("./testdata/conf_mod_errors/bfe_2.conf", "")
+
+	// use default value
+	if config.Basic.ProductRulePath != "mod_errors/errors_rules.data" {
+		t.Error("ProductRulePath should be mod_errors/errors_rules.data")
+	}
+}
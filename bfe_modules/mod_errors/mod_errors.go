@@ -0,0 +1,279 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// module for custom error pages
+
+package mod_errors
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/web-monitor/metrics"
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+const (
+	ModErrors     = "mod_errors"
+	GlobalProduct = "global"
+)
+
+var (
+	openDebug = false
+)
+
+// header fields removed when body of response is replaced
+var bodyFields = []string{
+	"Content-Encoding",
+	"Content-Length",
+	"Content-Md5",
+	"Content-Range",
+	"Etag",
+	"Last-Modified",
+	"Transfer-Encoding",
+}
+
+type ModuleErrorsState struct {
+	ResTotal      *metrics.Counter // all response in
+	ResMatched    *metrics.Counter // response matched by errors rule
+	ResReplaced   *metrics.Counter // response replaced by content of local file
+	ResRedirected *metrics.Counter // response replaced by redirect
+}
+
+type ModuleErrors struct {
+	name    string            // name of module
+	state   ModuleErrorsState // module state
+	metrics metrics.Metrics
+
+	confRoot        string            // root dir of config
+	productRulePath string            // path of errors rule data file
+	ruleTable       *ProductRuleTable // table for product errors rules
+}
+
+func NewModuleErrors() *ModuleErrors {
+	m := new(ModuleErrors)
+	m.name = ModErrors
+	m.metrics.Init(&m.state, ModErrors, 0)
+
+	m.ruleTable = NewProductRuleTable()
+
+	return m
+}
+
+func (m *ModuleErrors) Name() string {
+	return m.name
+}
+
+func (m *ModuleErrors) State() interface{} {
+	return &m.state
+}
+
+// loadProductRuleConf load from config file, response files are reloaded too.
+func (m *ModuleErrors) loadProductRuleConf(query url.Values) error {
+	// get path
+	path := query.Get("path")
+	if path == "" {
+		// use default
+		path = m.productRulePath
+	}
+
+	// load file
+	conf, err := ProductRuleConfLoad(path, m.confRoot)
+	if err != nil {
+		return fmt.Errorf("err in ProductRuleConfLoad(%s):%s", path, err)
+	}
+
+	m.ruleTable.Update(conf)
+	return nil
+}
+
+// isBackendResponse checks whether response is from backend, not created by bfe.
+func isBackendResponse(req *bfe_basic.Request) bool {
+	return req.ErrCode == nil && len(req.Backend.BackendAddr) != 0
+}
+
+// match checks whether response matches errors rule.
+func (rule *errorsRule) match(req *bfe_basic.Request, res *bfe_http.Response, fromBackend bool) bool {
+	if !rule.StatusCodes[res.StatusCode] {
+		return false
+	}
+
+	if fromBackend && !rule.ReplaceBackend {
+		return false
+	}
+
+	if len(rule.ErrCodes) != 0 && (req.ErrCode == nil || !rule.ErrCodes[req.ErrCode.Error()]) {
+		return false
+	}
+
+	return rule.Cond.Match(req)
+}
+
+// findRule finds errors rule for response, rules of product are checked
+// before global rules.
+func (m *ModuleErrors) findRule(req *bfe_basic.Request, res *bfe_http.Response) *errorsRule {
+	fromBackend := isBackendResponse(req)
+
+	for _, product := range []string{req.Route.Product, GlobalProduct} {
+		rules, ok := m.ruleTable.Search(product)
+		if !ok {
+			continue
+		}
+
+		for i := range *rules {
+			rule := &(*rules)[i]
+			if rule.match(req, res, fromBackend) {
+				return rule
+			}
+		}
+	}
+
+	return nil
+}
+
+// replaceResponse replaces status code and body of response.
+func replaceResponse(req *bfe_basic.Request, res *bfe_http.Response, rule *errorsRule) {
+	if rule.StatusCode != 0 {
+		res.StatusCode = rule.StatusCode
+		res.Status = fmt.Sprintf("%d %s", rule.StatusCode, bfe_http.StatusText[rule.StatusCode])
+	}
+
+	for _, field := range bodyFields {
+		res.Header.Del(field)
+	}
+	res.Header.Set("Content-Type", rule.ContentType)
+	res.Header.Set("Content-Length", strconv.Itoa(len(rule.Body)))
+	res.ContentLength = int64(len(rule.Body))
+	res.TransferEncoding = nil
+
+	// Note: original body of response from backend is closed by bfe server
+	if req.HttpRequest.Method == "HEAD" {
+		res.Body = bfe_http.EofReader
+	} else {
+		res.Body = ioutil.NopCloser(bytes.NewReader(rule.Body))
+	}
+}
+
+// errorsHandler is a handler for replacing error response.
+func (m *ModuleErrors) errorsHandler(req *bfe_basic.Request, res *bfe_http.Response) int {
+	m.state.ResTotal.Inc(1)
+	if res == nil {
+		return bfe_module.BFE_HANDLER_GOON
+	}
+
+	rule := m.findRule(req, res)
+	if rule == nil {
+		return bfe_module.BFE_HANDLER_GOON
+	}
+	m.state.ResMatched.Inc(1)
+
+	if openDebug {
+		log.Logger.Debug("%s replace response (status:%d, err:%v) with %s", m.name,
+			res.StatusCode, req.ErrCode, rule.Action)
+	}
+
+	switch rule.Action {
+	case ActionRedirect:
+		m.state.ResRedirected.Inc(1)
+		req.Redirect.Url = rule.Location
+		req.Redirect.Code = rule.StatusCode
+		if req.Redirect.Code == 0 {
+			req.Redirect.Code = bfe_http.StatusFound
+		}
+		return bfe_module.BFE_HANDLER_REDIRECT
+
+	case ActionReturn:
+		m.state.ResReplaced.Inc(1)
+		replaceResponse(req, res, rule)
+	}
+
+	return bfe_module.BFE_HANDLER_GOON
+}
+
+func (m *ModuleErrors) getState(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetAll()
+	return s.Format(params)
+}
+
+func (m *ModuleErrors) getStateDiff(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetDiff()
+	return s.Format(params)
+}
+
+func (m *ModuleErrors) monitorHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name:           m.getState,
+		m.name + ".diff": m.getStateDiff,
+	}
+	return handlers
+}
+
+func (m *ModuleErrors) reloadHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name + ".product_rule_table": m.loadProductRuleConf,
+	}
+	return handlers
+}
+
+func (m *ModuleErrors) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHandlers,
+	cr string) error {
+	var conf *ConfModErrors
+	var err error
+
+	// load module config
+	confPath := bfe_module.ModConfPath(cr, m.name)
+	if conf, err = ConfLoad(confPath, cr); err != nil {
+		return fmt.Errorf("%s: conf load err %s", m.name, err.Error())
+	}
+
+	m.confRoot = cr
+	m.productRulePath = conf.Basic.ProductRulePath
+	openDebug = conf.Log.OpenDebug
+
+	// load conf data
+	if err = m.loadProductRuleConf(nil); err != nil {
+		return fmt.Errorf("%s: loadProductRuleConf() err %s", m.name, err.Error())
+	}
+
+	// register handler
+	err = cbs.AddFilter(bfe_module.HANDLE_READ_BACKEND, m.errorsHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.errorsHandler): %s", m.name, err.Error())
+	}
+
+	// register web handler for monitor
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_MONITOR, m.monitorHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.monitorHandlers): %s", m.name, err.Error())
+	}
+	// register web handler for reload
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_RELOAD, m.reloadHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.reloadHandlers): %s", m.name, err.Error())
+	}
+
+	return nil
+}
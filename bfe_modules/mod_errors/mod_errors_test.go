@@ -0,0 +1,168 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_errors
+
+import (
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+func prepareModule(t *testing.T) *ModuleErrors {
+	m := NewModuleErrors()
+	err := m.Init(bfe_module.NewBfeCallbacks(), web_monitor.NewWebHandlers(), "./testdata")
+	if err != nil {
+		t.Fatalf("Init(): %s", err)
+	}
+	return m
+}
+
+func prepareRequest(product string, path string) *bfe_basic.Request {
+	request := new(bfe_basic.Request)
+	request.HttpRequest = new(bfe_http.Request)
+	request.HttpRequest.Method = "GET"
+	request.HttpRequest.Header = make(bfe_http.Header)
+	request.HttpRequest.URL, _ = url.Parse(path)
+	request.Session = new(bfe_basic.Session)
+	request.Context = make(map[interface{}]interface{})
+	request.Route = bfe_basic.RequestRoute{Product: product}
+	return request
+}
+
+func prepareBackendResponse(req *bfe_basic.Request, code int) *bfe_http.Response {
+	req.Backend.BackendAddr = "10.0.0.1"
+	res := new(bfe_http.Response)
+	res.StatusCode = code
+	res.Header = make(bfe_http.Header)
+	res.Header.Set("Content-Type", "text/plain")
+	res.Header.Set("Content-Length", "11")
+	res.Header.Set("X-Backend", "rs1")
+	res.Body = ioutil.NopCloser(strings.NewReader("bad gateway"))
+	return res
+}
+
+func readBody(t *testing.T, res *bfe_http.Response) string {
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("read body: %s", err)
+	}
+	return string(body)
+}
+
+func TestErrorsHandlerInternalResponse(t *testing.T) {
+	m := prepareModule(t)
+
+	// matched by error code
+	req := prepareRequest("pn", "/api/users")
+	req.ErrCode = bfe_basic.ErrBkNoBackend
+	res := bfe_basic.CreateInternalSrvErrResp(req)
+	if ret := m.errorsHandler(req, res); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Fatalf("errorsHandler() should return GOON")
+	}
+	if res.StatusCode != 503 || res.Header.Get("Content-Type") != "application/json" ||
+		res.Header.Get("Content-Length") != "34" || res.Header.Get("Server") != "bfe" {
+		t.Errorf("unexpected response: %d %v", res.StatusCode, res.Header)
+	}
+	if body := readBody(t, res); body != "{\"error\": \"no backend available\"}\n" {
+		t.Errorf("unexpected body: %s", body)
+	}
+
+	// error code not matched, fall through to next rule
+	req = prepareRequest("pn", "/api/users")
+	req.ErrCode = bfe_basic.ErrBkFindLocation
+	res = bfe_basic.CreateInternalSrvErrResp(req)
+	m.errorsHandler(req, res)
+	if res.StatusCode != 500 || res.Header.Get("Content-Type") != "text/html" {
+		t.Errorf("unexpected response: %d %v", res.StatusCode, res.Header)
+	}
+
+	// redirect
+	req = prepareRequest("pn", "/old/index.html")
+	req.ErrCode = bfe_basic.ErrBkNoCluster
+	res = bfe_basic.CreateInternalSrvErrResp(req)
+	if ret := m.errorsHandler(req, res); ret != bfe_module.BFE_HANDLER_REDIRECT {
+		t.Fatalf("errorsHandler() should return REDIRECT")
+	}
+	if req.Redirect.Url != "https://status.example.org/" || req.Redirect.Code != bfe_http.StatusFound {
+		t.Errorf("unexpected redirect: %+v", req.Redirect)
+	}
+
+	// product not found, global rule is used
+	req = prepareRequest("", "/")
+	req.ErrCode = bfe_basic.ErrBkFindProduct
+	res = bfe_basic.CreateInternalSrvErrResp(req)
+	m.errorsHandler(req, res)
+	if res.StatusCode != 404 || readBody(t, res) != "<html><body>Site not found.</body></html>\n" {
+		t.Errorf("unexpected response: %d %v", res.StatusCode, res.Header)
+	}
+
+	// HEAD request
+	req = prepareRequest("pn", "/index.html")
+	req.HttpRequest.Method = "HEAD"
+	req.ErrCode = bfe_basic.ErrBkNoBackend
+	res = bfe_basic.CreateInternalSrvErrResp(req)
+	m.errorsHandler(req, res)
+	if res.Header.Get("Content-Length") == "0" || readBody(t, res) != "" {
+		t.Errorf("body should be empty for HEAD request")
+	}
+
+	if m.state.ResMatched.Get() != 5 || m.state.ResReplaced.Get() != 4 || m.state.ResRedirected.Get() != 1 {
+		t.Errorf("unexpected state: %+v", m.state)
+	}
+}
+
+func TestErrorsHandlerBackendResponse(t *testing.T) {
+	m := prepareModule(t)
+
+	// replaced if ReplaceBackend is true
+	req := prepareRequest("pn", "/index.html")
+	res := prepareBackendResponse(req, bfe_http.StatusBadGateway)
+	m.errorsHandler(req, res)
+	if res.StatusCode != 502 || res.Header.Get("Content-Type") != "text/html" ||
+		res.Header.Get("X-Backend") != "rs1" {
+		t.Errorf("unexpected response: %d %v", res.StatusCode, res.Header)
+	}
+	if body := readBody(t, res); !strings.Contains(body, "Service unavailable") {
+		t.Errorf("unexpected body: %s", body)
+	}
+
+	// not replaced if ReplaceBackend is false
+	req = prepareRequest("pn", "/old/index.html")
+	res = prepareBackendResponse(req, bfe_http.StatusInternalServerError)
+	req.Route.Product = "pn2"
+	m.errorsHandler(req, res)
+	if readBody(t, res) != "bad gateway" {
+		t.Errorf("response from backend should not be replaced")
+	}
+
+	// status code not matched
+	req = prepareRequest("pn", "/index.html")
+	res = prepareBackendResponse(req, bfe_http.StatusNotFound)
+	m.errorsHandler(req, res)
+	if readBody(t, res) != "bad gateway" {
+		t.Errorf("response with status code not matched should not be replaced")
+	}
+}
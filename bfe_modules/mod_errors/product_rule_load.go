@@ -0,0 +1,324 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_errors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic/condition"
+	"github.com/baidu/bfe/bfe_util"
+)
+
+// actions for errors rule
+const (
+	ActionReturn   = "RETURN"   // return content of local file
+	ActionRedirect = "REDIRECT" // redirect to location
+)
+
+const (
+	// max size of response file
+	maxFileSize = 1024 * 1024
+)
+
+type errorsParam struct {
+	StatusCode  int    // status code of response, optional
+	ContentType string // content type of response, for RETURN
+	FilePath    string // path of response file, for RETURN
+	Location    string // location of redirect, for REDIRECT
+}
+
+type errorsRuleFile struct {
+	Cond           *string      // condition for errors rule
+	StatusCodes    []int        // status codes of response to match
+	ErrCodes       []string     // error codes of request to match, optional
+	ReplaceBackend bool         // whether response from backend is replaced, optional
+	Action         *string      // action for errors rule, RETURN or REDIRECT
+	Param          *errorsParam // param of action
+}
+
+type errorsRule struct {
+	Cond           condition.Condition // condition for errors rule
+	StatusCodes    map[int]bool        // status codes of response to match
+	ErrCodes       map[string]bool     // error codes of request to match, empty means any
+	ReplaceBackend bool                // whether response from backend is replaced
+	Action         string              // action for errors rule
+	StatusCode     int                 // status code of response, 0 means not changed
+	ContentType    string              // content type of response
+	Body           []byte              // body of response
+	Location       string              // location of redirect
+}
+
+type errorsRuleFileList []errorsRuleFile
+type errorsRuleList []errorsRule
+
+type ProductRulesFile map[string]*errorsRuleFileList // product => list of errors rules
+type ProductRules map[string]*errorsRuleList
+
+type productRuleConfFile struct {
+	Version *string // version of the config
+	Config  *ProductRulesFile
+}
+
+type productRuleConf struct {
+	Version string       // version of the config
+	Config  ProductRules // product rules for errors
+}
+
+func errorsParamCheck(action string, param *errorsParam) error {
+	if param == nil {
+		return errors.New("no Param")
+	}
+
+	switch action {
+	case ActionReturn:
+		if param.StatusCode != 0 && (param.StatusCode < 200 || param.StatusCode > 599) {
+			return fmt.Errorf("invalid StatusCode: %d", param.StatusCode)
+		}
+		if len(param.FilePath) == 0 {
+			return errors.New("no FilePath")
+		}
+		if len(param.ContentType) == 0 {
+			return errors.New("no ContentType")
+		}
+
+	case ActionRedirect:
+		if param.StatusCode != 0 && (param.StatusCode < 300 || param.StatusCode > 399) {
+			return fmt.Errorf("invalid StatusCode: %d", param.StatusCode)
+		}
+		if len(param.Location) == 0 {
+			return errors.New("no Location")
+		}
+		if _, err := url.Parse(param.Location); err != nil {
+			return fmt.Errorf("invalid Location: %s", err)
+		}
+
+	default:
+		return fmt.Errorf("invalid Action: %s", action)
+	}
+
+	return nil
+}
+
+func errorsRuleCheck(conf errorsRuleFile) error {
+	// check Cond
+	if conf.Cond == nil {
+		return errors.New("no Cond")
+	}
+
+	// check StatusCodes
+	if len(conf.StatusCodes) == 0 {
+		return errors.New("no StatusCodes")
+	}
+	for _, code := range conf.StatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid status code: %d", code)
+		}
+	}
+
+	// check ErrCodes
+	for _, code := range conf.ErrCodes {
+		if len(code) == 0 {
+			return errors.New("empty error code in ErrCodes")
+		}
+	}
+
+	// check Action
+	if conf.Action == nil {
+		return errors.New("no Action")
+	}
+
+	// check Param
+	if err := errorsParamCheck(*conf.Action, conf.Param); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func errorsRuleListCheck(conf *errorsRuleFileList) error {
+	for index, rule := range *conf {
+		err := errorsRuleCheck(rule)
+		if err != nil {
+			return fmt.Errorf("errorsRule:%d, %s", index, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRulesCheck(conf *ProductRulesFile) error {
+	for product, ruleList := range *conf {
+		if ruleList == nil {
+			return fmt.Errorf("no errorsRuleList for product:%s", product)
+		}
+
+		err := errorsRuleListCheck(ruleList)
+		if err != nil {
+			return fmt.Errorf("ProductRules:%s, %s", product, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRuleConfCheck(conf productRuleConfFile) error {
+	var err error
+
+	// check Version
+	if conf.Version == nil {
+		return errors.New("no Version")
+	}
+
+	// check Config
+	if conf.Config == nil {
+		return errors.New("no Config")
+	}
+
+	err = productRulesCheck(conf.Config)
+	if err != nil {
+		return fmt.Errorf("Config:%s", err.Error())
+	}
+
+	return nil
+}
+
+// fileCache avoids loading the same response file more than once
+type fileCache struct {
+	confRoot string
+	files    map[string][]byte
+}
+
+func (c *fileCache) content(path string) ([]byte, error) {
+	path = bfe_util.ConfPathProc(path, c.confRoot)
+	if data, ok := c.files[path]; ok {
+		return data, nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() || fi.Size() > maxFileSize {
+		return nil, fmt.Errorf("%s is not a regular file or larger than %d bytes", path, maxFileSize)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c.files[path] = data
+	return data, nil
+}
+
+func ruleConvert(ruleFile errorsRuleFile, files *fileCache, product string) (errorsRule, error) {
+	var err error
+	rule := errorsRule{}
+
+	rule.Cond, err = condition.BuildWithProduct(*ruleFile.Cond, product)
+	if err != nil {
+		return rule, err
+	}
+
+	rule.StatusCodes = make(map[int]bool)
+	for _, code := range ruleFile.StatusCodes {
+		rule.StatusCodes[code] = true
+	}
+	rule.ErrCodes = make(map[string]bool)
+	for _, code := range ruleFile.ErrCodes {
+		rule.ErrCodes[code] = true
+	}
+	rule.ReplaceBackend = ruleFile.ReplaceBackend
+
+	param := ruleFile.Param
+	rule.Action = *ruleFile.Action
+	rule.StatusCode = param.StatusCode
+	switch rule.Action {
+	case ActionReturn:
+		rule.ContentType = param.ContentType
+		rule.Body, err = files.content(param.FilePath)
+		if err != nil {
+			return rule, fmt.Errorf("load FilePath: %s", err)
+		}
+	case ActionRedirect:
+		rule.Location = param.Location
+	}
+
+	return rule, nil
+}
+
+func ruleListConvert(ruleFileList *errorsRuleFileList, files *fileCache, product string) (*errorsRuleList, error) {
+	ruleList := new(errorsRuleList)
+	*ruleList = make([]errorsRule, 0)
+
+	for _, ruleFile := range *ruleFileList {
+		rule, err := ruleConvert(ruleFile, files, product)
+		if err != nil {
+			return nil, err
+		}
+		*ruleList = append(*ruleList, rule)
+	}
+
+	return ruleList, nil
+}
+
+// ProductRuleConfLoad load errors rule config from file, together with
+// response files referenced by rules. Relative path of response file is
+// relative to confRoot.
+func ProductRuleConfLoad(filename string, confRoot string) (productRuleConf, error) {
+	var conf productRuleConf
+	var err error
+
+	// open the file
+	file, err := os.Open(filename)
+	if err != nil {
+		return conf, err
+	}
+	defer file.Close()
+
+	// decode the file
+	decoder := json.NewDecoder(file)
+	var config productRuleConfFile
+	err = decoder.Decode(&config)
+	if err != nil {
+		return conf, err
+	}
+
+	// check config
+	err = productRuleConfCheck(config)
+	if err != nil {
+		return conf, err
+	}
+
+	// convert config
+	files := &fileCache{confRoot: confRoot, files: make(map[string][]byte)}
+	conf.Version = *config.Version
+	conf.Config = make(ProductRules)
+	for product, ruleFileList := range *config.Config {
+		ruleList, err := ruleListConvert(ruleFileList, files, product)
+		if err != nil {
+			return conf, fmt.Errorf("ProductRules:%s, %s", product, err)
+		}
+		conf.Config[product] = ruleList
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_errors
+
+import (
+	"testing"
+)
+
+func TestErrorsRuleConfLoad(t *testing.T) {
+	config, err := ProductRuleConfLoad("./testdata/mod_errors/errors_rules.data", "./testdata")
+	if err != nil {
+		t.Fatalf("get err from ProductRuleConfLoad():%s", err.Error())
+	}
+
+	rules := *config.Config["pn"]
+	if len(rules) != 3 {
+		t.Fatalf("len(config.Config['pn']) should be 3")
+	}
+
+	rule := rules[0]
+	if rule.Action != ActionReturn || rule.StatusCode != 503 || rule.ContentType != "application/json" ||
+		string(rule.Body) != "{\"error\": \"no backend available\"}\n" ||
+		!rule.StatusCodes[502] || !rule.ErrCodes["BK_NO_BACKEND"] || rule.ReplaceBackend {
+		t.Errorf("unexpected rule 0: %+v", rule)
+	}
+
+	rule = rules[1]
+	if rule.Action != ActionRedirect || rule.Location != "https://status.example.org/" || rule.StatusCode != 0 {
+		t.Errorf("unexpected rule 1: %+v", rule)
+	}
+
+	if _, ok := config.Config[GlobalProduct]; !ok {
+		t.Errorf("global rules should be loaded")
+	}
+}
+
+func TestErrorsRuleConfLoadInvalid(t *testing.T) {
+	files := []string{
+		"./testdata/errors_rules_1.data", // no StatusCodes
+		"./testdata/errors_rules_2.data", // file not exist
+		"./testdata/errors_rules_3.data", // invalid status code for redirect
+		"./testdata/errors_rules_4.data", // invalid action
+	}
+
+	for _, file := range files {
+		if _, err := ProductRuleConfLoad(file, "./testdata"); err == nil {
+			t.Errorf("err should not be nil for %s", file)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_fault
+
+import (
+	"github.com/baidu/go-lib/log"
+	gcfg "gopkg.in/gcfg.v1"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_util"
+)
+
+type ConfModFault struct {
+	Basic struct {
+		ProductRulePath string // path of product fault rule data
+	}
+
+	Log struct {
+		OpenDebug bool // whether open debug
+	}
+}
+
+// ConfLoad loads config from config file
+func ConfLoad(filePath string, confRoot string) (*ConfModFault, error) {
+	var cfg ConfModFault
+	var err error
+
+	// read config from file
+	err = gcfg.ReadFileInto(&cfg, filePath)
+	if err != nil {
+		return &cfg, err
+	}
+
+	// check conf of mod_fault
+	err = cfg.Check(confRoot)
+	if err != nil {
+		return &cfg, err
+	}
+
+	return &cfg, nil
+}
+
+func (cfg *ConfModFault) Check(confRoot string) error {
+	return ConfModFaultCheck(cfg, confRoot)
+}
+
+func ConfModFaultCheck(cfg *ConfModFault, confRoot string) error {
+	if cfg.Basic.ProductRulePath == "" {
+		log.Logger.Warn("ModFault.ProductRulePath not set, use default value")
+		cfg.Basic.ProductRulePath = "mod_fault/fault_rules.data"
+	}
+	cfg.Basic.ProductRulePath = bfe_util.ConfPathProc(cfg.Basic.ProductRulePath, confRoot)
+
+	return nil
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// module for fault injection
+
+package mod_fault
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"time"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/web-monitor/metrics"
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+const (
+	ModFault = "mod_fault"
+)
+
+const (
+	// context key for bandwidth of response
+	CtxThrottleRate = "mod_fault.throttle_rate"
+)
+
+var (
+	ERR_FAULT_INJECT = errors.New("FAULT_INJECT")
+)
+
+var (
+	openDebug = false
+)
+
+type ModuleFaultState struct {
+	ReqTotal      *metrics.Counter // all request in
+	ReqToFault    *metrics.Counter // request with condition satisfied and sampled
+	RuleExpired   *metrics.Counter // request with condition satisfied but rule expired
+	FaultDelay    *metrics.Counter // request delayed
+	FaultAbort    *metrics.Counter // request aborted
+	FaultReset    *metrics.Counter // connection reset
+	FaultThrottle *metrics.Counter // response throttled
+}
+
+type ModuleFault struct {
+	name    string           // name of module
+	state   ModuleFaultState // module state
+	metrics metrics.Metrics
+
+	productRulePath string            // path of fault rule data file
+	ruleTable       *ProductRuleTable // table for product fault rules
+}
+
+func NewModuleFault() *ModuleFault {
+	m := new(ModuleFault)
+	m.name = ModFault
+	m.metrics.Init(&m.state, ModFault, 0)
+
+	m.ruleTable = NewProductRuleTable()
+
+	return m
+}
+
+func (m *ModuleFault) Name() string {
+	return m.name
+}
+
+func (m *ModuleFault) State() interface{} {
+	return &m.state
+}
+
+func (m *ModuleFault) loadProductRuleConf(query url.Values) error {
+	// get path
+	path := query.Get("path")
+	if path == "" {
+		// use default
+		path = m.productRulePath
+	}
+
+	// load file
+	conf, err := ProductRuleConfLoad(path)
+	if err != nil {
+		return fmt.Errorf("err in ProductRuleConfLoad(%s):%s", path, err)
+	}
+
+	m.ruleTable.Update(conf)
+	return nil
+}
+
+// findRule returns first matched and unexpired rule for request.
+func (m *ModuleFault) findRule(req *bfe_basic.Request, now time.Time) *faultRule {
+	rules, ok := m.ruleTable.Search(req.Route.Product)
+	if !ok {
+		if openDebug {
+			log.Logger.Debug("%s product %s not found, just pass",
+				m.name, req.Route.Product)
+		}
+		return nil
+	}
+
+	for i := range *rules {
+		rule := &(*rules)[i]
+		if !rule.Cond.Match(req) {
+			continue
+		}
+
+		// expired rule is turned off
+		if !rule.ExpireTime.IsZero() && now.After(rule.ExpireTime) {
+			m.state.RuleExpired.Inc(1)
+			continue
+		}
+
+		return rule
+	}
+
+	return nil
+}
+
+// delayOf returns delay of request for given rule.
+func delayOf(rule *faultRule) time.Duration {
+	if rule.MaxDelay <= rule.Delay {
+		return rule.Delay
+	}
+	return rule.Delay + time.Duration(rand.Int63n(int64(rule.MaxDelay-rule.Delay)+1))
+}
+
+// faultRequestHandler is a handler for injecting fault to request.
+func (m *ModuleFault) faultRequestHandler(req *bfe_basic.Request) (int, *bfe_http.Response) {
+	m.state.ReqTotal.Inc(1)
+
+	rule := m.findRule(req, time.Now())
+	if rule == nil {
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+	if rule.Percentage < 100 && rand.Float64()*100 >= rule.Percentage {
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+	m.state.ReqToFault.Inc(1)
+
+	if openDebug {
+		log.Logger.Debug("%s inject fault %s (remote:%s)", m.name, rule.Action, req.RemoteAddr)
+	}
+
+	switch rule.Action {
+	case ActionDelay:
+		m.state.FaultDelay.Inc(1)
+		time.Sleep(delayOf(rule))
+
+	case ActionAbort:
+		m.state.FaultAbort.Inc(1)
+		req.ErrCode = ERR_FAULT_INJECT
+		return bfe_module.BFE_HANDLER_RESPONSE, bfe_basic.CreateInternalResp(req, rule.StatusCode)
+
+	case ActionReset:
+		m.state.FaultReset.Inc(1)
+		req.ErrCode = ERR_FAULT_INJECT
+		return bfe_module.BFE_HANDLER_CLOSE, nil
+
+	case ActionThrottle:
+		req.SetContext(CtxThrottleRate, rule.Rate)
+	}
+
+	return bfe_module.BFE_HANDLER_GOON, nil
+}
+
+// faultResponseHandler is a handler for throttling bandwidth of response.
+func (m *ModuleFault) faultResponseHandler(req *bfe_basic.Request, res *bfe_http.Response) int {
+	rate, ok := req.GetContext(CtxThrottleRate).(int)
+	if !ok || res.Body == nil {
+		return bfe_module.BFE_HANDLER_GOON
+	}
+
+	m.state.FaultThrottle.Inc(1)
+	res.Body = newThrottledReader(res.Body, rate)
+	return bfe_module.BFE_HANDLER_GOON
+}
+
+func (m *ModuleFault) getState(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetAll()
+	return s.Format(params)
+}
+
+func (m *ModuleFault) getStateDiff(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetDiff()
+	return s.Format(params)
+}
+
+func (m *ModuleFault) monitorHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name:           m.getState,
+		m.name + ".diff": m.getStateDiff,
+	}
+	return handlers
+}
+
+func (m *ModuleFault) reloadHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name + ".product_rule_table": m.loadProductRuleConf,
+	}
+	return handlers
+}
+
+func (m *ModuleFault) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHandlers,
+	cr string) error {
+	var conf *ConfModFault
+	var err error
+
+	// load module config
+	confPath := bfe_module.ModConfPath(cr, m.name)
+	if conf, err = ConfLoad(confPath, cr); err != nil {
+		return fmt.Errorf("%s: conf load err %s", m.name, err.Error())
+	}
+
+	m.productRulePath = conf.Basic.ProductRulePath
+	openDebug = conf.Log.OpenDebug
+
+	// load conf data
+	if err = m.loadProductRuleConf(nil); err != nil {
+		return fmt.Errorf("%s: loadProductRuleConf() err %s", m.name, err.Error())
+	}
+
+	// register handler
+	err = cbs.AddFilter(bfe_module.HANDLE_AFTER_LOCATION, m.faultRequestHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.faultRequestHandler): %s", m.name, err.Error())
+	}
+
+	err = cbs.AddFilter(bfe_module.HANDLE_READ_BACKEND, m.faultResponseHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.faultResponseHandler): %s", m.name, err.Error())
+	}
+
+	// register web handler for monitor
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_MONITOR, m.monitorHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.monitorHandlers): %s", m.name, err.Error())
+	}
+	// register web handler for reload
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_RELOAD, m.reloadHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.reloadHandlers): %s", m.name, err.Error())
+	}
+
+	return nil
+}
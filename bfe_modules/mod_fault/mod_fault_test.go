@@ -0,0 +1,159 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_fault
+
+import (
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+func prepareModule(t *testing.T) *ModuleFault {
+	m := NewModuleFault()
+	err := m.Init(bfe_module.NewBfeCallbacks(), web_monitor.NewWebHandlers(), "./testdata")
+	if err != nil {
+		t.Fatalf("Init(): %s", err)
+	}
+	return m
+}
+
+func prepareRequest(path string) *bfe_basic.Request {
+	request := new(bfe_basic.Request)
+	request.HttpRequest = new(bfe_http.Request)
+	request.HttpRequest.Method = "GET"
+	request.HttpRequest.Header = make(bfe_http.Header)
+	request.HttpRequest.URL, _ = url.Parse(path)
+	request.Session = new(bfe_basic.Session)
+	request.Context = make(map[interface{}]interface{})
+	request.Route = bfe_basic.RequestRoute{Product: "pn"}
+	return request
+}
+
+func TestFaultRequestHandlerDelay(t *testing.T) {
+	m := prepareModule(t)
+
+	start := time.Now()
+	ret, res := m.faultRequestHandler(prepareRequest("/delay"))
+	if ret != bfe_module.BFE_HANDLER_GOON || res != nil {
+		t.Errorf("faultRequestHandler() should return GOON")
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("request should be delayed for 20ms, got %s", elapsed)
+	}
+
+	start = time.Now()
+	m.faultRequestHandler(prepareRequest("/random-delay"))
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("request should be delayed for at least 10ms, got %s", elapsed)
+	}
+
+	if m.state.FaultDelay.Get() != 2 {
+		t.Errorf("FaultDelay should be 2")
+	}
+}
+
+func TestFaultRequestHandler(t *testing.T) {
+	m := prepareModule(t)
+
+	// abort
+	req := prepareRequest("/abort")
+	ret, res := m.faultRequestHandler(req)
+	if ret != bfe_module.BFE_HANDLER_RESPONSE || res == nil || res.StatusCode != 503 {
+		t.Errorf("request should be aborted with 503")
+	}
+	if req.ErrCode != ERR_FAULT_INJECT {
+		t.Errorf("ErrCode should be ERR_FAULT_INJECT")
+	}
+
+	// reset
+	ret, _ = m.faultRequestHandler(prepareRequest("/reset"))
+	if ret != bfe_module.BFE_HANDLER_CLOSE {
+		t.Errorf("connection should be closed")
+	}
+
+	// expired rule
+	ret, _ = m.faultRequestHandler(prepareRequest("/expired"))
+	if ret != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("expired rule should be turned off")
+	}
+
+	// disabled rule
+	ret, _ = m.faultRequestHandler(prepareRequest("/disabled"))
+	if ret != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("disabled rule should be ignored")
+	}
+
+	// other product
+	req = prepareRequest("/abort")
+	req.Route.Product = "pn2"
+	ret, _ = m.faultRequestHandler(req)
+	if ret != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("request of other product should not be aborted")
+	}
+
+	if m.state.ReqTotal.Get() != 5 || m.state.ReqToFault.Get() != 2 || m.state.RuleExpired.Get() != 1 ||
+		m.state.FaultAbort.Get() != 1 || m.state.FaultReset.Get() != 1 {
+		t.Errorf("unexpected state: %+v", m.state)
+	}
+}
+
+func TestFaultResponseHandlerThrottle(t *testing.T) {
+	m := prepareModule(t)
+
+	req := prepareRequest("/throttle")
+	if ret, _ := m.faultRequestHandler(req); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Fatalf("faultRequestHandler() should return GOON")
+	}
+
+	res := new(bfe_http.Response)
+	res.StatusCode = bfe_http.StatusOK
+	res.Header = make(bfe_http.Header)
+	res.Body = ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 200)))
+	m.faultResponseHandler(req, res)
+
+	// 200 bytes at 1000 bytes per second
+	start := time.Now()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil || len(body) != 200 {
+		t.Fatalf("unexpected body: %d %v", len(body), err)
+	}
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("response should be throttled, got %s", elapsed)
+	}
+	if m.state.FaultThrottle.Get() != 1 {
+		t.Errorf("FaultThrottle should be 1")
+	}
+
+	// response of other request not throttled
+	req = prepareRequest("/index.html")
+	m.faultRequestHandler(req)
+	res.Body = ioutil.NopCloser(strings.NewReader("ok"))
+	m.faultResponseHandler(req, res)
+	if _, ok := res.Body.(*throttledReader); ok {
+		t.Errorf("response should not be throttled")
+	}
+}
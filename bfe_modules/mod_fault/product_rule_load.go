@@ -0,0 +1,275 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_fault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic/condition"
+)
+
+// actions for fault rule
+const (
+	ActionDelay    = "DELAY"    // delay request
+	ActionAbort    = "ABORT"    // abort request with status code
+	ActionReset    = "RESET"    // close connection directly
+	ActionThrottle = "THROTTLE" // throttle bandwidth of response
+)
+
+type faultParam struct {
+	Delay      int // delay (in ms) of request, for DELAY
+	MaxDelay   int // max delay (in ms), delay is random in [Delay, MaxDelay] if set, for DELAY
+	StatusCode int // status code of response, for ABORT
+	Rate       int // bandwidth (in bytes per second) of response, for THROTTLE
+}
+
+type faultRuleFile struct {
+	Cond       *string     // condition for fault rule
+	Percentage *float64    // percentage of matched request to inject fault, (0, 100]
+	Action     *string     // action for fault rule
+	Param      *faultParam // param of action
+	Enable     bool        // whether rule is enabled
+	ExpireTime string      // expire time (RFC 3339) of rule, optional
+}
+
+type faultRule struct {
+	Cond       condition.Condition // condition for fault rule
+	Percentage float64             // percentage of matched request to inject fault
+	Action     string              // action for fault rule
+	Delay      time.Duration       // delay of request
+	MaxDelay   time.Duration       // max delay of request, 0 means fixed delay
+	StatusCode int                 // status code of response
+	Rate       int                 // bandwidth (in bytes per second) of response
+	ExpireTime time.Time           // expire time of rule, zero means never expire
+}
+
+type faultRuleFileList []faultRuleFile
+type faultRuleList []faultRule
+
+type ProductRulesFile map[string]*faultRuleFileList // product => list of fault rules
+type ProductRules map[string]*faultRuleList
+
+type productRuleConfFile struct {
+	Version *string // version of the config
+	Config  *ProductRulesFile
+}
+
+type productRuleConf struct {
+	Version string       // version of the config
+	Config  ProductRules // product rules for fault
+}
+
+func faultParamCheck(action string, param *faultParam) error {
+	if param == nil {
+		return errors.New("no Param")
+	}
+
+	switch action {
+	case ActionDelay:
+		if param.Delay <= 0 {
+			return fmt.Errorf("invalid Delay: %d", param.Delay)
+		}
+		if param.MaxDelay != 0 && param.MaxDelay < param.Delay {
+			return fmt.Errorf("invalid MaxDelay: %d", param.MaxDelay)
+		}
+
+	case ActionAbort:
+		if param.StatusCode < 200 || param.StatusCode > 599 {
+			return fmt.Errorf("invalid StatusCode: %d", param.StatusCode)
+		}
+
+	case ActionReset:
+		// no param needed
+
+	case ActionThrottle:
+		if param.Rate <= 0 {
+			return fmt.Errorf("invalid Rate: %d", param.Rate)
+		}
+
+	default:
+		return fmt.Errorf("invalid Action: %s", action)
+	}
+
+	return nil
+}
+
+func faultRuleCheck(conf faultRuleFile) error {
+	// check Cond
+	if conf.Cond == nil {
+		return errors.New("no Cond")
+	}
+
+	// check Percentage
+	if conf.Percentage == nil {
+		return errors.New("no Percentage")
+	}
+	if *conf.Percentage <= 0 || *conf.Percentage > 100 {
+		return fmt.Errorf("invalid Percentage: %v", *conf.Percentage)
+	}
+
+	// check Action
+	if conf.Action == nil {
+		return errors.New("no Action")
+	}
+
+	// check Param
+	if err := faultParamCheck(*conf.Action, conf.Param); err != nil {
+		return err
+	}
+
+	// check ExpireTime
+	if len(conf.ExpireTime) != 0 {
+		if _, err := time.Parse(time.RFC3339, conf.ExpireTime); err != nil {
+			return fmt.Errorf("invalid ExpireTime: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func faultRuleListCheck(conf *faultRuleFileList) error {
+	for index, rule := range *conf {
+		err := faultRuleCheck(rule)
+		if err != nil {
+			return fmt.Errorf("faultRule:%d, %s", index, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRulesCheck(conf *ProductRulesFile) error {
+	for product, ruleList := range *conf {
+		if ruleList == nil {
+			return fmt.Errorf("no faultRuleList for product:%s", product)
+		}
+
+		err := faultRuleListCheck(ruleList)
+		if err != nil {
+			return fmt.Errorf("ProductRules:%s, %s", product, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRuleConfCheck(conf productRuleConfFile) error {
+	var err error
+
+	// check Version
+	if conf.Version == nil {
+		return errors.New("no Version")
+	}
+
+	// check Config
+	if conf.Config == nil {
+		return errors.New("no Config")
+	}
+
+	err = productRulesCheck(conf.Config)
+	if err != nil {
+		return fmt.Errorf("Config:%s", err.Error())
+	}
+
+	return nil
+}
+
+func ruleConvert(ruleFile faultRuleFile, product string) (faultRule, error) {
+	var err error
+	rule := faultRule{}
+
+	rule.Cond, err = condition.BuildWithProduct(*ruleFile.Cond, product)
+	if err != nil {
+		return rule, err
+	}
+
+	rule.Percentage = *ruleFile.Percentage
+	rule.Action = *ruleFile.Action
+	rule.Delay = time.Duration(ruleFile.Param.Delay) * time.Millisecond
+	rule.MaxDelay = time.Duration(ruleFile.Param.MaxDelay) * time.Millisecond
+	rule.StatusCode = ruleFile.Param.StatusCode
+	rule.Rate = ruleFile.Param.Rate
+	if len(ruleFile.ExpireTime) != 0 {
+		rule.ExpireTime, _ = time.Parse(time.RFC3339, ruleFile.ExpireTime)
+	}
+
+	return rule, nil
+}
+
+func ruleListConvert(ruleFileList *faultRuleFileList, product string) (*faultRuleList, error) {
+	ruleList := new(faultRuleList)
+	*ruleList = make([]faultRule, 0)
+
+	for _, ruleFile := range *ruleFileList {
+		// disabled rule is ignored
+		if !ruleFile.Enable {
+			continue
+		}
+
+		rule, err := ruleConvert(ruleFile, product)
+		if err != nil {
+			return nil, err
+		}
+		*ruleList = append(*ruleList, rule)
+	}
+
+	return ruleList, nil
+}
+
+// ProductRuleConfLoad load fault rule config from file.
+func ProductRuleConfLoad(filename string) (productRuleConf, error) {
+	var conf productRuleConf
+	var err error
+
+	// open the file
+	file, err := os.Open(filename)
+	if err != nil {
+		return conf, err
+	}
+	defer file.Close()
+
+	// decode the file
+	decoder := json.NewDecoder(file)
+	var config productRuleConfFile
+	err = decoder.Decode(&config)
+	if err != nil {
+		return conf, err
+	}
+
+	// check config
+	err = productRuleConfCheck(config)
+	if err != nil {
+		return conf, err
+	}
+
+	// convert config
+	conf.Version = *config.Version
+	conf.Config = make(ProductRules)
+	for product, ruleFileList := range *config.Config {
+		ruleList, err := ruleListConvert(ruleFileList, product)
+		if err != nil {
+			return conf, err
+		}
+		conf.Config[product] = ruleList
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_fault
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFaultRuleConfLoad(t *testing.T) {
+	config, err := ProductRuleConfLoad("./testdata/mod_fault/fault_rules.data")
+	if err != nil {
+		t.Fatalf("get err from ProductRuleConfLoad():%s", err.Error())
+	}
+
+	// disabled rule is ignored
+	rules := *config.Config["pn"]
+	if len(rules) != 6 {
+		t.Fatalf("len(config.Config['pn']) should be 6")
+	}
+
+	rule := rules[1]
+	if rule.Action != ActionDelay || rule.Delay != 10*time.Millisecond || rule.MaxDelay != 30*time.Millisecond {
+		t.Errorf("unexpected rule 1: %+v", rule)
+	}
+
+	rule = rules[2]
+	expireTime := time.Date(2099, 1, 1, 0, 0, 0, 0, time.FixedZone("", 8*3600))
+	if rule.Action != ActionAbort || rule.StatusCode != 503 || !rule.ExpireTime.Equal(expireTime) {
+		t.Errorf("unexpected rule 2: %+v", rule)
+	}
+
+	rule = rules[4]
+	if rule.Action != ActionThrottle || rule.Rate != 1000 || !rule.ExpireTime.IsZero() {
+		t.Errorf("unexpected rule 4: %+v", rule)
+	}
+}
+
+func TestFaultRuleConfLoadInvalid(t *testing.T) {
+	files := []string{
+		"./testdata/fault_rules_1.data", // no Percentage
+		"./testdata/fault_rules_2.data", // invalid Action
+		"./testdata/fault_rules_3.data", // MaxDelay less than Delay
+		"./testdata/fault_rules_4.data", // invalid ExpireTime
+	}
+
+	for _, file := range files {
+		if _, err := ProductRuleConfLoad(file); err == nil {
+			t.Errorf("err should not be nil for %s", file)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// reader with limited bandwidth
+
+package mod_fault
+
+import (
+	"io"
+	"time"
+)
+
+// throttledReader limits bandwidth of reading from underlying reader.
+type throttledReader struct {
+	rc    io.ReadCloser // underlying reader
+	rate  int           // bandwidth in bytes per second
+	start time.Time     // time of first read
+	total int64         // bytes read
+}
+
+func newThrottledReader(rc io.ReadCloser, rate int) *throttledReader {
+	return &throttledReader{rc: rc, rate: rate}
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+
+	// read at most 1/10 of rate each time, for smooth output
+	chunk := r.rate / 10
+	if chunk < 1 {
+		chunk = 1
+	}
+	if len(p) > chunk {
+		p = p[:chunk]
+	}
+
+	n, err := r.rc.Read(p)
+	r.total += int64(n)
+
+	// wait until average bandwidth not exceed rate
+	expected := time.Duration(r.total * int64(time.Second) / int64(r.rate))
+	if elapsed := time.Since(r.start); elapsed < expected {
+		time.Sleep(expected - elapsed)
+	}
+
+	return n, err
+}
+
+func (r *throttledReader) Close() error {
+	return r.rc.Close()
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_geo
+
+import (
+	"github.com/baidu/go-lib/log"
+	gcfg "gopkg.in/gcfg.v1"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_util"
+)
+
+type ConfModGeo struct {
+	Basic struct {
+		GeoDictPath string // path of geo dict file (text or binary)
+	}
+
+	Log struct {
+		OpenDebug bool // whether open debug
+	}
+}
+
+// ConfLoad loads config from config file
+func ConfLoad(filePath string, confRoot string) (*ConfModGeo, error) {
+	var cfg ConfModGeo
+	var err error
+
+	// read config from file
+	err = gcfg.ReadFileInto(&cfg, filePath)
+	if err != nil {
+		return &cfg, err
+	}
+
+	// check conf of mod_geo
+	err = cfg.Check(confRoot)
+	if err != nil {
+		return &cfg, err
+	}
+
+	return &cfg, nil
+}
+
+func (cfg *ConfModGeo) Check(confRoot string) error {
+	return ConfModGeoCheck(cfg, confRoot)
+}
+
+func ConfModGeoCheck(cfg *ConfModGeo, confRoot string) error {
+	if cfg.Basic.GeoDictPath == "" {
+		log.Logger.Warn("ModGeo.GeoDictPath not set, use default value")
+		cfg.Basic.GeoDictPath = "mod_geo/geo.data"
+	}
+	cfg.Basic.GeoDictPath = bfe_util.ConfPathProc(cfg.Basic.GeoDictPath, confRoot)
+
+	return nil
+}
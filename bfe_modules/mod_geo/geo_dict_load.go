@@ -0,0 +1,404 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_geo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_util/ipdict"
+)
+
+/*
+Geo dict could be a text file or a binary file.
+
+Text file: one ip range per line, e.g.
+
+	#{"Version": "20190101000000"}
+	# startIP endIP country|region|city|isp
+	1.0.1.0 1.0.3.255 CN|Fujian|Fuzhou|China Telecom
+	240e:: 240e:ff:ffff:ffff:ffff:ffff:ffff:ffff CN|||China Telecom
+
+ - the first line may be meta info in json, other lines begin with "#" are comments
+ - start ip and end ip are separated by spaces or tabs
+
+Binary file (big endian), could be converted from text file by GeoDictTxtToBin():
+
+	magic   [8]byte   "BFEGEO01"
+	verLen  uint16    length of version
+	version [verLen]byte
+	num     uint32    number of records
+	locLen  uint32    length of location in record
+	records [num]{startIP [16]byte, endIP [16]byte, location [locLen]byte}
+
+The layout of records is the same as ipdict.IpLocationTable.
+*/
+
+const (
+	geoFieldNum = 4   // country|region|city|isp
+	geoFieldSep = "|" // separator of location fields
+)
+
+var (
+	binaryMagic = []byte("BFEGEO01")
+)
+
+var (
+	errGeoDictEmpty = errors.New("no ip range in geo dict")
+)
+
+type geoEntry struct {
+	startIP  net.IP // start ip, in 16-byte form
+	endIP    net.IP // end ip, in 16-byte form
+	location string // location, e.g. "CN|Fujian|Fuzhou|China Telecom"
+}
+
+// GeoDictConf is the content of geo dict file
+type GeoDictConf struct {
+	Version string     // version of geo dict
+	entries []geoEntry // ip ranges with location
+}
+
+// GeoDict is a dict for searching geo location by ip
+type GeoDict struct {
+	Version  string                  // version of geo dict
+	EntryNum int                     // number of ip ranges
+	table    *ipdict.IpLocationTable // ip range => location
+}
+
+type geoMetaInfo struct {
+	Version string
+}
+
+func geoEntryParse(startStr, endStr, location string) (geoEntry, error) {
+	var entry geoEntry
+
+	startIP := net.ParseIP(startStr)
+	if startIP == nil {
+		return entry, fmt.Errorf("invalid start ip: %s", startStr)
+	}
+	endIP := net.ParseIP(endStr)
+	if endIP == nil {
+		return entry, fmt.Errorf("invalid end ip: %s", endStr)
+	}
+	if (startIP.To4() == nil) != (endIP.To4() == nil) {
+		return entry, fmt.Errorf("start ip and end ip should both be ipv4 or ipv6")
+	}
+	if bytes.Compare(startIP.To16(), endIP.To16()) > 0 {
+		return entry, fmt.Errorf("start ip %s > end ip %s", startStr, endStr)
+	}
+
+	if err := locationCheck(location); err != nil {
+		return entry, err
+	}
+
+	entry.startIP = startIP.To16()
+	entry.endIP = endIP.To16()
+	entry.location = location
+	return entry, nil
+}
+
+func locationCheck(location string) error {
+	if strings.Count(location, geoFieldSep) != geoFieldNum-1 {
+		return fmt.Errorf("invalid location: %s, should be country|region|city|isp", location)
+	}
+	if strings.IndexByte(location, 0) >= 0 {
+		return fmt.Errorf("invalid location: %q", location)
+	}
+	if len(location) > ipdict.MAX_LOC_LEN {
+		return fmt.Errorf("location too long: %s", location)
+	}
+	return nil
+}
+
+// nextField returns the first field separated by spaces or tabs, and the rest of string
+func nextField(s string) (string, string) {
+	s = strings.TrimLeft(s, " \t")
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimLeft(s[i:], " \t")
+}
+
+func geoDictTxtLoad(reader io.Reader) (*GeoDictConf, error) {
+	conf := new(GeoDictConf)
+
+	scanner := bufio.NewScanner(reader)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.Trim(scanner.Text(), " \t\r")
+
+		// meta info in the first line
+		if lineNum == 1 && strings.HasPrefix(line, "#{") {
+			var meta geoMetaInfo
+			if err := json.Unmarshal([]byte(line[1:]), &meta); err != nil {
+				return nil, fmt.Errorf("line %d: invalid meta info: %s", lineNum, err)
+			}
+			conf.Version = meta.Version
+			continue
+		}
+
+		// line begins with "#" is considered as a comment
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		startStr, rest := nextField(line)
+		endStr, location := nextField(rest)
+		entry, err := geoEntryParse(startStr, endStr, location)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err)
+		}
+		conf.entries = append(conf.entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+func geoDictBinLoad(reader io.Reader) (*GeoDictConf, error) {
+	conf := new(GeoDictConf)
+
+	magic := make([]byte, len(binaryMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return nil, fmt.Errorf("read magic: %s", err)
+	}
+	if !bytes.Equal(magic, binaryMagic) {
+		return nil, fmt.Errorf("invalid magic: %q", magic)
+	}
+
+	var verLen uint16
+	if err := binary.Read(reader, binary.BigEndian, &verLen); err != nil {
+		return nil, fmt.Errorf("read version: %s", err)
+	}
+	version := make([]byte, verLen)
+	if _, err := io.ReadFull(reader, version); err != nil {
+		return nil, fmt.Errorf("read version: %s", err)
+	}
+	conf.Version = string(version)
+
+	var num, locLen uint32
+	if err := binary.Read(reader, binary.BigEndian, &num); err != nil {
+		return nil, fmt.Errorf("read record num: %s", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &locLen); err != nil {
+		return nil, fmt.Errorf("read location len: %s", err)
+	}
+	if num > ipdict.MAX_LINE {
+		return nil, fmt.Errorf("too many records: %d", num)
+	}
+	if locLen == 0 || locLen > ipdict.MAX_LOC_LEN {
+		return nil, fmt.Errorf("invalid location len: %d", locLen)
+	}
+
+	record := make([]byte, ipdict.HEADER_LEN+locLen)
+	conf.entries = make([]geoEntry, 0, num)
+	for i := uint32(0); i < num; i++ {
+		if _, err := io.ReadFull(reader, record); err != nil {
+			return nil, fmt.Errorf("read record %d: %s", i, err)
+		}
+
+		startIP := net.IP(record[:ipdict.IP_SIZE])
+		endIP := net.IP(record[ipdict.IP_SIZE:ipdict.HEADER_LEN])
+		location := string(record[ipdict.HEADER_LEN:])
+		if n := strings.IndexByte(location, 0); n >= 0 {
+			location = location[:n]
+		}
+
+		entry, err := geoEntryParse(startIP.String(), endIP.String(), location)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %s", i, err)
+		}
+		conf.entries = append(conf.entries, entry)
+	}
+
+	return conf, nil
+}
+
+// GeoDictConfLoad loads geo dict from text file or binary file.
+func GeoDictConfLoad(filename string) (*GeoDictConf, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// check format by magic
+	reader := bufio.NewReader(file)
+	magic, _ := reader.Peek(len(binaryMagic))
+	if bytes.Equal(magic, binaryMagic) {
+		return geoDictBinLoad(reader)
+	}
+	return geoDictTxtLoad(reader)
+}
+
+// sortEntries sorts entries by start ip, and checks whether ip ranges overlap.
+func (conf *GeoDictConf) sortEntries() error {
+	entries := conf.entries
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].startIP, entries[j].startIP) < 0
+	})
+
+	for i := 1; i < len(entries); i++ {
+		if bytes.Compare(entries[i].startIP, entries[i-1].endIP) <= 0 {
+			return fmt.Errorf("ip range %s-%s overlaps with %s-%s",
+				entries[i].startIP, entries[i].endIP, entries[i-1].startIP, entries[i-1].endIP)
+		}
+	}
+
+	return nil
+}
+
+// maxLocationLen returns max length of location in entries.
+func (conf *GeoDictConf) maxLocationLen() int {
+	locLen := 0
+	for _, entry := range conf.entries {
+		if len(entry.location) > locLen {
+			locLen = len(entry.location)
+		}
+	}
+	return locLen
+}
+
+// SaveBinary writes geo dict in binary format.
+func (conf *GeoDictConf) SaveBinary(writer io.Writer) error {
+	if err := conf.sortEntries(); err != nil {
+		return err
+	}
+
+	locLen := conf.maxLocationLen()
+	if locLen == 0 {
+		locLen = 1
+	}
+
+	buf := bufio.NewWriter(writer)
+	buf.Write(binaryMagic)
+	binary.Write(buf, binary.BigEndian, uint16(len(conf.Version)))
+	buf.WriteString(conf.Version)
+	binary.Write(buf, binary.BigEndian, uint32(len(conf.entries)))
+	binary.Write(buf, binary.BigEndian, uint32(locLen))
+
+	record := make([]byte, ipdict.HEADER_LEN+locLen)
+	for _, entry := range conf.entries {
+		for i := range record {
+			record[i] = 0
+		}
+		copy(record[:ipdict.IP_SIZE], entry.startIP)
+		copy(record[ipdict.IP_SIZE:ipdict.HEADER_LEN], entry.endIP)
+		copy(record[ipdict.HEADER_LEN:], entry.location)
+		buf.Write(record)
+	}
+
+	return buf.Flush()
+}
+
+// GeoDictTxtToBin converts geo dict from text file to binary file.
+func GeoDictTxtToBin(txtFile string, binFile string) error {
+	conf, err := GeoDictConfLoad(txtFile)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(binFile)
+	if err != nil {
+		return err
+	}
+
+	if err = conf.SaveBinary(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// NewGeoDict creates geo dict from config.
+func NewGeoDict(conf *GeoDictConf) (*GeoDict, error) {
+	if len(conf.entries) == 0 {
+		return nil, errGeoDictEmpty
+	}
+
+	if err := conf.sortEntries(); err != nil {
+		return nil, err
+	}
+
+	locLen := conf.maxLocationLen()
+	if locLen == 0 {
+		locLen = 1
+	}
+
+	table, err := ipdict.NewIpLocationTable(uint32(len(conf.entries)), uint32(locLen))
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range conf.entries {
+		if err := table.Add(entry.startIP, entry.endIP, entry.location); err != nil {
+			return nil, err
+		}
+	}
+	table.Version = conf.Version
+
+	dict := new(GeoDict)
+	dict.Version = conf.Version
+	dict.EntryNum = len(conf.entries)
+	dict.table = table
+	return dict, nil
+}
+
+// GeoDictLoad loads geo dict from file.
+func GeoDictLoad(filename string) (*GeoDict, error) {
+	conf, err := GeoDictConfLoad(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewGeoDict(conf)
+}
+
+// Search searches geo location of given ip.
+func (d *GeoDict) Search(ip net.IP) (*bfe_basic.GeoInfo, bool) {
+	location, err := d.table.Search(ip)
+	if err != nil {
+		return nil, false
+	}
+
+	fields := strings.SplitN(location, geoFieldSep, geoFieldNum)
+	if len(fields) != geoFieldNum {
+		return nil, false
+	}
+
+	return &bfe_basic.GeoInfo{
+		Country: fields[0],
+		Region:  fields[1],
+		City:    fields[2],
+		ISP:     fields[3],
+	}, true
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_geo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+)
+
+func checkGeoDict(t *testing.T, dict *GeoDict) {
+	if dict.Version != "20190101000000" || dict.EntryNum != 4 {
+		t.Errorf("unexpected dict: version %s, entry num %d", dict.Version, dict.EntryNum)
+	}
+
+	cases := []struct {
+		ip   string
+		info *bfe_basic.GeoInfo
+	}{
+		{"1.0.1.0", &bfe_basic.GeoInfo{Country: "CN", Region: "Fujian", City: "Fuzhou", ISP: "China Telecom"}},
+		{"1.0.3.255", &bfe_basic.GeoInfo{Country: "CN", Region: "Fujian", City: "Fuzhou", ISP: "China Telecom"}},
+		{"8.8.8.8", &bfe_basic.GeoInfo{Country: "US", Region: "California", City: "Mountain View", ISP: "Google"}},
+		{"10.1.1.1", &bfe_basic.GeoInfo{Country: "CN", Region: "Beijing", City: "Beijing", ISP: "Internal"}},
+		{"240e:1::1", &bfe_basic.GeoInfo{Country: "CN", Region: "", City: "", ISP: "China Telecom"}},
+		{"1.0.4.0", nil},
+		{"0.0.0.1", nil},
+		{"192.168.1.1", nil},
+		{"2001:db8::1", nil},
+	}
+
+	for _, c := range cases {
+		info, ok := dict.Search(net.ParseIP(c.ip))
+		if c.info == nil {
+			if ok {
+				t.Errorf("geo location of %s should not be found, got %+v", c.ip, info)
+			}
+			continue
+		}
+		if !ok || *info != *c.info {
+			t.Errorf("geo location of %s should be %+v, got %+v", c.ip, c.info, info)
+		}
+	}
+}
+
+func TestGeoDictLoadTxt(t *testing.T) {
+	dict, err := GeoDictLoad("./testdata/mod_geo/geo.data")
+	if err != nil {
+		t.Fatalf("GeoDictLoad(): %s", err)
+	}
+
+	checkGeoDict(t, dict)
+}
+
+func TestGeoDictLoadBin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mod_geo")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	binFile := filepath.Join(dir, "geo.bin")
+	if err := GeoDictTxtToBin("./testdata/mod_geo/geo.data", binFile); err != nil {
+		t.Fatalf("GeoDictTxtToBin(): %s", err)
+	}
+
+	dict, err := GeoDictLoad(binFile)
+	if err != nil {
+		t.Fatalf("GeoDictLoad(): %s", err)
+	}
+
+	checkGeoDict(t, dict)
+}
+
+func TestGeoDictLoadInvalid(t *testing.T) {
+	files := []string{
+		"./testdata/geo_1.data",    // invalid location
+		"./testdata/geo_2.data",    // ip range overlap
+		"./testdata/geo_3.data",    // mixed ipv4 and ipv6
+		"./testdata/geo_4.data",    // no ip range
+		"./testdata/no_exist.data", // file not exist
+	}
+
+	for _, file := range files {
+		if _, err := GeoDictLoad(file); err == nil {
+			t.Errorf("err should not be nil for %s", file)
+		}
+	}
+}
+
+func TestGeoDictLoadBinTruncated(t *testing.T) {
+	conf, err := GeoDictConfLoad("./testdata/mod_geo/geo.data")
+	if err != nil {
+		t.Fatalf("GeoDictConfLoad(): %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := conf.SaveBinary(&buf); err != nil {
+		t.Fatalf("SaveBinary(): %s", err)
+	}
+
+	data := buf.Bytes()
+	if _, err := geoDictBinLoad(bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Errorf("err should not be nil for truncated binary dict")
+	}
+}
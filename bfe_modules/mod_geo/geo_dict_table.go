@@ -0,0 +1,69 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_geo
+
+import (
+	"net"
+	"sync"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+)
+
+type GeoDictTable struct {
+	lock sync.RWMutex
+	dict *GeoDict
+}
+
+type GeoDictStatus struct {
+	Version  string // version of geo dict
+	EntryNum int    // number of ip ranges
+}
+
+func NewGeoDictTable() *GeoDictTable {
+	t := new(GeoDictTable)
+	return t
+}
+
+func (t *GeoDictTable) Update(dict *GeoDict) {
+	t.lock.Lock()
+	t.dict = dict
+	t.lock.Unlock()
+}
+
+func (t *GeoDictTable) Search(ip net.IP) (*bfe_basic.GeoInfo, bool) {
+	t.lock.RLock()
+	dict := t.dict
+	t.lock.RUnlock()
+
+	if dict == nil {
+		return nil, false
+	}
+	return dict.Search(ip)
+}
+
+func (t *GeoDictTable) Status() GeoDictStatus {
+	t.lock.RLock()
+	dict := t.dict
+	t.lock.RUnlock()
+
+	var status GeoDictStatus
+	if dict != nil {
+		status.Version = dict.Version
+		status.EntryNum = dict.EntryNum
+	}
+	return status
+}
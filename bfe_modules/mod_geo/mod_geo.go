@@ -0,0 +1,192 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// module for geo location of client ip
+
+package mod_geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/web-monitor/metrics"
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+const (
+	ModGeo = "mod_geo"
+)
+
+var (
+	openDebug = false
+)
+
+type ModuleGeoState struct {
+	ReqTotal      *metrics.Counter // all request in
+	ReqNoClientIP *metrics.Counter // request without client ip
+	GeoFound      *metrics.Counter // request with geo location found
+	GeoNotFound   *metrics.Counter // request with geo location not found
+}
+
+type ModuleGeo struct {
+	name    string         // name of module
+	state   ModuleGeoState // module state
+	metrics metrics.Metrics
+
+	geoDictPath string        // path of geo dict file
+	geoDict     *GeoDictTable // table for geo dict
+}
+
+func NewModuleGeo() *ModuleGeo {
+	m := new(ModuleGeo)
+	m.name = ModGeo
+	m.metrics.Init(&m.state, ModGeo, 0)
+
+	m.geoDict = NewGeoDictTable()
+
+	return m
+}
+
+func (m *ModuleGeo) Name() string {
+	return m.name
+}
+
+func (m *ModuleGeo) State() interface{} {
+	return &m.state
+}
+
+// loadGeoDict load geo dict from file.
+func (m *ModuleGeo) loadGeoDict(query url.Values) error {
+	// get path
+	path := query.Get("path")
+	if path == "" {
+		// use default
+		path = m.geoDictPath
+	}
+
+	// load file
+	dict, err := GeoDictLoad(path)
+	if err != nil {
+		return fmt.Errorf("err in GeoDictLoad(%s):%s", path, err)
+	}
+
+	m.geoDict.Update(dict)
+	return nil
+}
+
+// geoHandler is a handler for setting geo location of client ip.
+func (m *ModuleGeo) geoHandler(req *bfe_basic.Request) (int, *bfe_http.Response) {
+	m.state.ReqTotal.Inc(1)
+
+	if req.ClientAddr == nil {
+		m.state.ReqNoClientIP.Inc(1)
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	info, ok := m.geoDict.Search(req.ClientAddr.IP)
+	if !ok {
+		m.state.GeoNotFound.Inc(1)
+		if openDebug {
+			log.Logger.Debug("%s geo location of %s not found", m.name, req.ClientAddr.IP)
+		}
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	m.state.GeoFound.Inc(1)
+	req.SetGeoInfo(info)
+	if openDebug {
+		log.Logger.Debug("%s geo location of %s: %+v", m.name, req.ClientAddr.IP, *info)
+	}
+
+	return bfe_module.BFE_HANDLER_GOON, nil
+}
+
+func (m *ModuleGeo) getState(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetAll()
+	return s.Format(params)
+}
+
+func (m *ModuleGeo) getStateDiff(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetDiff()
+	return s.Format(params)
+}
+
+func (m *ModuleGeo) getGeoDictStatus(params map[string][]string) ([]byte, error) {
+	return json.Marshal(m.geoDict.Status())
+}
+
+func (m *ModuleGeo) monitorHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name:               m.getState,
+		m.name + ".diff":     m.getStateDiff,
+		m.name + ".geo_dict": m.getGeoDictStatus,
+	}
+	return handlers
+}
+
+func (m *ModuleGeo) reloadHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name + ".geo_dict": m.loadGeoDict,
+	}
+	return handlers
+}
+
+func (m *ModuleGeo) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHandlers,
+	cr string) error {
+	var conf *ConfModGeo
+	var err error
+
+	// load module config
+	confPath := bfe_module.ModConfPath(cr, m.name)
+	if conf, err = ConfLoad(confPath, cr); err != nil {
+		return fmt.Errorf("%s: conf load err %s", m.name, err.Error())
+	}
+
+	m.geoDictPath = conf.Basic.GeoDictPath
+	openDebug = conf.Log.OpenDebug
+
+	// load geo dict
+	if err = m.loadGeoDict(nil); err != nil {
+		return fmt.Errorf("%s: loadGeoDict() err %s", m.name, err.Error())
+	}
+
+	// register handler
+	err = cbs.AddFilter(bfe_module.HANDLE_BEFORE_LOCATION, m.geoHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.geoHandler): %s", m.name, err.Error())
+	}
+
+	// register web handler for monitor
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_MONITOR, m.monitorHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.monitorHandlers): %s", m.name, err.Error())
+	}
+	// register web handler for reload
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_RELOAD, m.reloadHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.reloadHandlers): %s", m.name, err.Error())
+	}
+
+	return nil
+}
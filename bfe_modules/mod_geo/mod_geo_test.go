@@ -0,0 +1,120 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_geo
+
+import (
+	"net"
+	"net/url"
+	"testing"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_basic/condition"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+func prepareModule(t *testing.T) *ModuleGeo {
+	m := NewModuleGeo()
+	err := m.Init(bfe_module.NewBfeCallbacks(), web_monitor.NewWebHandlers(), "./testdata")
+	if err != nil {
+		t.Fatalf("Init(): %s", err)
+	}
+	return m
+}
+
+func prepareRequest(clientIP string) *bfe_basic.Request {
+	request := new(bfe_basic.Request)
+	request.HttpRequest = new(bfe_http.Request)
+	request.HttpRequest.Header = make(bfe_http.Header)
+	request.HttpRequest.URL, _ = url.Parse("/index.html")
+	request.Session = new(bfe_basic.Session)
+	request.Context = make(map[interface{}]interface{})
+	if clientIP != "" {
+		request.ClientAddr = &net.TCPAddr{IP: net.ParseIP(clientIP), Port: 8098}
+	}
+	return request
+}
+
+func TestGeoHandler(t *testing.T) {
+	m := prepareModule(t)
+
+	req := prepareRequest("8.8.8.8")
+	if ret, _ := m.geoHandler(req); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Fatalf("geoHandler() should return GOON")
+	}
+	info := req.GeoInfo()
+	if info == nil || info.Country != "US" || info.City != "Mountain View" {
+		t.Errorf("unexpected geo info: %+v", info)
+	}
+
+	req = prepareRequest("192.168.1.1")
+	m.geoHandler(req)
+	if req.GeoInfo() != nil {
+		t.Errorf("geo info should be nil, got %+v", req.GeoInfo())
+	}
+
+	req = prepareRequest("")
+	m.geoHandler(req)
+	if req.GeoInfo() != nil {
+		t.Errorf("geo info should be nil, got %+v", req.GeoInfo())
+	}
+
+	if m.state.ReqTotal.Get() != 3 || m.state.GeoFound.Get() != 1 ||
+		m.state.GeoNotFound.Get() != 1 || m.state.ReqNoClientIP.Get() != 1 {
+		t.Errorf("unexpected state: %+v", m.state)
+	}
+}
+
+func TestGeoCond(t *testing.T) {
+	m := prepareModule(t)
+
+	cond, err := condition.Build("req_cip_country_in(\"CN\", false) && req_cip_isp_in(\"China Telecom\", false)")
+	if err != nil {
+		t.Fatalf("condition.Build(): %s", err)
+	}
+
+	req := prepareRequest("1.0.2.1")
+	m.geoHandler(req)
+	if !cond.Match(req) {
+		t.Errorf("1.0.2.1 should match condition")
+	}
+
+	req = prepareRequest("8.8.8.8")
+	m.geoHandler(req)
+	if cond.Match(req) {
+		t.Errorf("8.8.8.8 should not match condition")
+	}
+}
+
+func TestLoadGeoDict(t *testing.T) {
+	m := prepareModule(t)
+
+	query := url.Values{}
+	query.Set("path", "./testdata/geo_2.data")
+	if err := m.loadGeoDict(query); err == nil {
+		t.Errorf("loadGeoDict() should fail for invalid dict")
+	}
+
+	// geo dict not changed
+	if status := m.geoDict.Status(); status.Version != "20190101000000" || status.EntryNum != 4 {
+		t.Errorf("unexpected geo dict status: %+v", status)
+	}
+}
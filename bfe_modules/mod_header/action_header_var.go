@@ -38,6 +38,12 @@ var VariableHandlers = map[string]HeaderValueHandler{
 	"bfe_session_id":   getSessionId,
 	"bfe_vip":          getBfeVip,
 
+	// for client geo location (set by mod_geo)
+	"bfe_client_country": getClientCountry,
+	"bfe_client_region":  getClientRegion,
+	"bfe_client_city":    getClientCity,
+	"bfe_client_isp":     getClientISP,
+
 	// for bfe
 	"bfe_server_name": getBfeServerName,
 
@@ -78,6 +84,38 @@ func getClientPort(req *bfe_basic.Request) string {
 	return strconv.Itoa(req.ClientAddr.Port)
 }
 
+// get country of client ip
+func getClientCountry(req *bfe_basic.Request) string {
+	if info := req.GeoInfo(); info != nil {
+		return info.Country
+	}
+	return ""
+}
+
+// get region of client ip
+func getClientRegion(req *bfe_basic.Request) string {
+	if info := req.GeoInfo(); info != nil {
+		return info.Region
+	}
+	return ""
+}
+
+// get city of client ip
+func getClientCity(req *bfe_basic.Request) string {
+	if info := req.GeoInfo(); info != nil {
+		return info.City
+	}
+	return ""
+}
+
+// get isp of client ip
+func getClientISP(req *bfe_basic.Request) string {
+	if info := req.GeoInfo(); info != nil {
+		return info.ISP
+	}
+	return ""
+}
+
 // get request host
 func getRequestHost(req *bfe_basic.Request) string {
 	return req.HttpRequest.Host
@@ -269,3 +269,22 @@ func BenchmarkHeaderConvertCase2(b *testing.B) {
 		textproto.CanonicalMIMEHeaderKey(header)
 	}
 }
+
+func TestHeaderActionsDoGeoVariable(t *testing.T) {
+	req := makeBasicRequest()
+	req.Context = make(map[interface{}]interface{})
+	req.SetGeoInfo(&bfe_basic.GeoInfo{Country: "CN", Region: "Beijing", City: "Beijing", ISP: "China Telecom"})
+
+	actions := []Action{
+		{Cmd: "REQ_HEADER_SET", Params: []string{"X-Client-Country", "%bfe_client_country"}},
+		{Cmd: "REQ_HEADER_SET", Params: []string{"X-Client-Isp", "%bfe_client_isp"}},
+	}
+	HeaderActionsDo(req, 0, actions)
+
+	if country := req.HttpRequest.Header.Get("X-Client-Country"); country != "CN" {
+		t.Errorf("X-Client-Country should be CN, got %s", country)
+	}
+	if isp := req.HttpRequest.Header.Get("X-Client-Isp"); isp != "China Telecom" {
+		t.Errorf("X-Client-Isp should be China Telecom, got %s", isp)
+	}
+}
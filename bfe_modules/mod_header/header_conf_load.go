@@ -129,13 +129,13 @@ func HeaderConfCheck(conf HeaderConfFile) error {
 	return nil
 }
 
-func ruleConvert(ruleFile HeaderRuleFile) (HeaderRule, error) {
+func ruleConvert(ruleFile HeaderRuleFile, product string) (HeaderRule, error) {
 	rule := HeaderRule{}
 
 	if ruleFile.Cond == nil {
 		return rule, fmt.Errorf("cond not set")
 	}
-	cond, err := condition.Build(*ruleFile.Cond)
+	cond, err := condition.BuildWithProduct(*ruleFile.Cond, product)
 	if err != nil {
 		return rule, err
 	}
@@ -150,12 +150,12 @@ func ruleConvert(ruleFile HeaderRuleFile) (HeaderRule, error) {
 	return rule, nil
 }
 
-func ruleListConvert(ruleFileList *RuleFileList) (*RuleList, error) {
+func ruleListConvert(ruleFileList *RuleFileList, product string) (*RuleList, error) {
 	ruleList := new(RuleList)
 	*ruleList = make([]HeaderRule, 0)
 
 	for _, ruleFile := range *ruleFileList {
-		rule, err := ruleConvert(ruleFile)
+		rule, err := ruleConvert(ruleFile, product)
 		if err != nil {
 			return ruleList, err
 		}
@@ -233,7 +233,7 @@ func HeaderConfLoad(filename string) (HeaderConf, error) {
 	conf.Config = make(ProductRules)
 
 	for product, ruleFileList := range *config.Config {
-		ruleList, err := ruleListConvert(ruleFileList)
+		ruleList, err := ruleListConvert(ruleFileList, product)
 		if err != nil {
 			return conf, err
 		}
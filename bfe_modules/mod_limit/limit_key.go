@@ -0,0 +1,90 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_limit
+
+import (
+	"errors"
+	"fmt"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+)
+
+// source of bucket key
+const (
+	KeyClientIP = "CLIENT_IP" // ip of client
+	KeyHeader   = "HEADER"    // value of request header
+	KeyCookie   = "COOKIE"    // value of request cookie
+	KeyQuery    = "QUERY"     // value of request query
+	KeyLogId    = "LOGID"     // log id of request
+)
+
+type LimitKeyFile struct {
+	Type *string // source of key
+	Name string  // name of header/cookie/query
+}
+
+type LimitKey struct {
+	Type string // source of key
+	Name string // name of header/cookie/query
+}
+
+func LimitKeyFileCheck(conf *LimitKeyFile) error {
+	if conf.Type == nil {
+		return errors.New("no Type")
+	}
+
+	switch *conf.Type {
+	case KeyClientIP, KeyLogId:
+		return nil
+	case KeyHeader, KeyCookie, KeyQuery:
+		if len(conf.Name) == 0 {
+			return fmt.Errorf("no Name for key type %s", *conf.Type)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid Type:%s", *conf.Type)
+	}
+}
+
+func limitKeyConvert(keyFile LimitKeyFile) LimitKey {
+	return LimitKey{Type: *keyFile.Type, Name: keyFile.Name}
+}
+
+// Get gets bucket key from request. Empty string is returned if not found.
+func (k LimitKey) Get(req *bfe_basic.Request) string {
+	switch k.Type {
+	case KeyClientIP:
+		if req.ClientAddr != nil {
+			return req.ClientAddr.IP.String()
+		}
+		if req.RemoteAddr != nil {
+			return req.RemoteAddr.IP.String()
+		}
+	case KeyHeader:
+		return req.HttpRequest.Header.Get(k.Name)
+	case KeyCookie:
+		if cookie, ok := req.Cookie(k.Name); ok {
+			return cookie.Value
+		}
+	case KeyQuery:
+		return req.CachedQuery().Get(k.Name)
+	case KeyLogId:
+		return req.LogId
+	}
+
+	return ""
+}
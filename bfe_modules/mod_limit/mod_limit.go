@@ -0,0 +1,267 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// module for limiting request rate
+
+package mod_limit
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/web-monitor/metrics"
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+const (
+	ModLimit     = "mod_limit"
+	CtxLimitInfo = "mod_limit.limit_info"
+)
+
+var (
+	ERR_RATE_LIMIT = errors.New("RATE_LIMIT")
+)
+
+var (
+	openDebug = false
+)
+
+type ModuleLimitState struct {
+	ReqTotal     *metrics.Counter // all request in
+	ReqToCheck   *metrics.Counter // request to check
+	ReqAccept    *metrics.Counter // request accepted
+	ReqLimited   *metrics.Counter // request exceeded limit
+	ReqClose     *metrics.Counter // request closed
+	ReqReject    *metrics.Counter // request rejected with 429
+	ReqTag       *metrics.Counter // request tagged and passed
+	KeyNotFound  *metrics.Counter // request with condition satisfied, but key not found
+	KeyTableFull *metrics.Counter // bucket evicted before refilled, since bucket table is full
+	WrongCommand *metrics.Counter // request exceeded limit, but wrong command
+}
+
+type LimitInfo struct {
+	LimitRuleName string // limit rule name
+	LimitKey      string // bucket key
+}
+
+type ModuleLimit struct {
+	name    string           // name of module
+	state   ModuleLimitState // module state
+	metrics metrics.Metrics
+
+	productRulePath string            // path of limit rule data file
+	ruleTable       *ProductRuleTable // table for product limit rules
+}
+
+func NewModuleLimit() *ModuleLimit {
+	m := new(ModuleLimit)
+	m.name = ModLimit
+	m.metrics.Init(&m.state, ModLimit, 0)
+
+	return m
+}
+
+func (m *ModuleLimit) Name() string {
+	return m.name
+}
+
+func (m *ModuleLimit) State() interface{} {
+	return &m.state
+}
+
+// loadProductRuleConf load from config file.
+func (m *ModuleLimit) loadProductRuleConf(query url.Values) error {
+	// get path
+	path := query.Get("path")
+	if path == "" {
+		// use default
+		path = m.productRulePath
+	}
+
+	// load file
+	conf, err := ProductRuleConfLoad(path)
+	if err != nil {
+		return fmt.Errorf("err in ProductRuleConfLoad(%s):%s", path, err)
+	}
+
+	m.ruleTable.Update(conf)
+	return nil
+}
+
+// productLimitHandler is a handler for doing product limit.
+func (m *ModuleLimit) productLimitHandler(request *bfe_basic.Request) (
+	int, *bfe_http.Response) {
+	if openDebug {
+		log.Logger.Debug("%s check request", m.name)
+	}
+	m.state.ReqTotal.Inc(1)
+
+	// find limit rules for given request
+	rules, ok := m.ruleTable.Search(request.Route.Product)
+	if !ok { // no rules found
+		if openDebug {
+			log.Logger.Debug("%s product %s not found, just pass",
+				m.name, request.Route.Product)
+		}
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	m.state.ReqToCheck.Inc(1)
+	return m.productRulesProcess(request, rules)
+}
+
+func (m *ModuleLimit) productRulesProcess(req *bfe_basic.Request, rules *limitRuleList) (
+	int, *bfe_http.Response) {
+	now := time.Now()
+
+	for _, rule := range *rules {
+		if openDebug {
+			log.Logger.Debug("%s process rule: %v", m.name, rule.Name)
+		}
+
+		// rule condition is satisfied ?
+		if !rule.Cond.Match(req) {
+			continue
+		}
+
+		key := rule.Key.Get(req)
+		if len(key) == 0 {
+			m.state.KeyNotFound.Inc(1)
+			continue
+		}
+
+		allowed, evicted := rule.buckets.Take(key, now)
+		if evicted {
+			m.state.KeyTableFull.Inc(1)
+		}
+		if allowed {
+			continue
+		}
+
+		// limit is exceeded
+		m.state.ReqLimited.Inc(1)
+		limitInfo := &LimitInfo{LimitRuleName: rule.Name, LimitKey: key}
+		req.SetContext(CtxLimitInfo, limitInfo)
+
+		switch rule.Action.Cmd {
+		case ActionClose:
+			req.ErrCode = ERR_RATE_LIMIT
+			log.Logger.Debug("%s close connection (rule:%s, key:%s, remote:%s)",
+				m.name, rule.Name, key, req.RemoteAddr)
+			m.state.ReqClose.Inc(1)
+			return bfe_module.BFE_HANDLER_CLOSE, nil
+
+		case ActionReject:
+			req.ErrCode = ERR_RATE_LIMIT
+			log.Logger.Debug("%s reject request (rule:%s, key:%s, remote:%s)",
+				m.name, rule.Name, key, req.RemoteAddr)
+			m.state.ReqReject.Inc(1)
+			return bfe_module.BFE_HANDLER_RESPONSE,
+				bfe_basic.CreateInternalResp(req, bfe_http.StatusTooManyRequests)
+
+		case ActionTag:
+			req.AddTags(rule.Action.Params[0], []string{rule.Action.Params[1]})
+			m.state.ReqTag.Inc(1)
+
+		default:
+			if openDebug {
+				log.Logger.Debug("%s unknown limit command (%s), just pass",
+					m.name, rule.Action.Cmd)
+			}
+			m.state.WrongCommand.Inc(1)
+		}
+	}
+
+	if openDebug {
+		log.Logger.Debug("%s accept request", m.name)
+	}
+	m.state.ReqAccept.Inc(1)
+	return bfe_module.BFE_HANDLER_GOON, nil
+}
+
+func (m *ModuleLimit) getState(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetAll()
+	return s.Format(params)
+}
+
+func (m *ModuleLimit) getStateDiff(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetDiff()
+	return s.Format(params)
+}
+
+func (m *ModuleLimit) monitorHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name:           m.getState,
+		m.name + ".diff": m.getStateDiff,
+	}
+	return handlers
+}
+
+func (m *ModuleLimit) reloadHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name + ".product_rule_table": m.loadProductRuleConf,
+	}
+	return handlers
+}
+
+func (m *ModuleLimit) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHandlers,
+	cr string) error {
+	var conf *ConfModLimit
+	var err error
+
+	// load module config
+	confPath := bfe_module.ModConfPath(cr, m.name)
+	if conf, err = ConfLoad(confPath, cr); err != nil {
+		return fmt.Errorf("%s: conf load err %s", m.name, err.Error())
+	}
+
+	m.productRulePath = conf.Basic.ProductRulePath
+	m.ruleTable = NewProductRuleTable(conf.Basic.MaxKeysPerRule)
+	openDebug = conf.Log.OpenDebug
+
+	// load conf data
+	if err = m.loadProductRuleConf(nil); err != nil {
+		return fmt.Errorf("%s: loadProductRuleConf() err %s", m.name, err.Error())
+	}
+
+	// register handler
+	err = cbs.AddFilter(bfe_module.HANDLE_FOUND_PRODUCT, m.productLimitHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.productLimitHandler): %s", m.name, err.Error())
+	}
+
+	// register web handler for monitor
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_MONITOR, m.monitorHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.monitorHandlers): %s", m.name, err.Error())
+	}
+	// register web handler for reload
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_RELOAD, m.reloadHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.reloadHandlers): %s", m.name, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_limit
+
+import (
+	"net"
+	"net/url"
+	"testing"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+func prepareModule() *ModuleLimit {
+	m := NewModuleLimit()
+	m.Init(bfe_module.NewBfeCallbacks(), web_monitor.NewWebHandlers(), "./testdata")
+	return m
+}
+
+func prepareRequest(path string) *bfe_basic.Request {
+	request := new(bfe_basic.Request)
+	request.HttpRequest = new(bfe_http.Request)
+	request.HttpRequest.Header = make(bfe_http.Header)
+	request.HttpRequest.URL, _ = url.Parse(path)
+	request.Session = new(bfe_basic.Session)
+	request.Context = make(map[interface{}]interface{})
+	request.Tags.TagTable = make(map[string][]string)
+	request.RemoteAddr, _ = net.ResolveTCPAddr("tcp", "10.1.1.1:8098")
+	request.Route = bfe_basic.RequestRoute{Product: "pn"}
+	return request
+}
+
+func TestProductLimitNoRule(t *testing.T) {
+	m := prepareModule()
+
+	req := prepareRequest("/close")
+	req.Route.Product = "unknown"
+	for i := 0; i < 5; i++ {
+		status, _ := m.productLimitHandler(req)
+		if status != bfe_module.BFE_HANDLER_GOON {
+			t.Errorf("Should not limit request")
+		}
+	}
+}
+
+func TestProductLimitClose(t *testing.T) {
+	m := prepareModule()
+
+	// burst is 2
+	for i := 0; i < 2; i++ {
+		status, _ := m.productLimitHandler(prepareRequest("/close"))
+		if status != bfe_module.BFE_HANDLER_GOON {
+			t.Errorf("Should not limit request %d", i)
+		}
+	}
+
+	req := prepareRequest("/close")
+	status, _ := m.productLimitHandler(req)
+	if status != bfe_module.BFE_HANDLER_CLOSE {
+		t.Errorf("Should close request")
+	}
+	if req.ErrCode != ERR_RATE_LIMIT {
+		t.Errorf("ErrCode should be ERR_RATE_LIMIT")
+	}
+
+	limitInfo, ok := req.GetContext(CtxLimitInfo).(*LimitInfo)
+	if !ok || limitInfo.LimitRuleName != "limit_by_ip" || limitInfo.LimitKey != "10.1.1.1" {
+		t.Errorf("unexpected limit info: %v", limitInfo)
+	}
+
+	// request from other client ip
+	req = prepareRequest("/close")
+	req.RemoteAddr, _ = net.ResolveTCPAddr("tcp", "10.1.1.2:8098")
+	status, _ = m.productLimitHandler(req)
+	if status != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("Should not limit request from other client")
+	}
+}
+
+func TestProductLimitReject(t *testing.T) {
+	m := prepareModule()
+
+	req := prepareRequest("/reject")
+	req.HttpRequest.Header.Set("X-User", "user1")
+	status, _ := m.productLimitHandler(req)
+	if status != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("Should not limit request")
+	}
+
+	status, res := m.productLimitHandler(req)
+	if status != bfe_module.BFE_HANDLER_RESPONSE {
+		t.Errorf("Should reject request")
+	}
+	if res == nil || res.StatusCode != bfe_http.StatusTooManyRequests {
+		t.Errorf("status code should be 429")
+	}
+
+	// key not found
+	req = prepareRequest("/reject")
+	status, _ = m.productLimitHandler(req)
+	if status != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("Should not limit request without key")
+	}
+	if m.state.KeyNotFound.Get() != 1 {
+		t.Errorf("KeyNotFound should be 1")
+	}
+}
+
+func TestProductLimitTag(t *testing.T) {
+	m := prepareModule()
+
+	status, _ := m.productLimitHandler(prepareRequest("/tag?uid=1"))
+	if status != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("Should not limit request")
+	}
+
+	req := prepareRequest("/tag?uid=1")
+	status, _ = m.productLimitHandler(req)
+	if status != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("Should pass tagged request")
+	}
+	tags := req.GetTags("rate_limit")
+	if len(tags) != 1 || tags[0] != "exceeded" {
+		t.Errorf("request should be tagged, got %v", tags)
+	}
+}
+
+func TestModuleMisc(t *testing.T) {
+	m := prepareModule()
+	if s, _ := m.getState(nil); s == nil {
+		t.Errorf("Should return valid state")
+	}
+	if m.monitorHandlers() == nil {
+		t.Errorf("Should return valid monitor handlers")
+	}
+	if m.reloadHandlers() == nil {
+		t.Errorf("Should return valid reload handlers")
+	}
+}
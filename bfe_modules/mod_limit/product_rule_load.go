@@ -0,0 +1,231 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_limit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic/condition"
+)
+
+type limitRuleFile struct {
+	Cond   *string       // condition for limit
+	Name   *string       // limit rule name
+	Key    *LimitKeyFile // source of bucket key
+	Rate   *float64      // requests allowed per second
+	Burst  *int          // max burst of requests
+	Action *ActionFile   // action when limit is exceeded
+}
+
+type limitRule struct {
+	Cond   condition.Condition // condition for limit
+	Name   string              // limit rule name
+	Key    LimitKey            // source of bucket key
+	Rate   float64             // requests allowed per second
+	Burst  int                 // max burst of requests
+	Action Action              // action when limit is exceeded
+
+	buckets *BucketTable // token buckets for keys
+}
+
+type limitRuleFileList []limitRuleFile
+type limitRuleList []*limitRule
+
+type ProductRulesFile map[string]*limitRuleFileList // product => list of limit rules
+type ProductRules map[string]*limitRuleList
+
+type productRuleConfFile struct {
+	Version *string // version of the config
+	Config  *ProductRulesFile
+}
+
+type productRuleConf struct {
+	Version string       // version of the config
+	Config  ProductRules // product rules for limit
+}
+
+func limitRuleCheck(conf limitRuleFile) error {
+	// check Cond
+	if conf.Cond == nil {
+		return errors.New("no Cond")
+	}
+
+	// check Name
+	if conf.Name == nil {
+		return errors.New("no Name")
+	}
+
+	// check Key
+	if conf.Key == nil {
+		return errors.New("no Key")
+	}
+	if err := LimitKeyFileCheck(conf.Key); err != nil {
+		return fmt.Errorf("Key:%s", err.Error())
+	}
+
+	// check Rate and Burst
+	if conf.Rate == nil {
+		return errors.New("no Rate")
+	}
+	if *conf.Rate <= 0 {
+		return fmt.Errorf("Rate should be > 0")
+	}
+	if conf.Burst == nil {
+		return errors.New("no Burst")
+	}
+	if *conf.Burst < 1 {
+		return fmt.Errorf("Burst should be >= 1")
+	}
+
+	// check Actions
+	if conf.Action == nil {
+		return errors.New("no Action")
+	}
+	if err := ActionFileCheck(conf.Action); err != nil {
+		return fmt.Errorf("Action:%s", err.Error())
+	}
+
+	return nil
+}
+
+func limitRuleListCheck(conf *limitRuleFileList) error {
+	ruleNameMap := make(map[string]bool)
+	for index, rule := range *conf {
+		err := limitRuleCheck(rule)
+		if err != nil {
+			return fmt.Errorf("limitRule:%d, %s", index, err.Error())
+		}
+
+		// check rule name for one product
+		if _, ok := ruleNameMap[*rule.Name]; ok {
+			return fmt.Errorf("limitRule:%d, two rules have same name[%s]!", index, *rule.Name)
+		}
+		ruleNameMap[*rule.Name] = true
+	}
+
+	return nil
+}
+
+func productRulesCheck(conf *ProductRulesFile) error {
+	for product, ruleList := range *conf {
+		if ruleList == nil {
+			return fmt.Errorf("no limitRuleList for product:%s", product)
+		}
+
+		err := limitRuleListCheck(ruleList)
+		if err != nil {
+			return fmt.Errorf("ProductRules:%s, %s", product, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRuleConfCheck(conf productRuleConfFile) error {
+	var err error
+
+	// check Version
+	if conf.Version == nil {
+		return errors.New("no Version")
+	}
+
+	// check Config
+	if conf.Config == nil {
+		return errors.New("no Config")
+	}
+
+	err = productRulesCheck(conf.Config)
+	if err != nil {
+		return fmt.Errorf("Config:%s", err.Error())
+	}
+
+	return nil
+}
+
+func ruleConvert(ruleFile limitRuleFile, product string) (*limitRule, error) {
+	rule := new(limitRule)
+
+	cond, err := condition.BuildWithProduct(*ruleFile.Cond, product)
+	if err != nil {
+		return nil, err
+	}
+	rule.Cond = cond
+	rule.Name = *ruleFile.Name
+	rule.Key = limitKeyConvert(*ruleFile.Key)
+	rule.Rate = *ruleFile.Rate
+	rule.Burst = *ruleFile.Burst
+	rule.Action = actionConvert(*ruleFile.Action)
+	return rule, nil
+}
+
+func ruleListConvert(ruleFileList *limitRuleFileList, product string) (*limitRuleList, error) {
+	ruleList := new(limitRuleList)
+	*ruleList = make([]*limitRule, 0)
+
+	for _, ruleFile := range *ruleFileList {
+		rule, err := ruleConvert(ruleFile, product)
+		if err != nil {
+			return nil, err
+		}
+		*ruleList = append(*ruleList, rule)
+	}
+
+	return ruleList, nil
+}
+
+// ProductRuleConfLoad load limit rule config from file.
+func ProductRuleConfLoad(filename string) (productRuleConf, error) {
+	var conf productRuleConf
+	var err error
+
+	// open the file
+	file, err := os.Open(filename)
+	if err != nil {
+		return conf, err
+	}
+	defer file.Close()
+
+	// decode the file
+	decoder := json.NewDecoder(file)
+	var config productRuleConfFile
+	err = decoder.Decode(&config)
+	if err != nil {
+		return conf, err
+	}
+
+	// check config
+	err = productRuleConfCheck(config)
+	if err != nil {
+		return conf, err
+	}
+
+	// convert config
+	conf.Version = *config.Version
+	conf.Config = make(ProductRules)
+	for product, ruleFileList := range *config.Config {
+		ruleList, err := ruleListConvert(ruleFileList, product)
+		if err != nil {
+			return conf, err
+		}
+		conf.Config[product] = ruleList
+	}
+
+	return conf, nil
+}
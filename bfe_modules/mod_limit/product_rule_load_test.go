@@ -0,0 +1,44 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_limit
+
+import (
+	"testing"
+)
+
+func TestLimitRuleConfLoad(t *testing.T) {
+	config, err := ProductRuleConfLoad("./testdata/mod_limit/limit_rules.data")
+	if err != nil {
+		t.Fatalf("get err from ProductRuleConfLoad():%s", err.Error())
+	}
+
+	if len(*config.Config["pn"]) != 3 {
+		t.Errorf("len(config.Config['pn']) should be 3")
+	}
+}
+
+func TestLimitRuleConfLoadInvalid(t *testing.T) {
+	files := []string{
+		"./testdata/limit_rules_1.data", // no name for header key
+		"./testdata/limit_rules_2.data", // invalid rate
+		"./testdata/limit_rules_3.data", // invalid params for TAG
+	}
+
+	for _, file := range files {
+		if _, err := ProductRuleConfLoad(file); err == nil {
+			t.Errorf("err should not be nil for %s", file)
+		}
+	}
+}
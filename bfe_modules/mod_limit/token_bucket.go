@@ -0,0 +1,142 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// token buckets for each key
+
+package mod_limit
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	bucketShardNum = 64 // number of shards in bucket table
+)
+
+type tokenBucket struct {
+	key    string    // key of bucket
+	tokens float64   // tokens available
+	last   time.Time // time of last update
+}
+
+type bucketShard struct {
+	lock    sync.Mutex
+	buckets map[string]*list.Element
+	lru     *list.List // front is most recently used
+}
+
+// BucketTable holds token buckets for keys of one rule.
+type BucketTable struct {
+	rate     float64       // tokens added per second
+	burst    float64       // max tokens of bucket
+	maxKeys  int           // max number of keys in each shard
+	idleTime time.Duration // time for an idle bucket to be full
+
+	shards [bucketShardNum]bucketShard
+}
+
+// NewBucketTable creates a BucketTable.
+//
+// Params:
+//     - rate: tokens added per second
+//     - burst: max tokens of bucket
+//     - maxKeys: max number of keys in table
+func NewBucketTable(rate float64, burst int, maxKeys int) *BucketTable {
+	t := new(BucketTable)
+	t.rate = rate
+	t.burst = float64(burst)
+	t.maxKeys = (maxKeys + bucketShardNum - 1) / bucketShardNum
+	t.idleTime = time.Duration(t.burst / rate * float64(time.Second))
+
+	for i := range t.shards {
+		t.shards[i].buckets = make(map[string]*list.Element)
+		t.shards[i].lru = list.New()
+	}
+
+	return t
+}
+
+// Take takes a token for key. If table is full, least recently used
+// bucket is evicted for new key.
+//
+// Returns:
+//     - allowed: whether a token is taken
+//     - evicted: true if a bucket not refilled to full is evicted
+func (t *BucketTable) Take(key string, now time.Time) (allowed bool, evicted bool) {
+	shard := &t.shards[shardIndex(key)]
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	var bucket *tokenBucket
+	if elem, ok := shard.buckets[key]; ok {
+		shard.lru.MoveToFront(elem)
+		bucket = elem.Value.(*tokenBucket)
+	} else {
+		if shard.lru.Len() >= t.maxKeys {
+			evicted = t.evict(shard, now)
+		}
+
+		bucket = &tokenBucket{key: key, tokens: t.burst, last: now}
+		shard.buckets[key] = shard.lru.PushFront(bucket)
+	}
+
+	// refill tokens
+	elapsed := now.Sub(bucket.last).Seconds()
+	if elapsed > 0 {
+		bucket.tokens += elapsed * t.rate
+		if bucket.tokens > t.burst {
+			bucket.tokens = t.burst
+		}
+		bucket.last = now
+	}
+
+	if bucket.tokens < 1 {
+		return false, evicted
+	}
+	bucket.tokens--
+	return true, evicted
+}
+
+// Len returns number of keys in table.
+func (t *BucketTable) Len() int {
+	n := 0
+	for i := range t.shards {
+		shard := &t.shards[i]
+		shard.lock.Lock()
+		n += shard.lru.Len()
+		shard.lock.Unlock()
+	}
+	return n
+}
+
+// evict removes least recently used bucket in shard, and returns true if
+// the bucket has not been refilled to full.
+func (t *BucketTable) evict(shard *bucketShard, now time.Time) bool {
+	elem := shard.lru.Back()
+	bucket := elem.Value.(*tokenBucket)
+	shard.lru.Remove(elem)
+	delete(shard.buckets, bucket.key)
+
+	return now.Sub(bucket.last) < t.idleTime
+}
+
+func shardIndex(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32() % bucketShardNum
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_limit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBucketTableTake(t *testing.T) {
+	table := NewBucketTable(2, 2, 1000)
+	now := time.Now()
+
+	// burst
+	for i := 0; i < 2; i++ {
+		if allowed, _ := table.Take("k1", now); !allowed {
+			t.Errorf("request %d should be allowed", i)
+		}
+	}
+	if allowed, _ := table.Take("k1", now); allowed {
+		t.Errorf("request should be limited")
+	}
+
+	// other key
+	if allowed, _ := table.Take("k2", now); !allowed {
+		t.Errorf("request of other key should be allowed")
+	}
+
+	// refill after 500ms
+	now = now.Add(500 * time.Millisecond)
+	if allowed, _ := table.Take("k1", now); !allowed {
+		t.Errorf("request should be allowed after refill")
+	}
+	if allowed, _ := table.Take("k1", now); allowed {
+		t.Errorf("request should be limited")
+	}
+}
+
+// keysInShard returns n keys in the same shard.
+func keysInShard(n int) []string {
+	keys := make([]string, 0, n)
+	for i := 0; len(keys) < n; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if shardIndex(key) == shardIndex("k0") {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestBucketTableFull(t *testing.T) {
+	// 100 keys for each shard
+	maxKeys := 100
+	table := NewBucketTable(1, 1, maxKeys*bucketShardNum)
+	now := time.Now()
+	keys := keysInShard(maxKeys + 1)
+
+	for _, key := range keys[:maxKeys] {
+		table.Take(key, now)
+	}
+
+	// least recently used key is evicted for new key, and new key is limited
+	table.Take(keys[1], now)
+	if _, evicted := table.Take(keys[maxKeys], now); !evicted {
+		t.Errorf("bucket should be evicted when table is full")
+	}
+	if allowed, _ := table.Take(keys[maxKeys], now); allowed {
+		t.Errorf("request of new key should be limited")
+	}
+	if table.Len() != maxKeys {
+		t.Errorf("table size should be %d, got %d", maxKeys, table.Len())
+	}
+
+	// only one bucket is evicted for each new key
+	if allowed, _ := table.Take(keys[1], now); allowed {
+		t.Errorf("recently used key should not be evicted")
+	}
+	if allowed, _ := table.Take(keys[0], now); !allowed {
+		t.Errorf("least recently used key should be evicted")
+	}
+
+	// bucket refilled to full is evicted silently
+	later := now.Add(2 * time.Second)
+	if _, evicted := table.Take("new", later); evicted {
+		t.Errorf("evicted bucket should be refilled")
+	}
+}
+
+func BenchmarkBucketTableFull(b *testing.B) {
+	table := NewBucketTable(1, 1, 100000)
+	now := time.Now()
+	for i := 0; i < 100000; i++ {
+		table.Take(fmt.Sprintf("k%d", i), now)
+	}
+	keys := make([]string, b.N)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("n%d", i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		table.Take(keys[i], now)
+	}
+}
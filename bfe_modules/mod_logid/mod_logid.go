@@ -59,6 +59,10 @@ func (m *ModuleLogId) Name() string {
 	return m.name
 }
 
+func (m *ModuleLogId) State() interface{} {
+	return &m.state
+}
+
 func (m *ModuleLogId) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHandlers,
 	cr string) error {
 	// register handler
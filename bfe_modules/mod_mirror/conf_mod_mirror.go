@@ -0,0 +1,101 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_mirror
+
+import (
+	"fmt"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	gcfg "gopkg.in/gcfg.v1"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_util"
+)
+
+type ConfModMirror struct {
+	Basic struct {
+		ProductRulePath string // path of product mirror rule data
+		WorkerNum       int    // number of workers sending mirror request
+		QueueSize       int    // max number of mirror request waiting to be sent
+		MaxBodySize     int    // max size of request body to mirror, no more than 4096
+	}
+
+	Log struct {
+		OpenDebug bool // whether open debug
+	}
+}
+
+// ConfLoad loads config from config file
+func ConfLoad(filePath string, confRoot string) (*ConfModMirror, error) {
+	var cfg ConfModMirror
+	var err error
+
+	// read config from file
+	err = gcfg.ReadFileInto(&cfg, filePath)
+	if err != nil {
+		return &cfg, err
+	}
+
+	// check conf of mod_mirror
+	err = cfg.Check(confRoot)
+	if err != nil {
+		return &cfg, err
+	}
+
+	return &cfg, nil
+}
+
+func (cfg *ConfModMirror) Check(confRoot string) error {
+	return ConfModMirrorCheck(cfg, confRoot)
+}
+
+func ConfModMirrorCheck(cfg *ConfModMirror, confRoot string) error {
+	if cfg.Basic.ProductRulePath == "" {
+		log.Logger.Warn("ModMirror.ProductRulePath not set, use default value")
+		cfg.Basic.ProductRulePath = "mod_mirror/mirror_rules.data"
+	}
+	cfg.Basic.ProductRulePath = bfe_util.ConfPathProc(cfg.Basic.ProductRulePath, confRoot)
+
+	if cfg.Basic.WorkerNum < 0 {
+		return fmt.Errorf("ModMirror.WorkerNum should not be negative")
+	}
+	if cfg.Basic.WorkerNum == 0 {
+		log.Logger.Warn("ModMirror.WorkerNum not set, use default value")
+		cfg.Basic.WorkerNum = 16
+	}
+
+	if cfg.Basic.QueueSize < 0 {
+		return fmt.Errorf("ModMirror.QueueSize should not be negative")
+	}
+	if cfg.Basic.QueueSize == 0 {
+		log.Logger.Warn("ModMirror.QueueSize not set, use default value")
+		cfg.Basic.QueueSize = 1024
+	}
+
+	// body larger than read buffer of connection could not be peeked
+	if cfg.Basic.MaxBodySize < 0 || cfg.Basic.MaxBodySize > bfe_http.MaxReqBodyPeekSize {
+		return fmt.Errorf("ModMirror.MaxBodySize should be in [0, %d]", bfe_http.MaxReqBodyPeekSize)
+	}
+	if cfg.Basic.MaxBodySize == 0 {
+		log.Logger.Warn("ModMirror.MaxBodySize not set, use default value")
+		cfg.Basic.MaxBodySize = bfe_http.MaxReqBodyPeekSize
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_mirror
+
+import (
+	"testing"
+)
+
+func TestConfModMirrorLoad_1(t *testing.T) {
+	config, err := ConfLoad("./testdata/conf_mod_mirror/bfe_1.conf", "")
+	if err != nil {
+		t.Fatalf("ConfLoad():err=%s", err.Error())
+	}
+
+	if config.Basic.ProductRulePath != "/home/bfe/conf/mirror_rules.data" {
+		t.Error("ProductRulePath should be /home/bfe/conf/mirror_rules.data")
+	}
+	if config.Basic.WorkerNum != 4 || config.Basic.QueueSize != 100 || config.Basic.MaxBodySize != 1024 {
+		t.Errorf("unexpected config: %+v", config.Basic)
+	}
+}
+
+func TestConfModMirrorLoad_2(t *testing.T) {
+	config, _ := ConfLoad("./testdata/conf_mod_mirror/bfe_2.conf", "")
+
+	// use default value
+	if config.Basic.ProductRulePath != "mod_mirror/mirror_rules.data" {
+		t.Error("ProductRulePath should be mod_mirror/mirror_rules.data")
+	}
+	if config.Basic.WorkerNum != 16 || config.Basic.QueueSize != 1024 || config.Basic.MaxBodySize != 4096 {
+		t.Errorf("unexpected config: %+v", config.Basic)
+	}
+}
+
+func TestConfModMirrorLoad_3(t *testing.T) {
+	if _, err := ConfLoad("./testdata/conf_mod_mirror/bfe_3.conf", ""); err == nil {
+		t.Error("err should not be nil for negative QueueSize")
+	}
+}
+
+func TestConfModMirrorLoad_4(t *testing.T) {
+	if _, err := ConfLoad("./testdata/conf_mod_mirror/bfe_4.conf", ""); err == nil {
+		t.Error("err should not be nil for MaxBodySize larger than read buffer")
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// module for mirroring request to shadow cluster
+
+package mod_mirror
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/url"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/web-monitor/metrics"
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+const (
+	ModMirror = "mod_mirror"
+)
+
+const (
+	// max size of shadow response body read before discarded
+	maxDiscardSize = 64 * 1024
+)
+
+// hop-by-hop headers not copied to mirror request
+var skipHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+type ModuleMirrorState struct {
+	ReqTotal       *metrics.Counter // all request in
+	ReqToMirror    *metrics.Counter // request with condition satisfied and sampled
+	MirrorSuccess  *metrics.Counter // mirror request succeeded
+	MirrorFail     *metrics.Counter // mirror request failed
+	MirrorDrop     *metrics.Counter // mirror request dropped for queue full
+	MirrorDropBody *metrics.Counter // mirror request dropped for body not copied
+}
+
+// mirrorTask is a request to send to shadow cluster.
+type mirrorTask struct {
+	cluster string             // shadow cluster
+	req     *bfe_basic.Request // snapshot of original request, for balance
+	outreq  *bfe_http.Request  // mirror request
+}
+
+type ModuleMirror struct {
+	name    string            // name of module
+	state   ModuleMirrorState // module state
+	metrics metrics.Metrics
+
+	productRulePath string                    // path of mirror rule data file
+	ruleTable       *ProductRuleTable         // table for product mirror rules
+	maxBodySize     int                       // max size of request body to mirror
+	queue           chan *mirrorTask          // queue of mirror requests
+	invoker         bfe_module.ClusterInvoker // invoker for sending mirror request
+
+	// whether open debug, kept in module since it is read by workers
+	openDebug bool
+}
+
+func NewModuleMirror() *ModuleMirror {
+	m := new(ModuleMirror)
+	m.name = ModMirror
+	m.metrics.Init(&m.state, ModMirror, 0)
+
+	m.ruleTable = NewProductRuleTable()
+
+	return m
+}
+
+func (m *ModuleMirror) Name() string {
+	return m.name
+}
+
+func (m *ModuleMirror) State() interface{} {
+	return &m.state
+}
+
+// SetClusterInvoker sets invoker for sending mirror request to shadow cluster.
+func (m *ModuleMirror) SetClusterInvoker(invoker bfe_module.ClusterInvoker) {
+	m.invoker = invoker
+}
+
+func (m *ModuleMirror) loadProductRuleConf(query url.Values) error {
+	// get path
+	path := query.Get("path")
+	if path == "" {
+		// use default
+		path = m.productRulePath
+	}
+
+	// load file
+	conf, err := ProductRuleConfLoad(path)
+	if err != nil {
+		return fmt.Errorf("err in ProductRuleConfLoad(%s):%s", path, err)
+	}
+
+	m.ruleTable.Update(conf)
+	return nil
+}
+
+// newMirrorRequest creates mirror request with method, url, headers and
+// body of original request.
+func newMirrorRequest(req *bfe_basic.Request, body []byte) *bfe_http.Request {
+	httpReq := req.HttpRequest
+
+	outreq := new(bfe_http.Request)
+	outreq.Method = httpReq.Method
+	outreq.URL = &url.URL{
+		Path:     httpReq.URL.Path,
+		RawPath:  httpReq.URL.RawPath,
+		RawQuery: httpReq.URL.RawQuery,
+	}
+	outreq.Proto = "HTTP/1.1"
+	outreq.ProtoMajor = 1
+	outreq.ProtoMinor = 1
+	outreq.Host = httpReq.Host
+	outreq.Header = make(bfe_http.Header)
+	outreq.State = new(bfe_http.RequestState)
+
+	for key, values := range httpReq.Header {
+		outreq.Header[key] = append([]string(nil), values...)
+	}
+	for _, key := range skipHeaders {
+		outreq.Header.Del(key)
+	}
+
+	outreq.ContentLength = int64(len(body))
+	if len(body) != 0 {
+		outreq.Body = ioutil.NopCloser(bytes.NewReader(body))
+	} else {
+		outreq.Body = bfe_http.EofReader
+	}
+
+	return outreq
+}
+
+// newMirrorTask creates mirror task which is independent of original request,
+// since original request may be finished before mirror request is sent.
+func newMirrorTask(req *bfe_basic.Request, cluster string, body []byte) *mirrorTask {
+	outreq := newMirrorRequest(req, body)
+
+	mreq := new(bfe_basic.Request)
+	mreq.HttpRequest = outreq
+	mreq.RemoteAddr = req.RemoteAddr
+	mreq.ClientAddr = req.ClientAddr
+	mreq.LogId = req.LogId
+	mreq.Route = req.Route
+	mreq.Route.ClusterName = cluster
+	mreq.Context = make(map[interface{}]interface{})
+
+	return &mirrorTask{cluster: cluster, req: mreq, outreq: outreq}
+}
+
+// sendMirror sends mirror request to shadow cluster, response is discarded.
+func (m *ModuleMirror) sendMirror(task *mirrorTask) error {
+	if m.invoker == nil {
+		return errors.New("no cluster invoker")
+	}
+
+	res, err := m.invoker.InvokeCluster(task.cluster, task.req, task.outreq)
+	if err != nil {
+		return err
+	}
+
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, maxDiscardSize))
+	res.Body.Close()
+	return nil
+}
+
+// mirrorWorker sends mirror requests in queue.
+func (m *ModuleMirror) mirrorWorker() {
+	for task := range m.queue {
+		if err := m.sendMirror(task); err != nil {
+			m.state.MirrorFail.Inc(1)
+			if m.openDebug {
+				log.Logger.Debug("%s mirror request to %s failed: %s", m.name, task.cluster, err)
+			}
+			continue
+		}
+		m.state.MirrorSuccess.Inc(1)
+	}
+}
+
+// mirrorHandler is a handler for mirroring request to shadow cluster.
+// Mirror request is sent asynchronously, and dropped if queue is full.
+func (m *ModuleMirror) mirrorHandler(req *bfe_basic.Request) (int, *bfe_http.Response) {
+	m.state.ReqTotal.Inc(1)
+
+	// find mirror rules for given request
+	rules, ok := m.ruleTable.Search(req.Route.Product)
+	if !ok {
+		if m.openDebug {
+			log.Logger.Debug("%s product %s not found, just pass",
+				m.name, req.Route.Product)
+		}
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	for i := range *rules {
+		rule := &(*rules)[i]
+		if !rule.Cond.Match(req) {
+			continue
+		}
+
+		// first matched rule is used
+		if rule.Percentage < 100 && rand.Float64()*100 >= rule.Percentage {
+			break
+		}
+		m.state.ReqToMirror.Inc(1)
+
+		body, err := req.PeekReqBody(m.maxBodySize)
+		if err != nil {
+			m.state.MirrorDropBody.Inc(1)
+			if m.openDebug {
+				log.Logger.Debug("%s request body not copied: %s", m.name, err)
+			}
+			break
+		}
+
+		select {
+		case m.queue <- newMirrorTask(req, rule.Cluster, body):
+		default:
+			m.state.MirrorDrop.Inc(1)
+		}
+		break
+	}
+
+	return bfe_module.BFE_HANDLER_GOON, nil
+}
+
+func (m *ModuleMirror) getState(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetAll()
+	return s.Format(params)
+}
+
+func (m *ModuleMirror) getStateDiff(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetDiff()
+	return s.Format(params)
+}
+
+func (m *ModuleMirror) monitorHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name:           m.getState,
+		m.name + ".diff": m.getStateDiff,
+	}
+	return handlers
+}
+
+func (m *ModuleMirror) reloadHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name + ".product_rule_table": m.loadProductRuleConf,
+	}
+	return handlers
+}
+
+func (m *ModuleMirror) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHandlers,
+	cr string) error {
+	var conf *ConfModMirror
+	var err error
+
+	// load module config
+	confPath := bfe_module.ModConfPath(cr, m.name)
+	if conf, err = ConfLoad(confPath, cr); err != nil {
+		return fmt.Errorf("%s: conf load err %s", m.name, err.Error())
+	}
+
+	m.productRulePath = conf.Basic.ProductRulePath
+	m.maxBodySize = conf.Basic.MaxBodySize
+	m.openDebug = conf.Log.OpenDebug
+
+	// load conf data
+	if err = m.loadProductRuleConf(nil); err != nil {
+		return fmt.Errorf("%s: loadProductRuleConf() err %s", m.name, err.Error())
+	}
+
+	// start workers for mirror request
+	m.queue = make(chan *mirrorTask, conf.Basic.QueueSize)
+	for i := 0; i < conf.Basic.WorkerNum; i++ {
+		go m.mirrorWorker()
+	}
+
+	// register handler
+	err = cbs.AddFilter(bfe_module.HANDLE_AFTER_LOCATION, m.mirrorHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.mirrorHandler): %s", m.name, err.Error())
+	}
+
+	// register web handler for monitor
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_MONITOR, m.monitorHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.monitorHandlers): %s", m.name, err.Error())
+	}
+	// register web handler for reload
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_RELOAD, m.reloadHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.reloadHandlers): %s", m.name, err.Error())
+	}
+
+	return nil
+}
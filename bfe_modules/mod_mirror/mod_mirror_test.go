@@ -0,0 +1,215 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_mirror
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+// mirrorCall is a mirror request received by fakeInvoker
+type mirrorCall struct {
+	cluster string
+	req     *bfe_basic.Request
+	outreq  *bfe_http.Request
+	body    string
+}
+
+// fakeInvoker is a shadow cluster for test
+type fakeInvoker struct {
+	calls   chan mirrorCall
+	release chan bool // if not nil, invoke is blocked until released
+}
+
+func newFakeInvoker() *fakeInvoker {
+	return &fakeInvoker{calls: make(chan mirrorCall, 10)}
+}
+
+func (f *fakeInvoker) InvokeCluster(cluster string, req *bfe_basic.Request,
+	outreq *bfe_http.Request) (*bfe_http.Response, error) {
+	body, _ := ioutil.ReadAll(outreq.Body)
+	f.calls <- mirrorCall{cluster, req, outreq, string(body)}
+	if f.release != nil {
+		<-f.release
+	}
+
+	if outreq.Header.Get("X-Fail") != "" {
+		return nil, errors.New("connection refused")
+	}
+
+	res := new(bfe_http.Response)
+	res.StatusCode = bfe_http.StatusOK
+	res.Header = make(bfe_http.Header)
+	res.Body = ioutil.NopCloser(strings.NewReader("shadow response"))
+	return res, nil
+}
+
+func (f *fakeInvoker) waitCall(t *testing.T) mirrorCall {
+	select {
+	case call := <-f.calls:
+		return call
+	case <-time.After(5 * time.Second):
+		t.Fatalf("mirror request not received")
+	}
+	return mirrorCall{}
+}
+
+// peekableBody is a request body supporting peek
+type peekableBody struct {
+	data []byte
+	*bytes.Reader
+}
+
+func newPeekableBody(data string) *peekableBody {
+	return &peekableBody{[]byte(data), bytes.NewReader([]byte(data))}
+}
+
+func (b *peekableBody) Peek(n int) ([]byte, error) {
+	return b.data[:n], nil
+}
+
+func (b *peekableBody) Close() error {
+	return nil
+}
+
+func prepareModule(t *testing.T) (*ModuleMirror, *fakeInvoker) {
+	m := NewModuleMirror()
+	invoker := newFakeInvoker()
+	m.SetClusterInvoker(invoker)
+	err := m.Init(bfe_module.NewBfeCallbacks(), web_monitor.NewWebHandlers(), "./testdata")
+	if err != nil {
+		t.Fatalf("Init(): %s", err)
+	}
+	return m, invoker
+}
+
+func prepareRequest(method string, path string, body string) *bfe_basic.Request {
+	request := new(bfe_basic.Request)
+	request.HttpRequest = new(bfe_http.Request)
+	request.HttpRequest.Method = method
+	request.HttpRequest.Host = "example.org"
+	request.HttpRequest.Header = make(bfe_http.Header)
+	request.HttpRequest.URL, _ = url.Parse(path)
+	request.HttpRequest.ContentLength = int64(len(body))
+	request.HttpRequest.Body = newPeekableBody(body)
+	request.Session = new(bfe_basic.Session)
+	request.Context = make(map[interface{}]interface{})
+	request.Route = bfe_basic.RequestRoute{Product: "pn", ClusterName: "cluster_online"}
+	return request
+}
+
+func TestMirrorHandler(t *testing.T) {
+	m, invoker := prepareModule(t)
+
+	req := prepareRequest("POST", "/api/users?id=1", "name=alice")
+	req.HttpRequest.Header.Set("Cookie", "uid=1")
+	req.HttpRequest.Header.Set("Connection", "keep-alive")
+	if ret, res := m.mirrorHandler(req); ret != bfe_module.BFE_HANDLER_GOON || res != nil {
+		t.Fatalf("mirrorHandler() should return GOON")
+	}
+
+	call := invoker.waitCall(t)
+	if call.cluster != "cluster_shadow" || call.req.Route.ClusterName != "cluster_shadow" {
+		t.Errorf("mirror request should be sent to cluster_shadow")
+	}
+	if call.outreq.Method != "POST" || call.outreq.URL.RequestURI() != "/api/users?id=1" ||
+		call.outreq.Host != "example.org" {
+		t.Errorf("unexpected mirror request: %s %s %s", call.outreq.Method, call.outreq.URL, call.outreq.Host)
+	}
+	if call.outreq.Header.Get("Cookie") != "uid=1" || call.outreq.Header.Get("Connection") != "" {
+		t.Errorf("unexpected header of mirror request: %v", call.outreq.Header)
+	}
+	if call.body != "name=alice" || call.outreq.ContentLength != 10 {
+		t.Errorf("unexpected body of mirror request: %s", call.body)
+	}
+
+	// original request body is not consumed
+	body, _ := ioutil.ReadAll(req.HttpRequest.Body)
+	if string(body) != "name=alice" {
+		t.Errorf("original request body should not be consumed")
+	}
+
+	// condition not matched
+	req = prepareRequest("GET", "/index.html", "")
+	m.mirrorHandler(req)
+
+	// body too large
+	req = prepareRequest("POST", "/api/upload", strings.Repeat("x", 17))
+	m.mirrorHandler(req)
+
+	// body with unknown size
+	req = prepareRequest("POST", "/api/upload", "x")
+	req.HttpRequest.ContentLength = -1
+	m.mirrorHandler(req)
+
+	// mirror failed
+	req = prepareRequest("GET", "/api/users", "")
+	req.HttpRequest.Header.Set("X-Fail", "1")
+	m.mirrorHandler(req)
+	invoker.waitCall(t)
+
+	// wait for worker to finish
+	for i := 0; i < 100 && m.state.MirrorFail.Get() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if m.state.ReqTotal.Get() != 5 || m.state.ReqToMirror.Get() != 4 ||
+		m.state.MirrorDropBody.Get() != 2 || m.state.MirrorSuccess.Get() != 1 ||
+		m.state.MirrorFail.Get() != 1 {
+		t.Errorf("unexpected state: %+v", m.state)
+	}
+}
+
+func TestMirrorHandlerQueueFull(t *testing.T) {
+	m, invoker := prepareModule(t)
+	invoker.release = make(chan bool)
+
+	// first request is being sent by the only worker
+	m.mirrorHandler(prepareRequest("GET", "/api/1", ""))
+	invoker.waitCall(t)
+
+	// second request is queued, third request is dropped
+	start := time.Now()
+	m.mirrorHandler(prepareRequest("GET", "/api/2", ""))
+	m.mirrorHandler(prepareRequest("GET", "/api/3", ""))
+	if time.Since(start) > time.Second {
+		t.Errorf("mirrorHandler() should not wait for mirror request")
+	}
+	if m.state.MirrorDrop.Get() != 1 {
+		t.Errorf("MirrorDrop should be 1")
+	}
+
+	invoker.release <- true
+	call := invoker.waitCall(t)
+	if call.outreq.URL.Path != "/api/2" {
+		t.Errorf("queued request should be sent")
+	}
+	invoker.release <- true
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_mirror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic/condition"
+)
+
+type mirrorRuleFile struct {
+	Cond       *string  // condition for mirror
+	Cluster    *string  // shadow cluster which request is mirrored to
+	Percentage *float64 // percentage of matched request to mirror, (0, 100]
+}
+
+type mirrorRule struct {
+	Cond       condition.Condition // condition for mirror
+	Cluster    string              // shadow cluster which request is mirrored to
+	Percentage float64             // percentage of matched request to mirror
+}
+
+type mirrorRuleFileList []mirrorRuleFile
+type mirrorRuleList []mirrorRule
+
+type ProductRulesFile map[string]*mirrorRuleFileList // product => list of mirror rules
+type ProductRules map[string]*mirrorRuleList
+
+type productRuleConfFile struct {
+	Version *string // version of the config
+	Config  *ProductRulesFile
+}
+
+type productRuleConf struct {
+	Version string       // version of the config
+	Config  ProductRules // product rules for mirror
+}
+
+func mirrorRuleCheck(conf mirrorRuleFile) error {
+	// check Cond
+	if conf.Cond == nil {
+		return errors.New("no Cond")
+	}
+
+	// check Cluster
+	if conf.Cluster == nil || len(*conf.Cluster) == 0 {
+		return errors.New("no Cluster")
+	}
+
+	// check Percentage
+	if conf.Percentage == nil {
+		return errors.New("no Percentage")
+	}
+	if *conf.Percentage <= 0 || *conf.Percentage > 100 {
+		return fmt.Errorf("invalid Percentage: %v", *conf.Percentage)
+	}
+
+	return nil
+}
+
+func mirrorRuleListCheck(conf *mirrorRuleFileList) error {
+	for index, rule := range *conf {
+		err := mirrorRuleCheck(rule)
+		if err != nil {
+			return fmt.Errorf("mirrorRule:%d, %s", index, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRulesCheck(conf *ProductRulesFile) error {
+	for product, ruleList := range *conf {
+		if ruleList == nil {
+			return fmt.Errorf("no mirrorRuleList for product:%s", product)
+		}
+
+		err := mirrorRuleListCheck(ruleList)
+		if err != nil {
+			return fmt.Errorf("ProductRules:%s, %s", product, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRuleConfCheck(conf productRuleConfFile) error {
+	var err error
+
+	// check Version
+	if conf.Version == nil {
+		return errors.New("no Version")
+	}
+
+	// check Config
+	if conf.Config == nil {
+		return errors.New("no Config")
+	}
+
+	err = productRulesCheck(conf.Config)
+	if err != nil {
+		return fmt.Errorf("Config:%s", err.Error())
+	}
+
+	return nil
+}
+
+func ruleConvert(ruleFile mirrorRuleFile, product string) (mirrorRule, error) {
+	var err error
+	rule := mirrorRule{}
+
+	rule.Cond, err = condition.BuildWithProduct(*ruleFile.Cond, product)
+	if err != nil {
+		return rule, err
+	}
+
+	rule.Cluster = *ruleFile.Cluster
+	rule.Percentage = *ruleFile.Percentage
+
+	return rule, nil
+}
+
+func ruleListConvert(ruleFileList *mirrorRuleFileList, product string) (*mirrorRuleList, error) {
+	ruleList := new(mirrorRuleList)
+	*ruleList = make([]mirrorRule, 0)
+
+	for _, ruleFile := range *ruleFileList {
+		rule, err := ruleConvert(ruleFile, product)
+		if err != nil {
+			return nil, err
+		}
+		*ruleList = append(*ruleList, rule)
+	}
+
+	return ruleList, nil
+}
+
+// ProductRuleConfLoad load mirror rule config from file.
+func ProductRuleConfLoad(filename string) (productRuleConf, error) {
+	var conf productRuleConf
+	var err error
+
+	// open the file
+	file, err := os.Open(filename)
+	if err != nil {
+		return conf, err
+	}
+	defer file.Close()
+
+	// decode the file
+	decoder := json.NewDecoder(file)
+	var config productRuleConfFile
+	err = decoder.Decode(&config)
+	if err != nil {
+		return conf, err
+	}
+
+	// check config
+	err = productRuleConfCheck(config)
+	if err != nil {
+		return conf, err
+	}
+
+	// convert config
+	conf.Version = *config.Version
+	conf.Config = make(ProductRules)
+	for product, ruleFileList := range *config.Config {
+		ruleList, err := ruleListConvert(ruleFileList, product)
+		if err != nil {
+			return conf, err
+		}
+		conf.Config[product] = ruleList
+	}
+
+	return conf, nil
+}
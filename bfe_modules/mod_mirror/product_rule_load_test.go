@@ -0,0 +1,51 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_mirror
+
+import (
+	"testing"
+)
+
+func TestMirrorRuleConfLoad(t *testing.T) {
+	config, err := ProductRuleConfLoad("./testdata/mod_mirror/mirror_rules.data")
+	if err != nil {
+		t.Fatalf("get err from ProductRuleConfLoad():%s", err.Error())
+	}
+
+	rules := *config.Config["pn"]
+	if len(rules) != 2 {
+		t.Fatalf("len(config.Config['pn']) should be 2")
+	}
+	if rules[0].Cluster != "cluster_shadow" || rules[0].Percentage != 100 {
+		t.Errorf("unexpected rule 0: %+v", rules[0])
+	}
+	if rules[1].Percentage != 0.001 {
+		t.Errorf("unexpected rule 1: %+v", rules[1])
+	}
+}
+
+func TestMirrorRuleConfLoadInvalid(t *testing.T) {
+	files := []string{
+		"./testdata/mirror_rules_1.data", // no Cluster
+		"./testdata/mirror_rules_2.data", // zero Percentage
+		"./testdata/mirror_rules_3.data", // Percentage larger than 100
+	}
+
+	for _, file := range files {
+		if _, err := ProductRuleConfLoad(file); err == nil {
+			t.Errorf("err should not be nil for %s", file)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_prison
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// action for request of jailed key
+const (
+	ActionClose    = "CLOSE"    // close the connection directly
+	ActionFinish   = "FINISH"   // close the connection after reply
+	ActionResponse = "RESPONSE" // return custom response, params: status code, body
+)
+
+type ActionFile struct {
+	Cmd    *string  // command of action
+	Params []string // params of action
+}
+
+type Action struct {
+	Cmd        string // command of action
+	StatusCode int    // status code of custom response
+	Body       []byte // body of custom response
+}
+
+func ActionFileCheck(conf *ActionFile) error {
+	var paramsLenCheck int
+
+	// check command
+	if conf.Cmd == nil {
+		return errors.New("no Cmd")
+	}
+
+	// validate command, and get how many params should exist for each command
+	switch *conf.Cmd {
+	case ActionClose, ActionFinish:
+		paramsLenCheck = 0
+	case ActionResponse:
+		paramsLenCheck = 2
+	default:
+		return fmt.Errorf("invalid cmd:%s", *conf.Cmd)
+	}
+
+	// check params
+	if conf.Params == nil {
+		return errors.New("no Params")
+	}
+
+	paramsLen := len(conf.Params)
+	if paramsLenCheck != paramsLen {
+		return fmt.Errorf("num of params:[ok:%d, now:%d]", paramsLenCheck, paramsLen)
+	}
+
+	if *conf.Cmd == ActionResponse {
+		code, err := strconv.Atoi(conf.Params[0])
+		if err != nil || code < 200 || code > 599 {
+			return fmt.Errorf("invalid status code:%s", conf.Params[0])
+		}
+	}
+
+	return nil
+}
+
+func actionConvert(actionFile ActionFile) Action {
+	action := Action{}
+	action.Cmd = *actionFile.Cmd
+	if action.Cmd == ActionResponse {
+		action.StatusCode, _ = strconv.Atoi(actionFile.Params[0])
+		action.Body = []byte(actionFile.Params[1])
+	}
+	return action
+}
@@ -0,0 +1,352 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// module for jailing client with high request frequency
+
+package mod_prison
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"time"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/web-monitor/metrics"
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+const (
+	ModPrison     = "mod_prison"
+	CtxPrisonInfo = "mod_prison.prison_info"
+)
+
+var (
+	ERR_PRISON = errors.New("PRISON")
+)
+
+var (
+	openDebug = false
+)
+
+type ModulePrisonState struct {
+	ReqTotal     *metrics.Counter // all request in
+	ReqToCheck   *metrics.Counter // request to check
+	ReqAccept    *metrics.Counter // request accepted
+	ReqJailed    *metrics.Counter // request of jailed key
+	ReqClose     *metrics.Counter // request closed directly
+	ReqFinish    *metrics.Counter // request closed after reply
+	ReqResponse  *metrics.Counter // request responded with custom response
+	KeyJailed    *metrics.Counter // key jailed
+	KeyReleased  *metrics.Counter // key released manually
+	KeyNotFound  *metrics.Counter // request with condition satisfied, but key not found
+	KeyTableFull *metrics.Counter // record evicted while in effect, since prison table is full
+	WrongCommand *metrics.Counter // request of jailed key, but wrong command
+}
+
+type PrisonInfo struct {
+	PrisonRuleName string // prison rule name
+	PrisonKey      string // prison key
+}
+
+// JailedKeysStatus is jailed keys of each rule for each product.
+type JailedKeysStatus map[string]map[string][]JailedKey // product => rule name => jailed keys
+
+type ModulePrison struct {
+	name    string            // name of module
+	state   ModulePrisonState // module state
+	metrics metrics.Metrics
+
+	productRulePath string            // path of prison rule data file
+	ruleTable       *ProductRuleTable // table for product prison rules
+}
+
+func NewModulePrison() *ModulePrison {
+	m := new(ModulePrison)
+	m.name = ModPrison
+	m.metrics.Init(&m.state, ModPrison, 0)
+
+	return m
+}
+
+func (m *ModulePrison) Name() string {
+	return m.name
+}
+
+func (m *ModulePrison) State() interface{} {
+	return &m.state
+}
+
+// loadProductRuleConf load from config file.
+func (m *ModulePrison) loadProductRuleConf(query url.Values) error {
+	// get path
+	path := query.Get("path")
+	if path == "" {
+		// use default
+		path = m.productRulePath
+	}
+
+	// load file
+	conf, err := ProductRuleConfLoad(path)
+	if err != nil {
+		return fmt.Errorf("err in ProductRuleConfLoad(%s):%s", path, err)
+	}
+
+	m.ruleTable.Update(conf)
+	return nil
+}
+
+// releaseKey releases key from prison. Key is released for all rules of
+// the product if rule is not specified.
+func (m *ModulePrison) releaseKey(query url.Values) error {
+	product := query.Get("product")
+	if product == "" {
+		return fmt.Errorf("no product")
+	}
+	key := query.Get("key")
+	if key == "" {
+		return fmt.Errorf("no key")
+	}
+	ruleName := query.Get("rule")
+
+	rules, ok := m.ruleTable.Search(product)
+	if !ok {
+		return fmt.Errorf("no rules for product %s", product)
+	}
+
+	released := false
+	now := time.Now()
+	for _, rule := range *rules {
+		if ruleName != "" && rule.Name != ruleName {
+			continue
+		}
+		if rule.prison.Release(key, now) {
+			released = true
+		}
+	}
+	if !released {
+		return fmt.Errorf("key %s not in prison", key)
+	}
+
+	m.state.KeyReleased.Inc(1)
+	log.Logger.Info("%s release key (product:%s, rule:%s, key:%s)", m.name, product, ruleName, key)
+	return nil
+}
+
+// createCustomResp creates custom response for request of jailed key.
+func createCustomResp(req *bfe_basic.Request, action Action) *bfe_http.Response {
+	res := bfe_basic.CreateInternalResp(req, action.StatusCode)
+	res.ContentLength = int64(len(action.Body))
+	res.Body = ioutil.NopCloser(bytes.NewReader(action.Body))
+	return res
+}
+
+// productPrisonHandler is a handler for doing product prison.
+func (m *ModulePrison) productPrisonHandler(request *bfe_basic.Request) (
+	int, *bfe_http.Response) {
+	if openDebug {
+		log.Logger.Debug("%s check request", m.name)
+	}
+	m.state.ReqTotal.Inc(1)
+
+	// find prison rules for given request
+	rules, ok := m.ruleTable.Search(request.Route.Product)
+	if !ok { // no rules found
+		if openDebug {
+			log.Logger.Debug("%s product %s not found, just pass",
+				m.name, request.Route.Product)
+		}
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	m.state.ReqToCheck.Inc(1)
+	return m.productRulesProcess(request, rules)
+}
+
+func (m *ModulePrison) productRulesProcess(req *bfe_basic.Request, rules *prisonRuleList) (
+	int, *bfe_http.Response) {
+	now := time.Now()
+
+	for _, rule := range *rules {
+		if openDebug {
+			log.Logger.Debug("%s process rule: %v", m.name, rule.Name)
+		}
+
+		// rule condition is satisfied ?
+		if !rule.Cond.Match(req) {
+			continue
+		}
+
+		key := rule.Key.Get(req)
+		if len(key) == 0 {
+			m.state.KeyNotFound.Inc(1)
+			continue
+		}
+
+		jailed, newJailed, evicted := rule.prison.Visit(key, now)
+		if evicted {
+			m.state.KeyTableFull.Inc(1)
+		}
+		if newJailed {
+			m.state.KeyJailed.Inc(1)
+			log.Logger.Info("%s jail key (rule:%s, key:%s)", m.name, rule.Name, key)
+		}
+		if !jailed {
+			continue
+		}
+
+		// key is in prison
+		m.state.ReqJailed.Inc(1)
+		prisonInfo := &PrisonInfo{PrisonRuleName: rule.Name, PrisonKey: key}
+		req.SetContext(CtxPrisonInfo, prisonInfo)
+
+		switch rule.Action.Cmd {
+		case ActionClose:
+			req.ErrCode = ERR_PRISON
+			log.Logger.Debug("%s close connection (rule:%s, key:%s, remote:%s)",
+				m.name, rule.Name, key, req.RemoteAddr)
+			m.state.ReqClose.Inc(1)
+			return bfe_module.BFE_HANDLER_CLOSE, nil
+
+		case ActionFinish:
+			req.ErrCode = ERR_PRISON
+			log.Logger.Debug("%s finish connection (rule:%s, key:%s, remote:%s)",
+				m.name, rule.Name, key, req.RemoteAddr)
+			m.state.ReqFinish.Inc(1)
+			return bfe_module.BFE_HANDLER_FINISH, nil
+
+		case ActionResponse:
+			req.ErrCode = ERR_PRISON
+			log.Logger.Debug("%s custom response (rule:%s, key:%s, remote:%s)",
+				m.name, rule.Name, key, req.RemoteAddr)
+			m.state.ReqResponse.Inc(1)
+			return bfe_module.BFE_HANDLER_RESPONSE, createCustomResp(req, rule.Action)
+
+		default:
+			if openDebug {
+				log.Logger.Debug("%s unknown prison command (%s), just pass",
+					m.name, rule.Action.Cmd)
+			}
+			m.state.WrongCommand.Inc(1)
+		}
+	}
+
+	if openDebug {
+		log.Logger.Debug("%s accept request", m.name)
+	}
+	m.state.ReqAccept.Inc(1)
+	return bfe_module.BFE_HANDLER_GOON, nil
+}
+
+func (m *ModulePrison) getState(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetAll()
+	return s.Format(params)
+}
+
+func (m *ModulePrison) getStateDiff(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetDiff()
+	return s.Format(params)
+}
+
+// getJailedKeys returns jailed keys, which are filtered by product if
+// param product is specified.
+func (m *ModulePrison) getJailedKeys(params map[string][]string) ([]byte, error) {
+	var product string
+	if values, ok := params["product"]; ok && len(values) != 0 {
+		product = values[0]
+	}
+
+	status := make(JailedKeysStatus)
+	now := time.Now()
+	for name, rules := range m.ruleTable.GetRules() {
+		if product != "" && name != product {
+			continue
+		}
+
+		status[name] = make(map[string][]JailedKey)
+		for _, rule := range *rules {
+			status[name][rule.Name] = rule.prison.JailedKeys(now)
+		}
+	}
+
+	return json.Marshal(status)
+}
+
+func (m *ModulePrison) monitorHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name:                  m.getState,
+		m.name + ".diff":        m.getStateDiff,
+		m.name + ".jailed_keys": m.getJailedKeys,
+	}
+	return handlers
+}
+
+func (m *ModulePrison) reloadHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name + ".product_rule_table": m.loadProductRuleConf,
+		m.name + ".release":            m.releaseKey,
+	}
+	return handlers
+}
+
+func (m *ModulePrison) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHandlers,
+	cr string) error {
+	var conf *ConfModPrison
+	var err error
+
+	// load module config
+	confPath := bfe_module.ModConfPath(cr, m.name)
+	if conf, err = ConfLoad(confPath, cr); err != nil {
+		return fmt.Errorf("%s: conf load err %s", m.name, err.Error())
+	}
+
+	m.productRulePath = conf.Basic.ProductRulePath
+	m.ruleTable = NewProductRuleTable(conf.Basic.MaxKeysPerRule)
+	openDebug = conf.Log.OpenDebug
+
+	// load conf data
+	if err = m.loadProductRuleConf(nil); err != nil {
+		return fmt.Errorf("%s: loadProductRuleConf() err %s", m.name, err.Error())
+	}
+
+	// register handler
+	err = cbs.AddFilter(bfe_module.HANDLE_FOUND_PRODUCT, m.productPrisonHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.productPrisonHandler): %s", m.name, err.Error())
+	}
+
+	// register web handler for monitor
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_MONITOR, m.monitorHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.monitorHandlers): %s", m.name, err.Error())
+	}
+	// register web handler for reload
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_RELOAD, m.reloadHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.reloadHandlers): %s", m.name, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_prison
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"testing"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+func prepareModule(t *testing.T) *ModulePrison {
+	m := NewModulePrison()
+	err := m.Init(bfe_module.NewBfeCallbacks(), web_monitor.NewWebHandlers(), "./testdata")
+	if err != nil {
+		t.Fatalf("Init(): %s", err)
+	}
+	return m
+}
+
+func prepareRequest(path string) *bfe_basic.Request {
+	request := new(bfe_basic.Request)
+	request.HttpRequest = new(bfe_http.Request)
+	request.HttpRequest.Header = make(bfe_http.Header)
+	request.HttpRequest.URL, _ = url.Parse(path)
+	request.Session = new(bfe_basic.Session)
+	request.Context = make(map[interface{}]interface{})
+	request.RemoteAddr, _ = net.ResolveTCPAddr("tcp", "10.1.1.1:8098")
+	request.Route = bfe_basic.RequestRoute{Product: "pn"}
+	return request
+}
+
+func TestProductPrisonClose(t *testing.T) {
+	m := prepareModule(t)
+
+	// threshold is 2
+	for i := 0; i < 2; i++ {
+		status, _ := m.productPrisonHandler(prepareRequest("/close"))
+		if status != bfe_module.BFE_HANDLER_GOON {
+			t.Errorf("Should not jail request %d", i)
+		}
+	}
+
+	req := prepareRequest("/close")
+	status, _ := m.productPrisonHandler(req)
+	if status != bfe_module.BFE_HANDLER_CLOSE {
+		t.Errorf("Should close request")
+	}
+	if req.ErrCode != ERR_PRISON {
+		t.Errorf("ErrCode should be ERR_PRISON")
+	}
+	info, ok := req.GetContext(CtxPrisonInfo).(*PrisonInfo)
+	if !ok || info.PrisonRuleName != "prison_by_ip" || info.PrisonKey != "10.1.1.1" {
+		t.Errorf("unexpected prison info: %v", info)
+	}
+
+	// other client
+	req = prepareRequest("/close")
+	req.RemoteAddr, _ = net.ResolveTCPAddr("tcp", "10.1.1.2:8098")
+	if status, _ := m.productPrisonHandler(req); status != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("Should not jail other client")
+	}
+
+	// other product
+	req = prepareRequest("/close")
+	req.Route.Product = "unknown"
+	if status, _ := m.productPrisonHandler(req); status != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("Should not jail request of other product")
+	}
+
+	if m.state.KeyJailed.Get() != 1 || m.state.ReqJailed.Get() != 1 || m.state.ReqClose.Get() != 1 {
+		t.Errorf("unexpected state: %+v", m.state)
+	}
+}
+
+func TestProductPrisonFinishAndResponse(t *testing.T) {
+	m := prepareModule(t)
+
+	// cookie key
+	req := prepareRequest("/finish")
+	req.HttpRequest.Header.Set("Cookie", "uid=u1")
+	m.productPrisonHandler(req)
+	req = prepareRequest("/finish")
+	req.HttpRequest.Header.Set("Cookie", "uid=u1")
+	if status, _ := m.productPrisonHandler(req); status != bfe_module.BFE_HANDLER_FINISH {
+		t.Errorf("Should finish request")
+	}
+
+	// key not found
+	m.productPrisonHandler(prepareRequest("/finish"))
+	if m.state.KeyNotFound.Get() != 1 {
+		t.Errorf("KeyNotFound should be 1")
+	}
+
+	// custom response
+	req = prepareRequest("/response")
+	req.HttpRequest.Header.Set("X-User", "u1")
+	m.productPrisonHandler(req)
+	status, res := m.productPrisonHandler(req)
+	if status != bfe_module.BFE_HANDLER_RESPONSE || res == nil || res.StatusCode != 403 {
+		t.Fatalf("Should return custom response")
+	}
+	if body, _ := ioutil.ReadAll(res.Body); string(body) != "access denied" {
+		t.Errorf("unexpected body: %s", body)
+	}
+}
+
+func TestJailedKeysAndRelease(t *testing.T) {
+	m := prepareModule(t)
+
+	for i := 0; i < 3; i++ {
+		m.productPrisonHandler(prepareRequest("/close"))
+	}
+
+	data, err := m.getJailedKeys(map[string][]string{"product": {"pn"}})
+	if err != nil {
+		t.Fatalf("getJailedKeys(): %s", err)
+	}
+	var status JailedKeysStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		t.Fatalf("json.Unmarshal(): %s", err)
+	}
+	keys := status["pn"]["prison_by_ip"]
+	if len(keys) != 1 || keys[0].Key != "10.1.1.1" || len(status["pn"]["prison_by_cookie"]) != 0 {
+		t.Errorf("unexpected jailed keys: %s", data)
+	}
+
+	// release
+	query := url.Values{"product": {"pn"}, "key": {"10.1.1.1"}}
+	if err := m.releaseKey(query); err != nil {
+		t.Errorf("releaseKey(): %s", err)
+	}
+	if status, _ := m.productPrisonHandler(prepareRequest("/close")); status != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("Should not jail request after released")
+	}
+	if err := m.releaseKey(query); err == nil {
+		t.Errorf("releaseKey() should fail for key not in prison")
+	}
+	if err := m.releaseKey(url.Values{"product": {"pn"}}); err == nil {
+		t.Errorf("releaseKey() should fail without key")
+	}
+
+	// jailed key is kept after reload
+	for i := 0; i < 3; i++ {
+		m.productPrisonHandler(prepareRequest("/close"))
+	}
+	if err := m.loadProductRuleConf(nil); err != nil {
+		t.Fatalf("loadProductRuleConf(): %s", err)
+	}
+	if status, _ := m.productPrisonHandler(prepareRequest("/close")); status != bfe_module.BFE_HANDLER_CLOSE {
+		t.Errorf("Should keep jailed key after reload")
+	}
+}
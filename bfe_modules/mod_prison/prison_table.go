@@ -0,0 +1,219 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// sliding window counters and jail state for each key
+
+package mod_prison
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	prisonShardNum = 64 // number of shards in prison table
+)
+
+// prisonRecord is the state of a key. Requests in sliding window are
+// estimated by counters of current and previous fixed windows.
+type prisonRecord struct {
+	key         string    // key of record
+	windowStart time.Time // start time of current window
+	curCount    int       // requests in current window
+	prevCount   int       // requests in previous window
+	freeTime    time.Time // time when key is released from prison
+}
+
+// jailed returns whether key is in prison.
+func (r *prisonRecord) jailed(now time.Time) bool {
+	return now.Before(r.freeTime)
+}
+
+// idle returns whether record has no effect and can be evicted silently.
+func (r *prisonRecord) idle(now time.Time, window time.Duration) bool {
+	return !r.jailed(now) && now.Sub(r.windowStart) >= 2*window
+}
+
+type prisonShard struct {
+	lock    sync.Mutex
+	records map[string]*list.Element
+	lru     *list.List // front is most recently used
+}
+
+// remove removes record in shard.
+func (s *prisonShard) remove(elem *list.Element) *prisonRecord {
+	record := elem.Value.(*prisonRecord)
+	s.lru.Remove(elem)
+	delete(s.records, record.key)
+	return record
+}
+
+// JailedKey is a key in prison.
+type JailedKey struct {
+	Key      string    // prison key
+	FreeTime time.Time // time when key is released from prison
+}
+
+// PrisonTable holds state of keys for one rule.
+type PrisonTable struct {
+	window     time.Duration // length of sliding window
+	threshold  int           // max requests allowed in window
+	prisonTime time.Duration // time for key to stay in prison
+	maxKeys    int           // max number of keys in each shard
+
+	shards [prisonShardNum]prisonShard
+}
+
+// NewPrisonTable creates a PrisonTable.
+//
+// Params:
+//     - window: length of sliding window
+//     - threshold: max requests allowed in window
+//     - prisonTime: time for key to stay in prison
+//     - maxKeys: max number of keys in table
+func NewPrisonTable(window time.Duration, threshold int, prisonTime time.Duration,
+	maxKeys int) *PrisonTable {
+	t := new(PrisonTable)
+	t.window = window
+	t.threshold = threshold
+	t.prisonTime = prisonTime
+	t.maxKeys = (maxKeys + prisonShardNum - 1) / prisonShardNum
+
+	for i := range t.shards {
+		t.shards[i].records = make(map[string]*list.Element)
+		t.shards[i].lru = list.New()
+	}
+
+	return t
+}
+
+// Visit counts a request for key, and checks whether key is in prison.
+// If table is full, least recently used record is evicted for new key.
+//
+// Returns:
+//     - jailed: whether key is in prison
+//     - newJailed: whether key is jailed by this request
+//     - evicted: true if a record still in effect is evicted
+func (t *PrisonTable) Visit(key string, now time.Time) (jailed bool, newJailed bool, evicted bool) {
+	shard := &t.shards[shardIndex(key)]
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	var record *prisonRecord
+	if elem, ok := shard.records[key]; ok {
+		shard.lru.MoveToFront(elem)
+		record = elem.Value.(*prisonRecord)
+	} else {
+		if shard.lru.Len() >= t.maxKeys {
+			oldest := shard.remove(shard.lru.Back())
+			evicted = !oldest.idle(now, t.window)
+		}
+
+		record = &prisonRecord{key: key, windowStart: now}
+		shard.records[key] = shard.lru.PushFront(record)
+	}
+
+	// requests of jailed key are not counted
+	if record.jailed(now) {
+		return true, false, evicted
+	}
+
+	// slide window
+	if elapsed := now.Sub(record.windowStart); elapsed >= t.window {
+		n := elapsed / t.window
+		if n == 1 {
+			record.prevCount = record.curCount
+		} else {
+			record.prevCount = 0
+		}
+		record.curCount = 0
+		record.windowStart = record.windowStart.Add(n * t.window)
+	}
+	record.curCount++
+
+	// estimate requests in sliding window
+	weight := 1 - float64(now.Sub(record.windowStart))/float64(t.window)
+	count := float64(record.prevCount)*weight + float64(record.curCount)
+	if count <= float64(t.threshold) {
+		return false, false, evicted
+	}
+
+	// jail the key, and count from zero after released
+	record.freeTime = now.Add(t.prisonTime)
+	record.windowStart = record.freeTime
+	record.curCount = 0
+	record.prevCount = 0
+	return true, true, evicted
+}
+
+// Release releases key from prison.
+//
+// Returns:
+//     whether key is in prison before released
+func (t *PrisonTable) Release(key string, now time.Time) bool {
+	shard := &t.shards[shardIndex(key)]
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	elem, ok := shard.records[key]
+	if !ok || !elem.Value.(*prisonRecord).jailed(now) {
+		return false
+	}
+
+	shard.remove(elem)
+	return true
+}
+
+// JailedKeys returns keys in prison, sorted by key.
+func (t *PrisonTable) JailedKeys(now time.Time) []JailedKey {
+	keys := make([]JailedKey, 0)
+	for i := range t.shards {
+		shard := &t.shards[i]
+		shard.lock.Lock()
+		for key, elem := range shard.records {
+			if record := elem.Value.(*prisonRecord); record.jailed(now) {
+				keys = append(keys, JailedKey{Key: key, FreeTime: record.freeTime})
+			}
+		}
+		shard.lock.Unlock()
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Key < keys[j].Key
+	})
+	return keys
+}
+
+// Len returns number of keys in table.
+func (t *PrisonTable) Len() int {
+	n := 0
+	for i := range t.shards {
+		shard := &t.shards[i]
+		shard.lock.Lock()
+		n += shard.lru.Len()
+		shard.lock.Unlock()
+	}
+	return n
+}
+
+func shardIndex(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32() % prisonShardNum
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_prison
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPrisonTableVisit(t *testing.T) {
+	table := NewPrisonTable(10*time.Second, 3, time.Minute, 1000)
+	now := time.Unix(1500000000, 0)
+
+	// within threshold
+	for i := 0; i < 3; i++ {
+		if jailed, _, _ := table.Visit("k1", now); jailed {
+			t.Errorf("request %d should not be jailed", i)
+		}
+	}
+
+	// exceed threshold
+	if jailed, newJailed, _ := table.Visit("k1", now); !jailed || !newJailed {
+		t.Errorf("key should be jailed")
+	}
+	if jailed, newJailed, _ := table.Visit("k1", now.Add(59*time.Second)); !jailed || newJailed {
+		t.Errorf("key should stay in prison")
+	}
+
+	// other key
+	if jailed, _, _ := table.Visit("k2", now); jailed {
+		t.Errorf("other key should not be jailed")
+	}
+
+	// released after prison time
+	now = now.Add(time.Minute)
+	if jailed, _, _ := table.Visit("k1", now); jailed {
+		t.Errorf("key should be released")
+	}
+}
+
+func TestPrisonTableSlidingWindow(t *testing.T) {
+	table := NewPrisonTable(10*time.Second, 3, time.Minute, 1000)
+	now := time.Unix(1500000000, 0)
+
+	for i := 0; i < 3; i++ {
+		table.Visit("k1", now)
+	}
+
+	// half of previous window is counted: 3 * 0.5 + 1
+	if jailed, _, _ := table.Visit("k1", now.Add(15*time.Second)); jailed {
+		t.Errorf("key should not be jailed")
+	}
+	// 3 * 0.5 + 2
+	if jailed, _, _ := table.Visit("k1", now.Add(15*time.Second)); !jailed {
+		t.Errorf("key should be jailed")
+	}
+
+	// counters are reset after two windows
+	for i := 0; i < 3; i++ {
+		table.Visit("k2", now)
+	}
+	if jailed, _, _ := table.Visit("k2", now.Add(20*time.Second)); jailed {
+		t.Errorf("key should not be jailed")
+	}
+}
+
+func TestPrisonTableRelease(t *testing.T) {
+	table := NewPrisonTable(10*time.Second, 1, time.Minute, 1000)
+	now := time.Unix(1500000000, 0)
+
+	table.Visit("k2", now)
+	table.Visit("k2", now)
+	table.Visit("k1", now)
+	table.Visit("k1", now)
+	table.Visit("k3", now)
+
+	keys := table.JailedKeys(now)
+	if len(keys) != 2 || keys[0].Key != "k1" || keys[1].Key != "k2" ||
+		!keys[0].FreeTime.Equal(now.Add(time.Minute)) {
+		t.Errorf("unexpected jailed keys: %v", keys)
+	}
+
+	if !table.Release("k1", now) {
+		t.Errorf("k1 should be released")
+	}
+	if table.Release("k3", now) {
+		t.Errorf("k3 is not jailed")
+	}
+	if jailed, _, _ := table.Visit("k1", now); jailed {
+		t.Errorf("k1 should not be jailed after released")
+	}
+}
+
+// keysInShard returns n keys in the same shard.
+func keysInShard(n int) []string {
+	keys := make([]string, 0, n)
+	for i := 0; len(keys) < n; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if shardIndex(key) == shardIndex("k0") {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestPrisonTableFull(t *testing.T) {
+	// 100 keys for each shard
+	maxKeys := 100
+	table := NewPrisonTable(time.Second, 1, time.Minute, maxKeys*prisonShardNum)
+	now := time.Unix(1500000000, 0)
+	keys := keysInShard(maxKeys + 1)
+
+	for _, key := range keys[:maxKeys] {
+		table.Visit(key, now)
+	}
+	table.Visit(keys[1], now) // keys[1] is jailed
+
+	// least recently used key is evicted for new key, and new key is jailed
+	if _, _, evicted := table.Visit(keys[maxKeys], now); !evicted {
+		t.Errorf("record should be evicted when table is full")
+	}
+	if jailed, newJailed, _ := table.Visit(keys[maxKeys], now); !jailed || !newJailed {
+		t.Errorf("new key should be jailed")
+	}
+	if table.Len() != maxKeys {
+		t.Errorf("table size should be %d, got %d", maxKeys, table.Len())
+	}
+
+	// only one record is evicted for each new key
+	if jailed, _, _ := table.Visit(keys[1], now); !jailed {
+		t.Errorf("recently used key should not be evicted")
+	}
+	if _, _, evicted := table.Visit(keys[0], now); !evicted {
+		t.Errorf("least recently used key should be evicted")
+	}
+
+	// idle record is evicted silently
+	later := now.Add(2 * time.Second)
+	if _, _, evicted := table.Visit("new", later); evicted {
+		t.Errorf("evicted record should be idle")
+	}
+}
+
+func BenchmarkPrisonTableFull(b *testing.B) {
+	table := NewPrisonTable(time.Second, 1, time.Minute, 100000)
+	now := time.Now()
+	for i := 0; i < 100000; i++ {
+		table.Visit(fmt.Sprintf("k%d", i), now)
+	}
+	keys := make([]string, b.N)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("n%d", i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		table.Visit(keys[i], now)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_prison
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic/condition"
+)
+
+type prisonRuleFile struct {
+	Cond        *string        // condition for prison
+	Name        *string        // prison rule name
+	Key         *PrisonKeyFile // source of prison key
+	CheckPeriod *int           // length (in seconds) of sliding window
+	Threshold   *int           // max requests allowed in window
+	PrisonTime  *int           // time (in seconds) for key to stay in prison
+	Action      *ActionFile    // action for request of jailed key
+}
+
+type prisonRule struct {
+	Cond        condition.Condition // condition for prison
+	Name        string              // prison rule name
+	Key         PrisonKey           // source of prison key
+	CheckPeriod time.Duration       // length of sliding window
+	Threshold   int                 // max requests allowed in window
+	PrisonTime  time.Duration       // time for key to stay in prison
+	Action      Action              // action for request of jailed key
+
+	prison *PrisonTable // state of keys
+}
+
+type prisonRuleFileList []prisonRuleFile
+type prisonRuleList []*prisonRule
+
+type ProductRulesFile map[string]*prisonRuleFileList // product => list of prison rules
+type ProductRules map[string]*prisonRuleList
+
+type productRuleConfFile struct {
+	Version *string // version of the config
+	Config  *ProductRulesFile
+}
+
+type productRuleConf struct {
+	Version string       // version of the config
+	Config  ProductRules // product rules for prison
+}
+
+func prisonRuleCheck(conf prisonRuleFile) error {
+	// check Cond
+	if conf.Cond == nil {
+		return errors.New("no Cond")
+	}
+
+	// check Name
+	if conf.Name == nil {
+		return errors.New("no Name")
+	}
+
+	// check Key
+	if conf.Key == nil {
+		return errors.New("no Key")
+	}
+	if err := PrisonKeyFileCheck(conf.Key); err != nil {
+		return fmt.Errorf("Key:%s", err.Error())
+	}
+
+	// check CheckPeriod, Threshold and PrisonTime
+	if conf.CheckPeriod == nil {
+		return errors.New("no CheckPeriod")
+	}
+	if *conf.CheckPeriod <= 0 {
+		return fmt.Errorf("CheckPeriod should be > 0")
+	}
+	if conf.Threshold == nil {
+		return errors.New("no Threshold")
+	}
+	if *conf.Threshold < 0 {
+		return fmt.Errorf("Threshold should be >= 0")
+	}
+	if conf.PrisonTime == nil {
+		return errors.New("no PrisonTime")
+	}
+	if *conf.PrisonTime <= 0 {
+		return fmt.Errorf("PrisonTime should be > 0")
+	}
+
+	// check Actions
+	if conf.Action == nil {
+		return errors.New("no Action")
+	}
+	if err := ActionFileCheck(conf.Action); err != nil {
+		return fmt.Errorf("Action:%s", err.Error())
+	}
+
+	return nil
+}
+
+func prisonRuleListCheck(conf *prisonRuleFileList) error {
+	ruleNameMap := make(map[string]bool)
+	for index, rule := range *conf {
+		err := prisonRuleCheck(rule)
+		if err != nil {
+			return fmt.Errorf("prisonRule:%d, %s", index, err.Error())
+		}
+
+		// check rule name for one product
+		if _, ok := ruleNameMap[*rule.Name]; ok {
+			return fmt.Errorf("prisonRule:%d, two rules have same name[%s]!", index, *rule.Name)
+		}
+		ruleNameMap[*rule.Name] = true
+	}
+
+	return nil
+}
+
+func productRulesCheck(conf *ProductRulesFile) error {
+	for product, ruleList := range *conf {
+		if ruleList == nil {
+			return fmt.Errorf("no prisonRuleList for product:%s", product)
+		}
+
+		err := prisonRuleListCheck(ruleList)
+		if err != nil {
+			return fmt.Errorf("ProductRules:%s, %s", product, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRuleConfCheck(conf productRuleConfFile) error {
+	var err error
+
+	// check Version
+	if conf.Version == nil {
+		return errors.New("no Version")
+	}
+
+	// check Config
+	if conf.Config == nil {
+		return errors.New("no Config")
+	}
+
+	err = productRulesCheck(conf.Config)
+	if err != nil {
+		return fmt.Errorf("Config:%s", err.Error())
+	}
+
+	return nil
+}
+
+func ruleConvert(ruleFile prisonRuleFile, product string) (*prisonRule, error) {
+	rule := new(prisonRule)
+
+	cond, err := condition.BuildWithProduct(*ruleFile.Cond, product)
+	if err != nil {
+		return nil, err
+	}
+	rule.Cond = cond
+	rule.Name = *ruleFile.Name
+	rule.Key = prisonKeyConvert(*ruleFile.Key)
+	rule.CheckPeriod = time.Duration(*ruleFile.CheckPeriod) * time.Second
+	rule.Threshold = *ruleFile.Threshold
+	rule.PrisonTime = time.Duration(*ruleFile.PrisonTime) * time.Second
+	rule.Action = actionConvert(*ruleFile.Action)
+	return rule, nil
+}
+
+func ruleListConvert(ruleFileList *prisonRuleFileList, product string) (*prisonRuleList, error) {
+	ruleList := new(prisonRuleList)
+	*ruleList = make([]*prisonRule, 0)
+
+	for _, ruleFile := range *ruleFileList {
+		rule, err := ruleConvert(ruleFile, product)
+		if err != nil {
+			return nil, err
+		}
+		*ruleList = append(*ruleList, rule)
+	}
+
+	return ruleList, nil
+}
+
+// ProductRuleConfLoad load prison rule config from file.
+func ProductRuleConfLoad(filename string) (productRuleConf, error) {
+	var conf productRuleConf
+	var err error
+
+	// open the file
+	file, err := os.Open(filename)
+	if err != nil {
+		return conf, err
+	}
+	defer file.Close()
+
+	// decode the file
+	decoder := json.NewDecoder(file)
+	var config productRuleConfFile
+	err = decoder.Decode(&config)
+	if err != nil {
+		return conf, err
+	}
+
+	// check config
+	err = productRuleConfCheck(config)
+	if err != nil {
+		return conf, err
+	}
+
+	// convert config
+	conf.Version = *config.Version
+	conf.Config = make(ProductRules)
+	for product, ruleFileList := range *config.Config {
+		ruleList, err := ruleListConvert(ruleFileList, product)
+		if err != nil {
+			return conf, err
+		}
+		conf.Config[product] = ruleList
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_prison
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPrisonRuleConfLoad(t *testing.T) {
+	config, err := ProductRuleConfLoad("./testdata/mod_prison/prison_rules.data")
+	if err != nil {
+		t.Fatalf("get err from ProductRuleConfLoad():%s", err.Error())
+	}
+
+	rules := *config.Config["pn"]
+	if len(rules) != 3 {
+		t.Fatalf("len(config.Config['pn']) should be 3")
+	}
+
+	rule := rules[0]
+	if rule.Name != "prison_by_ip" || rule.Key.Type != KeyClientIP || rule.CheckPeriod != 10*time.Second ||
+		rule.Threshold != 2 || rule.PrisonTime != time.Minute || rule.Action.Cmd != ActionClose {
+		t.Errorf("unexpected rule 0: %+v", rule)
+	}
+
+	rule = rules[2]
+	if rule.Action.Cmd != ActionResponse || rule.Action.StatusCode != 403 ||
+		string(rule.Action.Body) != "access denied" {
+		t.Errorf("unexpected rule 2: %+v", rule)
+	}
+}
+
+func TestPrisonRuleConfLoadInvalid(t *testing.T) {
+	files := []string{
+		"./testdata/prison_rules_1.data", // no CheckPeriod
+		"./testdata/prison_rules_2.data", // zero PrisonTime
+		"./testdata/prison_rules_3.data", // invalid status code
+	}
+
+	for _, file := range files {
+		if _, err := ProductRuleConfLoad(file); err == nil {
+			t.Errorf("err should not be nil for %s", file)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_prison
+
+import (
+	"sync"
+)
+
+type ProductRuleTable struct {
+	lock         sync.RWMutex
+	version      string
+	productRules ProductRules
+	maxKeys      int // max number of keys for each rule
+}
+
+func NewProductRuleTable(maxKeys int) *ProductRuleTable {
+	t := new(ProductRuleTable)
+	t.productRules = make(ProductRules)
+	t.maxKeys = maxKeys
+	return t
+}
+
+// Update updates rules. State of keys for unchanged rules are kept.
+func (t *ProductRuleTable) Update(conf productRuleConf) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for product, rules := range conf.Config {
+		oldRules := t.productRules[product]
+		for _, rule := range *rules {
+			if oldRule := findRule(oldRules, rule.Name); oldRule != nil &&
+				oldRule.Key == rule.Key && oldRule.CheckPeriod == rule.CheckPeriod &&
+				oldRule.Threshold == rule.Threshold && oldRule.PrisonTime == rule.PrisonTime {
+				rule.prison = oldRule.prison
+				continue
+			}
+			rule.prison = NewPrisonTable(rule.CheckPeriod, rule.Threshold, rule.PrisonTime, t.maxKeys)
+		}
+	}
+
+	t.version = conf.Version
+	t.productRules = conf.Config
+}
+
+func (t *ProductRuleTable) Search(product string) (*prisonRuleList, bool) {
+	t.lock.RLock()
+	productRules := t.productRules
+	t.lock.RUnlock()
+
+	rules, ok := productRules[product]
+	return rules, ok
+}
+
+// GetVersion returns version of rules.
+func (t *ProductRuleTable) GetVersion() string {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.version
+}
+
+func findRule(rules *prisonRuleList, name string) *prisonRule {
+	if rules == nil {
+		return nil
+	}
+
+	for _, rule := range *rules {
+		if rule.Name == name {
+			return rule
+		}
+	}
+	return nil
+}
+
+// GetRules returns rules of all products.
+func (t *ProductRuleTable) GetRules() ProductRules {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.productRules
+}
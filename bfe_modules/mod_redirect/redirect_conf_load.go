@@ -126,10 +126,10 @@ func RedirectConfCheck(conf RedirectConfFile) error {
 	return nil
 }
 
-func ruleConvert(ruleFile RedirectRuleFile) (RedirectRule, error) {
+func ruleConvert(ruleFile RedirectRuleFile, product string) (RedirectRule, error) {
 	rule := RedirectRule{}
 
-	cond, err := condition.Build(*ruleFile.Cond)
+	cond, err := condition.BuildWithProduct(*ruleFile.Cond, product)
 	if err != nil {
 		return rule, err
 	}
@@ -140,12 +140,12 @@ func ruleConvert(ruleFile RedirectRuleFile) (RedirectRule, error) {
 	return rule, nil
 }
 
-func ruleListConvert(ruleFileList *RuleFileList) (*RuleList, error) {
+func ruleListConvert(ruleFileList *RuleFileList, product string) (*RuleList, error) {
 	ruleList := new(RuleList)
 	*ruleList = make([]RedirectRule, 0)
 
 	for _, ruleFile := range *ruleFileList {
-		rule, err := ruleConvert(ruleFile)
+		rule, err := ruleConvert(ruleFile, product)
 		if err != nil {
 			return ruleList, err
 		}
@@ -189,7 +189,7 @@ func redirectConfLoad(filename string) (redirectConf, error) {
 	conf.Config = make(ProductRules)
 
 	for product, ruleFileList := range *config.Config {
-		ruleList, err := ruleListConvert(ruleFileList)
+		ruleList, err := ruleListConvert(ruleFileList, product)
 		if err != nil {
 			return conf, err
 		}
@@ -122,13 +122,13 @@ func ReWriteConfCheck(conf ReWriteConfFile) error {
 	return nil
 }
 
-func ruleConvert(ruleFile ReWriteRuleFile) (ReWriteRule, error) {
+func ruleConvert(ruleFile ReWriteRuleFile, product string) (ReWriteRule, error) {
 	rule := ReWriteRule{}
 
 	if ruleFile.Cond == nil {
 		return rule, fmt.Errorf("cond not set")
 	}
-	cond, err := condition.Build(*ruleFile.Cond)
+	cond, err := condition.BuildWithProduct(*ruleFile.Cond, product)
 	if err != nil {
 		return rule, err
 	}
@@ -139,12 +139,12 @@ func ruleConvert(ruleFile ReWriteRuleFile) (ReWriteRule, error) {
 	return rule, nil
 }
 
-func ruleListConvert(ruleFileList *RuleFileList) (*RuleList, error) {
+func ruleListConvert(ruleFileList *RuleFileList, product string) (*RuleList, error) {
 	ruleList := new(RuleList)
 	*ruleList = make([]ReWriteRule, 0)
 
 	for _, ruleFile := range *ruleFileList {
-		rule, err := ruleConvert(ruleFile)
+		rule, err := ruleConvert(ruleFile, product)
 		if err != nil {
 			return ruleList, err
 		}
@@ -188,7 +188,7 @@ func ReWriteConfLoad(filename string) (ReWriteConf, error) {
 	conf.Config = make(ProductRules)
 
 	for product, ruleFileList := range *config.Config {
-		ruleList, err := ruleListConvert(ruleFileList)
+		ruleList, err := ruleListConvert(ruleFileList, product)
 		if err != nil {
 			return conf, err
 		}
@@ -0,0 +1,99 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// parse Range header of request
+
+package mod_static
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	errNoOverlap = errors.New("range not satisfiable")
+)
+
+type httpRange struct {
+	start  int64 // first byte of range
+	length int64 // length of range
+}
+
+// parseRange parses Range header for content with given size.
+// Only single byte range is supported, Range header with invalid syntax
+// or multiple ranges is ignored (nil is returned).
+//
+// Returns:
+//     (range, error), error is errNoOverlap if range is not satisfiable
+func parseRange(s string, size int64) (*httpRange, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(s, prefix) {
+		return nil, nil
+	}
+
+	spec := strings.TrimSpace(s[len(prefix):])
+	if strings.Contains(spec, ",") {
+		return nil, nil
+	}
+
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return nil, nil
+	}
+	first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+
+	// suffix range, eg. bytes=-500
+	if len(first) == 0 {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return nil, nil
+		}
+		if n == 0 || size == 0 {
+			return nil, errNoOverlap
+		}
+		if n > size {
+			n = size
+		}
+		return &httpRange{start: size - n, length: n}, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return nil, nil
+	}
+
+	end := size - 1
+	if len(last) != 0 {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return nil, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	if start >= size {
+		return nil, errNoOverlap
+	}
+
+	return &httpRange{start: start, length: end - start + 1}, nil
+}
+
+// contentRange returns value of Content-Range header.
+func (r *httpRange) contentRange(size int64) string {
+	return "bytes " + strconv.FormatInt(r.start, 10) + "-" +
+		strconv.FormatInt(r.start+r.length-1, 10) + "/" + strconv.FormatInt(size, 10)
+}
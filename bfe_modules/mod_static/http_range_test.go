@@ -0,0 +1,66 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_static
+
+import (
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		value  string
+		start  int64
+		length int64
+		ignore bool
+		err    error
+	}{
+		{"bytes=0-9", 0, 10, false, nil},
+		{"bytes=10-", 10, 90, false, nil},
+		{"bytes=-10", 90, 10, false, nil},
+		{"bytes=-200", 0, 100, false, nil},
+		{"bytes=50-200", 50, 50, false, nil},
+		{"bytes=100-", 0, 0, false, errNoOverlap},
+		{"bytes=-0", 0, 0, false, errNoOverlap},
+		{"bytes=0-1,5-6", 0, 0, true, nil},
+		{"bytes=9-1", 0, 0, true, nil},
+		{"bytes=a-b", 0, 0, true, nil},
+		{"items=0-9", 0, 0, true, nil},
+	}
+
+	for _, c := range cases {
+		r, err := parseRange(c.value, 100)
+		if err != c.err {
+			t.Errorf("parseRange(%s) err should be %v, not %v", c.value, c.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if c.ignore != (r == nil) {
+			t.Errorf("parseRange(%s) should be ignored: %v", c.value, c.ignore)
+			continue
+		}
+		if r != nil && (r.start != c.start || r.length != c.length) {
+			t.Errorf("parseRange(%s) = %+v, expect start %d length %d", c.value, r, c.start, c.length)
+		}
+	}
+}
+
+func TestContentRange(t *testing.T) {
+	r := &httpRange{start: 10, length: 20}
+	if cr := r.contentRange(100); cr != "bytes 10-29/100" {
+		t.Errorf("unexpected content range: %s", cr)
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// module for serving static files
+
+package mod_static
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/web-monitor/metrics"
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+const (
+	ModStatic = "mod_static"
+)
+
+var (
+	openDebug = false
+)
+
+type ModuleStaticState struct {
+	ReqTotal            *metrics.Counter // all request in
+	ReqToCheck          *metrics.Counter // request with condition satisfied
+	FileServed          *metrics.Counter // request served with file
+	FilePreCompressed   *metrics.Counter // request served with pre-compressed .gz file
+	FileNotModified     *metrics.Counter // request served with 304
+	FileNotFound        *metrics.Counter // file not found
+	FileOpenErr         *metrics.Counter // failed to open file
+	RangeServed         *metrics.Counter // request served with 206
+	RangeNotSatisfiable *metrics.Counter // request served with 416
+	MethodNotAllowed    *metrics.Counter // request method is not GET or HEAD
+}
+
+type ModuleStatic struct {
+	name    string            // name of module
+	state   ModuleStaticState // module state
+	metrics metrics.Metrics
+
+	confRoot        string            // root dir of config
+	productRulePath string            // path of static rule data file
+	ruleTable       *ProductRuleTable // table for product static rules
+}
+
+func NewModuleStatic() *ModuleStatic {
+	m := new(ModuleStatic)
+	m.name = ModStatic
+	m.metrics.Init(&m.state, ModStatic, 0)
+
+	m.ruleTable = NewProductRuleTable()
+
+	return m
+}
+
+func (m *ModuleStatic) Name() string {
+	return m.name
+}
+
+func (m *ModuleStatic) State() interface{} {
+	return &m.state
+}
+
+// loadProductRuleConf load from config file.
+func (m *ModuleStatic) loadProductRuleConf(query url.Values) error {
+	// get path
+	path := query.Get("path")
+	if path == "" {
+		// use default
+		path = m.productRulePath
+	}
+
+	// load file
+	conf, err := ProductRuleConfLoad(path, m.confRoot)
+	if err != nil {
+		return fmt.Errorf("err in ProductRuleConfLoad(%s):%s", path, err)
+	}
+
+	m.ruleTable.Update(conf)
+	return nil
+}
+
+// staticFileHandler is a handler for serving static file.
+func (m *ModuleStatic) staticFileHandler(req *bfe_basic.Request) (int, *bfe_http.Response) {
+	m.state.ReqTotal.Inc(1)
+
+	// find static rules for given request
+	rules, ok := m.ruleTable.Search(req.Route.Product)
+	if !ok {
+		if openDebug {
+			log.Logger.Debug("%s product %s not found, just pass",
+				m.name, req.Route.Product)
+		}
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	for i := range *rules {
+		rule := &(*rules)[i]
+		if rule.Cond.Match(req) {
+			m.state.ReqToCheck.Inc(1)
+			return bfe_module.BFE_HANDLER_RESPONSE, m.serveFile(req, rule)
+		}
+	}
+
+	return bfe_module.BFE_HANDLER_GOON, nil
+}
+
+// serveFile creates response with static file for request.
+func (m *ModuleStatic) serveFile(req *bfe_basic.Request, rule *staticRule) *bfe_http.Response {
+	httpReq := req.HttpRequest
+	if httpReq.Method != "GET" && httpReq.Method != "HEAD" {
+		m.state.MethodNotAllowed.Inc(1)
+		res := bfe_basic.CreateInternalResp(req, bfe_http.StatusMethodNotAllowed)
+		res.Header.Set("Allow", "GET, HEAD")
+		return res
+	}
+
+	file, info, err := openFile(rule, httpReq.URL.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			m.state.FileNotFound.Inc(1)
+			return bfe_basic.CreateInternalResp(req, bfe_http.StatusNotFound)
+		}
+		if os.IsPermission(err) {
+			m.state.FileOpenErr.Inc(1)
+			return bfe_basic.CreateInternalResp(req, bfe_http.StatusForbidden)
+		}
+
+		log.Logger.Warn("%s open file for %s err: %s", m.name, httpReq.URL.Path, err)
+		m.state.FileOpenErr.Inc(1)
+		return bfe_basic.CreateInternalResp(req, bfe_http.StatusInternalServerError)
+	}
+
+	res := bfe_basic.CreateInternalResp(req, bfe_http.StatusOK)
+	res.Header.Set("Content-Type", mimeType(info.Name()))
+
+	// use pre-compressed file if exists
+	if rule.PreCompressGzip {
+		res.Header.Set("Vary", "Accept-Encoding")
+		if acceptGzip(httpReq.Header) {
+			if gzFile, gzInfo, err := openRegularFile(file.Name() + ".gz"); err == nil {
+				file.Close()
+				file, info = gzFile, gzInfo
+				res.Header.Set("Content-Encoding", "gzip")
+				m.state.FilePreCompressed.Inc(1)
+			}
+		}
+	}
+
+	modTime := info.ModTime()
+	res.Header.Set("Last-Modified", modTime.UTC().Format(bfe_http.TimeFormat))
+	res.Header.Set("Accept-Ranges", "bytes")
+
+	if notModifiedSince(httpReq.Header, modTime) {
+		file.Close()
+		m.state.FileNotModified.Inc(1)
+		res.StatusCode = bfe_http.StatusNotModified
+		res.Header.Del("Content-Type")
+		return res
+	}
+
+	size := info.Size()
+	start, length := int64(0), size
+
+	if r, err := requestRange(httpReq.Header, size, modTime); err != nil {
+		file.Close()
+		m.state.RangeNotSatisfiable.Inc(1)
+		res.StatusCode = bfe_http.StatusRequestedRangeNotSatisfiable
+		res.Header.Del("Content-Type")
+		res.Header.Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+		return res
+	} else if r != nil {
+		m.state.RangeServed.Inc(1)
+		res.StatusCode = bfe_http.StatusPartialContent
+		res.Header.Set("Content-Range", r.contentRange(size))
+		start, length = r.start, r.length
+	}
+
+	res.Header.Set("Content-Length", strconv.FormatInt(length, 10))
+	res.ContentLength = length
+
+	if httpReq.Method == "HEAD" {
+		file.Close()
+		return res
+	}
+
+	if start > 0 {
+		if _, err := file.Seek(start, io.SeekStart); err != nil {
+			file.Close()
+			log.Logger.Warn("%s seek file %s err: %s", m.name, file.Name(), err)
+			m.state.FileOpenErr.Inc(1)
+			return bfe_basic.CreateInternalResp(req, bfe_http.StatusInternalServerError)
+		}
+	}
+
+	if openDebug {
+		log.Logger.Debug("%s serve file %s", m.name, file.Name())
+	}
+	m.state.FileServed.Inc(1)
+	res.Body = newFileReader(file, length)
+	return res
+}
+
+// notModifiedSince checks If-Modified-Since of request.
+func notModifiedSince(header bfe_http.Header, modTime time.Time) bool {
+	ims := header.Get("If-Modified-Since")
+	if len(ims) == 0 {
+		return false
+	}
+
+	t, err := bfe_http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+
+	// Note: Last-Modified has a resolution of seconds
+	return !modTime.Truncate(time.Second).After(t)
+}
+
+// requestRange returns range of request. Range is ignored if If-Range
+// does not match Last-Modified of file.
+func requestRange(header bfe_http.Header, size int64, modTime time.Time) (*httpRange, error) {
+	value := header.Get("Range")
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	if ifRange := header.Get("If-Range"); len(ifRange) != 0 {
+		t, err := bfe_http.ParseTime(ifRange)
+		if err != nil || !modTime.Truncate(time.Second).Equal(t) {
+			return nil, nil
+		}
+	}
+
+	return parseRange(value, size)
+}
+
+// acceptGzip checks whether request accepts gzip encoding.
+func acceptGzip(header bfe_http.Header) bool {
+	for _, value := range header["Accept-Encoding"] {
+		for _, item := range strings.Split(value, ",") {
+			params := strings.Split(item, ";")
+			coding := strings.ToLower(strings.TrimSpace(params[0]))
+			if coding != "gzip" && coding != "x-gzip" {
+				continue
+			}
+
+			for _, param := range params[1:] {
+				param = strings.ToLower(strings.Replace(param, " ", "", -1))
+				if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil && q == 0 {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *ModuleStatic) getState(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetAll()
+	return s.Format(params)
+}
+
+func (m *ModuleStatic) getStateDiff(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetDiff()
+	return s.Format(params)
+}
+
+func (m *ModuleStatic) monitorHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name:           m.getState,
+		m.name + ".diff": m.getStateDiff,
+	}
+	return handlers
+}
+
+func (m *ModuleStatic) reloadHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name + ".product_rule_table": m.loadProductRuleConf,
+	}
+	return handlers
+}
+
+func (m *ModuleStatic) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHandlers,
+	cr string) error {
+	var conf *ConfModStatic
+	var err error
+
+	// load module config
+	confPath := bfe_module.ModConfPath(cr, m.name)
+	if conf, err = ConfLoad(confPath, cr); err != nil {
+		return fmt.Errorf("%s: conf load err %s", m.name, err.Error())
+	}
+
+	m.confRoot = cr
+	m.productRulePath = conf.Basic.ProductRulePath
+	openDebug = conf.Log.OpenDebug
+
+	// load conf data
+	if err = m.loadProductRuleConf(nil); err != nil {
+		return fmt.Errorf("%s: loadProductRuleConf() err %s", m.name, err.Error())
+	}
+
+	// register handler, before route rules are matched, so that product
+	// without route rule and cluster could be served
+	err = cbs.AddFilter(bfe_module.HANDLE_FOUND_PRODUCT, m.staticFileHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.staticFileHandler): %s", m.name, err.Error())
+	}
+
+	// register web handler for monitor
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_MONITOR, m.monitorHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.monitorHandlers): %s", m.name, err.Error())
+	}
+	// register web handler for reload
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_RELOAD, m.reloadHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.reloadHandlers): %s", m.name, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,276 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_static
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/url"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_config/bfe_route_conf/host_rule_conf"
+	"github.com/baidu/bfe/bfe_config/bfe_route_conf/route_rule_conf"
+	"github.com/baidu/bfe/bfe_config/bfe_route_conf/vip_rule_conf"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+	"github.com/baidu/bfe/bfe_modules/mod_block"
+	"github.com/baidu/bfe/bfe_route"
+)
+
+func prepareModule() *ModuleStatic {
+	m := NewModuleStatic()
+	m.Init(bfe_module.NewBfeCallbacks(), web_monitor.NewWebHandlers(), "./testdata")
+	return m
+}
+
+func prepareRequest(method string, path string) *bfe_basic.Request {
+	request := new(bfe_basic.Request)
+	request.HttpRequest = new(bfe_http.Request)
+	request.HttpRequest.Method = method
+	request.HttpRequest.Header = make(bfe_http.Header)
+	request.HttpRequest.URL, _ = url.Parse(path)
+	request.Session = new(bfe_basic.Session)
+	request.Context = make(map[interface{}]interface{})
+	request.Route = bfe_basic.RequestRoute{Product: "pn"}
+	return request
+}
+
+func serve(t *testing.T, m *ModuleStatic, req *bfe_basic.Request) (*bfe_http.Response, string) {
+	ret, res := m.staticFileHandler(req)
+	if ret != bfe_module.BFE_HANDLER_RESPONSE || res == nil {
+		t.Fatalf("staticFileHandler() should return response")
+	}
+
+	data, _ := ioutil.ReadAll(res.Body)
+	return res, string(data)
+}
+
+func TestServeFile(t *testing.T) {
+	m := prepareModule()
+
+	res, body := serve(t, m, prepareRequest("GET", "/robots.txt"))
+	if res.StatusCode != bfe_http.StatusOK || body != "User-agent: *\nDisallow: /\n" {
+		t.Errorf("unexpected response: %d %q", res.StatusCode, body)
+	}
+	if res.Header.Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Errorf("unexpected Content-Type: %s", res.Header.Get("Content-Type"))
+	}
+	if res.Header.Get("Content-Length") != "26" || res.Header.Get("Last-Modified") == "" {
+		t.Errorf("Content-Length and Last-Modified should be set")
+	}
+
+	// index file
+	res, body = serve(t, m, prepareRequest("GET", "/"))
+	if res.StatusCode != bfe_http.StatusOK || body != "<html>index</html>\n" {
+		t.Errorf("unexpected response for index: %d %q", res.StatusCode, body)
+	}
+
+	// file in sub dir
+	res, _ = serve(t, m, prepareRequest("GET", "/sub/data.json"))
+	if res.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected Content-Type: %s", res.Header.Get("Content-Type"))
+	}
+
+	// HEAD
+	res, body = serve(t, m, prepareRequest("HEAD", "/robots.txt"))
+	if res.StatusCode != bfe_http.StatusOK || body != "" || res.Header.Get("Content-Length") != "26" {
+		t.Errorf("unexpected response for HEAD")
+	}
+}
+
+func TestServeFileError(t *testing.T) {
+	m := prepareModule()
+
+	cases := map[string]int{
+		"/not_exist.txt":         bfe_http.StatusNotFound,
+		"/empty/":                bfe_http.StatusNotFound,
+		"/../mod_static_test.go": bfe_http.StatusNotFound,
+		"/../../mod_static.go":   bfe_http.StatusNotFound,
+	}
+	for path, code := range cases {
+		res, _ := serve(t, m, prepareRequest("GET", path))
+		if res.StatusCode != code {
+			t.Errorf("status code for %s should be %d, not %d", path, code, res.StatusCode)
+		}
+	}
+
+	res, _ := serve(t, m, prepareRequest("POST", "/robots.txt"))
+	if res.StatusCode != bfe_http.StatusMethodNotAllowed || res.Header.Get("Allow") == "" {
+		t.Errorf("status code should be 405")
+	}
+
+	// request not matched
+	if ret, _ := m.staticFileHandler(prepareRequest("GET", "/api/user")); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Errorf("request not matched should pass")
+	}
+}
+
+func TestServeFileRange(t *testing.T) {
+	m := prepareModule()
+
+	req := prepareRequest("GET", "/robots.txt")
+	req.HttpRequest.Header.Set("Range", "bytes=0-9")
+	res, body := serve(t, m, req)
+	if res.StatusCode != bfe_http.StatusPartialContent || body != "User-agent" {
+		t.Errorf("unexpected response: %d %q", res.StatusCode, body)
+	}
+	if res.Header.Get("Content-Range") != "bytes 0-9/26" || res.Header.Get("Content-Length") != "10" {
+		t.Errorf("unexpected Content-Range: %s", res.Header.Get("Content-Range"))
+	}
+
+	req = prepareRequest("GET", "/robots.txt")
+	req.HttpRequest.Header.Set("Range", "bytes=-11")
+	if _, body = serve(t, m, req); body != "isallow: /\n" {
+		t.Errorf("unexpected body: %q", body)
+	}
+
+	req = prepareRequest("GET", "/robots.txt")
+	req.HttpRequest.Header.Set("Range", "bytes=100-")
+	res, _ = serve(t, m, req)
+	if res.StatusCode != bfe_http.StatusRequestedRangeNotSatisfiable ||
+		res.Header.Get("Content-Range") != "bytes */26" {
+		t.Errorf("status code should be 416")
+	}
+
+	// If-Range not matched
+	req = prepareRequest("GET", "/robots.txt")
+	req.HttpRequest.Header.Set("Range", "bytes=0-9")
+	req.HttpRequest.Header.Set("If-Range", time.Unix(0, 0).UTC().Format(bfe_http.TimeFormat))
+	if res, _ = serve(t, m, req); res.StatusCode != bfe_http.StatusOK {
+		t.Errorf("status code should be 200")
+	}
+}
+
+func TestServeFileNotModified(t *testing.T) {
+	m := prepareModule()
+
+	res, _ := serve(t, m, prepareRequest("GET", "/robots.txt"))
+
+	req := prepareRequest("GET", "/robots.txt")
+	req.HttpRequest.Header.Set("If-Modified-Since", res.Header.Get("Last-Modified"))
+	if res, _ = serve(t, m, req); res.StatusCode != bfe_http.StatusNotModified {
+		t.Errorf("status code should be 304")
+	}
+
+	req = prepareRequest("GET", "/robots.txt")
+	req.HttpRequest.Header.Set("If-Modified-Since", time.Unix(0, 0).UTC().Format(bfe_http.TimeFormat))
+	if res, _ = serve(t, m, req); res.StatusCode != bfe_http.StatusOK {
+		t.Errorf("status code should be 200")
+	}
+}
+
+func TestServePreCompressed(t *testing.T) {
+	m := prepareModule()
+
+	req := prepareRequest("GET", "/app.js")
+	req.HttpRequest.Header.Set("Accept-Encoding", "gzip, deflate")
+	ret, res := m.staticFileHandler(req)
+	if ret != bfe_module.BFE_HANDLER_RESPONSE || res.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("pre-compressed file should be served")
+	}
+	if res.Header.Get("Content-Type") != "application/javascript" ||
+		res.Header.Get("Vary") != "Accept-Encoding" {
+		t.Errorf("unexpected header: %v", res.Header)
+	}
+
+	gr, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader(): %s", err)
+	}
+	if data, _ := ioutil.ReadAll(gr); string(data) != "console.log(\"hello bfe\");\n" {
+		t.Errorf("unexpected body: %q", data)
+	}
+
+	// gzip not accepted
+	req = prepareRequest("GET", "/app.js")
+	req.HttpRequest.Header.Set("Accept-Encoding", "gzip;q=0")
+	res, _ = serve(t, m, req)
+	if res.Header.Get("Content-Encoding") != "" {
+		t.Errorf("pre-compressed file should not be served")
+	}
+}
+
+func TestModuleMisc(t *testing.T) {
+	m := prepareModule()
+	if s, _ := m.getState(nil); s == nil {
+		t.Errorf("Should return valid state")
+	}
+	if m.monitorHandlers() == nil {
+		t.Errorf("Should return valid monitor handlers")
+	}
+	if m.reloadHandlers() == nil {
+		t.Errorf("Should return valid reload handlers")
+	}
+}
+
+func TestServeAfterBlock(t *testing.T) {
+	// register modules in the order of bfe_modules
+	cbs := bfe_module.NewBfeCallbacks()
+	whs := web_monitor.NewWebHandlers()
+	if err := mod_block.NewModuleBlock().Init(cbs, whs, "./testdata"); err != nil {
+		t.Fatalf("mod_block Init() error: %s", err)
+	}
+	if err := NewModuleStatic().Init(cbs, whs, "./testdata"); err != nil {
+		t.Fatalf("mod_static Init() error: %s", err)
+	}
+	hl := cbs.GetHandlerList(bfe_module.HANDLE_FOUND_PRODUCT)
+
+	// blocked by mod_block before served
+	req := prepareRequest("GET", "/robots.txt")
+	ret, res := hl.FilterRequest(req)
+	if ret != bfe_module.BFE_HANDLER_CLOSE || res != nil {
+		t.Errorf("request should be blocked, got %d", ret)
+	}
+
+	// not blocked, served by mod_static
+	req = prepareRequest("GET", "/sub/data.json")
+	ret, res = hl.FilterRequest(req)
+	if ret != bfe_module.BFE_HANDLER_RESPONSE || res == nil || res.StatusCode != bfe_http.StatusOK {
+		t.Errorf("request should be served, got %d", ret)
+	}
+}
+
+func TestServeWithoutRoute(t *testing.T) {
+	cbs := bfe_module.NewBfeCallbacks()
+	if err := NewModuleStatic().Init(cbs, web_monitor.NewWebHandlers(), "./testdata"); err != nil {
+		t.Fatalf("mod_static Init() error: %s", err)
+	}
+
+	// no route rule for product pn
+	routeConf, err := route_rule_conf.RouteConfLoad("./testdata/route_rule.data")
+	if err != nil {
+		t.Fatalf("RouteConfLoad(): %s", err)
+	}
+	var hostTable bfe_route.HostTable
+	hostTable.Update(host_rule_conf.HostConf{}, vip_rule_conf.VipConf{}, routeConf)
+	if err := hostTable.LookupCluster(prepareRequest("GET", "/index.html")); err == nil {
+		t.Fatalf("LookupCluster() should fail for product without route rule")
+	}
+
+	// served at HANDLE_FOUND_PRODUCT, before route rules are matched
+	req := prepareRequest("GET", "/index.html")
+	ret, res := cbs.GetHandlerList(bfe_module.HANDLE_FOUND_PRODUCT).FilterRequest(req)
+	if ret != bfe_module.BFE_HANDLER_RESPONSE || res == nil || res.StatusCode != bfe_http.StatusOK {
+		t.Errorf("request should be served, got %d", ret)
+	}
+}
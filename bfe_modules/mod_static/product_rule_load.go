@@ -0,0 +1,206 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_static
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic/condition"
+	"github.com/baidu/bfe/bfe_util"
+)
+
+var (
+	// default index files
+	DefaultIndexFiles = []string{"index.html"}
+)
+
+type staticRuleFile struct {
+	Cond            *string  // condition for static file
+	DocumentRoot    *string  // root dir of static files
+	IndexFiles      []string // index files for directory
+	PreCompressGzip bool     // whether serve pre-compressed .gz file
+}
+
+type staticRule struct {
+	Cond            condition.Condition // condition for static file
+	DocumentRoot    string              // root dir of static files
+	IndexFiles      []string            // index files for directory
+	PreCompressGzip bool                // whether serve pre-compressed .gz file
+}
+
+type staticRuleFileList []staticRuleFile
+type staticRuleList []staticRule
+
+type ProductRulesFile map[string]*staticRuleFileList // product => list of static rules
+type ProductRules map[string]*staticRuleList
+
+type productRuleConfFile struct {
+	Version *string // version of the config
+	Config  *ProductRulesFile
+}
+
+type productRuleConf struct {
+	Version string       // version of the config
+	Config  ProductRules // product rules for static file
+}
+
+func staticRuleCheck(conf staticRuleFile) error {
+	// check Cond
+	if conf.Cond == nil {
+		return errors.New("no Cond")
+	}
+
+	// check DocumentRoot
+	if conf.DocumentRoot == nil || len(*conf.DocumentRoot) == 0 {
+		return errors.New("no DocumentRoot")
+	}
+
+	// check IndexFiles
+	for _, index := range conf.IndexFiles {
+		if len(index) == 0 || strings.ContainsAny(index, "/\\") {
+			return fmt.Errorf("invalid index file: %s", index)
+		}
+	}
+
+	return nil
+}
+
+func staticRuleListCheck(conf *staticRuleFileList) error {
+	for index, rule := range *conf {
+		err := staticRuleCheck(rule)
+		if err != nil {
+			return fmt.Errorf("staticRule:%d, %s", index, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRulesCheck(conf *ProductRulesFile) error {
+	for product, ruleList := range *conf {
+		if ruleList == nil {
+			return fmt.Errorf("no staticRuleList for product:%s", product)
+		}
+
+		err := staticRuleListCheck(ruleList)
+		if err != nil {
+			return fmt.Errorf("ProductRules:%s, %s", product, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRuleConfCheck(conf productRuleConfFile) error {
+	var err error
+
+	// check Version
+	if conf.Version == nil {
+		return errors.New("no Version")
+	}
+
+	// check Config
+	if conf.Config == nil {
+		return errors.New("no Config")
+	}
+
+	err = productRulesCheck(conf.Config)
+	if err != nil {
+		return fmt.Errorf("Config:%s", err.Error())
+	}
+
+	return nil
+}
+
+func ruleConvert(ruleFile staticRuleFile, confRoot string, product string) (staticRule, error) {
+	rule := staticRule{}
+
+	cond, err := condition.BuildWithProduct(*ruleFile.Cond, product)
+	if err != nil {
+		return rule, err
+	}
+	rule.Cond = cond
+	rule.DocumentRoot = bfe_util.ConfPathProc(*ruleFile.DocumentRoot, confRoot)
+
+	rule.IndexFiles = ruleFile.IndexFiles
+	if len(rule.IndexFiles) == 0 {
+		rule.IndexFiles = DefaultIndexFiles
+	}
+
+	rule.PreCompressGzip = ruleFile.PreCompressGzip
+	return rule, nil
+}
+
+func ruleListConvert(ruleFileList *staticRuleFileList, confRoot string, product string) (*staticRuleList, error) {
+	ruleList := new(staticRuleList)
+	*ruleList = make([]staticRule, 0)
+
+	for _, ruleFile := range *ruleFileList {
+		rule, err := ruleConvert(ruleFile, confRoot, product)
+		if err != nil {
+			return nil, err
+		}
+		*ruleList = append(*ruleList, rule)
+	}
+
+	return ruleList, nil
+}
+
+// ProductRuleConfLoad load static rule config from file.
+// Relative DocumentRoot is relative to confRoot.
+func ProductRuleConfLoad(filename string, confRoot string) (productRuleConf, error) {
+	var conf productRuleConf
+	var err error
+
+	// open the file
+	file, err := os.Open(filename)
+	if err != nil {
+		return conf, err
+	}
+	defer file.Close()
+
+	// decode the file
+	decoder := json.NewDecoder(file)
+	var config productRuleConfFile
+	err = decoder.Decode(&config)
+	if err != nil {
+		return conf, err
+	}
+
+	// check config
+	err = productRuleConfCheck(config)
+	if err != nil {
+		return conf, err
+	}
+
+	// convert config
+	conf.Version = *config.Version
+	conf.Config = make(ProductRules)
+	for product, ruleFileList := range *config.Config {
+		ruleList, err := ruleListConvert(ruleFileList, confRoot, product)
+		if err != nil {
+			return conf, err
+		}
+		conf.Config[product] = ruleList
+	}
+
+	return conf, nil
+}
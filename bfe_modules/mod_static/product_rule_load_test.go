@@ -0,0 +1,50 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_static
+
+import (
+	"testing"
+)
+
+func TestStaticRuleConfLoad(t *testing.T) {
+	config, err := ProductRuleConfLoad("./testdata/mod_static/static_rules.data", "/home/bfe/conf")
+	if err != nil {
+		t.Fatalf("get err from ProductRuleConfLoad():%s", err.Error())
+	}
+
+	rules := *config.Config["pn"]
+	if len(rules) != 1 {
+		t.Fatalf("len(config.Config['pn']) should be 1")
+	}
+	if rules[0].DocumentRoot != "/home/bfe/conf/static/pn" {
+		t.Errorf("DocumentRoot should be /home/bfe/conf/static/pn, not %s", rules[0].DocumentRoot)
+	}
+	if len(rules[0].IndexFiles) != 2 || !rules[0].PreCompressGzip {
+		t.Errorf("unexpected rule: %+v", rules[0])
+	}
+}
+
+func TestStaticRuleConfLoadInvalid(t *testing.T) {
+	files := []string{
+		"./testdata/static_rules_1.data", // no DocumentRoot
+		"./testdata/static_rules_2.data", // invalid index file
+	}
+
+	for _, file := range files {
+		if _, err := ProductRuleConfLoad(file, ""); err == nil {
+			t.Errorf("err should not be nil for %s", file)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// open static file and detect content type
+
+package mod_static
+
+import (
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	DefaultMimeType = "application/octet-stream"
+)
+
+// content types for extensions, which are not always in system mime table
+var mimeTypes = map[string]string{
+	".css":   "text/css; charset=utf-8",
+	".htm":   "text/html; charset=utf-8",
+	".html":  "text/html; charset=utf-8",
+	".ico":   "image/x-icon",
+	".js":    "application/javascript",
+	".json":  "application/json",
+	".svg":   "image/svg+xml",
+	".txt":   "text/plain; charset=utf-8",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".xml":   "text/xml; charset=utf-8",
+}
+
+// mimeType returns content type for file name.
+func mimeType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := mimeTypes[ext]; ok {
+		return t
+	}
+
+	if t := mime.TypeByExtension(ext); len(t) != 0 {
+		return t
+	}
+
+	return DefaultMimeType
+}
+
+// openFile opens file for url path under document root. If path refers to
+// a directory, the first index file found is opened.
+func openFile(rule *staticRule, urlPath string) (*os.File, os.FileInfo, error) {
+	if strings.Contains(urlPath, "\x00") {
+		return nil, nil, os.ErrNotExist
+	}
+
+	// Note: path.Clean() removes ".." elements, so file out of
+	// document root is never accessed
+	name := filepath.Join(rule.DocumentRoot, filepath.FromSlash(path.Clean("/"+urlPath)))
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if info.IsDir() {
+		for _, index := range rule.IndexFiles {
+			file, info, err := openRegularFile(filepath.Join(name, index))
+			if err == nil {
+				return file, info, nil
+			}
+		}
+		return nil, nil, os.ErrNotExist
+	}
+
+	return openRegularFile(name)
+}
+
+// openRegularFile opens file if it is a regular file.
+func openRegularFile(name string) (*os.File, os.FileInfo, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	if !info.Mode().IsRegular() {
+		file.Close()
+		return nil, nil, os.ErrNotExist
+	}
+
+	return file, info, nil
+}
+
+// fileReader reads at most n bytes from file, file is closed after
+// EOF or error.
+type fileReader struct {
+	file   *os.File
+	reader io.Reader
+	closed bool
+}
+
+func newFileReader(file *os.File, n int64) *fileReader {
+	return &fileReader{file: file, reader: io.LimitReader(file, n)}
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil {
+		r.Close()
+	}
+	return n, err
+}
+
+func (r *fileReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	return r.file.Close()
+}
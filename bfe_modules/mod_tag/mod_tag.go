@@ -0,0 +1,198 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// module for adding tags to request
+
+package mod_tag
+
+import (
+	"fmt"
+	"net/url"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/web-monitor/metrics"
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+const (
+	ModTag = "mod_tag"
+)
+
+var (
+	openDebug = false
+)
+
+type ModuleTagState struct {
+	ReqTotal  *metrics.Counter // all request in
+	ReqTagged *metrics.Counter // request with at least one tag added
+	TagAdded  *metrics.Counter // tags added
+}
+
+type ModuleTag struct {
+	name    string         // name of module
+	state   ModuleTagState // module state
+	metrics metrics.Metrics
+
+	productRulePath string            // path of tag rule data file
+	ruleTable       *ProductRuleTable // table for product tag rules
+}
+
+func NewModuleTag() *ModuleTag {
+	m := new(ModuleTag)
+	m.name = ModTag
+	m.metrics.Init(&m.state, ModTag, 0)
+
+	m.ruleTable = NewProductRuleTable()
+
+	return m
+}
+
+func (m *ModuleTag) Name() string {
+	return m.name
+}
+
+func (m *ModuleTag) State() interface{} {
+	return &m.state
+}
+
+// loadProductRuleConf load from config file.
+func (m *ModuleTag) loadProductRuleConf(query url.Values) error {
+	// get path
+	path := query.Get("path")
+	if path == "" {
+		// use default
+		path = m.productRulePath
+	}
+
+	// load file
+	conf, err := ProductRuleConfLoad(path)
+	if err != nil {
+		return fmt.Errorf("err in ProductRuleConfLoad(%s):%s", path, err)
+	}
+
+	m.ruleTable.Update(conf)
+	return nil
+}
+
+// tagHandler is a handler for adding tags to request.
+func (m *ModuleTag) tagHandler(req *bfe_basic.Request) (int, *bfe_http.Response) {
+	m.state.ReqTotal.Inc(1)
+
+	// find tag rules for given request
+	rules, ok := m.ruleTable.Search(req.Route.Product)
+	if !ok {
+		if openDebug {
+			log.Logger.Debug("%s product %s not found, just pass",
+				m.name, req.Route.Product)
+		}
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	tagged := false
+	for _, rule := range *rules {
+		if !rule.Cond.Match(req) {
+			continue
+		}
+
+		req.AddTags(rule.Param.TagName, []string{rule.Param.TagValue})
+		m.state.TagAdded.Inc(1)
+		tagged = true
+
+		if openDebug {
+			log.Logger.Debug("%s add tag %s:%s", m.name, rule.Param.TagName, rule.Param.TagValue)
+		}
+
+		if rule.Last {
+			break
+		}
+	}
+
+	if tagged {
+		m.state.ReqTagged.Inc(1)
+	}
+
+	return bfe_module.BFE_HANDLER_GOON, nil
+}
+
+func (m *ModuleTag) getState(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetAll()
+	return s.Format(params)
+}
+
+func (m *ModuleTag) getStateDiff(params map[string][]string) ([]byte, error) {
+	s := m.metrics.GetDiff()
+	return s.Format(params)
+}
+
+func (m *ModuleTag) monitorHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name:           m.getState,
+		m.name + ".diff": m.getStateDiff,
+	}
+	return handlers
+}
+
+func (m *ModuleTag) reloadHandlers() map[string]interface{} {
+	handlers := map[string]interface{}{
+		m.name + ".product_rule_table": m.loadProductRuleConf,
+	}
+	return handlers
+}
+
+func (m *ModuleTag) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHandlers,
+	cr string) error {
+	var conf *ConfModTag
+	var err error
+
+	// load module config
+	confPath := bfe_module.ModConfPath(cr, m.name)
+	if conf, err = ConfLoad(confPath, cr); err != nil {
+		return fmt.Errorf("%s: conf load err %s", m.name, err.Error())
+	}
+
+	m.productRulePath = conf.Basic.ProductRulePath
+	openDebug = conf.Log.OpenDebug
+
+	// load conf data
+	if err = m.loadProductRuleConf(nil); err != nil {
+		return fmt.Errorf("%s: loadProductRuleConf() err %s", m.name, err.Error())
+	}
+
+	// register handler
+	err = cbs.AddFilter(bfe_module.HANDLE_FOUND_PRODUCT, m.tagHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.tagHandler): %s", m.name, err.Error())
+	}
+
+	// register web handler for monitor
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_MONITOR, m.monitorHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.monitorHandlers): %s", m.name, err.Error())
+	}
+	// register web handler for reload
+	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_RELOAD, m.reloadHandlers())
+	if err != nil {
+		return fmt.Errorf("%s.Init():RegisterHandlers(m.reloadHandlers): %s", m.name, err.Error())
+	}
+
+	return nil
+}
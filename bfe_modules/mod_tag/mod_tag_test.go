@@ -0,0 +1,121 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_tag
+
+import (
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_basic/condition"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_module"
+)
+
+func prepareModule() *ModuleTag {
+	m := NewModuleTag()
+	m.Init(bfe_module.NewBfeCallbacks(), web_monitor.NewWebHandlers(), "./testdata")
+	return m
+}
+
+func prepareRequest(clientIP string) *bfe_basic.Request {
+	request := new(bfe_basic.Request)
+	request.HttpRequest = new(bfe_http.Request)
+	request.HttpRequest.Header = make(bfe_http.Header)
+	request.HttpRequest.URL, _ = url.Parse("/index.html")
+	request.Session = new(bfe_basic.Session)
+	request.Context = make(map[interface{}]interface{})
+	request.Tags.TagTable = make(map[string][]string)
+	request.ClientAddr = &net.TCPAddr{IP: net.ParseIP(clientIP), Port: 8098}
+	request.Route = bfe_basic.RequestRoute{Product: "pn"}
+	return request
+}
+
+func TestTagHandler(t *testing.T) {
+	m := prepareModule()
+
+	// internal client with canary cookie
+	req := prepareRequest("10.1.1.1")
+	req.HttpRequest.Header.Set("Cookie", "canary=1")
+	if ret, _ := m.tagHandler(req); ret != bfe_module.BFE_HANDLER_GOON {
+		t.Fatalf("tagHandler() should return GOON")
+	}
+	if tags := req.GetTags("client_type"); !reflect.DeepEqual(tags, []string{"internal"}) {
+		t.Errorf("client_type tags should be [internal], got %v", tags)
+	}
+	if tags := req.GetTags("release"); !reflect.DeepEqual(tags, []string{"canary"}) {
+		t.Errorf("release tags should be [canary], got %v", tags)
+	}
+
+	// bot matches the last rule, stop processing
+	req = prepareRequest("10.1.1.1")
+	req.HttpRequest.Header.Set("User-Agent", "Baiduspider")
+	req.HttpRequest.Header.Set("Cookie", "canary=1")
+	m.tagHandler(req)
+	if tags := req.GetTags("client_type"); !reflect.DeepEqual(tags, []string{"bot"}) {
+		t.Errorf("client_type tags should be [bot], got %v", tags)
+	}
+	if tags := req.GetTags("release"); len(tags) != 0 {
+		t.Errorf("release tags should be empty, got %v", tags)
+	}
+
+	// no rule matched
+	req = prepareRequest("192.168.1.1")
+	m.tagHandler(req)
+	if len(req.Tags.TagTable) != 0 {
+		t.Errorf("no tag should be added, got %v", req.Tags.TagTable)
+	}
+
+	// unknown product
+	req = prepareRequest("10.1.1.1")
+	req.Route.Product = "unknown"
+	m.tagHandler(req)
+	if len(req.Tags.TagTable) != 0 {
+		t.Errorf("no tag should be added, got %v", req.Tags.TagTable)
+	}
+
+	if m.state.ReqTotal.Get() != 4 || m.state.ReqTagged.Get() != 2 || m.state.TagAdded.Get() != 3 {
+		t.Errorf("unexpected state: %+v", m.state)
+	}
+}
+
+func TestTagMatchCond(t *testing.T) {
+	m := prepareModule()
+
+	cond, err := condition.Build("req_tag_match(\"client_type\", \"internal\")")
+	if err != nil {
+		t.Fatalf("condition.Build(): %s", err)
+	}
+
+	req := prepareRequest("10.1.1.1")
+	m.tagHandler(req)
+	if !cond.Match(req) {
+		t.Errorf("req_tag_match should match tagged request")
+	}
+
+	req = prepareRequest("192.168.1.1")
+	m.tagHandler(req)
+	if cond.Match(req) {
+		t.Errorf("req_tag_match should not match untagged request")
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_tag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic/condition"
+)
+
+type TagParam struct {
+	TagName  string // name of tag, e.g. "client_type"
+	TagValue string // value of tag, e.g. "bot"
+}
+
+type tagRuleFile struct {
+	Cond  *string   // condition for tag
+	Param *TagParam // tag to add
+	Last  bool      // if true, stop processing the next rule
+}
+
+type tagRule struct {
+	Cond  condition.Condition // condition for tag
+	Param TagParam            // tag to add
+	Last  bool                // if true, stop processing the next rule
+}
+
+type tagRuleFileList []tagRuleFile
+type tagRuleList []tagRule
+
+type ProductRulesFile map[string]*tagRuleFileList // product => list of tag rules
+type ProductRules map[string]*tagRuleList
+
+type productRuleConfFile struct {
+	Version *string // version of the config
+	Config  *ProductRulesFile
+}
+
+type productRuleConf struct {
+	Version string       // version of the config
+	Config  ProductRules // product rules for tag
+}
+
+func tagParamCheck(param *TagParam) error {
+	if len(param.TagName) == 0 {
+		return errors.New("no TagName")
+	}
+
+	if len(param.TagValue) == 0 {
+		return errors.New("no TagValue")
+	}
+
+	// req_tag_match only compares the part before ':'
+	if strings.Contains(param.TagValue, ":") {
+		return fmt.Errorf("TagValue should not contain ':': %s", param.TagValue)
+	}
+
+	return nil
+}
+
+func tagRuleCheck(conf tagRuleFile) error {
+	// check Cond
+	if conf.Cond == nil {
+		return errors.New("no Cond")
+	}
+
+	// check Param
+	if conf.Param == nil {
+		return errors.New("no Param")
+	}
+
+	if err := tagParamCheck(conf.Param); err != nil {
+		return fmt.Errorf("Param:%s", err.Error())
+	}
+
+	return nil
+}
+
+func tagRuleListCheck(conf *tagRuleFileList) error {
+	for index, rule := range *conf {
+		err := tagRuleCheck(rule)
+		if err != nil {
+			return fmt.Errorf("tagRule:%d, %s", index, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRulesCheck(conf *ProductRulesFile) error {
+	for product, ruleList := range *conf {
+		if ruleList == nil {
+			return fmt.Errorf("no tagRuleList for product:%s", product)
+		}
+
+		err := tagRuleListCheck(ruleList)
+		if err != nil {
+			return fmt.Errorf("ProductRules:%s, %s", product, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func productRuleConfCheck(conf productRuleConfFile) error {
+	var err error
+
+	// check Version
+	if conf.Version == nil {
+		return errors.New("no Version")
+	}
+
+	// check Config
+	if conf.Config == nil {
+		return errors.New("no Config")
+	}
+
+	err = productRulesCheck(conf.Config)
+	if err != nil {
+		return fmt.Errorf("Config:%s", err.Error())
+	}
+
+	return nil
+}
+
+func ruleConvert(ruleFile tagRuleFile, product string) (tagRule, error) {
+	rule := tagRule{}
+
+	cond, err := condition.BuildWithProduct(*ruleFile.Cond, product)
+	if err != nil {
+		return rule, err
+	}
+	rule.Cond = cond
+	rule.Param = *ruleFile.Param
+	rule.Last = ruleFile.Last
+
+	return rule, nil
+}
+
+func ruleListConvert(ruleFileList *tagRuleFileList, product string) (*tagRuleList, error) {
+	ruleList := new(tagRuleList)
+	*ruleList = make([]tagRule, 0)
+
+	for _, ruleFile := range *ruleFileList {
+		rule, err := ruleConvert(ruleFile, product)
+		if err != nil {
+			return nil, err
+		}
+		*ruleList = append(*ruleList, rule)
+	}
+
+	return ruleList, nil
+}
+
+// ProductRuleConfLoad load tag rule config from file.
+func ProductRuleConfLoad(filename string) (productRuleConf, error) {
+	var conf productRuleConf
+	var err error
+
+	// open the file
+	file, err := os.Open(filename)
+	if err != nil {
+		return conf, err
+	}
+	defer file.Close()
+
+	// decode the file
+	decoder := json.NewDecoder(file)
+	var config productRuleConfFile
+	err = decoder.Decode(&config)
+	if err != nil {
+		return conf, err
+	}
+
+	// check config
+	err = productRuleConfCheck(config)
+	if err != nil {
+		return conf, err
+	}
+
+	// convert config
+	conf.Version = *config.Version
+	conf.Config = make(ProductRules)
+	for product, ruleFileList := range *config.Config {
+		ruleList, err := ruleListConvert(ruleFileList, product)
+		if err != nil {
+			return conf, err
+		}
+		conf.Config[product] = ruleList
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_tag
+
+import (
+	"testing"
+)
+
+func TestTagRuleConfLoad(t *testing.T) {
+	config, err := ProductRuleConfLoad("./testdata/mod_tag/tag_rules.data")
+	if err != nil {
+		t.Fatalf("get err from ProductRuleConfLoad():%s", err.Error())
+	}
+
+	rules := *config.Config["pn"]
+	if len(rules) != 3 {
+		t.Fatalf("len(config.Config['pn']) should be 3")
+	}
+	if rules[0].Param.TagName != "client_type" || rules[0].Param.TagValue != "bot" || !rules[0].Last {
+		t.Errorf("unexpected rule: %+v", rules[0])
+	}
+}
+
+func TestTagRuleConfLoadInvalid(t *testing.T) {
+	files := []string{
+		"./testdata/tag_rules_1.data", // no Param
+		"./testdata/tag_rules_2.data", // invalid TagValue
+		"./testdata/tag_rules_3.data", // invalid Cond
+	}
+
+	for _, file := range files {
+		if _, err := ProductRuleConfLoad(file); err == nil {
+			t.Errorf("err should not be nil for %s", file)
+		}
+	}
+}
@@ -14,18 +14,39 @@
 
 package mod_trust_clientip
 
+import (
+	"fmt"
+)
+
 import (
 	gcfg "gopkg.in/gcfg.v1"
 	"github.com/baidu/go-lib/log"
 )
 
 import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
 	"github.com/baidu/bfe/bfe_util"
 )
 
+// policies for forwarded headers of outgoing request
+const (
+	PolicyAppend  = "APPEND"  // append address of remote peer
+	PolicyReplace = "REPLACE" // replace with address of client
+	PolicySet     = "SET"     // set to proto of client
+	PolicyRemove  = "REMOVE"  // remove the header
+)
+
 type ConfModTrustClientIP struct {
 	Basic struct {
-		DataPath string // path of config data (trust-ip)
+		DataPath        string // path of config data (trust-ip)
+		RecursiveHeader string // header for recursive client ip resolution, X-Forwarded-For or Forwarded
+	}
+
+	Outbound struct {
+		XForwardedFor   string // policy for X-Forwarded-For: APPEND, REPLACE or REMOVE
+		XForwardedProto string // policy for X-Forwarded-Proto: SET or REMOVE
+		Forwarded       string // policy for Forwarded: APPEND, REPLACE or REMOVE
 	}
 
 	Log struct {
@@ -64,5 +85,39 @@ func ConfModTrustClientIPCheck(cfg *ConfModTrustClientIP, confRoot string) error
 	}
 
 	cfg.Basic.DataPath = bfe_util.ConfPathProc(cfg.Basic.DataPath, confRoot)
+
+	if cfg.Basic.RecursiveHeader != "" {
+		header := bfe_http.CanonicalHeaderKey(cfg.Basic.RecursiveHeader)
+		if header != bfe_basic.HeaderForwardedFor && header != bfe_basic.HeaderForwarded {
+			return fmt.Errorf("ModTrustClientIP.RecursiveHeader invalid: %s", cfg.Basic.RecursiveHeader)
+		}
+		cfg.Basic.RecursiveHeader = header
+	}
+
+	if err := policyCheck(cfg.Outbound.XForwardedFor, PolicyAppend, PolicyReplace, PolicyRemove); err != nil {
+		return fmt.Errorf("ModTrustClientIP.Outbound.XForwardedFor: %s", err)
+	}
+	if err := policyCheck(cfg.Outbound.XForwardedProto, PolicySet, PolicyRemove); err != nil {
+		return fmt.Errorf("ModTrustClientIP.Outbound.XForwardedProto: %s", err)
+	}
+	if err := policyCheck(cfg.Outbound.Forwarded, PolicyAppend, PolicyReplace, PolicyRemove); err != nil {
+		return fmt.Errorf("ModTrustClientIP.Outbound.Forwarded: %s", err)
+	}
+
 	return nil
 }
+
+// policyCheck checks whether policy is one of given policies. Empty policy
+// means header is not changed.
+func policyCheck(policy string, policies ...string) error {
+	if policy == "" {
+		return nil
+	}
+
+	for _, p := range policies {
+		if policy == p {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid policy: %s", policy)
+}
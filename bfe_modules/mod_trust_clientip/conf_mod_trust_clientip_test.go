@@ -39,3 +39,30 @@ func Test_conf_mod_trust_clientip_case2(t *testing.T) {
 		t.Error("DataPath should be /home/bfe/conf/mod_trust_clientip/trust_client_ip.data")
 	}
 }
+
+func Test_conf_mod_trust_clientip_case3(t *testing.T) {
+	config, err := ConfLoad("./testdata/conf_mod_trust_clientip/bfe_3.conf", "")
+	if err != nil {
+		t.Fatalf("ConfLoad():err=%s", err.Error())
+	}
+
+	if config.Basic.RecursiveHeader != "X-Forwarded-For" {
+		t.Error("RecursiveHeader should be X-Forwarded-For")
+	}
+	if config.Outbound.XForwardedFor != PolicyReplace || config.Outbound.XForwardedProto != PolicySet ||
+		config.Outbound.Forwarded != PolicyAppend {
+		t.Errorf("unexpected Outbound: %+v", config.Outbound)
+	}
+}
+
+func Test_conf_mod_trust_clientip_case4(t *testing.T) {
+	// invalid policy
+	if _, err := ConfLoad("./testdata/conf_mod_trust_clientip/bfe_4.conf", ""); err == nil {
+		t.Error("ConfLoad() should fail for invalid policy")
+	}
+
+	// invalid recursive header
+	if _, err := ConfLoad("./testdata/conf_mod_trust_clientip/bfe_5.conf", ""); err == nil {
+		t.Error("ConfLoad() should fail for invalid recursive header")
+	}
+}
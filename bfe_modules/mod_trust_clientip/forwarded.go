@@ -0,0 +1,126 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// parse and format of X-Forwarded-For and Forwarded header
+
+package mod_trust_clientip
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// parseXForwardedFor parses addresses in X-Forwarded-For header, in order
+// from client to proxy. Invalid address is returned as nil.
+func parseXForwardedFor(values []string) []*net.TCPAddr {
+	addrs := make([]*net.TCPAddr, 0)
+	for _, value := range values {
+		for _, node := range strings.Split(value, ",") {
+			node = strings.TrimSpace(node)
+			if len(node) == 0 {
+				continue
+			}
+			addrs = append(addrs, parseNode(node))
+		}
+	}
+	return addrs
+}
+
+// parseForwarded parses addresses in "for" parameter of Forwarded
+// header (RFC 7239), in order from client to proxy. Invalid or
+// obfuscated address is returned as nil.
+func parseForwarded(values []string) []*net.TCPAddr {
+	addrs := make([]*net.TCPAddr, 0)
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			if len(strings.TrimSpace(element)) == 0 {
+				continue
+			}
+
+			var addr *net.TCPAddr
+			for _, pair := range splitQuoted(element, ';') {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "for") {
+					continue
+				}
+				node := strings.TrimSpace(kv[1])
+				if unquoted, err := strconv.Unquote(node); err == nil {
+					node = unquoted
+				}
+				addr = parseNode(node)
+			}
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// splitQuoted splits s by sep, which is not in quoted string.
+func splitQuoted(s string, sep byte) []string {
+	parts := make([]string, 0)
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseNode parses node of forwarded header, eg. 10.0.0.1, 10.0.0.1:80,
+// 1::1, [1::1]:80. Returns nil for invalid or obfuscated node.
+func parseNode(node string) *net.TCPAddr {
+	if ip := net.ParseIP(node); ip != nil {
+		return &net.TCPAddr{IP: ip}
+	}
+
+	host, portStr := node, ""
+	if h, p, err := net.SplitHostPort(node); err == nil {
+		host, portStr = h, p
+	} else if strings.HasPrefix(node, "[") && strings.HasSuffix(node, "]") {
+		host = node[1 : len(node)-1]
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil
+	}
+	addr := &net.TCPAddr{IP: ip}
+	if port, err := strconv.Atoi(portStr); err == nil {
+		addr.Port = port
+	}
+	return addr
+}
+
+// formatForwardedElement formats element of Forwarded header.
+func formatForwardedElement(ip net.IP, proto string) string {
+	node := ip.String()
+	if ip.To4() == nil {
+		// ipv6 address should be quoted and enclosed in brackets
+		node = "\"[" + node + "]\""
+	}
+	return "for=" + node + ";proto=" + proto
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mod_trust_clientip
+
+import (
+	"net"
+	"testing"
+)
+
+func addrsString(addrs []*net.TCPAddr) []string {
+	strs := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr == nil {
+			strs = append(strs, "<nil>")
+			continue
+		}
+		strs = append(strs, addr.String())
+	}
+	return strs
+}
+
+func checkAddrs(t *testing.T, name string, addrs []*net.TCPAddr, expect []string) {
+	strs := addrsString(addrs)
+	if len(strs) != len(expect) {
+		t.Errorf("%s: addrs should be %v, not %v", name, expect, strs)
+		return
+	}
+	for i := range strs {
+		if strs[i] != expect[i] {
+			t.Errorf("%s: addrs should be %v, not %v", name, expect, strs)
+			return
+		}
+	}
+}
+
+func TestParseXForwardedFor(t *testing.T) {
+	addrs := parseXForwardedFor([]string{"1.1.1.1, 2.2.2.2:8080", "1::1,[2::2]:80, ,unknown"})
+	checkAddrs(t, "X-Forwarded-For", addrs,
+		[]string{"1.1.1.1:0", "2.2.2.2:8080", "[1::1]:0", "[2::2]:80", "<nil>"})
+}
+
+func TestParseForwarded(t *testing.T) {
+	addrs := parseForwarded([]string{
+		`for=1.1.1.1;proto=https, For="[2001:db8::1]:4711"`,
+		`for=_hidden, by=3.3.3.3, for="2.2.2.2:80";host="a,b;c"`,
+	})
+	checkAddrs(t, "Forwarded", addrs,
+		[]string{"1.1.1.1:0", "[2001:db8::1]:4711", "<nil>", "<nil>", "2.2.2.2:80"})
+}
+
+func TestFormatForwardedElement(t *testing.T) {
+	if s := formatForwardedElement(net.ParseIP("1.1.1.1"), "http"); s != "for=1.1.1.1;proto=http" {
+		t.Errorf("unexpected element: %s", s)
+	}
+	if s := formatForwardedElement(net.ParseIP("1::1"), "https"); s != `for="[1::1]";proto=https` {
+		t.Errorf("unexpected element: %s", s)
+	}
+}
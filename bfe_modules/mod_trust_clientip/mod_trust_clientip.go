@@ -19,6 +19,7 @@ package mod_trust_clientip
 import (
 	"bytes"
 	"fmt"
+	"net"
 	"net/url"
 	"strings"
 )
@@ -31,12 +32,14 @@ import (
 
 import (
 	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
 	"github.com/baidu/bfe/bfe_module"
 	"github.com/baidu/bfe/bfe_util/ipdict"
 )
 
 const (
 	ModTrustClientIP = "mod_trust_clientip"
+	CtxForwardedInfo = "mod_trust_clientip.forwarded_info"
 )
 
 var (
@@ -48,6 +51,15 @@ type ModuleTrustClientIPState struct {
 	ConnTrustClientip        *metrics.Counter // connnection from trust addr
 	ConnAddrInternal         *metrics.Counter // connection from internal
 	ConnAddrInternalNotTrust *metrics.Counter // connection from internal and not trust
+	ReqRecursive             *metrics.Counter // request with client ip resolved recursively
+	ReqRecursiveInvalid      *metrics.Counter // request with invalid address found in recursive resolution
+}
+
+// ForwardedInfo is forwarded headers of incoming request.
+type ForwardedInfo struct {
+	XForwardedFor   string // value of X-Forwarded-For
+	XForwardedProto string // value of X-Forwarded-Proto
+	Forwarded       string // value of Forwarded
 }
 
 type ModuleTrustClientIP struct {
@@ -56,6 +68,11 @@ type ModuleTrustClientIP struct {
 	state      ModuleTrustClientIPState // module state
 	metrics    metrics.Metrics          // diff counter of moudle state
 	trustTable *ipdict.IPTable          // table for storing trust-ip
+
+	recursiveHeader string // header for recursive client ip resolution
+	xffPolicy       string // policy for X-Forwarded-For of outgoing request
+	protoPolicy     string // policy for X-Forwarded-Proto of outgoing request
+	forwardedPolicy string // policy for Forwarded of outgoing request
 }
 
 func NewModuleTrustClientIP() *ModuleTrustClientIP {
@@ -70,6 +87,10 @@ func (m *ModuleTrustClientIP) Name() string {
 	return m.name
 }
 
+func (m *ModuleTrustClientIP) State() interface{} {
+	return &m.state
+}
+
 func ipItemsMake(conf TrustIPConf) (*ipdict.IPItems, error) {
 	// calucate singleIPNum and pairIPNum
 	singleIPNum, pairIPNum := 0, 0
@@ -170,6 +191,133 @@ func (m *ModuleTrustClientIP) acceptHandler(session *bfe_basic.Session) int {
 	return bfe_module.BFE_HANDLER_GOON
 }
 
+// resolveClientAddr walks addresses from right to left, skipping trusted
+// addresses, to find address of client. If invalid address is found, the
+// last valid address is used.
+//
+// Params:
+//     - addrs: addresses in forwarded header, in order from client to proxy
+//     - peer: address of remote peer
+//
+// Returns:
+//     (address of client, false if invalid address is found)
+func (m *ModuleTrustClientIP) resolveClientAddr(addrs []*net.TCPAddr, peer *net.TCPAddr) (*net.TCPAddr, bool) {
+	client := peer
+	for i := len(addrs) - 1; i >= 0; i-- {
+		if addrs[i] == nil {
+			return client, false
+		}
+
+		client = addrs[i]
+		if !m.trustTable.Search(client.IP) {
+			break
+		}
+	}
+	return client, true
+}
+
+// clientAddrHandler saves forwarded headers of incoming request, and
+// resolves address of client recursively if enabled.
+func (m *ModuleTrustClientIP) clientAddrHandler(req *bfe_basic.Request) (int, *bfe_http.Response) {
+	header := req.HttpRequest.Header
+
+	if m.xffPolicy != "" || m.protoPolicy != "" || m.forwardedPolicy != "" {
+		req.SetContext(CtxForwardedInfo, &ForwardedInfo{
+			XForwardedFor:   strings.Join(header[bfe_basic.HeaderForwardedFor], ", "),
+			XForwardedProto: header.Get(bfe_basic.HeaderForwardedProto),
+			Forwarded:       strings.Join(header[bfe_basic.HeaderForwarded], ", "),
+		})
+	}
+
+	// client ip from untrusted peer is not resolved
+	if m.recursiveHeader == "" || !req.Session.IsTrustIP {
+		return bfe_module.BFE_HANDLER_GOON, nil
+	}
+
+	var addrs []*net.TCPAddr
+	if m.recursiveHeader == bfe_basic.HeaderForwarded {
+		addrs = parseForwarded(header[bfe_basic.HeaderForwarded])
+	} else {
+		addrs = parseXForwardedFor(header[bfe_basic.HeaderForwardedFor])
+	}
+
+	client, valid := m.resolveClientAddr(addrs, req.RemoteAddr)
+	req.ClientAddr = client
+	m.state.ReqRecursive.Inc(1)
+	if !valid {
+		m.state.ReqRecursiveInvalid.Inc(1)
+	}
+
+	if openDebug {
+		log.Logger.Debug("mod_trust_clientip:src ip = %s, client ip = %s, valid = %v",
+			req.RemoteAddr.IP, client.IP, valid)
+	}
+
+	return bfe_module.BFE_HANDLER_GOON, nil
+}
+
+// forwardHandler writes forwarded headers of outgoing request by policy.
+func (m *ModuleTrustClientIP) forwardHandler(req *bfe_basic.Request) int {
+	if req.OutRequest == nil {
+		return bfe_module.BFE_HANDLER_GOON
+	}
+	header := req.OutRequest.Header
+
+	// forwarded headers from untrusted peer are dropped
+	info, ok := req.GetContext(CtxForwardedInfo).(*ForwardedInfo)
+	if !ok || !req.Session.IsTrustIP {
+		info = new(ForwardedInfo)
+	}
+
+	peerIP := req.RemoteAddr.IP
+	clientIP := peerIP
+	if req.ClientAddr != nil {
+		clientIP = req.ClientAddr.IP
+	}
+	proto := "http"
+	if req.Session.IsSecure {
+		proto = "https"
+	}
+
+	switch m.xffPolicy {
+	case PolicyAppend:
+		header.Set(bfe_basic.HeaderForwardedFor, appendValue(info.XForwardedFor, peerIP.String()))
+	case PolicyReplace:
+		header.Set(bfe_basic.HeaderForwardedFor, clientIP.String())
+	case PolicyRemove:
+		header.Del(bfe_basic.HeaderForwardedFor)
+	}
+
+	switch m.protoPolicy {
+	case PolicySet:
+		if info.XForwardedProto != "" {
+			header.Set(bfe_basic.HeaderForwardedProto, info.XForwardedProto)
+		} else {
+			header.Set(bfe_basic.HeaderForwardedProto, proto)
+		}
+	case PolicyRemove:
+		header.Del(bfe_basic.HeaderForwardedProto)
+	}
+
+	switch m.forwardedPolicy {
+	case PolicyAppend:
+		header.Set(bfe_basic.HeaderForwarded, appendValue(info.Forwarded, formatForwardedElement(peerIP, proto)))
+	case PolicyReplace:
+		header.Set(bfe_basic.HeaderForwarded, formatForwardedElement(clientIP, proto))
+	case PolicyRemove:
+		header.Del(bfe_basic.HeaderForwarded)
+	}
+
+	return bfe_module.BFE_HANDLER_GOON
+}
+
+func appendValue(prior string, value string) string {
+	if prior == "" {
+		return value
+	}
+	return prior + ", " + value
+}
+
 func (m *ModuleTrustClientIP) getState(params map[string][]string) ([]byte, error) {
 	s := m.metrics.GetAll()
 	return s.Format(params)
@@ -204,6 +352,10 @@ func (m *ModuleTrustClientIP) Init(cbs *bfe_module.BfeCallbacks, whs *web_monito
 func (m *ModuleTrustClientIP) init(cfg *ConfModTrustClientIP, cbs *bfe_module.BfeCallbacks,
 	whs *web_monitor.WebHandlers) error {
 	m.configPath = cfg.Basic.DataPath
+	m.recursiveHeader = cfg.Basic.RecursiveHeader
+	m.xffPolicy = cfg.Outbound.XForwardedFor
+	m.protoPolicy = cfg.Outbound.XForwardedProto
+	m.forwardedPolicy = cfg.Outbound.Forwarded
 
 	// set debug switch
 	openDebug = cfg.Log.OpenDebug
@@ -223,6 +375,18 @@ func (m *ModuleTrustClientIP) init(cfg *ConfModTrustClientIP, cbs *bfe_module.Bf
 		return fmt.Errorf("%s.Init(): AddFilter(m.acceptHandler): %s", m.name, err.Error())
 	}
 
+	// for resolving client addr
+	err = cbs.AddFilter(bfe_module.HANDLE_BEFORE_LOCATION, m.clientAddrHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.clientAddrHandler): %s", m.name, err.Error())
+	}
+
+	// for writing forwarded headers
+	err = cbs.AddFilter(bfe_module.HANDLE_FORWARD, m.forwardHandler)
+	if err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.forwardHandler): %s", m.name, err.Error())
+	}
+
 	// register web handler for monitor
 	err = web_monitor.RegisterHandlers(whs, web_monitor.WEB_HANDLE_MONITOR, m.monitorHandlers())
 	if err != nil {
@@ -21,6 +21,7 @@ import (
 
 import (
 	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
 	"github.com/baidu/bfe/bfe_util/ipdict"
 	"github.com/baidu/bfe/bfe_util/net_util"
 )
@@ -93,3 +94,137 @@ func TestLoadConfData_case1(t *testing.T) {
 	}
 
 }
+
+func prepareModule(t *testing.T) *ModuleTrustClientIP {
+	m := NewModuleTrustClientIP()
+	m.trustTable = ipdict.NewIPTable()
+	m.configPath = "./testdata/trust_ip_1.conf"
+	if err := m.loadConfData(nil); err != nil {
+		t.Fatalf("get err from m.loadConfData():%s", err.Error())
+	}
+	return m
+}
+
+func prepareRequest(remoteIP string, trusted bool) *bfe_basic.Request {
+	req := new(bfe_basic.Request)
+	req.Session = new(bfe_basic.Session)
+	req.Session.IsTrustIP = trusted
+	req.RemoteAddr = &net.TCPAddr{IP: net.ParseIP(remoteIP), Port: 8080}
+	req.ClientAddr = req.RemoteAddr
+	req.HttpRequest = new(bfe_http.Request)
+	req.HttpRequest.Header = make(bfe_http.Header)
+	req.Context = make(map[interface{}]interface{})
+	return req
+}
+
+func TestClientAddrHandlerRecursive(t *testing.T) {
+	m := prepareModule(t)
+	m.recursiveHeader = bfe_basic.HeaderForwardedFor
+
+	cases := []struct {
+		remoteIP string
+		trusted  bool
+		xff      []string
+		clientIP string
+	}{
+		// untrusted peer
+		{"8.8.8.8", false, []string{"1.2.3.4"}, "8.8.8.8"},
+		// trusted peer without header
+		{"119.75.215.1", true, nil, "119.75.215.1"},
+		// skip trusted proxies from right to left
+		{"119.75.215.1", true, []string{"9.9.9.9, 1.2.3.4, 122.70.136.1", "127.0.0.1"}, "1.2.3.4"},
+		// all addresses are trusted
+		{"119.75.215.1", true, []string{"127.0.0.2, 122.70.136.1"}, "127.0.0.2"},
+		// stop at invalid address
+		{"119.75.215.1", true, []string{"1.2.3.4, unknown, 122.70.136.1"}, "122.70.136.1"},
+	}
+
+	for i, c := range cases {
+		req := prepareRequest(c.remoteIP, c.trusted)
+		for _, v := range c.xff {
+			req.HttpRequest.Header.Add(bfe_basic.HeaderForwardedFor, v)
+		}
+		m.clientAddrHandler(req)
+		if req.ClientAddr == nil || req.ClientAddr.IP.String() != c.clientIP {
+			t.Errorf("case %d: client ip should be %s, not %v", i, c.clientIP, req.ClientAddr)
+		}
+	}
+
+	if m.state.ReqRecursive.Get() != 4 || m.state.ReqRecursiveInvalid.Get() != 1 {
+		t.Errorf("unexpected state: %+v", m.state)
+	}
+
+	// Forwarded header
+	m.recursiveHeader = bfe_basic.HeaderForwarded
+	req := prepareRequest("119.75.215.1", true)
+	req.HttpRequest.Header.Set(bfe_basic.HeaderForwarded,
+		`for="[2001:db8::1]:4711";proto=https, for=122.70.136.1`)
+	m.clientAddrHandler(req)
+	if req.ClientAddr.String() != "[2001:db8::1]:4711" {
+		t.Errorf("client addr should be [2001:db8::1]:4711, not %v", req.ClientAddr)
+	}
+}
+
+func TestForwardHandler(t *testing.T) {
+	m := prepareModule(t)
+	m.recursiveHeader = bfe_basic.HeaderForwardedFor
+	m.xffPolicy = PolicyAppend
+	m.protoPolicy = PolicySet
+	m.forwardedPolicy = PolicyAppend
+
+	// trusted peer: forwarded headers are kept and appended
+	req := prepareRequest("119.75.215.1", true)
+	req.HttpRequest.Header.Set(bfe_basic.HeaderForwardedFor, "1.2.3.4")
+	req.HttpRequest.Header.Set(bfe_basic.HeaderForwardedProto, "https")
+	req.HttpRequest.Header.Set(bfe_basic.HeaderForwarded, "for=1.2.3.4;proto=https")
+	m.clientAddrHandler(req)
+
+	// header is changed after saved by clientAddrHandler (eg. by mod_header)
+	req.HttpRequest.Header.Set(bfe_basic.HeaderForwardedFor, "1.2.3.4, 119.75.215.1")
+	req.OutRequest = req.HttpRequest
+	m.forwardHandler(req)
+	// forwardHandler is idempotent for retry
+	m.forwardHandler(req)
+
+	header := req.OutRequest.Header
+	if v := header.Get(bfe_basic.HeaderForwardedFor); v != "1.2.3.4, 119.75.215.1" {
+		t.Errorf("unexpected X-Forwarded-For: %s", v)
+	}
+	if v := header.Get(bfe_basic.HeaderForwardedProto); v != "https" {
+		t.Errorf("unexpected X-Forwarded-Proto: %s", v)
+	}
+	if v := header.Get(bfe_basic.HeaderForwarded); v != "for=1.2.3.4;proto=https, for=119.75.215.1;proto=http" {
+		t.Errorf("unexpected Forwarded: %s", v)
+	}
+
+	// untrusted peer: forwarded headers are dropped
+	m.xffPolicy = PolicyReplace
+	m.forwardedPolicy = PolicyReplace
+	req = prepareRequest("1::1", false)
+	req.Session.IsSecure = true
+	req.HttpRequest.Header.Set(bfe_basic.HeaderForwardedFor, "1.2.3.4")
+	req.HttpRequest.Header.Set(bfe_basic.HeaderForwardedProto, "http")
+	m.clientAddrHandler(req)
+	req.OutRequest = req.HttpRequest
+	m.forwardHandler(req)
+
+	header = req.OutRequest.Header
+	if v := header.Get(bfe_basic.HeaderForwardedFor); v != "1::1" {
+		t.Errorf("unexpected X-Forwarded-For: %s", v)
+	}
+	if v := header.Get(bfe_basic.HeaderForwardedProto); v != "https" {
+		t.Errorf("unexpected X-Forwarded-Proto: %s", v)
+	}
+	if v := header.Get(bfe_basic.HeaderForwarded); v != `for="[1::1]";proto=https` {
+		t.Errorf("unexpected Forwarded: %s", v)
+	}
+
+	// remove headers
+	m.xffPolicy = PolicyRemove
+	m.protoPolicy = PolicyRemove
+	m.forwardedPolicy = PolicyRemove
+	m.forwardHandler(req)
+	if len(header) != 0 {
+		t.Errorf("forwarded headers should be removed: %v", header)
+	}
+}
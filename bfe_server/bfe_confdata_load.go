@@ -29,6 +29,8 @@ import (
 )
 
 import (
+	"github.com/baidu/bfe/bfe_basic/condition"
+	"github.com/baidu/bfe/bfe_config/bfe_cond_conf/cond_dict_conf"
 	"github.com/baidu/bfe/bfe_config/bfe_tls_conf/server_cert_conf"
 	"github.com/baidu/bfe/bfe_config/bfe_tls_conf/session_ticket_key_conf"
 	"github.com/baidu/bfe/bfe_config/bfe_tls_conf/tls_rule_conf"
@@ -267,3 +269,36 @@ func (srv *BfeServer) NameConfReload(query url.Values) error {
 
 	return bns.LoadLocalNameConf(nameConfFile)
 }
+
+// CondDictReload reloads dictionary of named conditions. Rules loaded
+// before are not affected, and should be reloaded to use new dictionary.
+// Reload fails if any named condition used by rules loaded is removed.
+func (srv *BfeServer) CondDictReload(query url.Values) error {
+	condDictFile := query.Get("path")
+	if condDictFile == "" {
+		condDictFile = srv.Config.Server.CondDictConf
+	}
+	if condDictFile == "" {
+		return fmt.Errorf("CondDictReload(): CondDictConf not set")
+	}
+
+	return srv.condDictLoad(condDictFile)
+}
+
+func (srv *BfeServer) condDictLoad(condDictFile string) error {
+	condDict, err := cond_dict_conf.CondDictConfLoad(condDictFile)
+	if err != nil {
+		log.Logger.Error("CondDictReload():cond_dict_conf.CondDictConfLoad: %s", err)
+		return err
+	}
+
+	// all named conditions are replaced at once, named conditions used by
+	// rules loaded should not be removed
+	if err := condition.UpdateCondDict(condDict.Dict); err != nil {
+		log.Logger.Error("CondDictReload():condition.UpdateCondDict: %s", err)
+		return err
+	}
+	log.Logger.Info("load condition dictionary success, version[%s]", condDict.Version)
+
+	return nil
+}
@@ -114,6 +114,7 @@ func NewBfeServer(cfg bfe_conf.BfeConfig,
 
 	// initialize counters, proxyState
 	s.serverStatus = NewServerStatus()
+	s.serverStatus.StartReqStateDiff(cfg.Server.MonitorInterval)
 
 	// initialize bufioCache
 	s.BufioCache = NewBufioCache()
@@ -319,6 +320,7 @@ func (srv *BfeServer) InitLayer4InfoFetcher() {
 }
 
 func (srv *BfeServer) InitModules(confRoot string) error {
+	srv.Modules.SetClusterInvoker(srv.ReverseProxy)
 	return srv.Modules.Init(srv.CallBacks, srv.Monitor.WebHandlers, confRoot)
 }
 
@@ -26,6 +26,7 @@ import (
 )
 
 import (
+	"github.com/baidu/bfe/bfe_basic/condition"
 	"github.com/baidu/bfe/bfe_config/bfe_conf"
 	"github.com/baidu/bfe/bfe_modules"
 )
@@ -41,6 +42,9 @@ func StartUp(cfg bfe_conf.BfeConfig, version string, confRoot string) error {
 	// set all available modules
 	bfe_modules.SetModules()
 
+	// set max size of request body peeked by condition primitives
+	condition.SetReqBodyPeekSize(cfg.ReqBodyPeek.MaxSize, productReqBodyPeekSize(cfg))
+
 	// create bfe server
 	bfeServer := NewBfeServer(cfg, lnMap, version)
 	bfeServer.InitLayer4InfoFetcher()
@@ -78,6 +82,15 @@ func StartUp(cfg bfe_conf.BfeConfig, version string, confRoot string) error {
 		return err
 	}
 
+	// load condition dictionary, which is used by rules of modules
+	if len(cfg.Server.CondDictConf) > 0 {
+		if err = bfeServer.condDictLoad(cfg.Server.CondDictConf); err != nil {
+			log.Logger.Error("StartUp(): condDictLoad():%s", err.Error())
+			return err
+		}
+		log.Logger.Info("StartUp(): condDictLoad() OK")
+	}
+
 	// initialize modules
 	err = bfeServer.InitModules(confRoot)
 	if err != nil {
@@ -117,6 +130,14 @@ func StartUp(cfg bfe_conf.BfeConfig, version string, confRoot string) error {
 	return err
 }
 
+func productReqBodyPeekSize(config bfe_conf.BfeConfig) map[string]int {
+	sizes := make(map[string]int)
+	for product, peekConf := range config.ProductReqBodyPeek {
+		sizes[product] = peekConf.MaxSize
+	}
+	return sizes
+}
+
 func createListeners(config bfe_conf.BfeConfig) (map[string]net.Listener, error) {
 	lnMap := make(map[string]net.Listener)
 	lnConf := map[string]int{
@@ -0,0 +1,102 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// invoke cluster for sub-request of modules
+
+package bfe_server
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+import (
+	bfe_cluster_backend "github.com/baidu/bfe/bfe_balance/backend"
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+)
+
+// InvokeCluster sends outreq to a backend of given cluster, which is selected
+// by balance of bfe server. No retry is done if backend fails.
+// It implements bfe_module.ClusterInvoker.
+func (p *ReverseProxy) InvokeCluster(clusterName string, req *bfe_basic.Request,
+	outreq *bfe_http.Request) (*bfe_http.Response, error) {
+	srv := p.server
+
+	// look up for cluster
+	cluster, err := srv.GetServerConf().ClusterTable.Lookup(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	transport := p.getTransport(cluster)
+
+	// look up for balance
+	bal, err := srv.balTable.Lookup(clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	// use a copy of request for balance, which may modify the request
+	balReq := *req
+	balReq.Stat = nil
+	balReq.RetryTime = 0
+
+	var backend *bfe_cluster_backend.BfeBackend
+	for i := 0; i < 20; i++ {
+		backend, err = bal.Balance(&balReq)
+		if err == bfe_basic.ErrBkCrossRetryBalance {
+			balReq.RetryTime += 1
+			continue
+		}
+		break
+	}
+	if err != nil {
+		return nil, err
+	}
+	if backend == nil {
+		return nil, fmt.Errorf("no backend for cluster %s", clusterName)
+	}
+
+	// invoke backend
+	backend.AddConnNum()
+	setBackendAddr(outreq, backend)
+
+	res, err := transport.RoundTrip(outreq)
+	if err != nil {
+		backend.DecConnNum()
+		backend.OnFail(clusterName)
+		return nil, err
+	}
+	backend.OnSuccess()
+
+	// connection num is decreased after body of response is closed by caller
+	res.Body = &invokeRespBody{ReadCloser: res.Body, backend: backend}
+
+	return res, nil
+}
+
+// invokeRespBody is body of response from InvokeCluster, which decreases
+// connection num of backend when closed.
+type invokeRespBody struct {
+	io.ReadCloser
+	backend   *bfe_cluster_backend.BfeBackend
+	closeOnce sync.Once
+}
+
+func (b *invokeRespBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.closeOnce.Do(b.backend.DecConnNum)
+	return err
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bfe_server
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+import (
+	bfe_cluster_backend "github.com/baidu/bfe/bfe_balance/backend"
+)
+
+func TestInvokeRespBodyClose(t *testing.T) {
+	backend := bfe_cluster_backend.NewBfeBackend()
+	backend.AddConnNum()
+
+	body := &invokeRespBody{
+		ReadCloser: ioutil.NopCloser(strings.NewReader("ok")),
+		backend:    backend,
+	}
+	if data, _ := ioutil.ReadAll(body); string(data) != "ok" {
+		t.Errorf("unexpected body: %s", data)
+	}
+	if backend.ConnNum() != 1 {
+		t.Errorf("conn num should not be decreased before body closed")
+	}
+
+	// conn num is decreased only once
+	body.Close()
+	body.Close()
+	if backend.ConnNum() != 0 {
+		t.Errorf("conn num should be 0 after body closed, got %d", backend.ConnNum())
+	}
+}
@@ -339,10 +339,13 @@ func (c *conn) serve() {
 			c.remoteAddr, session.Vip, tlsState.DidResume, time.Since(start).Nanoseconds()/1000)
 		proxyState.TlsHandshakeSucc.Inc(1)
 		serverStatus.ProxyHandshakeDelay.AddDuration(tlsState.HandshakeTime)
+		serverStatus.ProxyHandshakeDelayHist.ObserveDuration(tlsState.HandshakeTime)
 		if tlsState.DidResume {
 			serverStatus.ProxyHandshakeResumeDelay.AddDuration(tlsState.HandshakeTime)
+			serverStatus.ProxyHandshakeResumeDelayHist.ObserveDuration(tlsState.HandshakeTime)
 		} else {
 			serverStatus.ProxyHandshakeFullDelay.AddDuration(tlsState.HandshakeTime)
+			serverStatus.ProxyHandshakeFullDelayHist.ObserveDuration(tlsState.HandshakeTime)
 		}
 
 		// Callback for HANDLE_HANDSHAKE
@@ -556,6 +559,7 @@ func (c *conn) serveRequest(w bfe_http.ResponseWriter, request *bfe_basic.Reques
 	// modify state counters
 	session.IncReqNumActive(-1)
 	proxyState.ClientReqActiveInc(session.Proto, -1)
+	serverStatus.ReqStateUpdate(request)
 	if request.ErrCode != nil {
 		proxyState.ClientReqFail.Inc(1)
 	} else {
@@ -566,9 +570,11 @@ func (c *conn) serveRequest(w bfe_http.ResponseWriter, request *bfe_basic.Reques
 			if request.HttpRequest.ContentLength == 0 {
 				// for get/head request
 				serverStatus.ProxyDelay.AddBySub(request.Stat.ReadReqEnd, request.Stat.BackendFirst)
+				serverStatus.ProxyDelayHist.ObserveBySub(request.Stat.ReadReqEnd, request.Stat.BackendFirst)
 			} else {
 				// for post/put request
 				serverStatus.ProxyPostDelay.AddBySub(request.Stat.ReadReqEnd, request.Stat.BackendFirst)
+				serverStatus.ProxyPostDelayHist.ObserveBySub(request.Stat.ReadReqEnd, request.Stat.BackendFirst)
 			}
 		}
 	}
@@ -0,0 +1,113 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// metrics in prometheus text exposition format
+
+package bfe_server
+
+import (
+	"sort"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_module"
+	"github.com/baidu/bfe/bfe_util/prometheus"
+)
+
+// PrometheusMetricsGet returns all metrics in prometheus text exposition format.
+// It is served at /metrics of monitor port, and /monitor/metrics is kept as
+// an alias.
+func (srv *BfeServer) PrometheusMetricsGet(params map[string][]string) ([]byte, error) {
+	w := prometheus.NewWriter()
+
+	srv.writeServerStatusMetrics(w)
+	srv.writeBalTableMetrics(w)
+	srv.serverStatus.ProductReqState.WriteMetrics(w, "bfe_product", "product")
+	srv.serverStatus.ClusterReqState.WriteMetrics(w, "bfe_cluster", "cluster")
+	srv.writeModuleMetrics(w)
+
+	return w.Bytes(), nil
+}
+
+// writeServerStatusMetrics writes protocol/proxy/balance state and delay histograms.
+func (srv *BfeServer) writeServerStatusMetrics(w *prometheus.Writer) {
+	s := srv.serverStatus
+
+	w.WriteState("bfe_proxy_state", s.ProxyState)
+	w.WriteState("bfe_bal_state", s.BalState)
+	w.WriteState("bfe_tls_state", s.TlsState)
+	w.WriteState("bfe_spdy_state", s.SpdyState)
+	w.WriteState("bfe_http2_state", s.Http2State)
+	w.WriteState("bfe_http_state", s.HttpState)
+	w.WriteState("bfe_stream_state", s.StreamState)
+	w.WriteState("bfe_websocket_state", s.WebSocketState)
+
+	w.WriteHistogram("bfe_proxy_delay_seconds",
+		"Delay from reading request to connecting backend, for request without body",
+		s.ProxyDelayHist)
+	w.WriteHistogram("bfe_proxy_post_delay_seconds",
+		"Delay from reading request to connecting backend, for request with body",
+		s.ProxyPostDelayHist)
+	w.WriteHistogram("bfe_proxy_handshake_delay_seconds",
+		"Delay of tls handshake", s.ProxyHandshakeDelayHist)
+	w.WriteHistogram("bfe_proxy_handshake_full_delay_seconds",
+		"Delay of tls full handshake", s.ProxyHandshakeFullDelayHist)
+	w.WriteHistogram("bfe_proxy_handshake_resume_delay_seconds",
+		"Delay of tls resume handshake", s.ProxyHandshakeResumeDelayHist)
+}
+
+// writeBalTableMetrics writes number of backends for each cluster and sub-cluster.
+func (srv *BfeServer) writeBalTableMetrics(w *prometheus.Writer) {
+	state := srv.balTable.GetState()
+
+	w.WriteGauge("bfe_bal_table_backend_num", "Number of backends in BalTable",
+		float64(state.BackendNum))
+
+	clusters := make([]string, 0, len(state.Balancers))
+	for name := range state.Balancers {
+		clusters = append(clusters, name)
+	}
+	sort.Strings(clusters)
+
+	for _, cluster := range clusters {
+		w.WriteGauge("bfe_bal_cluster_backend_num", "Number of backends in cluster",
+			float64(state.Balancers[cluster].BackendNum),
+			prometheus.Label{Name: "cluster", Value: cluster})
+	}
+
+	for _, cluster := range clusters {
+		subClusters := state.Balancers[cluster].SubClusters
+		names := make([]string, 0, len(subClusters))
+		for name := range subClusters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			w.WriteGauge("bfe_bal_subcluster_backend_num", "Number of backends in sub-cluster",
+				float64(subClusters[name].BackendNum),
+				prometheus.Label{Name: "cluster", Value: cluster},
+				prometheus.Label{Name: "subcluster", Value: name})
+		}
+	}
+}
+
+// writeModuleMetrics writes state of enabled modules.
+func (srv *BfeServer) writeModuleMetrics(w *prometheus.Writer) {
+	for _, module := range srv.Modules.ModulesEnabled() {
+		if m, ok := module.(bfe_module.BfeModuleState); ok {
+			w.WriteState("bfe_"+module.Name(), m.State())
+		}
+	}
+}
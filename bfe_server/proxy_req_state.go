@@ -0,0 +1,295 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// request state for each product or cluster
+
+package bfe_server
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_util/prometheus"
+)
+
+// ReqStateData is request state for a product or cluster.
+type ReqStateData struct {
+	ReqTotal     int64                    // all requests
+	ReqFail      int64                    // requests with ErrCode != nil
+	Status1xx    int64                    // responses with status code 1xx
+	Status2xx    int64                    // responses with status code 2xx
+	Status3xx    int64                    // responses with status code 3xx
+	Status4xx    int64                    // responses with status code 4xx
+	Status5xx    int64                    // responses with status code 5xx
+	ErrCodes     map[string]int64         // requests for each error code
+	BackendDelay prometheus.HistogramData // delay of last backend (in second)
+	ClusterDelay prometheus.HistogramData // delay of cluster, including retries (in second)
+}
+
+// Sub returns d - last.
+func (d *ReqStateData) Sub(last *ReqStateData) *ReqStateData {
+	diff := &ReqStateData{
+		ReqTotal:     d.ReqTotal - last.ReqTotal,
+		ReqFail:      d.ReqFail - last.ReqFail,
+		Status1xx:    d.Status1xx - last.Status1xx,
+		Status2xx:    d.Status2xx - last.Status2xx,
+		Status3xx:    d.Status3xx - last.Status3xx,
+		Status4xx:    d.Status4xx - last.Status4xx,
+		Status5xx:    d.Status5xx - last.Status5xx,
+		ErrCodes:     make(map[string]int64),
+		BackendDelay: d.BackendDelay.Sub(last.BackendDelay),
+		ClusterDelay: d.ClusterDelay.Sub(last.ClusterDelay),
+	}
+	for errCode, count := range d.ErrCodes {
+		diff.ErrCodes[errCode] = count - last.ErrCodes[errCode]
+	}
+	return diff
+}
+
+type reqState struct {
+	reqTotal int64
+	reqFail  int64
+	status   [6]int64 // counters for 1xx-5xx, index by code/100
+
+	lock     sync.Mutex
+	errCodes map[string]int64
+
+	backendDelay *prometheus.Histogram
+	clusterDelay *prometheus.Histogram
+}
+
+func newReqState() *reqState {
+	s := new(reqState)
+	s.errCodes = make(map[string]int64)
+	s.backendDelay = prometheus.NewDelayHistogram()
+	s.clusterDelay = prometheus.NewDelayHistogram()
+	return s
+}
+
+func (s *reqState) update(req *bfe_basic.Request) {
+	atomic.AddInt64(&s.reqTotal, 1)
+
+	index := reqStatusCode(req) / 100
+	if index >= 1 && index <= 5 {
+		atomic.AddInt64(&s.status[index], 1)
+	}
+
+	if req.ErrCode != nil {
+		atomic.AddInt64(&s.reqFail, 1)
+		s.lock.Lock()
+		s.errCodes[req.ErrCode.Error()]++
+		s.lock.Unlock()
+	}
+
+	stat := req.Stat
+	if stat == nil {
+		return
+	}
+	if !stat.BackendStart.IsZero() && !stat.BackendEnd.IsZero() {
+		s.backendDelay.ObserveBySub(stat.BackendStart, stat.BackendEnd)
+	}
+	if !stat.ClusterStart.IsZero() && !stat.ClusterEnd.IsZero() {
+		s.clusterDelay.ObserveBySub(stat.ClusterStart, stat.ClusterEnd)
+	}
+}
+
+// reqStatusCode returns status code of response to client.
+func reqStatusCode(req *bfe_basic.Request) int {
+	// BfeStatusCode is set if response is made by bfe directly (e.g. redirect),
+	// which replaces the response from backend
+	if req.BfeStatusCode != 0 {
+		return req.BfeStatusCode
+	}
+	if req.HttpResponse != nil {
+		return req.HttpResponse.StatusCode
+	}
+	return 0
+}
+
+func (s *reqState) get() *ReqStateData {
+	d := &ReqStateData{
+		ReqTotal:     atomic.LoadInt64(&s.reqTotal),
+		ReqFail:      atomic.LoadInt64(&s.reqFail),
+		Status1xx:    atomic.LoadInt64(&s.status[1]),
+		Status2xx:    atomic.LoadInt64(&s.status[2]),
+		Status3xx:    atomic.LoadInt64(&s.status[3]),
+		Status4xx:    atomic.LoadInt64(&s.status[4]),
+		Status5xx:    atomic.LoadInt64(&s.status[5]),
+		ErrCodes:     make(map[string]int64),
+		BackendDelay: s.backendDelay.Get(),
+		ClusterDelay: s.clusterDelay.Get(),
+	}
+
+	s.lock.Lock()
+	for errCode, count := range s.errCodes {
+		d.ErrCodes[errCode] = count
+	}
+	s.lock.Unlock()
+
+	return d
+}
+
+// ReqStateTable holds request state for each product or cluster.
+type ReqStateTable struct {
+	lock   sync.RWMutex
+	states map[string]*reqState // key => state
+
+	diffLock sync.Mutex
+	last     map[string]*ReqStateData // state at the end of last interval
+	diff     map[string]*ReqStateData // diff of state in last interval
+}
+
+func NewReqStateTable() *ReqStateTable {
+	t := new(ReqStateTable)
+	t.states = make(map[string]*reqState)
+	t.last = make(map[string]*ReqStateData)
+	t.diff = make(map[string]*ReqStateData)
+	return t
+}
+
+// Update updates state of given key with finished request.
+func (t *ReqStateTable) Update(key string, req *bfe_basic.Request) {
+	if len(key) == 0 {
+		return
+	}
+
+	t.lock.RLock()
+	s, ok := t.states[key]
+	t.lock.RUnlock()
+
+	if !ok {
+		t.lock.Lock()
+		if s, ok = t.states[key]; !ok {
+			s = newReqState()
+			t.states[key] = s
+		}
+		t.lock.Unlock()
+	}
+
+	s.update(req)
+}
+
+// GetAll returns state for all keys.
+func (t *ReqStateTable) GetAll() map[string]*ReqStateData {
+	t.lock.RLock()
+	states := make(map[string]*reqState, len(t.states))
+	for key, s := range t.states {
+		states[key] = s
+	}
+	t.lock.RUnlock()
+
+	data := make(map[string]*ReqStateData, len(states))
+	for key, s := range states {
+		data[key] = s.get()
+	}
+	return data
+}
+
+// GetDiff returns diff of state in last interval.
+func (t *ReqStateTable) GetDiff() map[string]*ReqStateData {
+	t.diffLock.Lock()
+	defer t.diffLock.Unlock()
+	return t.diff
+}
+
+// UpdateDiff calculates diff between current state and state of last time.
+func (t *ReqStateTable) UpdateDiff() {
+	curr := t.GetAll()
+
+	diff := make(map[string]*ReqStateData, len(curr))
+	t.diffLock.Lock()
+	for key, d := range curr {
+		last, ok := t.last[key]
+		if !ok {
+			last = new(ReqStateData)
+		}
+		diff[key] = d.Sub(last)
+	}
+	t.last = curr
+	t.diff = diff
+	t.diffLock.Unlock()
+}
+
+// StartDiff updates diff of state periodically.
+func (t *ReqStateTable) StartDiff(interval time.Duration) {
+	go func() {
+		for {
+			// align to interval, e.g. 00:00:20, 00:00:40, ...
+			now := time.Now()
+			time.Sleep(now.Truncate(interval).Add(interval).Sub(now))
+			t.UpdateDiff()
+		}
+	}()
+}
+
+// WriteMetrics writes state in prometheus format.
+//
+// Params:
+//     - w: writer for prometheus metrics
+//     - prefix: prefix of metric name, e.g. "bfe_product"
+//     - label: label name of key, e.g. "product"
+func (t *ReqStateTable) WriteMetrics(w *prometheus.Writer, prefix string, label string) {
+	data := t.GetAll()
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		w.WriteCounter(prefix+"_req_total", "Number of requests", data[key].ReqTotal,
+			prometheus.Label{Name: label, Value: key})
+	}
+
+	for _, key := range keys {
+		d := data[key]
+		counts := []int64{d.Status1xx, d.Status2xx, d.Status3xx, d.Status4xx, d.Status5xx}
+		for i, count := range counts {
+			w.WriteCounter(prefix+"_resp_total", "Number of responses by status code class", count,
+				prometheus.Label{Name: label, Value: key},
+				prometheus.Label{Name: "code", Value: string('1'+byte(i)) + "xx"})
+		}
+	}
+
+	for _, key := range keys {
+		d := data[key]
+		errCodes := make([]string, 0, len(d.ErrCodes))
+		for errCode := range d.ErrCodes {
+			errCodes = append(errCodes, errCode)
+		}
+		sort.Strings(errCodes)
+
+		for _, errCode := range errCodes {
+			w.WriteCounter(prefix+"_req_err_total", "Number of requests by error code",
+				d.ErrCodes[errCode],
+				prometheus.Label{Name: label, Value: key},
+				prometheus.Label{Name: "err_code", Value: errCode})
+		}
+	}
+
+	for _, key := range keys {
+		w.WriteHistogramData(prefix+"_backend_delay_seconds", "Delay of last backend",
+			data[key].BackendDelay, prometheus.Label{Name: label, Value: key})
+	}
+
+	for _, key := range keys {
+		w.WriteHistogramData(prefix+"_cluster_delay_seconds", "Delay of cluster, including retries",
+			data[key].ClusterDelay, prometheus.Label{Name: label, Value: key})
+	}
+}
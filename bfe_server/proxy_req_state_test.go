@@ -0,0 +1,149 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bfe_server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_basic"
+	"github.com/baidu/bfe/bfe_http"
+	"github.com/baidu/bfe/bfe_util/prometheus"
+)
+
+func prepareReqStateRequest(statusCode int, errCode error) *bfe_basic.Request {
+	req := new(bfe_basic.Request)
+	req.Route.Product = "p1"
+	req.Backend.ClusterName = "c1"
+	req.ErrCode = errCode
+	if statusCode > 0 {
+		req.HttpResponse = &bfe_http.Response{StatusCode: statusCode}
+	}
+
+	start := time.Now()
+	req.Stat = bfe_basic.NewRequestStat(start)
+	req.Stat.ClusterStart = start
+	req.Stat.BackendStart = start
+	req.Stat.BackendEnd = start.Add(30 * time.Millisecond)
+	req.Stat.ClusterEnd = start.Add(30 * time.Millisecond)
+	return req
+}
+
+func TestReqStateTable(t *testing.T) {
+	status := NewServerStatus()
+	status.ReqStateUpdate(prepareReqStateRequest(200, nil))
+	status.ReqStateUpdate(prepareReqStateRequest(502, nil))
+	status.ReqStateUpdate(prepareReqStateRequest(0, bfe_basic.ErrBkConnectBackend))
+
+	for _, table := range []*ReqStateTable{status.ProductReqState, status.ClusterReqState} {
+		data := table.GetAll()
+		if len(data) != 1 {
+			t.Fatalf("state should contain 1 key, got %v", data)
+		}
+		for _, d := range data {
+			if d.ReqTotal != 3 || d.ReqFail != 1 || d.Status2xx != 1 || d.Status5xx != 1 {
+				t.Errorf("unexpected state: %+v", d)
+			}
+			if d.ErrCodes["BK_CONNECT_BACKEND"] != 1 {
+				t.Errorf("unexpected error codes: %v", d.ErrCodes)
+			}
+			if d.BackendDelay.Count != 3 {
+				t.Errorf("unexpected backend delay: %+v", d.BackendDelay)
+			}
+		}
+	}
+}
+
+func TestReqStateInternalResp(t *testing.T) {
+	status := NewServerStatus()
+
+	// failed to find product, internal error response is created
+	req := prepareReqStateRequest(0, bfe_basic.ErrBkFindProduct)
+	req.Route.Product = ""
+	req.Backend.ClusterName = ""
+	bfe_basic.CreateInternalSrvErrResp(req)
+	status.ReqStateUpdate(req)
+
+	// finish by module, without response
+	req = prepareReqStateRequest(0, nil)
+	req.BfeStatusCode = bfe_http.StatusInternalServerError
+	status.ReqStateUpdate(req)
+
+	// redirect by module
+	req = prepareReqStateRequest(0, nil)
+	req.BfeStatusCode = bfe_http.StatusFound
+	status.ReqStateUpdate(req)
+
+	// redirect by module after response from backend
+	req = prepareReqStateRequest(200, nil)
+	req.BfeStatusCode = bfe_http.StatusMovedPermanently
+	status.ReqStateUpdate(req)
+
+	d := status.ProductReqState.GetAll()[REQ_STATE_UNKNOWN_PRODUCT]
+	if d == nil || d.ReqTotal != 1 || d.Status5xx != 1 || d.ErrCodes["BK_FIND_PRODUCT"] != 1 {
+		t.Errorf("unexpected state of unknown product: %+v", d)
+	}
+
+	d = status.ProductReqState.GetAll()["p1"]
+	if d == nil || d.ReqTotal != 3 || d.Status5xx != 1 || d.Status3xx != 2 || d.Status2xx != 0 {
+		t.Errorf("unexpected state of product: %+v", d)
+	}
+
+	if _, ok := status.ClusterReqState.GetAll()[""]; ok {
+		t.Errorf("request without cluster should not be counted for cluster")
+	}
+}
+
+func TestReqStateTableDiff(t *testing.T) {
+	table := NewReqStateTable()
+	table.Update("p1", prepareReqStateRequest(200, nil))
+	table.UpdateDiff()
+	table.Update("p1", prepareReqStateRequest(404, nil))
+	table.Update("p1", prepareReqStateRequest(200, nil))
+	table.UpdateDiff()
+
+	diff := table.GetDiff()["p1"]
+	if diff.ReqTotal != 2 || diff.Status2xx != 1 || diff.Status4xx != 1 {
+		t.Errorf("unexpected diff: %+v", diff)
+	}
+	if diff.ClusterDelay.Count != 2 {
+		t.Errorf("unexpected cluster delay diff: %+v", diff.ClusterDelay)
+	}
+}
+
+func TestReqStateTableWriteMetrics(t *testing.T) {
+	table := NewReqStateTable()
+	table.Update("p1", prepareReqStateRequest(200, nil))
+	table.Update("p1", prepareReqStateRequest(0, bfe_basic.ErrBkNoBackend))
+
+	w := prometheus.NewWriter()
+	table.WriteMetrics(w, "bfe_product", "product")
+	out := string(w.Bytes())
+
+	expects := []string{
+		"bfe_product_req_total{product=\"p1\"} 2\n",
+		"bfe_product_resp_total{product=\"p1\",code=\"2xx\"} 1\n",
+		"bfe_product_req_err_total{product=\"p1\",err_code=\"BK_NO_BACKEND\"} 1\n",
+		"bfe_product_backend_delay_seconds_count{product=\"p1\"} 2\n",
+	}
+	for _, expect := range expects {
+		if !strings.Contains(out, expect) {
+			t.Errorf("output should contain %q, got:\n%s", expect, out)
+		}
+	}
+}
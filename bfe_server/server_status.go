@@ -16,6 +16,11 @@
 
 package bfe_server
 
+import (
+	"encoding/json"
+	"time"
+)
+
 import (
 	"github.com/baidu/go-lib/web-monitor/delay_counter"
 	"github.com/baidu/go-lib/web-monitor/metrics"
@@ -23,12 +28,14 @@ import (
 
 import (
 	bal "github.com/baidu/bfe/bfe_balance/bal_gslb"
+	"github.com/baidu/bfe/bfe_basic"
 	"github.com/baidu/bfe/bfe_http"
 	"github.com/baidu/bfe/bfe_http2"
 	"github.com/baidu/bfe/bfe_module"
 	"github.com/baidu/bfe/bfe_spdy"
 	"github.com/baidu/bfe/bfe_stream"
 	"github.com/baidu/bfe/bfe_tls"
+	"github.com/baidu/bfe/bfe_util/prometheus"
 	"github.com/baidu/bfe/bfe_websocket"
 )
 
@@ -40,6 +47,12 @@ const (
 	DC_BUCKET_NUM        = 10  // number of delay counter bucket
 )
 
+// setting for request state of product/cluster
+const (
+	REQ_STATE_DIFF_INTERVAL   = 20        // default interval for getting diff (in s)
+	REQ_STATE_UNKNOWN_PRODUCT = "unknown" // key for request without product
+)
+
 // key prefix
 const (
 	KP_PROXY_DELAY                  = "proxy_delay"
@@ -93,6 +106,17 @@ type ServerStatus struct {
 	ProxyHandshakeDelay       *delay_counter.DelayRecent
 	ProxyHandshakeFullDelay   *delay_counter.DelayRecent
 	ProxyHandshakeResumeDelay *delay_counter.DelayRecent
+
+	// histograms for delay, exported in prometheus format
+	ProxyDelayHist                *prometheus.Histogram
+	ProxyPostDelayHist            *prometheus.Histogram
+	ProxyHandshakeDelayHist       *prometheus.Histogram
+	ProxyHandshakeFullDelayHist   *prometheus.Histogram
+	ProxyHandshakeResumeDelayHist *prometheus.Histogram
+
+	// for request state of each product/cluster
+	ProductReqState *ReqStateTable
+	ClusterReqState *ReqStateTable
 }
 
 func NewServerStatus() *ServerStatus {
@@ -137,9 +161,45 @@ func NewServerStatus() *ServerStatus {
 	m.ProxyHandshakeFullDelay.SetKeyPrefix(KP_PROXY_HANDSHAKE_FULL_DELAY)
 	m.ProxyHandshakeResumeDelay.SetKeyPrefix(KP_PROXY_HANDSHAKE_RESUME_DELAY)
 
+	// initialize delay histogram
+	m.ProxyDelayHist = prometheus.NewDelayHistogram()
+	m.ProxyPostDelayHist = prometheus.NewDelayHistogram()
+	m.ProxyHandshakeDelayHist = prometheus.NewDelayHistogram()
+	m.ProxyHandshakeFullDelayHist = prometheus.NewDelayHistogram()
+	m.ProxyHandshakeResumeDelayHist = prometheus.NewDelayHistogram()
+
+	// initialize request state of product/cluster
+	m.ProductReqState = NewReqStateTable()
+	m.ClusterReqState = NewReqStateTable()
+
 	return m
 }
 
+// ReqStateUpdate updates request state of product and cluster.
+func (m *ServerStatus) ReqStateUpdate(req *bfe_basic.Request) {
+	// request without product (e.g. failed to find product) is also counted
+	product := req.Route.Product
+	if len(product) == 0 {
+		product = REQ_STATE_UNKNOWN_PRODUCT
+	}
+	m.ProductReqState.Update(product, req)
+
+	cluster := req.Backend.ClusterName
+	if len(cluster) == 0 {
+		cluster = req.Route.ClusterName
+	}
+	m.ClusterReqState.Update(cluster, req)
+}
+
+// StartReqStateDiff starts calculating diff of request state periodically.
+func (m *ServerStatus) StartReqStateDiff(interval int) {
+	if interval <= 0 {
+		interval = REQ_STATE_DIFF_INTERVAL
+	}
+	m.ProductReqState.StartDiff(time.Duration(interval) * time.Second)
+	m.ClusterReqState.StartDiff(time.Duration(interval) * time.Second)
+}
+
 func (srv *BfeServer) tlsStateGetAll(params map[string][]string) ([]byte, error) {
 	s := srv.serverStatus.TlsMetrics.GetAll()
 	return s.Format(params)
@@ -220,6 +280,22 @@ func (srv *BfeServer) balStateGetDiff(params map[string][]string) ([]byte, error
 	return s.Format(params)
 }
 
+func (srv *BfeServer) productStateGetAll(params map[string][]string) ([]byte, error) {
+	return json.Marshal(srv.serverStatus.ProductReqState.GetAll())
+}
+
+func (srv *BfeServer) productStateGetDiff(params map[string][]string) ([]byte, error) {
+	return json.Marshal(srv.serverStatus.ProductReqState.GetDiff())
+}
+
+func (srv *BfeServer) clusterStateGetAll(params map[string][]string) ([]byte, error) {
+	return json.Marshal(srv.serverStatus.ClusterReqState.GetAll())
+}
+
+func (srv *BfeServer) clusterStateGetDiff(params map[string][]string) ([]byte, error) {
+	return json.Marshal(srv.serverStatus.ClusterReqState.GetDiff())
+}
+
 func (srv *BfeServer) proxyDelayGet(params map[string][]string) ([]byte, error) {
 	d := srv.serverStatus.ProxyDelay
 	return d.FormatOutput(params)
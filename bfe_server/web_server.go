@@ -17,18 +17,40 @@
 package bfe_server
 
 import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/baidu/go-lib/gotrack"
 	"github.com/baidu/go-lib/log"
 	"github.com/baidu/go-lib/web-monitor/web_monitor"
 )
 
+import (
+	"github.com/baidu/bfe/bfe_module"
+	"github.com/baidu/bfe/bfe_util/prometheus"
+)
+
 type BfeMonitor struct {
-	WebServer   *web_monitor.MonitorServer
 	WebHandlers *web_monitor.WebHandlers
 	srv         *BfeServer
+
+	port      int       // port for listen
+	version   string    // version of bfe
+	startAt   string    // start time of web server
+	startOnce sync.Once // web server is started only once
 }
 
 func newBfeMonitor(srv *BfeServer, monitorPort int) (*BfeMonitor, error) {
-	m := &BfeMonitor{nil, nil, srv}
+	m := &BfeMonitor{srv: srv, port: monitorPort, version: srv.Version}
 
 	// initialize web handlers
 	m.WebHandlers = web_monitor.NewWebHandlers()
@@ -37,10 +59,6 @@ func newBfeMonitor(srv *BfeServer, monitorPort int) (*BfeMonitor, error) {
 		return nil, err
 	}
 
-	// initialize web server
-	m.WebServer = web_monitor.NewMonitorServer("bfe", srv.Version, monitorPort)
-	m.WebServer.HandlersSet(m.WebHandlers)
-
 	return m, nil
 }
 
@@ -62,6 +80,12 @@ func (m *BfeMonitor) monitorHandlers() map[string]interface{} {
 		"proxy_state":      m.srv.proxyStateGetAll,
 		"proxy_state_diff": m.srv.proxyStateGetDiff,
 
+		// for request state of each product/cluster
+		"proxy_product_state":      m.srv.productStateGetAll,
+		"proxy_product_state_diff": m.srv.productStateGetDiff,
+		"proxy_cluster_state":      m.srv.clusterStateGetAll,
+		"proxy_cluster_state_diff": m.srv.clusterStateGetDiff,
+
 		// for balance
 		"bal_state":      m.srv.balStateGetAll,
 		"bal_state_diff": m.srv.balStateGetDiff,
@@ -103,6 +127,9 @@ func (m *BfeMonitor) monitorHandlers() map[string]interface{} {
 		"module_status": m.srv.ModuleStatusGetJson,
 		// for proxy memory stat
 		"proxy_mem_stat": web_monitor.CreateMemStatsHandler("proxy_mem_stat"),
+
+		// for all metrics in prometheus format, alias of /metrics
+		"metrics": m.srv.PrometheusMetricsGet,
 	}
 	return handlers
 }
@@ -119,6 +146,9 @@ func (m *BfeMonitor) reloadHandlers() map[string]interface{} {
 		// for name conf
 		"name_conf": m.srv.NameConfReload,
 
+		// for condition dictionary
+		"cond_dict": m.srv.CondDictReload,
+
 		// for tls
 		"tls_conf":               m.srv.TLSConfReload,
 		"tls_session_ticket_key": m.srv.SessionTicketKeyReload,
@@ -144,6 +174,222 @@ func (m *BfeMonitor) WebHandlersInit(srv *BfeServer) error {
 	return nil
 }
 
+// apiTokenSet passes api token in request header to web handlers by query
+// param, which is the only input of web handlers. Token in query string is
+// removed, since query string may be recorded in logs.
+func apiTokenSet(r *http.Request) {
+	query := r.URL.Query()
+	query.Del(bfe_module.ApiTokenParam)
+	if token := r.Header.Get(bfe_module.ApiTokenHeader); len(token) != 0 {
+		query.Set(bfe_module.ApiTokenParam, token)
+	}
+	r.URL.RawQuery = query.Encode()
+}
+
+// apiTokenMiddleware sets api token before request is served by next.
+func apiTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiTokenSet(r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isValidForReload checks whether remote address is valid for doing reload
+func isValidForReload(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	return web_monitor.RELOAD_SRC_ALLOWED[host]
+}
+
+// subManualShow shows sub manual (monitor/reload)
+func (m *BfeMonitor) subManualShow(hType int, typeStr string) []byte {
+	commands := make([]string, 0)
+	for command := range *m.WebHandlers.Handlers[hType] {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+
+	str := "<html>\n<body>\n"
+	str += fmt.Sprintf("<p>%s manual for bfe</p>\n", typeStr)
+	str += fmt.Sprintf("<p>version: %s</p>\n", m.version)
+	str += fmt.Sprintf("<p>start_at: %s</p>\n", m.startAt)
+	for _, command := range commands {
+		str += fmt.Sprintf("<p><a href=\"/%s/%s\">%s</a></p>\n", typeStr, command, command)
+	}
+	str += "</body></html>"
+
+	return []byte(str)
+}
+
+// manualShow shows manual of web server
+func (m *BfeMonitor) manualShow() []byte {
+	str := "<html>\n<body>\n"
+	str += "<p>Welcome to bfe</p>\n"
+	str += fmt.Sprintf("<p>version: %s</p>\n", m.version)
+	str += fmt.Sprintf("<p>start_at: %s</p>\n", m.startAt)
+	str += "<p><a href=\"/monitor\">monitor</a></p>\n"
+	str += "<p><a href=\"/reload\">reload</a></p>\n"
+	str += "</body></html>"
+
+	return []byte(str)
+}
+
+func (m *BfeMonitor) monitorHandler(command string, params url.Values) (buff []byte, err error) {
+	defer func() {
+		if perr := recover(); perr != nil {
+			err = fmt.Errorf("monitor panic:%v", perr)
+			log.Logger.Warn("BfeMonitor.monitorHandler():%v\n%s", perr, gotrack.CurrentStackTrace(0))
+		}
+	}()
+
+	f, err := m.WebHandlers.GetHandler(web_monitor.WEB_HANDLE_MONITOR, command)
+	if err != nil {
+		return nil, err
+	}
+
+	switch f := f.(type) {
+	case func() ([]byte, error):
+		return f()
+	case func(map[string][]string) ([]byte, error):
+		return f(params)
+	case func(url.Values) ([]byte, error):
+		return f(params)
+	}
+
+	return nil, fmt.Errorf("invalid handler for monitor [%s]", command)
+}
+
+func (m *BfeMonitor) reloadHandler(command string, params url.Values,
+	remoteAddr string) (buff []byte, err error) {
+	var version string
+
+	defer func() {
+		if perr := recover(); perr != nil {
+			err = fmt.Errorf("reload panic:%v", perr)
+			log.Logger.Warn("BfeMonitor.reloadHandler():%v\n%s", perr, gotrack.CurrentStackTrace(0))
+		}
+	}()
+
+	// check source address
+	if !isValidForReload(remoteAddr) {
+		log.Logger.Warn("BfeMonitor.reloadHandler(): blocked reload request from [%s], cmd=[%s]",
+			remoteAddr, command)
+		return nil, fmt.Errorf("reload is not allowed from [%s]", remoteAddr)
+	}
+
+	f, err := m.WebHandlers.GetHandler(web_monitor.WEB_HANDLE_RELOAD, command)
+	if err != nil {
+		return nil, err
+	}
+
+	switch f := f.(type) {
+	case func() error:
+		err = f()
+	case func(map[string][]string) error:
+		err = f(params)
+	case func(url.Values) error:
+		err = f(params)
+	case func(url.Values) (string, error):
+		version, err = f(params)
+	default:
+		err = fmt.Errorf("invalid handler for reload [%s]", command)
+	}
+
+	// params are not logged, since they may contain api token
+	if err != nil {
+		log.Logger.Error("BfeMonitor.reloadHandler(): cmd=[%s], from [%s], err=[%s]",
+			command, remoteAddr, err.Error())
+		return nil, err
+	}
+	log.Logger.Info("BfeMonitor.reloadHandler(): cmd=[%s], from [%s]", command, remoteAddr)
+
+	if version != "" {
+		return []byte(fmt.Sprintf("{\"error\":null,\"version\":%q}", version)), nil
+	}
+	return []byte("{\"error\":null}"), nil
+}
+
+// webHandler serves requests for monitor and reload, with path like:
+//     /monitor/host_table_status
+//     /reload/server_data_conf
+func (m *BfeMonitor) webHandler(w http.ResponseWriter, r *http.Request) {
+	var buff []byte
+	var err error
+	var commands []string
+
+	if path := r.URL.Path[1:]; len(path) != 0 {
+		commands = strings.SplitN(path, "/", 2)
+	}
+	params := r.URL.Query()
+
+	switch len(commands) {
+	case 1:
+		switch commands[0] {
+		case "monitor":
+			buff = m.subManualShow(web_monitor.WEB_HANDLE_MONITOR, "monitor")
+		case "reload":
+			buff = m.subManualShow(web_monitor.WEB_HANDLE_RELOAD, "reload")
+		default:
+			err = fmt.Errorf("invalid command [%s]", commands[0])
+		}
+	case 2:
+		switch commands[0] {
+		case "monitor":
+			buff, err = m.monitorHandler(commands[1], params)
+		case "reload":
+			buff, err = m.reloadHandler(commands[1], params, r.RemoteAddr)
+		default:
+			err = fmt.Errorf("invalid command [%s]", commands[0])
+		}
+	default:
+		buff = m.manualShow()
+	}
+
+	if err != nil {
+		buff = []byte(fmt.Sprintf("{\"error\":%q}", err.Error()))
+	}
+	w.Write(buff)
+}
+
+// metricsHandler serves all metrics in prometheus text exposition format.
+func (m *BfeMonitor) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	buff, err := m.srv.PrometheusMetricsGet(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", prometheus.ContentType)
+	w.Write(buff)
+}
+
+// serveMux returns handlers of web server.
+func (m *BfeMonitor) serveMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", m.metricsHandler)
+	mux.Handle("/", apiTokenMiddleware(http.HandlerFunc(m.webHandler)))
+	return mux
+}
+
+// Start starts web server in background. Web server is started only once,
+// even if Start is called more than once.
 func (m *BfeMonitor) Start() {
-	go m.WebServer.Start()
+	m.startOnce.Do(func() {
+		m.startAt = time.Now().Format("2006-01-02 15:04:05")
+		mux := m.serveMux()
+		go m.listenAndServe(mux)
+	})
+}
+
+func (m *BfeMonitor) listenAndServe(handler http.Handler) {
+	log.Logger.Info("BfeMonitor: web server start at port[%d]", m.port)
+
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", m.port), handler); err != nil {
+		log.Logger.Error("BfeMonitor: err in http.ListenAndServe(): %s", err.Error())
+		// wait for log flushed
+		time.Sleep(1 * time.Second)
+		os.Exit(1)
+	}
 }
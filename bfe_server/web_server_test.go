@@ -0,0 +1,126 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bfe_server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+)
+
+import (
+	"github.com/baidu/bfe/bfe_config/bfe_conf"
+)
+
+func TestApiTokenSet(t *testing.T) {
+	cases := []struct {
+		url    string
+		header string
+		query  string
+	}{
+		// token in header is passed by query
+		{"/reload/mod_block.runtime_ip_del?ip=10.0.0.1", "t1", "ip=10.0.0.1&token=t1"},
+		// token in query is ignored
+		{"/reload/mod_block.runtime_ip_del?ip=10.0.0.1&token=t2", "", "ip=10.0.0.1"},
+		{"/monitor/mod_block.runtime_ip_table?token=t2", "t1", "token=t1"},
+	}
+
+	for _, c := range cases {
+		r, _ := http.NewRequest("GET", c.url, nil)
+		if c.header != "" {
+			r.Header.Set("X-Bfe-Api-Token", c.header)
+		}
+		apiTokenSet(r)
+		if r.URL.RawQuery != c.query {
+			t.Errorf("apiTokenSet(%s) got %s, want %s", c.url, r.URL.RawQuery, c.query)
+		}
+	}
+}
+
+func TestServeMux(t *testing.T) {
+	m := &BfeMonitor{WebHandlers: web_monitor.NewWebHandlers()}
+	m.WebHandlers.RegisterHandler(web_monitor.WEB_HANDLE_MONITOR, "token",
+		func(params url.Values) ([]byte, error) {
+			return []byte(params.Get("token")), nil
+		})
+	m.WebHandlers.RegisterHandler(web_monitor.WEB_HANDLE_RELOAD, "token",
+		func(params url.Values) error {
+			return nil
+		})
+	mux := m.serveMux()
+
+	cases := []struct {
+		url        string
+		remoteAddr string
+		header     string
+		body       string
+	}{
+		// token in header is passed to handler
+		{"/monitor/token", "127.0.0.1:8000", "t1", "t1"},
+		// token in query is ignored
+		{"/monitor/token?token=t2", "127.0.0.1:8000", "", ""},
+		{"/monitor/unknown", "127.0.0.1:8000", "", `{"error":"handler not exist, type[monitor], command[unknown]"}`},
+		{"/reload/token", "127.0.0.1:8000", "", `{"error":null}`},
+		{"/reload/token", "10.0.0.1:8000", "", `{"error":"reload is not allowed from [10.0.0.1:8000]"}`},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", c.url, nil)
+		r.RemoteAddr = c.remoteAddr
+		if c.header != "" {
+			r.Header.Set("X-Bfe-Api-Token", c.header)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Body.String() != c.body {
+			t.Errorf("serve %s got %s, want %s", c.url, w.Body.String(), c.body)
+		}
+	}
+
+	// web server is started only once
+	m.port = 0
+	m.Start()
+	m.Start()
+}
+
+func TestMetricsHandler(t *testing.T) {
+	var cfg bfe_conf.BfeConfig
+	cfg.Server.MonitorInterval = 20
+	m := &BfeMonitor{
+		WebHandlers: web_monitor.NewWebHandlers(),
+		srv:         NewBfeServer(cfg, nil, "test"),
+	}
+	mux := m.serveMux()
+
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("serve /metrics got status %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("serve /metrics got content type %s", got)
+	}
+	if !strings.Contains(w.Body.String(), "# TYPE bfe_proxy_delay_seconds histogram") {
+		t.Errorf("serve /metrics got unexpected body: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,353 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// rotating file writer for access log
+
+package access_log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+)
+
+// rotate policy for log file
+const (
+	RotateMinute   = "M"
+	RotateHour     = "H"
+	RotateDay      = "D"
+	RotateMidnight = "MIDNIGHT"
+	RotateNone     = "NONE"
+)
+
+const (
+	// max number of log lines waiting to be written to file
+	logBufferLength = 10000
+)
+
+var (
+	ErrBufferFull   = errors.New("log buffer full")
+	ErrWriterClosed = errors.New("log writer closed")
+)
+
+type LogConfig struct {
+	LogDir      string // dir of log file
+	LogPrefix   string // prefix of log file name, log file is <LogPrefix>.log
+	RotateWhen  string // time rotate policy, M/H/D/MIDNIGHT/NONE
+	BackupCount int    // max number of rotated files to keep, 0 means keep all
+	MaxFileSize int64  // max size of log file (in bytes), 0 means no limit
+}
+
+// Check checks log config.
+func (cfg *LogConfig) Check() error {
+	if cfg.LogDir == "" {
+		return fmt.Errorf("LogDir not set")
+	}
+
+	if cfg.LogPrefix == "" {
+		return fmt.Errorf("LogPrefix not set")
+	}
+
+	if _, err := rotateInterval(cfg.RotateWhen); err != nil {
+		return err
+	}
+
+	if cfg.BackupCount < 0 {
+		return fmt.Errorf("BackupCount should not be negative")
+	}
+
+	if cfg.MaxFileSize < 0 {
+		return fmt.Errorf("MaxFileSize should not be negative")
+	}
+
+	return nil
+}
+
+// rotateInterval returns the rotate interval for given policy.
+func rotateInterval(when string) (time.Duration, error) {
+	switch strings.ToUpper(when) {
+	case RotateMinute:
+		return time.Minute, nil
+	case RotateHour:
+		return time.Hour, nil
+	case RotateDay, RotateMidnight:
+		return 24 * time.Hour, nil
+	case RotateNone:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("invalid RotateWhen: %s", when)
+	}
+}
+
+// rotateSuffix returns time format of suffix for rotated files.
+func rotateSuffix(when string) string {
+	switch strings.ToUpper(when) {
+	case RotateMinute:
+		return "200601021504"
+	case RotateHour:
+		return "2006010215"
+	case RotateDay, RotateMidnight:
+		return "20060102"
+	default:
+		return "20060102150405"
+	}
+}
+
+// LogWriter is a file writer with time and size based rotation.
+// It is safe for concurrent use. Log lines are buffered and written to file
+// by a separate goroutine, and dropped if the buffer is full.
+type LogWriter struct {
+	conf     LogConfig
+	fileName string        // path of current log file
+	interval time.Duration // interval of time rotation
+	suffix   string        // time format of suffix
+
+	lock   sync.RWMutex
+	closed bool        // whether writer is closed
+	buffer chan []byte // log lines waiting to be written
+	done   chan bool   // closed after all lines written and file closed
+
+	// only accessed by goroutine writing file
+	file       *os.File
+	size       int64     // size of current log file
+	rolloverAt time.Time // time for next time rotation
+}
+
+// NewLogWriter creates a new LogWriter and opens the log file.
+func NewLogWriter(conf LogConfig) (*LogWriter, error) {
+	if err := conf.Check(); err != nil {
+		return nil, err
+	}
+
+	w := new(LogWriter)
+	w.conf = conf
+	w.fileName = path.Join(conf.LogDir, conf.LogPrefix+".log")
+	w.interval, _ = rotateInterval(conf.RotateWhen)
+	w.suffix = rotateSuffix(conf.RotateWhen)
+
+	if err := os.MkdirAll(conf.LogDir, 0755); err != nil {
+		return nil, fmt.Errorf("MkdirAll(%s): %s", conf.LogDir, err)
+	}
+
+	if err := w.openFile(time.Now()); err != nil {
+		return nil, err
+	}
+
+	w.buffer = make(chan []byte, logBufferLength)
+	w.done = make(chan bool)
+	go w.writeLoop()
+
+	return w, nil
+}
+
+// FileName returns path of current log file.
+func (w *LogWriter) FileName() string {
+	return w.fileName
+}
+
+// Write puts p to buffer, which is written to log file asynchronously.
+// ErrBufferFull is returned if p is dropped for buffer full.
+func (w *LogWriter) Write(p []byte) (int, error) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+
+	line := make([]byte, len(p))
+	copy(line, p)
+
+	select {
+	case w.buffer <- line:
+		return len(p), nil
+	default:
+		return 0, ErrBufferFull
+	}
+}
+
+// Close writes all buffered lines and closes the log file.
+func (w *LogWriter) Close() error {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.buffer)
+	w.lock.Unlock()
+
+	// wait for buffered lines written
+	<-w.done
+	return nil
+}
+
+// writeLoop writes lines in buffer to log file, rotating the file if needed.
+func (w *LogWriter) writeLoop() {
+	defer close(w.done)
+
+	for line := range w.buffer {
+		if err := w.writeFile(line); err != nil {
+			log.Logger.Warn("access_log: write %s err: %s", w.fileName, err)
+		}
+	}
+
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			log.Logger.Warn("access_log: close %s err: %s", w.fileName, err)
+		}
+		w.file = nil
+	}
+}
+
+func (w *LogWriter) writeFile(p []byte) error {
+	now := time.Now()
+	if w.file == nil || w.shouldRotate(now, len(p)) {
+		// file is reopened if failed in last rotation
+		if err := w.rotate(now); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return err
+}
+
+func (w *LogWriter) shouldRotate(now time.Time, n int) bool {
+	if w.interval > 0 && !now.Before(w.rolloverAt) {
+		return true
+	}
+
+	if w.conf.MaxFileSize > 0 && w.size > 0 && w.size+int64(n) > w.conf.MaxFileSize {
+		return true
+	}
+
+	return false
+}
+
+func (w *LogWriter) openFile(now time.Time) error {
+	file, err := os.OpenFile(w.fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("OpenFile(%s): %s", w.fileName, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("Stat(%s): %s", w.fileName, err)
+	}
+
+	w.file = file
+	w.size = info.Size()
+	w.rolloverAt = w.computeRollover(now)
+	return nil
+}
+
+// computeRollover calculates next rotate time, aligned to the interval.
+func (w *LogWriter) computeRollover(now time.Time) time.Time {
+	if w.interval == 0 {
+		return time.Time{}
+	}
+
+	if w.interval == 24*time.Hour {
+		// rotate at midnight of local time
+		y, m, d := now.Date()
+		return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+	}
+
+	return now.Truncate(w.interval).Add(w.interval)
+}
+
+func (w *LogWriter) rotate(now time.Time) error {
+	if w.file == nil {
+		return w.openFile(now)
+	}
+
+	err := w.file.Close()
+	w.file = nil
+	if err != nil {
+		return fmt.Errorf("Close(%s): %s", w.fileName, err)
+	}
+
+	// time of the rotated log period
+	period := now
+	if w.interval > 0 && !now.Before(w.rolloverAt) {
+		period = w.rolloverAt.Add(-w.interval)
+	}
+
+	// get a backup file name which not exists
+	backupName := w.fileName + "." + period.Format(w.suffix)
+	for i := 1; fileExists(backupName); i++ {
+		backupName = fmt.Sprintf("%s.%s.%d", w.fileName, period.Format(w.suffix), i)
+	}
+
+	if err := os.Rename(w.fileName, backupName); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Rename(%s): %s", w.fileName, err)
+	}
+
+	if err := w.openFile(now); err != nil {
+		return err
+	}
+
+	w.removeBackups()
+	return nil
+}
+
+// removeBackups removes the oldest rotated files exceeding BackupCount.
+func (w *LogWriter) removeBackups() {
+	if w.conf.BackupCount == 0 {
+		return
+	}
+
+	files, err := filepath.Glob(w.fileName + ".*")
+	if err != nil || len(files) <= w.conf.BackupCount {
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		ti, tj := modTime(files[i]), modTime(files[j])
+		if ti.Equal(tj) {
+			return files[i] < files[j]
+		}
+		return ti.Before(tj)
+	})
+
+	for _, file := range files[:len(files)-w.conf.BackupCount] {
+		os.Remove(file)
+	}
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func modTime(name string) time.Time {
+	info, err := os.Stat(name)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
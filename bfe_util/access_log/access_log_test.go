@@ -0,0 +1,115 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package access_log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogConfigCheck(t *testing.T) {
+	conf := LogConfig{LogDir: "./log", LogPrefix: "access", RotateWhen: "midnight"}
+	if err := conf.Check(); err != nil {
+		t.Errorf("Check() should succeed: %s", err)
+	}
+
+	conf.RotateWhen = "W"
+	if err := conf.Check(); err == nil {
+		t.Errorf("Check() should fail for invalid RotateWhen")
+	}
+
+	conf.RotateWhen = "H"
+	conf.LogPrefix = ""
+	if err := conf.Check(); err == nil {
+		t.Errorf("Check() should fail for empty LogPrefix")
+	}
+}
+
+func TestLogWriterSizeRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "access_log")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := LogConfig{
+		LogDir:      dir,
+		LogPrefix:   "access",
+		RotateWhen:  RotateNone,
+		BackupCount: 2,
+		MaxFileSize: 10,
+	}
+	w, err := NewLogWriter(conf)
+	if err != nil {
+		t.Fatalf("NewLogWriter(): %s", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := w.Write([]byte("12345678\n")); err != nil {
+			t.Fatalf("Write(): %s", err)
+		}
+	}
+
+	// wait for buffered lines written
+	w.Close()
+	if _, err := w.Write([]byte("12345678\n")); err != ErrWriterClosed {
+		t.Errorf("Write() after Close() should fail, got %v", err)
+	}
+
+	data, err := ioutil.ReadFile(w.FileName())
+	if err != nil || string(data) != "12345678\n" {
+		t.Errorf("unexpected log file content: %q, %v", data, err)
+	}
+
+	backups, _ := filepath.Glob(w.FileName() + ".*")
+	if len(backups) != 2 {
+		t.Errorf("backup count should be 2, got %v", backups)
+	}
+}
+
+func TestLogWriterBufferFull(t *testing.T) {
+	// writer without goroutine writing file
+	w := &LogWriter{buffer: make(chan []byte, 1)}
+
+	line := []byte("12345678\n")
+	if _, err := w.Write(line); err != nil {
+		t.Fatalf("Write(): %s", err)
+	}
+	if _, err := w.Write(line); err != ErrBufferFull {
+		t.Errorf("Write() should fail for buffer full, got %v", err)
+	}
+
+	// buffered line is a copy
+	line[0] = 'x'
+	if data := <-w.buffer; string(data) != "12345678\n" {
+		t.Errorf("unexpected buffered line: %q", data)
+	}
+}
+
+func TestComputeRollover(t *testing.T) {
+	w := &LogWriter{interval: time.Hour}
+	now := time.Date(2019, 7, 1, 10, 30, 0, 0, time.UTC)
+	if next := w.computeRollover(now); !next.Equal(time.Date(2019, 7, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected rollover time: %v", next)
+	}
+
+	w.interval = 24 * time.Hour
+	if next := w.computeRollover(now); !next.Equal(time.Date(2019, 7, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected rollover time: %v", next)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// histogram in prometheus style
+
+package prometheus
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// default buckets for delay (in second)
+var DelayBuckets = []float64{
+	0.001, 0.002, 0.005, 0.01, 0.02, 0.05, 0.1, 0.2, 0.5, 1, 2, 5, 10,
+}
+
+// Histogram counts observations in cumulative buckets. It is safe
+// for concurrent use.
+type Histogram struct {
+	upperBounds []float64 // upper bounds of buckets, sorted
+	counts      []uint64  // non-cumulative counts for each bucket, and +Inf
+	sumBits     uint64    // sum of observations, bits of float64
+}
+
+// HistogramData is a snapshot of histogram.
+type HistogramData struct {
+	UpperBounds []float64 // upper bounds of buckets
+	Buckets     []uint64  // cumulative counts for each bucket
+	Count       uint64    // count of observations
+	Sum         float64   // sum of observations
+}
+
+// NewHistogram creates a histogram with given upper bounds of buckets.
+func NewHistogram(upperBounds []float64) *Histogram {
+	h := new(Histogram)
+	h.upperBounds = make([]float64, len(upperBounds))
+	copy(h.upperBounds, upperBounds)
+	sort.Float64s(h.upperBounds)
+	h.counts = make([]uint64, len(h.upperBounds)+1)
+	return h
+}
+
+// NewDelayHistogram creates a histogram with default buckets for delay.
+func NewDelayHistogram() *Histogram {
+	return NewHistogram(DelayBuckets)
+}
+
+// Observe adds an observation.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	atomic.AddUint64(&h.counts[i], 1)
+
+	for {
+		oldBits := atomic.LoadUint64(&h.sumBits)
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + v)
+		if atomic.CompareAndSwapUint64(&h.sumBits, oldBits, newBits) {
+			break
+		}
+	}
+}
+
+// ObserveDuration adds a duration observation (in second).
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+// ObserveBySub adds observation of duration from start to end.
+func (h *Histogram) ObserveBySub(start, end time.Time) {
+	h.ObserveDuration(end.Sub(start))
+}
+
+// Get returns snapshot of histogram.
+func (h *Histogram) Get() HistogramData {
+	var d HistogramData
+	d.UpperBounds = h.upperBounds
+	d.Buckets = make([]uint64, len(h.upperBounds))
+
+	var cumulative uint64
+	for i := range h.upperBounds {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		d.Buckets[i] = cumulative
+	}
+	d.Count = cumulative + atomic.LoadUint64(&h.counts[len(h.upperBounds)])
+	d.Sum = math.Float64frombits(atomic.LoadUint64(&h.sumBits))
+
+	return d
+}
+
+// Sub returns d - last, for getting diff of histogram in a period.
+func (d HistogramData) Sub(last HistogramData) HistogramData {
+	if len(last.Buckets) != len(d.Buckets) {
+		return d
+	}
+
+	diff := HistogramData{
+		UpperBounds: d.UpperBounds,
+		Buckets:     make([]uint64, len(d.Buckets)),
+		Count:       d.Count - last.Count,
+		Sum:         d.Sum - last.Sum,
+	}
+	for i := range d.Buckets {
+		diff.Buckets[i] = d.Buckets[i] - last.Buckets[i]
+	}
+
+	return diff
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 0.01, 1})
+	h.Observe(0.005)
+	h.Observe(0.01)
+	h.Observe(0.5)
+	h.ObserveDuration(2 * time.Second)
+
+	d := h.Get()
+	expect := []uint64{2, 2, 3}
+	for i, count := range expect {
+		if d.Buckets[i] != count {
+			t.Errorf("bucket %v should be %d, got %d", d.UpperBounds[i], count, d.Buckets[i])
+		}
+	}
+	if d.Count != 4 {
+		t.Errorf("count should be 4, got %d", d.Count)
+	}
+	if d.Sum < 2.514 || d.Sum > 2.516 {
+		t.Errorf("sum should be 2.515, got %v", d.Sum)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// writer for prometheus text exposition format
+
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/metrics"
+)
+
+// metric types
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// ContentType is content type of text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Label is a label of metric sample.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Writer writes metrics in prometheus text exposition format.
+//
+// Note: samples of the same metric should be written continuously.
+type Writer struct {
+	buf      bytes.Buffer
+	families map[string]bool // metric families written
+}
+
+// NewWriter creates a new Writer.
+func NewWriter() *Writer {
+	w := new(Writer)
+	w.families = make(map[string]bool)
+	return w
+}
+
+// Bytes returns metrics written.
+func (w *Writer) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+// WriteCounter writes a counter sample.
+func (w *Writer) WriteCounter(name string, help string, value int64, labels ...Label) {
+	w.writeHeader(name, help, TypeCounter)
+	w.writeSample(name, labels, "", "", strconv.FormatInt(value, 10))
+}
+
+// WriteGauge writes a gauge sample.
+func (w *Writer) WriteGauge(name string, help string, value float64, labels ...Label) {
+	w.writeHeader(name, help, TypeGauge)
+	w.writeSample(name, labels, "", "", formatFloat(value))
+}
+
+// WriteHistogram writes samples of a histogram.
+func (w *Writer) WriteHistogram(name string, help string, h *Histogram, labels ...Label) {
+	w.WriteHistogramData(name, help, h.Get(), labels...)
+}
+
+// WriteHistogramData writes samples of a histogram snapshot.
+func (w *Writer) WriteHistogramData(name string, help string, d HistogramData, labels ...Label) {
+	w.writeHeader(name, help, TypeHistogram)
+	for i, upperBound := range d.UpperBounds {
+		w.writeSample(name+"_bucket", labels, "le", formatFloat(upperBound),
+			strconv.FormatUint(d.Buckets[i], 10))
+	}
+	w.writeSample(name+"_bucket", labels, "le", "+Inf", strconv.FormatUint(d.Count, 10))
+	w.writeSample(name+"_sum", labels, "", "", formatFloat(d.Sum))
+	w.writeSample(name+"_count", labels, "", "", strconv.FormatUint(d.Count, 10))
+}
+
+// WriteState writes all *metrics.Counter fields of state.
+//
+// Params:
+//     - prefix: prefix of metric name, e.g. "bfe_proxy_state"
+//     - state: pointer to struct with *metrics.Counter fields
+//
+// A field FooBar is written as counter <prefix>_foo_bar_total, or as gauge
+// <prefix>_foo_bar if field name contains "Active".
+func (w *Writer) WriteState(prefix string, state interface{}, labels ...Label) {
+	v := reflect.ValueOf(state)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" { // unexported field
+			continue
+		}
+
+		counter, ok := v.Field(i).Interface().(*metrics.Counter)
+		if !ok || counter == nil {
+			continue
+		}
+
+		name := prefix + "_" + SnakeCase(field.Name)
+		help := fmt.Sprintf("%s of %s", field.Name, t.Name())
+		if strings.Contains(field.Name, "Active") {
+			w.WriteGauge(name, help, float64(counter.Get()), labels...)
+		} else {
+			if !strings.HasSuffix(name, "_total") {
+				name += "_total"
+			}
+			w.WriteCounter(name, help, counter.Get(), labels...)
+		}
+	}
+}
+
+func (w *Writer) writeHeader(name string, help string, metricType string) {
+	if w.families[name] {
+		return
+	}
+	w.families[name] = true
+
+	fmt.Fprintf(&w.buf, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(&w.buf, "# TYPE %s %s\n", name, metricType)
+}
+
+func (w *Writer) writeSample(name string, labels []Label, extraName string,
+	extraValue string, value string) {
+	w.buf.WriteString(name)
+
+	if len(labels) > 0 || extraName != "" {
+		w.buf.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			fmt.Fprintf(&w.buf, "%s=\"%s\"", label.Name, escapeLabelValue(label.Value))
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.buf.WriteByte(',')
+			}
+			fmt.Fprintf(&w.buf, "%s=\"%s\"", extraName, escapeLabelValue(extraValue))
+		}
+		w.buf.WriteByte('}')
+	}
+
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(value)
+	w.buf.WriteByte('\n')
+}
+
+// SnakeCase converts CamelCase name to snake_case, e.g.
+// "ErrBkNoBalance" => "err_bk_no_balance", "HTTPState" => "http_state".
+func SnakeCase(name string) string {
+	var buf bytes.Buffer
+	runes := []rune(name)
+
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				buf.WriteByte('_')
+			}
+			buf.WriteRune(unicode.ToLower(r))
+			continue
+		}
+
+		if isNameRune(r) {
+			buf.WriteRune(r)
+		} else {
+			buf.WriteByte('_')
+		}
+	}
+
+	return buf.String()
+}
+
+func isNameRune(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_'
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return strings.Replace(s, "\n", `\n`, -1)
+}
+
+func escapeLabelValue(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return strings.Replace(s, `"`, `\"`, -1)
+}
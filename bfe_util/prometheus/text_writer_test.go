@@ -0,0 +1,101 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/baidu/go-lib/web-monitor/metrics"
+)
+
+type testState struct {
+	ReqTotal  *metrics.Counter
+	ReqFail   *metrics.Counter
+	ReqActive *metrics.Counter
+}
+
+func TestSnakeCase(t *testing.T) {
+	cases := map[string]string{
+		"ErrBkNoBalance":      "err_bk_no_balance",
+		"HTTPState":           "http_state",
+		"H2ReqHeaderSize":     "h2_req_header_size",
+		"TlsHandshakeFullAll": "tls_handshake_full_all",
+		"ConnUse100Continue":  "conn_use100_continue",
+		"mod_block":           "mod_block",
+	}
+
+	for name, expect := range cases {
+		if got := SnakeCase(name); got != expect {
+			t.Errorf("SnakeCase(%s) should be %s, got %s", name, expect, got)
+		}
+	}
+}
+
+func TestWriteState(t *testing.T) {
+	var state testState
+	var m metrics.Metrics
+	m.Init(&state, "test", 0)
+	state.ReqTotal.Inc(3)
+	state.ReqFail.Inc(1)
+	state.ReqActive.Inc(2)
+
+	w := NewWriter()
+	w.WriteState("bfe_test", &state, Label{Name: "product", Value: "p\"1"})
+	out := string(w.Bytes())
+
+	expects := []string{
+		"# TYPE bfe_test_req_total counter\n",
+		"bfe_test_req_total{product=\"p\\\"1\"} 3\n",
+		"bfe_test_req_fail_total{product=\"p\\\"1\"} 1\n",
+		"# TYPE bfe_test_req_active gauge\n",
+		"bfe_test_req_active{product=\"p\\\"1\"} 2\n",
+	}
+	for _, expect := range expects {
+		if !strings.Contains(out, expect) {
+			t.Errorf("output should contain %q, got:\n%s", expect, out)
+		}
+	}
+}
+
+func TestWriteHistogram(t *testing.T) {
+	h := NewHistogram([]float64{0.5, 1})
+	h.Observe(0.3)
+	h.Observe(3)
+
+	w := NewWriter()
+	w.WriteHistogram("bfe_delay_seconds", "delay", h, Label{Name: "cluster", Value: "c1"})
+	w.WriteHistogram("bfe_delay_seconds", "delay", h, Label{Name: "cluster", Value: "c2"})
+	out := string(w.Bytes())
+
+	expects := []string{
+		"bfe_delay_seconds_bucket{cluster=\"c1\",le=\"0.5\"} 1\n",
+		"bfe_delay_seconds_bucket{cluster=\"c1\",le=\"1\"} 1\n",
+		"bfe_delay_seconds_bucket{cluster=\"c1\",le=\"+Inf\"} 2\n",
+		"bfe_delay_seconds_sum{cluster=\"c1\"} 3.3\n",
+		"bfe_delay_seconds_count{cluster=\"c2\"} 2\n",
+	}
+	for _, expect := range expects {
+		if !strings.Contains(out, expect) {
+			t.Errorf("output should contain %q, got:\n%s", expect, out)
+		}
+	}
+
+	if strings.Count(out, "# TYPE bfe_delay_seconds histogram") != 1 {
+		t.Errorf("TYPE should be written once, got:\n%s", out)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/baidu/bfe
 go 1.12
 
 require (
+	github.com/andybalholm/brotli v0.0.0-20190621154722-5f990b63d2d6
 	github.com/asergeyev/nradix v0.0.0-20170505151046-3872ab85bb56 // indirect
 	github.com/baidu/go-lib v0.0.0-20190731032112-26c6ce93bc54
 	github.com/gomodule/redigo v2.0.0+incompatible